@@ -0,0 +1,167 @@
+package anomaly
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	ReasonUnusualAmount = "unusual_amount"
+	ReasonNewCategory   = "new_category"
+)
+
+const (
+	// minSamples is how many past expenses of a category are needed before
+	// the amount distribution is trusted.
+	minSamples = 5
+	// zThreshold is how many standard deviations above the mean an amount
+	// has to be to get flagged.
+	zThreshold = 3.0
+)
+
+// Stats describes the past expenses of a spender, overall and for a single category.
+type Stats struct {
+	Total    int
+	Count    int
+	Mean     float64
+	StdDev   float64
+	MaxSoFar float64
+}
+
+type Result struct {
+	Reason string
+	Score  float64
+}
+
+// Score rates an expense amount against the spender history. ok is false
+// when the expense looks like something the spender usually does.
+func Score(s Stats, amount float64) (Result, bool) {
+	if s.Count == 0 {
+		// a brand-new spender has nothing to compare against
+		if s.Total < minSamples {
+			return Result{}, false
+		}
+		return Result{Reason: ReasonNewCategory, Score: 1}, true
+	}
+
+	if s.Count < minSamples {
+		return Result{}, false
+	}
+
+	if s.StdDev == 0 {
+		if s.MaxSoFar > 0 && amount > s.MaxSoFar*zThreshold {
+			return Result{Reason: ReasonUnusualAmount, Score: amount / s.MaxSoFar}, true
+		}
+		return Result{}, false
+	}
+
+	z := (amount - s.Mean) / s.StdDev
+	if z < zThreshold {
+		return Result{}, false
+	}
+	return Result{Reason: ReasonUnusualAmount, Score: z}, true
+}
+
+const (
+	statsStmt = `SELECT COUNT(*),
+	COUNT(*) FILTER (WHERE category = $2),
+	COALESCE(AVG(amount) FILTER (WHERE category = $2), 0),
+	COALESCE(STDDEV_SAMP(amount) FILTER (WHERE category = $2), 0),
+	COALESCE(MAX(amount) FILTER (WHERE category = $2), 0)
+FROM transaction
+WHERE spender_id = $1 AND transaction_type = 'expense' AND id <> $3;`
+	cStmt = `INSERT INTO anomaly (transaction_id, spender_id, reason, score) VALUES ($1, $2, $3, $4);`
+)
+
+// Queryer runs the queries of Detect, a *sql.DB or a *sql.Tx.
+type Queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Detect scores a newly created expense against the spender history and
+// stores a flag when it is out of character. It reports whether the
+// expense was flagged. Run it in the transaction creating the expense so
+// the flag is saved along with it.
+func Detect(ctx context.Context, db Queryer, spenderID, transactionID int64, category string, amount float64) (bool, error) {
+	var s Stats
+	err := db.QueryRowContext(ctx, statsStmt, spenderID, category, transactionID).
+		Scan(&s.Total, &s.Count, &s.Mean, &s.StdDev, &s.MaxSoFar)
+	if err != nil {
+		return false, err
+	}
+
+	r, ok := Score(s, amount)
+	if !ok {
+		return false, nil
+	}
+
+	if _, err := db.ExecContext(ctx, cStmt, transactionID, spenderID, r.Reason, r.Score); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type Anomaly struct {
+	ID              int64   `json:"id"`
+	TransactionID   int64   `json:"transaction_id"`
+	Reason          string  `json:"reason"`
+	Score           float64 `json:"score"`
+	CreatedAt       string  `json:"created_at"`
+	Date            string  `json:"date"`
+	Amount          float64 `json:"amount"`
+	Category        string  `json:"category"`
+	TransactionType string  `json:"transaction_type"`
+	Note            string  `json:"note"`
+}
+
+type handler struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *handler {
+	return &handler{db}
+}
+
+const getBySpenderStmt = `SELECT a.id, a.transaction_id, a.reason, a.score, a.created_at, t.date, t.amount, t.category, t.transaction_type, t.note
+FROM anomaly a
+JOIN transaction t ON t.id = a.transaction_id
+WHERE a.spender_id = $1
+ORDER BY a.created_at DESC, a.id DESC;`
+
+func (h handler) GetSpenderAnomalies(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+	spenderID := c.Param("id")
+
+	rows, err := h.db.QueryContext(ctx, getBySpenderStmt, spenderID)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	anomalies := []Anomaly{}
+	for rows.Next() {
+		var a Anomaly
+		err := rows.Scan(&a.ID, &a.TransactionID, &a.Reason, &a.Score, &a.CreatedAt, &a.Date, &a.Amount, &a.Category, &a.TransactionType, &a.Note)
+		if err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		anomalies = append(anomalies, a)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("rows error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string][]Anomaly{
+		"anomalies": anomalies,
+	})
+}
@@ -0,0 +1,149 @@
+package anomaly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScore(t *testing.T) {
+	cases := []struct {
+		name   string
+		stats  Stats
+		amount float64
+		want   string
+		ok     bool
+	}{
+		{"not enough history", Stats{Total: 2}, 1000, "", false},
+		{"category never used", Stats{Total: 20}, 100, ReasonNewCategory, true},
+		{"not enough samples in category", Stats{Total: 20, Count: 3, Mean: 100, StdDev: 10, MaxSoFar: 110}, 1000, "", false},
+		{"usual amount", Stats{Total: 20, Count: 10, Mean: 100, StdDev: 20, MaxSoFar: 140}, 150, "", false},
+		{"far above distribution", Stats{Total: 20, Count: 10, Mean: 100, StdDev: 20, MaxSoFar: 140}, 500, ReasonUnusualAmount, true},
+		{"constant amounts", Stats{Total: 20, Count: 10, Mean: 50, MaxSoFar: 50}, 50, "", false},
+		{"constant amounts and a spike", Stats{Total: 20, Count: 10, Mean: 50, MaxSoFar: 50}, 500, ReasonUnusualAmount, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := Score(tc.stats, tc.amount)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.want, got.Reason)
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Run("flag unusual expense", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		row := sqlmock.NewRows([]string{"total", "count", "mean", "stddev", "max"}).AddRow(20, 10, 100.0, 20.0, 140.0)
+		mock.ExpectQuery(statsStmt).WithArgs(int64(1), "Food", int64(9)).WillReturnRows(row)
+		mock.ExpectExec(cStmt).WithArgs(int64(9), int64(1), ReasonUnusualAmount, 20.0).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		flagged, err := Detect(context.Background(), db, 1, 9, "Food", 500)
+
+		assert.NoError(t, err)
+		assert.True(t, flagged)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("usual expense is not stored", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		row := sqlmock.NewRows([]string{"total", "count", "mean", "stddev", "max"}).AddRow(20, 10, 100.0, 20.0, 140.0)
+		mock.ExpectQuery(statsStmt).WithArgs(int64(1), "Food", int64(9)).WillReturnRows(row)
+
+		flagged, err := Detect(context.Background(), db, 1, 9, "Food", 120)
+
+		assert.NoError(t, err)
+		assert.False(t, flagged)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("stats query error", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(statsStmt).WillReturnError(assert.AnError)
+
+		_, err := Detect(context.Background(), db, 1, 9, "Food", 120)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestGetSpenderAnomalies(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	t.Run("get spender anomalies successfully", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/anomalies", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"id", "transaction_id", "reason", "score", "created_at", "date", "amount", "category", "transaction_type", "note"}).
+			AddRow(1, 9, "unusual_amount", 20.0, "2024-05-20T00:00:00Z", "2024-05-20T00:00:00Z", 500.0, "Food", "expense", "Dinner")
+		mock.ExpectQuery(getBySpenderStmt).WithArgs("1").WillReturnRows(rows)
+
+		h := New(db)
+		err := h.GetSpenderAnomalies(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"anomalies": [{"id":1,"transaction_id":9,"reason":"unusual_amount","score":20,"created_at":"2024-05-20T00:00:00Z","date":"2024-05-20T00:00:00Z","amount":500,"category":"Food","transaction_type":"expense","note":"Dinner"}]}`, rec.Body.String())
+	})
+
+	t.Run("get spender anomalies database error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/anomalies", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(getBySpenderStmt).WithArgs("1").WillReturnError(assert.AnError)
+
+		h := New(db)
+		err := h.GetSpenderAnomalies(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("get spender anomalies rows error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/anomalies", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"id", "transaction_id", "reason", "score", "created_at", "date", "amount", "category", "transaction_type", "note"}).
+			AddRow(1, 9, "unusual_amount", 20.0, "2024-05-20T00:00:00Z", "2024-05-20T00:00:00Z", 500.0, "Food", "expense", "Dinner").
+			RowError(0, assert.AnError)
+		mock.ExpectQuery(getBySpenderStmt).WithArgs("1").WillReturnRows(rows)
+
+		h := New(db)
+		err := h.GetSpenderAnomalies(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
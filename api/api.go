@@ -3,12 +3,25 @@ package api
 import (
 	"database/sql"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/anomaly"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/forecast"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/health"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/household"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/job"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mailer"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/openapi"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rule"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/signurl"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/split"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/stream"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/webhook"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"go.uber.org/zap"
@@ -16,42 +29,177 @@ import (
 
 type Server struct {
 	*echo.Echo
+	Webhooks *webhook.Dispatcher
+	Stream   *stream.Broker
+	Jobs     *job.Runner
 }
 
 func New(db *sql.DB, cfg config.Config, logger *zap.Logger) *Server {
 	e := echo.New()
 
 	e.Use(middleware.Logger())
+	e.Use(middleware.Recover())
 	e.Use(mlog.Middleware(logger))
+	if cfg.FeatureFlag.EnableRequestValidation {
+		spec, err := openapi.Load()
+		if err != nil {
+			logger.Fatal("loading openapi document:", zap.Error(err))
+		}
+		e.Use(openapi.Validator(spec))
+	}
 
 	v1 := e.Group("/api/v1")
+	webhooks := webhook.NewDispatcher(db, logger)
+	broker := stream.NewBroker()
+	jobs := job.NewRunner(db, cfg.Jobs, logger)
 
+	v1.GET("/openapi.json", openapi.Serve)
 	v1.GET("/slow", health.Slow)
 	v1.GET("/health", health.Check(db))
-	v1.POST("/upload", eslip.Upload)
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		logger.Fatal("creating storage:", zap.Error(err))
+	}
+	keys, err := signurl.ParseKeys(cfg.Download.SigningKeys)
+	if err != nil {
+		logger.Fatal("parsing download signing keys:", zap.Error(err))
+	}
+	if len(keys) == 0 {
+		logger.Warn("no download signing keys, signed URLs will not survive a restart")
+		keys = []signurl.Key{signurl.RandomKey()}
+	}
+	verifier, err := eslip.NewVerifier(cfg.SlipVerify)
+	if err != nil {
+		logger.Fatal("creating slip verifier:", zap.Error(err))
+	}
+	slips := eslip.New(cfg.Upload, db, store, verifier).
+		WithSigner(signurl.New(keys, cfg.Download.URLTTL)).
+		WithJobs(jobs, eslip.SlipExtractor{Verifier: verifier})
+	// the signature of the URL is the authorization of a download
+	v1.GET("/downloads/:id", slips.Download)
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		logger.Fatal("creating mailer:", zap.Error(err))
+	}
+	mailKeys, err := signurl.ParseKeys(cfg.Mail.SigningKeys)
+	if err != nil {
+		logger.Fatal("parsing mail signing keys:", zap.Error(err))
+	}
+	if len(mailKeys) == 0 {
+		logger.Warn("no mail signing keys, verification links will not survive a restart")
+		mailKeys = []signurl.Key{signurl.RandomKey()}
+	}
+	spenders := spender.New(cfg.FeatureFlag, db).
+		WithVerification(signurl.New(mailKeys, cfg.Mail.VerifyTTL), mail, cfg.Mail.LinkBaseURL)
+	v1.GET("/spenders/:id/email/verify", spenders.VerifyEmail)
 
 	handleE := transaction.New(cfg.FeatureFlag, db)
 	v1.GET("/expenses", handleE.GetAll)
 
 	v1.Use(middleware.BasicAuth(AuthCheck))
 
+	v1.POST("/upload", slips.Upload)
+
 	{
-		h := spender.New(cfg.FeatureFlag, db)
+		h := spenders
 		v1.GET("/spenders", h.GetAll)
 		v1.POST("/spenders", h.Create)
 		v1.GET("/spenders/:id", h.GetSpenderByID)
+		v1.PUT("/spenders/:id", h.Update)
+		v1.PATCH("/spenders/:id", h.Patch)
+		v1.DELETE("/spenders/:id", h.Delete)
+		v1.POST("/spenders/:id/deactivate", h.Deactivate)
+		v1.POST("/spenders/:id/reactivate", h.Reactivate)
+		v1.POST("/spenders/:id/email/verification", h.SendVerification)
+		v1.PATCH("/spenders/:id/preferences", h.PatchPreferences)
+		v1.GET("/spenders/:id/promptpay", h.GetPromptPayQR)
+		v1.GET("/spenders/email-conflicts", h.GetEmailConflicts)
 		v1.GET("/categories", h.GetAllCategories)
 	}
+	{
+		h := category.New(cfg.FeatureFlag, db)
+		v1.GET("/spenders/:id/categories", h.GetAll)
+		v1.POST("/spenders/:id/categories", h.Create)
+		v1.GET("/spenders/:id/categories/:category_id", h.Get)
+		v1.PATCH("/spenders/:id/categories/:category_id", h.Update)
+		v1.DELETE("/spenders/:id/categories/:category_id", h.Delete)
+	}
+	{
+		h := rule.New(cfg.FeatureFlag, db)
+		v1.GET("/spenders/:id/rules", h.GetAll)
+		v1.POST("/spenders/:id/rules", h.Create)
+		v1.POST("/spenders/:id/rules/apply", h.Apply)
+		v1.PUT("/spenders/:id/rules/:rule_id", h.Update)
+		v1.DELETE("/spenders/:id/rules/:rule_id", h.Delete)
+	}
 	{
 		h := transaction.New(cfg.FeatureFlag, db)
 		v1.POST("/transactions", h.Create)
 		v1.PUT("/transactions/:id", h.PutTransaction)
+		v1.DELETE("/transactions/:id", h.Delete)
 		v1.GET("/spenders/:id/transactions", h.GetSpenderTransactions)
 		v1.GET("/spenders/:id/transactions/summary", h.GetSpenderTransactionSummary)
+		v1.GET("/spenders/:id/transactions/monthly", h.GetSpenderMonthlySummary)
 		v1.GET("/categorize", h.GetTransactionsGroupedByCategory)
 		v1.GET("/transactions", h.GetAllTransaction)
-
+	}
+	{
+		h := household.New(cfg.FeatureFlag, db).WithMailer(mail)
+		v1.GET("/households", h.GetAll)
+		v1.POST("/households", h.Create)
+		v1.GET("/households/invitations", h.GetPendingInvitations)
+		v1.POST("/households/invitations/:invitation_id/accept", h.Accept)
+		v1.POST("/households/invitations/:invitation_id/decline", h.Decline)
+		v1.GET("/households/:id", h.Get)
+		v1.PATCH("/households/:id", h.Rename)
+		v1.DELETE("/households/:id", h.Delete)
+		v1.PUT("/households/:id/members/:spender_id", h.SetRole)
+		v1.DELETE("/households/:id/members/:spender_id", h.RemoveMember)
+		v1.GET("/households/:id/invitations", h.GetInvitations)
+		v1.POST("/households/:id/invitations", h.Invite)
+		v1.DELETE("/households/:id/invitations/:invitation_id", h.Revoke)
+		v1.GET("/households/:id/transactions", h.GetTransactions)
+		v1.POST("/households/:id/transactions", h.CreateTransaction)
+		v1.PUT("/households/:id/transactions/:transaction_id", h.UpdateTransaction)
+		v1.DELETE("/households/:id/transactions/:transaction_id", h.DeleteTransaction)
+		v1.GET("/households/:id/transactions/summary", h.GetSummary)
+		v1.GET("/households/:id/categories", h.GetCategories)
+	}
+	{
+		h := split.New(cfg.FeatureFlag, db)
+		v1.POST("/bills", h.CreateBill)
+		v1.GET("/bills/:id", h.GetBill)
+		v1.DELETE("/bills/:id", h.DeleteBill)
+		v1.GET("/spenders/:id/balances", h.GetSpenderBalances)
+		v1.GET("/settlements/plan", h.GetSettlementPlan)
+		v1.GET("/settlements/promptpay", h.GetSettlementQR)
+		v1.POST("/settlements", h.SettleUp)
+	}
+	v1.GET("/attachments/:id", slips.GetAttachment)
+	v1.GET("/spenders/:id/attachments", slips.GetSpenderAttachments)
+	v1.POST("/receipts/textract", slips.Textract)
+	{
+		h := stream.New(db, broker)
+		v1.GET("/spenders/:id/transactions/stream", h.StreamSpenderTransactions)
+	}
+	{
+		h := anomaly.New(db)
+		v1.GET("/spenders/:id/anomalies", h.GetSpenderAnomalies)
+	}
+	{
+		h := forecast.New(db)
+		v1.GET("/spenders/:id/forecast", h.GetSpenderForecast)
+	}
+	v1.GET("/jobs/:id", job.New(db).GetJob)
+	{
+		h := webhook.New(db, webhooks)
+		v1.POST("/webhooks", h.Create)
+		v1.GET("/webhooks", h.GetAll)
+		v1.DELETE("/webhooks/:id", h.Delete)
+		v1.GET("/webhooks/:id/deliveries", h.GetDeliveries)
+		v1.POST("/webhooks/deliveries/:id/redeliver", h.Redeliver)
 	}
 
-	return &Server{e}
+	return &Server{e, webhooks, broker, jobs}
 }
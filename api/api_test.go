@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/openapi"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	spec, err := openapi.Load()
+	assert.NoError(t, err)
+
+	s := New(nil, config.Config{}, zap.NewNop())
+
+	var routes []string
+	for _, r := range s.Routes() {
+		// added by Echo for groups
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		routes = append(routes, r.Method+" "+spec.Path(r.Path))
+	}
+	var documented []string
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(routes)
+	sort.Strings(documented)
+
+	assert.Equal(t, routes, documented)
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	s := New(nil, config.Config{}, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"openapi": "3.0.3"`)
+}
+
+func TestRequestValidation(t *testing.T) {
+	cfg := config.Config{FeatureFlag: config.FeatureFlag{EnableRequestValidation: true}}
+	s := New(nil, cfg, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/spenders/abc", nil)
+	req.SetBasicAuth("user", "secret")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "\"id must be an integer\"\n", rec.Body.String())
+}
+
+func TestUploadRequiresAuth(t *testing.T) {
+	s := New(nil, config.Config{}, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload?spender_id=1", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,409 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/lib/pq"
+)
+
+// Types of categories, those of the transactions they are for.
+const (
+	TypeIncome  = "income"
+	TypeExpense = "expense"
+)
+
+// DefaultColor is the color of categories created without one.
+const DefaultColor = "#9E9E9E"
+
+var (
+	ErrNotFound        = errors.New("category not found")
+	ErrUnknownSpender  = errors.New("spender not found")
+	ErrInvalidName     = errors.New("name must be 1 to 50 characters")
+	ErrInvalidIcon     = errors.New("icon must be at most 32 characters")
+	ErrInvalidColor    = errors.New("color must be a hex color like #4CAF50")
+	ErrInvalidType     = errors.New("type must be income or expense")
+	ErrNameTaken       = errors.New("a category with this name and type already exists")
+	ErrSystem          = errors.New("system categories cannot be changed")
+	ErrTypeMismatch    = errors.New("category type does not match the transaction type")
+	ErrUnknownCategory = errors.New("category not found, create it first")
+	ErrUnknownParent   = errors.New("parent category not found")
+	ErrParentType      = errors.New("parent category must be of the same type")
+	ErrParentCycle     = errors.New("a category cannot be moved under itself or its subcategories")
+)
+
+var colorRe = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+const (
+	// columns are read by scanCategory, system categories have no spender.
+	columns = `id, COALESCE(spender_id, 0), COALESCE(parent_id, 0), name, icon, color, type`
+	// visible are the categories a spender can use, its own and the system ones.
+	visible = `(spender_id IS NULL OR spender_id = $1)`
+
+	listStmt   = `SELECT ` + columns + ` FROM category WHERE ` + visible + ` AND ($2 = '' OR type = $2) ORDER BY type, spender_id NULLS FIRST, LOWER(name);`
+	getStmt    = `SELECT ` + columns + ` FROM category WHERE ` + visible + ` AND id = $2;`
+	byNameStmt = `SELECT ` + columns + ` FROM category WHERE ` + visible + ` AND LOWER(name) = LOWER($2) AND type = LOWER($3) ORDER BY spender_id NULLS LAST LIMIT 1;`
+	// takenStmt keeps a custom category from shadowing another of the same
+	// name, the system ones included.
+	takenStmt  = `SELECT EXISTS (SELECT 1 FROM category WHERE ` + visible + ` AND LOWER(name) = LOWER($2) AND type = $3 AND id <> $4);`
+	cStmt      = `INSERT INTO category (spender_id, parent_id, name, icon, color, type) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6) RETURNING id;`
+	lockStmt   = `SELECT ` + columns + ` FROM category WHERE id = $1 AND spender_id = $2 FOR UPDATE;`
+	updateStmt = `UPDATE category SET parent_id = NULLIF($1, 0), name = $2, icon = $3, color = $4 WHERE id = $5;`
+	deleteStmt = `DELETE FROM category WHERE id = $1;`
+	// cycleStmt tells whether $2 is $1 or one of its ancestors, UNION stops
+	// at a cycle should one ever make it into the table.
+	cycleStmt = `WITH RECURSIVE up AS (
+	SELECT id, parent_id FROM category WHERE id = $1
+	UNION
+	SELECT c.id, c.parent_id FROM category c JOIN up ON c.id = up.parent_id
+) SELECT EXISTS (SELECT 1 FROM up WHERE id = $2);`
+	// liftChildrenStmt moves the subcategories of $2 up under its parent $1.
+	liftChildrenStmt = `UPDATE category SET parent_id = NULLIF($1, 0) WHERE parent_id = $2;`
+
+	// transactions keep the category name along with its id, so reports
+	// reading the name stay right.
+	renameTransactionsStmt   = `UPDATE transaction SET category = $1 WHERE category_id = $2 RETURNING id, COALESCE(spender_id, 0), COALESCE(category_id, 0), category;`
+	reassignTransactionsStmt = `UPDATE transaction SET category_id = NULLIF($1, 0), category = $2 WHERE category_id = $3 RETURNING id, COALESCE(spender_id, 0), COALESCE(category_id, 0), category;`
+)
+
+type Category struct {
+	ID int64 `json:"id"`
+	// SpenderID is 0 for system categories, shared by every spender.
+	SpenderID int64 `json:"spender_id,omitempty"`
+	// ParentID is the category this one is a subcategory of, 0 for none.
+	// Names stay unique whatever the parent so transactions can name them.
+	ParentID int64  `json:"parent_id,omitempty"`
+	Name     string `json:"name"`
+	Icon     string `json:"icon"`
+	Color    string `json:"color"`
+	Type     string `json:"type"`
+	System   bool   `json:"system"`
+}
+
+// Patch changes the fields that are set, the type of a category stays. A
+// ParentID of 0 moves the category to the top.
+type Patch struct {
+	ParentID *int64  `json:"parent_id"`
+	Name     *string `json:"name"`
+	Icon     *string `json:"icon"`
+	Color    *string `json:"color"`
+}
+
+// Queryer runs the queries of Resolve, a *sql.DB or a *sql.Tx.
+type Queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCategory(row scanner) (Category, error) {
+	var c Category
+	err := row.Scan(&c.ID, &c.SpenderID, &c.ParentID, &c.Name, &c.Icon, &c.Color, &c.Type)
+	c.System = c.SpenderID == 0
+	return c, err
+}
+
+func validType(t string) bool {
+	return t == TypeIncome || t == TypeExpense
+}
+
+func (c Category) validate() error {
+	if c.Name == "" || utf8.RuneCountInString(c.Name) > 50 {
+		return ErrInvalidName
+	}
+	if utf8.RuneCountInString(c.Icon) > 32 {
+		return ErrInvalidIcon
+	}
+	if !colorRe.MatchString(c.Color) {
+		return ErrInvalidColor
+	}
+	if !validType(c.Type) {
+		return ErrInvalidType
+	}
+	return nil
+}
+
+// Resolve finds the category of a transaction of spenderID, by id when it
+// is set or else by name, among the categories the spender can use. Names
+// match whatever their case, the spender's own categories first.
+func Resolve(ctx context.Context, q Queryer, spenderID, id int64, name, transactionType string) (Category, error) {
+	var c Category
+	var err error
+	if id != 0 {
+		c, err = scanCategory(q.QueryRowContext(ctx, getStmt, spenderID, id))
+	} else {
+		c, err = scanCategory(q.QueryRowContext(ctx, byNameStmt, spenderID, strings.TrimSpace(name), transactionType))
+	}
+	if err == sql.ErrNoRows {
+		return c, ErrUnknownCategory
+	} else if err != nil {
+		return c, err
+	}
+	if !strings.EqualFold(c.Type, transactionType) {
+		return c, ErrTypeMismatch
+	}
+	return c, nil
+}
+
+type Service struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+}
+
+func NewService(cfg config.FeatureFlag, db *sql.DB) Service {
+	return Service{cfg, db}
+}
+
+// List returns the categories the spender can use, of type when it is set.
+func (s Service) List(ctx context.Context, spenderID int64, typ string) ([]Category, error) {
+	if typ != "" && !validType(typ) {
+		return nil, ErrInvalidType
+	}
+	rows, err := s.db.QueryContext(ctx, listStmt, spenderID, typ)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cats := []Category{}
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+func (s Service) Get(ctx context.Context, spenderID, id int64) (Category, error) {
+	c, err := scanCategory(s.db.QueryRowContext(ctx, getStmt, spenderID, id))
+	if err == sql.ErrNoRows {
+		return c, ErrNotFound
+	}
+	return c, err
+}
+
+func isUnknownSpender(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+func isNameTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (s Service) taken(ctx context.Context, q Queryer, c Category) error {
+	var taken bool
+	if err := q.QueryRowContext(ctx, takenStmt, c.SpenderID, c.Name, c.Type, c.ID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return ErrNameTaken
+	}
+	return nil
+}
+
+// Create adds a custom category to the spender catalog.
+func (s Service) Create(ctx context.Context, c Category) (Category, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Icon = strings.TrimSpace(c.Icon)
+	if c.Color == "" {
+		c.Color = DefaultColor
+	}
+	c.Color = strings.ToUpper(c.Color)
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+	c.System = false
+
+	if err := s.parent(ctx, s.db, c); err != nil {
+		return c, err
+	}
+	if err := s.taken(ctx, s.db, c); err != nil {
+		return c, err
+	}
+	err := s.db.QueryRowContext(ctx, cStmt, c.SpenderID, c.ParentID, c.Name, c.Icon, c.Color, c.Type).Scan(&c.ID)
+	if isUnknownSpender(err) {
+		return c, ErrUnknownSpender
+	} else if isNameTaken(err) {
+		return c, ErrNameTaken
+	}
+	return c, err
+}
+
+// parent checks the parent of c is a category of the same type the spender
+// can use, and not c or one of its subcategories.
+func (s Service) parent(ctx context.Context, q Queryer, c Category) error {
+	if c.ParentID == 0 {
+		return nil
+	}
+	_, err := Resolve(ctx, q, c.SpenderID, c.ParentID, "", c.Type)
+	if err == ErrUnknownCategory {
+		return ErrUnknownParent
+	} else if err == ErrTypeMismatch {
+		return ErrParentType
+	} else if err != nil {
+		return err
+	}
+	if c.ID == 0 {
+		return nil
+	}
+	var cycle bool
+	if err := q.QueryRowContext(ctx, cycleStmt, c.ParentID, c.ID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ErrParentCycle
+	}
+	return nil
+}
+
+// lock returns the custom category id of the spender, locked until tx ends.
+// System categories are told apart from missing ones.
+func (s Service) lock(ctx context.Context, tx *sql.Tx, spenderID, id int64) (Category, error) {
+	c, err := scanCategory(tx.QueryRowContext(ctx, lockStmt, id, spenderID))
+	if err != sql.ErrNoRows {
+		return c, err
+	}
+	if c, err := scanCategory(tx.QueryRowContext(ctx, getStmt, spenderID, id)); err == nil && c.System {
+		return c, ErrSystem
+	}
+	return c, ErrNotFound
+}
+
+// Update changes a custom category, renaming it on its transactions too.
+func (s Service) Update(ctx context.Context, spenderID, id int64, p Patch) (Category, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Category{}, err
+	}
+	defer tx.Rollback()
+
+	c, err := s.lock(ctx, tx, spenderID, id)
+	if err != nil {
+		return c, err
+	}
+	moved := false
+	if p.ParentID != nil {
+		moved = *p.ParentID != c.ParentID
+		c.ParentID = *p.ParentID
+	}
+	renamed := false
+	if p.Name != nil {
+		name := strings.TrimSpace(*p.Name)
+		renamed = name != c.Name
+		c.Name = name
+	}
+	if p.Icon != nil {
+		c.Icon = strings.TrimSpace(*p.Icon)
+	}
+	if p.Color != nil {
+		c.Color = strings.ToUpper(*p.Color)
+	}
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+
+	if moved {
+		if err := s.parent(ctx, tx, c); err != nil {
+			return c, err
+		}
+	}
+	if renamed {
+		if err := s.taken(ctx, tx, c); err != nil {
+			return c, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, updateStmt, c.ParentID, c.Name, c.Icon, c.Color, c.ID); isNameTaken(err) {
+		return c, ErrNameTaken
+	} else if err != nil {
+		return c, err
+	}
+	if renamed {
+		if err := recategorize(ctx, tx, renameTransactionsStmt, c.Name, c.ID); err != nil {
+			return c, err
+		}
+	}
+	return c, tx.Commit()
+}
+
+// recategorize runs stmt, which changes the category of transactions and
+// returns them, and writes a transaction event for each.
+func recategorize(ctx context.Context, tx *sql.Tx, stmt string, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	var events []map[string]interface{}
+	for rows.Next() {
+		var id, spenderID, categoryID int64
+		var name string
+		if err := rows.Scan(&id, &spenderID, &categoryID, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, map[string]interface{}{
+			"id":          id,
+			"spender_id":  spenderID,
+			"category_id": categoryID,
+			"category":    name,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		if err := outbox.Write(ctx, tx, outbox.EventTransactionUpdated, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a custom category, its transactions move to the category
+// reassignTo, of the same type, or become uncategorized when it is 0. Its
+// subcategories move up under its parent.
+func (s Service) Delete(ctx context.Context, spenderID, id, reassignTo int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	c, err := s.lock(ctx, tx, spenderID, id)
+	if err != nil {
+		return err
+	}
+
+	var to Category
+	if reassignTo != 0 {
+		if reassignTo == id {
+			return ErrUnknownCategory
+		}
+		if to, err = Resolve(ctx, tx, spenderID, reassignTo, "", c.Type); err != nil {
+			return err
+		}
+	}
+	if err := recategorize(ctx, tx, reassignTransactionsStmt, to.ID, to.Name, c.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, liftChildrenStmt, c.ParentID, c.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, deleteStmt, c.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
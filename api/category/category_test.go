@@ -0,0 +1,76 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var categoryColumns = []string{"id", "spender_id", "parent_id", "name", "icon", "color", "type"}
+
+var recategorizedColumns = []string{"id", "spender_id", "category_id", "category"}
+
+const outboxStmt = `INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`
+
+func TestResolve(t *testing.T) {
+	t.Run("by name, whatever the case", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(byNameStmt).WithArgs(int64(1), "food", "Expense").
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(1, 0, 0, "Food", "restaurant", "#FF9800", "expense"))
+
+		c, err := Resolve(context.Background(), db, 1, 0, " food ", "Expense")
+
+		assert.NoError(t, err)
+		assert.Equal(t, Category{ID: 1, Name: "Food", Icon: "restaurant", Color: "#FF9800", Type: TypeExpense, System: true}, c)
+	})
+
+	t.Run("by id of another type", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(12)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(12, 0, 0, "Salary", "payments", "#4CAF50", "income"))
+
+		_, err := Resolve(context.Background(), db, 1, 12, "", TypeExpense)
+
+		assert.Equal(t, ErrTypeMismatch, err)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(99)).WillReturnError(sql.ErrNoRows)
+
+		_, err := Resolve(context.Background(), db, 1, 99, "", TypeExpense)
+
+		assert.Equal(t, ErrUnknownCategory, err)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	valid := Category{Name: "Coffee", Icon: "local_cafe", Color: "#6D4C41", Type: TypeExpense}
+	tests := []struct {
+		name string
+		edit func(c *Category)
+		want error
+	}{
+		{"valid", func(c *Category) {}, nil},
+		{"empty name", func(c *Category) { c.Name = "" }, ErrInvalidName},
+		{"long name", func(c *Category) { c.Name = strings.Repeat("ก", 51) }, ErrInvalidName},
+		{"short color", func(c *Category) { c.Color = "#FFF" }, ErrInvalidColor},
+		{"named color", func(c *Category) { c.Color = "brown" }, ErrInvalidColor},
+		{"unknown type", func(c *Category) { c.Type = "transfer" }, ErrInvalidType},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid
+			tc.edit(&c)
+			assert.Equal(t, tc.want, c.validate())
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package category
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var errBadID = errors.New("invalid spender or category id")
+
+type handler struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+}
+
+func New(cfg config.FeatureFlag, db *sql.DB) *handler {
+	return &handler{cfg, db}
+}
+
+func (h handler) service() Service {
+	return NewService(h.flag, h.db)
+}
+
+// params reads the spender id and, when the route has one, the category id.
+func params(c echo.Context) (spenderID, id int64, err error) {
+	if spenderID, err = strconv.ParseInt(c.Param("id"), 10, 64); err != nil {
+		return 0, 0, errBadID
+	}
+	if v := c.Param("category_id"); v != "" {
+		if id, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, 0, errBadID
+		}
+	}
+	return spenderID, id, nil
+}
+
+func status(err error) int {
+	switch err {
+	case errBadID, ErrInvalidName, ErrInvalidIcon, ErrInvalidColor, ErrInvalidType, ErrUnknownCategory, ErrTypeMismatch,
+		ErrUnknownParent, ErrParentType, ErrParentCycle:
+		return http.StatusBadRequest
+	case ErrSystem:
+		return http.StatusForbidden
+	case ErrNotFound, ErrUnknownSpender:
+		return http.StatusNotFound
+	case ErrNameTaken:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func fail(c echo.Context, msg string, err error) error {
+	code := status(err)
+	if code == http.StatusInternalServerError {
+		mlog.L(c).Error(msg, zap.Error(err))
+	}
+	return c.JSON(code, err.Error())
+}
+
+// GetAll lists the system categories and the spender's own, of ?type when
+// it is set.
+func (h handler) GetAll(c echo.Context) error {
+	spenderID, _, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	cats, err := h.service().List(c.Request().Context(), spenderID, c.QueryParam("type"))
+	if err != nil {
+		return fail(c, "query categories error", err)
+	}
+	return c.JSON(http.StatusOK, map[string][]Category{"categories": cats})
+}
+
+func (h handler) Get(c echo.Context) error {
+	spenderID, id, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	cat, err := h.service().Get(c.Request().Context(), spenderID, id)
+	if err != nil {
+		return fail(c, "query category error", err)
+	}
+	return c.JSON(http.StatusOK, cat)
+}
+
+func (h handler) Create(c echo.Context) error {
+	spenderID, _, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var cat Category
+	if err := c.Bind(&cat); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+	cat.SpenderID = spenderID
+
+	cat, err = h.service().Create(c.Request().Context(), cat)
+	if err != nil {
+		return fail(c, "create category error", err)
+	}
+	return c.JSON(http.StatusCreated, cat)
+}
+
+// Update changes the parent, name, icon or color of a custom category, the
+// fields left out are kept.
+func (h handler) Update(c echo.Context) error {
+	spenderID, id, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var p Patch
+	if err := c.Bind(&p); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+
+	cat, err := h.service().Update(c.Request().Context(), spenderID, id, p)
+	if err != nil {
+		return fail(c, "update category error", err)
+	}
+	return c.JSON(http.StatusOK, cat)
+}
+
+// Delete removes a custom category, its transactions move to the category
+// ?reassign_to or become uncategorized.
+func (h handler) Delete(c echo.Context) error {
+	spenderID, id, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var reassignTo int64
+	if v := c.QueryParam("reassign_to"); v != "" {
+		if reassignTo, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid reassign_to")
+		}
+	}
+
+	if err := h.service().Delete(c.Request().Context(), spenderID, id, reassignTo); err != nil {
+		return fail(c, "delete category error", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
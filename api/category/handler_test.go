@@ -0,0 +1,337 @@
+package category
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func call(method, target, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names, values = append(names, params[i]), append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	return c, rec
+}
+
+func TestGetAll(t *testing.T) {
+	t.Run("system and own categories", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "/?type=expense", "", "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(listStmt).WithArgs(int64(1), "expense").WillReturnRows(sqlmock.NewRows(categoryColumns).
+			AddRow(1, 0, 0, "Food", "restaurant", "#FF9800", "expense").
+			AddRow(19, 1, 0, "Coffee", "local_cafe", "#6D4C41", "expense"))
+
+		err := New(config.FeatureFlag{}, db).GetAll(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"categories": [
+			{"id": 1, "name": "Food", "icon": "restaurant", "color": "#FF9800", "type": "expense", "system": true},
+			{"id": 19, "spender_id": 1, "name": "Coffee", "icon": "local_cafe", "color": "#6D4C41", "type": "expense", "system": false}
+		]}`, rec.Body.String())
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "/?type=transfer", "", "id", "1")
+
+		err := New(config.FeatureFlag{}, nil).GetAll(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestGet(t *testing.T) {
+	c, rec := call(http.MethodGet, "/", "", "id", "1", "category_id", "99")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(99)).WillReturnError(sql.ErrNoRows)
+
+	err := New(config.FeatureFlag{}, db).Get(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("adds a custom category", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"name": " Coffee ", "icon": "local_cafe", "color": "#6d4c41", "type": "expense"}`, "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(takenStmt).WithArgs(int64(1), "Coffee", "expense", int64(0)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(cStmt).WithArgs(int64(1), int64(0), "Coffee", "local_cafe", "#6D4C41", "expense").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(19))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 19, "spender_id": 1, "name": "Coffee", "icon": "local_cafe", "color": "#6D4C41", "type": "expense", "system": false}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("default color", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"name": "Coffee", "type": "expense"}`, "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(takenStmt).WithArgs(int64(1), "Coffee", "expense", int64(0)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(cStmt).WithArgs(int64(1), int64(0), "Coffee", "", DefaultColor, "expense").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(19))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("name of a system category", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"name": "food", "type": "expense"}`, "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(takenStmt).WithArgs(int64(1), "food", "expense", int64(0)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("unknown spender", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"name": "Coffee", "type": "expense"}`, "id", "9")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(takenStmt).WithArgs(int64(9), "Coffee", "expense", int64(0)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(cStmt).WithArgs(int64(9), int64(0), "Coffee", "", DefaultColor, "expense").WillReturnError(&pq.Error{Code: "23503"})
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("under a parent", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"name": "Coffee", "type": "expense", "parent_id": 1}`, "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(1, 0, 0, "Food", "restaurant", "#FF9800", "expense"))
+		mock.ExpectQuery(takenStmt).WithArgs(int64(1), "Coffee", "expense", int64(0)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(cStmt).WithArgs(int64(1), int64(1), "Coffee", "", DefaultColor, "expense").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(19))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 19, "spender_id": 1, "parent_id": 1, "name": "Coffee", "icon": "", "color": "#9E9E9E", "type": "expense", "system": false}`, rec.Body.String())
+	})
+
+	t.Run("under a parent of another type", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"name": "Coffee", "type": "expense", "parent_id": 12}`, "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(12)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(12, 0, 0, "Salary", "payments", "#4CAF50", "income"))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `"parent category must be of the same type"`, rec.Body.String())
+	})
+
+	t.Run("invalid color", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"name": "Coffee", "color": "brown", "type": "expense"}`, "id", "1")
+
+		err := New(config.FeatureFlag{}, nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `"color must be a hex color like #4CAF50"`, rec.Body.String())
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("renames the category and its transactions", func(t *testing.T) {
+		c, rec := call(http.MethodPatch, "/", `{"name": "Coffee & Tea"}`, "id", "1", "category_id", "19")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(19), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(19, 1, 0, "Coffee", "local_cafe", "#6D4C41", "expense"))
+		mock.ExpectQuery(takenStmt).WithArgs(int64(1), "Coffee & Tea", "expense", int64(19)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec(updateStmt).WithArgs(int64(0), "Coffee & Tea", "local_cafe", "#6D4C41", int64(19)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(renameTransactionsStmt).WithArgs("Coffee & Tea", int64(19)).
+			WillReturnRows(sqlmock.NewRows(recategorizedColumns).AddRow(7, 1, 19, "Coffee & Tea").AddRow(8, 1, 19, "Coffee & Tea"))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.updated", `{"category":"Coffee \u0026 Tea","category_id":19,"id":7,"spender_id":1}`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.updated", `{"category":"Coffee \u0026 Tea","category_id":19,"id":8,"spender_id":1}`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 19, "spender_id": 1, "name": "Coffee & Tea", "icon": "local_cafe", "color": "#6D4C41", "type": "expense", "system": false}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("under one of its subcategories", func(t *testing.T) {
+		c, rec := call(http.MethodPatch, "/", `{"parent_id": 21}`, "id", "1", "category_id", "19")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(19), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(19, 1, 1, "Restaurants", "", "#FF9800", "expense"))
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(21)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(21, 1, 19, "Street Food", "", "#FF9800", "expense"))
+		mock.ExpectQuery(cycleStmt).WithArgs(int64(21), int64(19)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `"a category cannot be moved under itself or its subcategories"`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("to the top", func(t *testing.T) {
+		c, rec := call(http.MethodPatch, "/", `{"parent_id": 0}`, "id", "1", "category_id", "19")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(19), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(19, 1, 1, "Restaurants", "", "#FF9800", "expense"))
+		mock.ExpectExec(updateStmt).WithArgs(int64(0), "Restaurants", "", "#FF9800", int64(19)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 19, "spender_id": 1, "name": "Restaurants", "icon": "", "color": "#FF9800", "type": "expense", "system": false}`, rec.Body.String())
+	})
+
+	t.Run("system category", func(t *testing.T) {
+		c, rec := call(http.MethodPatch, "/", `{"color": "#000000"}`, "id", "1", "category_id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(1), int64(1)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(1, 0, 0, "Food", "restaurant", "#FF9800", "expense"))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("category of another spender", func(t *testing.T) {
+		c, rec := call(http.MethodPatch, "/", `{"color": "#000000"}`, "id", "1", "category_id", "20")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(20), int64(1)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(20)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("moves the transactions to another category", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "/?reassign_to=1", "", "id", "1", "category_id", "19")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(19), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(19, 1, 0, "Coffee", "local_cafe", "#6D4C41", "expense"))
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(1, 0, 0, "Food", "restaurant", "#FF9800", "expense"))
+		mock.ExpectQuery(reassignTransactionsStmt).WithArgs(int64(1), "Food", int64(19)).
+			WillReturnRows(sqlmock.NewRows(recategorizedColumns).AddRow(7, 1, 1, "Food"))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.updated", `{"category":"Food","category_id":1,"id":7,"spender_id":1}`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(liftChildrenStmt).WithArgs(int64(0), int64(19)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(deleteStmt).WithArgs(int64(19)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("leaves the transactions uncategorized", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "/", "", "id", "1", "category_id", "19")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(19), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(19, 1, 0, "Coffee", "local_cafe", "#6D4C41", "expense"))
+		mock.ExpectQuery(reassignTransactionsStmt).WithArgs(int64(0), "", int64(19)).
+			WillReturnRows(sqlmock.NewRows(recategorizedColumns).AddRow(7, 1, 0, ""))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.updated", `{"category":"","category_id":0,"id":7,"spender_id":1}`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(liftChildrenStmt).WithArgs(int64(0), int64(19)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(deleteStmt).WithArgs(int64(19)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reassign to a category of another type", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "/?reassign_to=12", "", "id", "1", "category_id", "19")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(19), int64(1)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(19, 1, 0, "Coffee", "local_cafe", "#6D4C41", "expense"))
+		mock.ExpectQuery(getStmt).WithArgs(int64(1), int64(12)).
+			WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(12, 0, 0, "Salary", "payments", "#4CAF50", "income"))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
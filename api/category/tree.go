@@ -0,0 +1,160 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// ancestryStmt reads categories along with every one above them.
+const ancestryStmt = `WITH RECURSIVE up AS (
+	SELECT * FROM category WHERE id = ANY($1)
+	UNION
+	SELECT c.* FROM category c JOIN up ON c.id = up.parent_id
+) SELECT ` + columns + ` FROM up;`
+
+// Total is what the transactions of a category add up to. Transactions
+// outside the catalog have no CategoryID and are told apart by name.
+type Total struct {
+	CategoryID      int64
+	Category        string
+	TransactionType string
+	Total           float64
+	Count           int
+}
+
+// Key identifies the node of a breakdown a total goes to.
+type Key struct {
+	CategoryID      int64
+	Category        string
+	TransactionType string
+}
+
+func (t Total) Key() Key {
+	if t.CategoryID != 0 {
+		return Key{CategoryID: t.CategoryID}
+	}
+	return Key{Category: t.Category, TransactionType: t.TransactionType}
+}
+
+// Node is a category of a breakdown. Its totals are those of its own
+// transactions and of its subcategories, to any depth.
+type Node struct {
+	CategoryID      int64   `json:"category_id,omitempty"`
+	Category        string  `json:"category"`
+	TransactionType string  `json:"transaction_type"`
+	Total           float64 `json:"total"`
+	Count           int     `json:"count"`
+	Children        []*Node `json:"children,omitempty"`
+}
+
+func (n *Node) Key() Key {
+	return Total{CategoryID: n.CategoryID, Category: n.Category, TransactionType: n.TransactionType}.Key()
+}
+
+// Ancestry returns the categories of ids along with their ancestors, what
+// Tree needs to place them.
+func Ancestry(ctx context.Context, db *sql.DB, ids []int64) ([]Category, error) {
+	if len(ids) == 0 {
+		return []Category{}, nil
+	}
+	rows, err := db.QueryContext(ctx, ancestryStmt, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cats := []Category{}
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+// IDs returns the catalog categories of totals, for Ancestry.
+func IDs(totals []Total) []int64 {
+	seen := map[int64]bool{}
+	ids := []int64{}
+	for _, t := range totals {
+		if t.CategoryID != 0 && !seen[t.CategoryID] {
+			seen[t.CategoryID] = true
+			ids = append(ids, t.CategoryID)
+		}
+	}
+	return ids
+}
+
+// Tree arranges totals under their categories, cats holding them and their
+// ancestors, and rolls each up to the top. Only categories with
+// transactions, theirs or their subcategories', are kept. Nodes come
+// largest first, the top ones and the children of each.
+func Tree(cats []Category, totals []Total) []*Node {
+	byID := make(map[int64]Category, len(cats))
+	for _, c := range cats {
+		byID[c.ID] = c
+	}
+
+	nodes := map[Key]*Node{}
+	roots := []*Node{}
+	var node func(k Key, name, typ string) *Node
+	node = func(k Key, name, typ string) *Node {
+		if n, ok := nodes[k]; ok {
+			return n
+		}
+		n := &Node{CategoryID: k.CategoryID, Category: name, TransactionType: typ}
+		nodes[k] = n
+		c, ok := byID[k.CategoryID]
+		if ok {
+			n.Category, n.TransactionType = c.Name, c.Type
+		}
+		if p, found := byID[c.ParentID]; ok && found {
+			parent := node(Key{CategoryID: p.ID}, p.Name, p.Type)
+			parent.Children = append(parent.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+		return n
+	}
+
+	for _, t := range totals {
+		k := t.Key()
+		n := node(k, t.Category, t.TransactionType)
+		n.Total += t.Total
+		n.Count += t.Count
+	}
+	for _, n := range roots {
+		rollUp(n)
+	}
+	sortNodes(roots)
+	return roots
+}
+
+// rollUp adds the totals of the subcategories of n to its own, rounded to
+// the satang so float sums do not show.
+func rollUp(n *Node) {
+	for _, child := range n.Children {
+		rollUp(child)
+		n.Total += child.Total
+		n.Count += child.Count
+	}
+	n.Total = math.Round(n.Total*100) / 100
+}
+
+func sortNodes(nodes []*Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Total != nodes[j].Total {
+			return nodes[i].Total > nodes[j].Total
+		}
+		return nodes[i].Category < nodes[j].Category
+	})
+	for _, n := range nodes {
+		sortNodes(n.Children)
+	}
+}
@@ -0,0 +1,65 @@
+package category
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree(t *testing.T) {
+	cats := []Category{
+		{ID: 1, Name: "Food", Type: TypeExpense},
+		{ID: 19, ParentID: 1, Name: "Restaurants", Type: TypeExpense},
+		{ID: 21, ParentID: 19, Name: "Street Food", Type: TypeExpense},
+		{ID: 20, ParentID: 1, Name: "Groceries", Type: TypeExpense},
+		{ID: 12, Name: "Salary", Type: TypeIncome},
+	}
+
+	t.Run("rolls totals up to every ancestor", func(t *testing.T) {
+		nodes := Tree(cats, []Total{
+			{CategoryID: 21, Category: "Street Food", TransactionType: TypeExpense, Total: 0.1, Count: 1},
+			{CategoryID: 19, Category: "Restaurants", TransactionType: TypeExpense, Total: 0.2, Count: 1},
+			{CategoryID: 20, Category: "Groceries", TransactionType: TypeExpense, Total: 100, Count: 2},
+			{CategoryID: 12, Category: "Salary", TransactionType: TypeIncome, Total: 50, Count: 1},
+		})
+
+		assert.Equal(t, []*Node{
+			{CategoryID: 1, Category: "Food", TransactionType: TypeExpense, Total: 100.3, Count: 4, Children: []*Node{
+				{CategoryID: 20, Category: "Groceries", TransactionType: TypeExpense, Total: 100, Count: 2},
+				{CategoryID: 19, Category: "Restaurants", TransactionType: TypeExpense, Total: 0.3, Count: 2, Children: []*Node{
+					{CategoryID: 21, Category: "Street Food", TransactionType: TypeExpense, Total: 0.1, Count: 1},
+				}},
+			}},
+			{CategoryID: 12, Category: "Salary", TransactionType: TypeIncome, Total: 50, Count: 1},
+		}, nodes)
+	})
+
+	t.Run("leaves out categories without transactions", func(t *testing.T) {
+		nodes := Tree(cats, []Total{
+			{CategoryID: 20, Category: "Groceries", TransactionType: TypeExpense, Total: 100, Count: 2},
+		})
+
+		assert.Equal(t, []*Node{
+			{CategoryID: 1, Category: "Food", TransactionType: TypeExpense, Total: 100, Count: 2, Children: []*Node{
+				{CategoryID: 20, Category: "Groceries", TransactionType: TypeExpense, Total: 100, Count: 2},
+			}},
+		}, nodes)
+	})
+
+	t.Run("transactions outside the catalog by name", func(t *testing.T) {
+		nodes := Tree(nil, []Total{
+			{Category: "Gadgets", TransactionType: TypeExpense, Total: 10, Count: 1},
+			{Category: "Gadgets", TransactionType: TypeExpense, Total: 20, Count: 1},
+			{Category: "Gadgets", TransactionType: TypeIncome, Total: 30, Count: 1},
+		})
+
+		assert.Equal(t, []*Node{
+			{Category: "Gadgets", TransactionType: TypeExpense, Total: 30, Count: 2},
+			{Category: "Gadgets", TransactionType: TypeIncome, Total: 30, Count: 1},
+		}, nodes)
+	})
+
+	t.Run("nothing", func(t *testing.T) {
+		assert.Equal(t, []*Node{}, Tree(cats, nil))
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 )
@@ -14,6 +15,13 @@ type Config struct {
 	Database    Database
 	Server      Server
 	FeatureFlag FeatureFlag
+	Outbox      Outbox
+	Storage     Storage
+	Upload      Upload
+	SlipVerify  SlipVerify
+	Download    Download
+	Jobs        Jobs
+	Mail        Mail
 }
 
 func (c Config) PostgresURI() string {
@@ -21,15 +29,94 @@ func (c Config) PostgresURI() string {
 }
 
 type Server struct {
-	Port string `env:"SERVER_PORT"`
+	Port     string `env:"SERVER_PORT"`
+	GRPCPort string `env:"GRPC_PORT"`
 }
 
 type Database struct {
 	PostgresURI string `env:"DATABASE_POSTGRES_URI,required"`
 }
 
+// Outbox selects where domain events are relayed besides the webhook
+// subscriptions, which always receive them: "webhook" (default, nowhere
+// else), "stdout" or "file".
+type Outbox struct {
+	Sink     string `env:"OUTBOX_SINK" envDefault:"webhook"`
+	FilePath string `env:"OUTBOX_FILE_PATH" envDefault:"outbox.jsonl"`
+}
+
+// Storage selects where uploaded files are kept: "local" (default) under
+// LocalDir, or "s3" in Bucket of any S3-compatible Endpoint. Keys are stored
+// under Prefix with both.
+type Storage struct {
+	Backend         string `env:"STORAGE_BACKEND" envDefault:"local"`
+	LocalDir        string `env:"STORAGE_LOCAL_DIR" envDefault:"uploads"`
+	Prefix          string `env:"STORAGE_PREFIX" envDefault:"eslip"`
+	Bucket          string `env:"STORAGE_BUCKET"`
+	Endpoint        string `env:"STORAGE_S3_ENDPOINT"`
+	Region          string `env:"STORAGE_S3_REGION" envDefault:"ap-southeast-1"`
+	AccessKeyID     string `env:"STORAGE_S3_ACCESS_KEY_ID"`
+	SecretAccessKey string `env:"STORAGE_S3_SECRET_ACCESS_KEY"`
+}
+
+// Upload limits what is accepted by the upload endpoint, sizes are in bytes.
+// Images are scaled down so neither side exceeds MaxImageSide pixels.
+type Upload struct {
+	MaxFileSize    int64 `env:"UPLOAD_MAX_FILE_SIZE" envDefault:"10485760"`
+	MaxRequestSize int64 `env:"UPLOAD_MAX_REQUEST_SIZE" envDefault:"33554432"`
+	MaxImageSide   int   `env:"UPLOAD_MAX_IMAGE_SIDE" envDefault:"2048"`
+}
+
+// SlipVerify selects how the amount and date of a slip transfer are looked
+// up, as its QR code carries neither: "none" (default) leaves them to the
+// spender, "http" asks the slip verification API at URL and "file" reads
+// them from the JSON file at File, keyed by transaction reference, where no
+// API is at hand like in development.
+type SlipVerify struct {
+	Backend string        `env:"SLIP_VERIFY_BACKEND" envDefault:"none"`
+	URL     string        `env:"SLIP_VERIFY_URL"`
+	APIKey  string        `env:"SLIP_VERIFY_API_KEY"`
+	Timeout time.Duration `env:"SLIP_VERIFY_TIMEOUT" envDefault:"10s"`
+	File    string        `env:"SLIP_VERIFY_FILE" envDefault:"slips.json"`
+}
+
+// Download signs the URLs receipt images are downloaded with. SigningKeys
+// lists "id:secret" pairs separated by commas, the first one signs and all
+// of them verify so keys can be rotated.
+type Download struct {
+	SigningKeys string        `env:"DOWNLOAD_SIGNING_KEYS"`
+	URLTTL      time.Duration `env:"DOWNLOAD_URL_TTL" envDefault:"15m"`
+}
+
+// Jobs sizes the background job workers, a failed job is run up to
+// MaxAttempts times.
+type Jobs struct {
+	Workers     int `env:"JOB_WORKERS" envDefault:"4"`
+	MaxAttempts int `env:"JOB_MAX_ATTEMPTS" envDefault:"3"`
+}
+
+// Mail selects how emails are sent: "file" (default) writes them to Dir,
+// "smtp" sends them through the server at SMTPAddr. Links to verify an
+// email expire after VerifyTTL.
+type Mail struct {
+	Backend   string        `env:"MAIL_BACKEND" envDefault:"file"`
+	Dir       string        `env:"MAIL_DIR" envDefault:"mail"`
+	From      string        `env:"MAIL_FROM" envDefault:"HongJot <no-reply@hongjot.local>"`
+	SMTPAddr  string        `env:"MAIL_SMTP_ADDR"`
+	Username  string        `env:"MAIL_SMTP_USERNAME"`
+	Password  string        `env:"MAIL_SMTP_PASSWORD"`
+	VerifyTTL time.Duration `env:"MAIL_VERIFY_TTL" envDefault:"48h"`
+	// LinkBaseURL is where the links of emails lead, never taken from the
+	// request whose Host the client chooses.
+	LinkBaseURL string `env:"MAIL_LINK_BASE_URL" envDefault:"http://localhost:8080"`
+	// SigningKeys sign the email tokens, apart from the download keys.
+	SigningKeys string `env:"MAIL_SIGNING_KEYS"`
+}
+
 type FeatureFlag struct {
 	EnableCreateSpender bool `env:"ENABLE_CREATE_SPENDER"`
+	// EnableRequestValidation checks requests against the OpenAPI document.
+	EnableRequestValidation bool `env:"ENABLE_REQUEST_VALIDATION"`
 }
 
 func Env(key string) string {
@@ -71,21 +158,70 @@ func parse(envPrefix string) (Config, error) {
 		return Config{}, errors.New("failed to parse feature flag config:" + err.Error())
 	}
 
+	outbox := &Outbox{}
+	if err := env.ParseWithOptions(outbox, opts); err != nil {
+		return Config{}, errors.New("failed to parse outbox config:" + err.Error())
+	}
+
+	storage := &Storage{}
+	if err := env.ParseWithOptions(storage, opts); err != nil {
+		return Config{}, errors.New("failed to parse storage config:" + err.Error())
+	}
+
+	upload := &Upload{}
+	if err := env.ParseWithOptions(upload, opts); err != nil {
+		return Config{}, errors.New("failed to parse upload config:" + err.Error())
+	}
+
+	slipVerify := &SlipVerify{}
+	if err := env.ParseWithOptions(slipVerify, opts); err != nil {
+		return Config{}, errors.New("failed to parse slip verify config:" + err.Error())
+	}
+
+	download := &Download{}
+	if err := env.ParseWithOptions(download, opts); err != nil {
+		return Config{}, errors.New("failed to parse download config:" + err.Error())
+	}
+
+	jobs := &Jobs{}
+	if err := env.ParseWithOptions(jobs, opts); err != nil {
+		return Config{}, errors.New("failed to parse jobs config:" + err.Error())
+	}
+
+	mail := &Mail{}
+	if err := env.ParseWithOptions(mail, opts); err != nil {
+		return Config{}, errors.New("failed to parse mail config:" + err.Error())
+	}
+
 	port := Env("SERVER_PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	grpcPort := Env("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+
 	return Config{
 		Database: Database{
 			PostgresURI: dbconf.PostgresURI,
 		},
 		Server: Server{
-			Port: port,
+			Port:     port,
+			GRPCPort: grpcPort,
 		},
 		FeatureFlag: FeatureFlag{
-			EnableCreateSpender: feats.EnableCreateSpender,
+			EnableCreateSpender:     feats.EnableCreateSpender,
+			EnableRequestValidation: feats.EnableRequestValidation,
 		},
+		Outbox:     *outbox,
+		Storage:    *storage,
+		Upload:     *upload,
+		SlipVerify: *slipVerify,
+		Download:   *download,
+		Jobs:       *jobs,
+		Mail:       *mail,
 	}, nil
 }
 
@@ -0,0 +1,26 @@
+// Package emvco holds what the EMVCo QR payloads of Thai banks share: the
+// tag-length-value fields and their checksum.
+package emvco
+
+import "fmt"
+
+// Field is a tag-length-value field, value must be at most 99 bytes.
+func Field(tag, value string) string {
+	return fmt.Sprintf("%s%02d%s", tag, len(value), value)
+}
+
+// CRC16 is the CRC-16/CCITT-FALSE used by EMVCo QR payloads.
+func CRC16(s string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
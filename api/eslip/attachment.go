@@ -0,0 +1,190 @@
+package eslip
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Attachment is an uploaded image recorded for a spender. TransactionID is
+// the transaction created with its location as image_url, if any.
+type Attachment struct {
+	ID             int64  `json:"id"`
+	SpenderID      int64  `json:"spender_id"`
+	Filename       string `json:"filename"`
+	Location       string `json:"location"`
+	TransactionRef string `json:"transaction_ref,omitempty"`
+	TransactionID  *int64 `json:"transaction_id,omitempty"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// Duplicate is an upload matching a slip the spender uploaded before.
+type Duplicate struct {
+	Filename   string     `json:"filename"`
+	MatchedBy  string     `json:"matched_by"`
+	Attachment Attachment `json:"attachment"`
+}
+
+const (
+	matchedByRef  = "transaction_ref"
+	matchedByHash = "image_hash"
+)
+
+const attachmentColumns = `a.id, a.spender_id, a.filename, a.location, COALESCE(a.transaction_ref, ''), a.created_at, t.id
+FROM attachment a LEFT JOIN transaction t ON t.spender_id = a.spender_id AND t.image_url = a.location`
+
+const (
+	getAttachmentStmt = `SELECT ` + attachmentColumns + `
+WHERE a.id = $1 ORDER BY t.id LIMIT 1;`
+	getByRefStmt = `SELECT ` + attachmentColumns + `
+WHERE a.spender_id = $1 AND a.transaction_ref = $2 ORDER BY a.id, t.id LIMIT 1;`
+	listAttachmentsStmt = `SELECT DISTINCT ON (a.id) ` + attachmentColumns + `
+WHERE a.spender_id = $1 ORDER BY a.id, t.id;`
+	// hashesStmt leaves out slips with a reference, those uploaded before
+	// hashes were kept for unreadable slips only have one too.
+	hashesStmt      = `SELECT id, image_hash FROM attachment WHERE spender_id = $1 AND image_hash IS NOT NULL AND transaction_ref IS NULL ORDER BY id;`
+	cAttachmentStmt = `INSERT INTO attachment (spender_id, filename, location, transaction_ref, image_hash) VALUES ($1, $2, $3, NULLIF($4, ''), $5) RETURNING id;`
+	// overrideStmt stores a slip uploaded again over its attachment, a
+	// reference is only recorded once per spender.
+	overrideStmt = `INSERT INTO attachment (spender_id, filename, location, transaction_ref, image_hash) VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+ON CONFLICT (spender_id, transaction_ref) WHERE transaction_ref IS NOT NULL DO UPDATE SET filename = EXCLUDED.filename, location = EXCLUDED.location RETURNING id;`
+)
+
+// refIndex keeps a spender from recording a slip reference twice, even
+// with concurrent uploads.
+const refIndex = "attachment_spender_id_transaction_ref_key"
+
+var errDuplicateSlip = errors.New("slip already uploaded")
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAttachment(row scanner) (Attachment, error) {
+	var a Attachment
+	var transactionID sql.NullInt64
+	err := row.Scan(&a.ID, &a.SpenderID, &a.Filename, &a.Location, &a.TransactionRef, &a.CreatedAt, &transactionID)
+	if transactionID.Valid {
+		a.TransactionID = &transactionID.Int64
+	}
+	return a, err
+}
+
+// findDuplicates looks for the slips of the uploads among those the spender
+// uploaded before, by transaction reference when the QR code was readable
+// and by image hash otherwise. The duplicate is also kept on its upload. A
+// slip sent twice in the request fails the second time.
+func findDuplicates(ctx context.Context, db *sql.DB, spenderID int64, uploads []*upload) ([]Duplicate, error) {
+	var hashes []storedHash
+	var loaded bool
+	var dups []Duplicate
+	// seen maps the references of the request to their file
+	seen := map[string]string{}
+
+	for _, u := range uploads {
+		if u.err != nil {
+			continue
+		}
+		if u.slip != nil {
+			if first, ok := seen[u.slip.TransactionRef]; ok {
+				u.err = fmt.Errorf("same slip as %s in this request", first)
+				continue
+			}
+			seen[u.slip.TransactionRef] = u.filename
+
+			dup, err := refDuplicate(ctx, db, spenderID, u)
+			if err == sql.ErrNoRows {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			u.dup = dup
+			dups = append(dups, *u.dup)
+			continue
+		}
+		if u.hash == nil {
+			continue
+		}
+
+		if !loaded {
+			var err error
+			if hashes, err = spenderHashes(ctx, db, spenderID); err != nil {
+				return nil, err
+			}
+			loaded = true
+		}
+		for _, h := range hashes {
+			if !SameImage(*u.hash, h.hash) {
+				continue
+			}
+			a, err := scanAttachment(db.QueryRowContext(ctx, getAttachmentStmt, h.id))
+			if err != nil {
+				return nil, err
+			}
+			u.dup = &Duplicate{u.filename, matchedByHash, a}
+			dups = append(dups, *u.dup)
+			break
+		}
+	}
+	return dups, nil
+}
+
+// refDuplicate returns the attachment recorded for the slip reference of u.
+func refDuplicate(ctx context.Context, db *sql.DB, spenderID int64, u *upload) (*Duplicate, error) {
+	a, err := scanAttachment(db.QueryRowContext(ctx, getByRefStmt, spenderID, u.slip.TransactionRef))
+	if err != nil {
+		return nil, err
+	}
+	return &Duplicate{u.filename, matchedByRef, a}, nil
+}
+
+type storedHash struct {
+	id   int64
+	hash uint64
+}
+
+func spenderHashes(ctx context.Context, db *sql.DB, spenderID int64) ([]storedHash, error) {
+	rows, err := db.QueryContext(ctx, hashesStmt, spenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []storedHash
+	for rows.Next() {
+		var id, h int64
+		if err := rows.Scan(&id, &h); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, storedHash{id, uint64(h)})
+	}
+	return hashes, rows.Err()
+}
+
+// createAttachment records u, errDuplicateSlip tells its reference was
+// recorded already unless override stores it over that attachment.
+func createAttachment(ctx context.Context, db *sql.DB, spenderID int64, u *upload, location string, override bool) (int64, error) {
+	var ref string
+	if u.slip != nil {
+		ref = u.slip.TransactionRef
+	}
+	var hash sql.NullInt64
+	if u.hash != nil {
+		hash = sql.NullInt64{Int64: int64(*u.hash), Valid: true}
+	}
+
+	stmt := cAttachmentStmt
+	if override {
+		stmt = overrideStmt
+	}
+	var id int64
+	err := db.QueryRowContext(ctx, stmt, spenderID, u.filename, location, ref, hash).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == refIndex {
+		return 0, errDuplicateSlip
+	}
+	return id, err
+}
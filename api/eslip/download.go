@@ -0,0 +1,115 @@
+package eslip
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/signurl"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// downloadPath is where Download is served.
+const downloadPath = "/api/v1/downloads/"
+
+// SignedAttachment is an attachment with the URLs to download it, and its
+// thumbnails, without credentials until ExpiresAt.
+type SignedAttachment struct {
+	Attachment
+	URLs      map[string]string `json:"urls"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// WithSigner enables signed download URLs.
+func (h *handler) WithSigner(signer signurl.Signer) *handler {
+	h.signer = &signer
+	return h
+}
+
+func downloadResource(id int64, size string) string {
+	if size == "" {
+		size = "original"
+	}
+	return "attachments/" + strconv.FormatInt(id, 10) + "/" + size
+}
+
+func (h handler) signedURL(id int64, size string) (string, time.Time) {
+	q, expires := h.signer.Sign(downloadResource(id, size))
+	if size != "original" {
+		q.Set("size", size)
+	}
+	u := url.URL{Path: downloadPath + strconv.FormatInt(id, 10), RawQuery: q.Encode()}
+	return u.String(), expires
+}
+
+// GetSpenderAttachments lists the spender attachments with short-lived
+// signed URLs, to be used where credentials cannot be sent like in <img>.
+func (h handler) GetSpenderAttachments(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	spenderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+
+	rows, err := h.db.QueryContext(ctx, listAttachmentsStmt, spenderID)
+	if err != nil {
+		logger.Error("query attachments error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	attachments := []SignedAttachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			logger.Error("scan attachment error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		sa := SignedAttachment{Attachment: a, URLs: map[string]string{}}
+		for _, size := range []string{"original", "thumb", "preview"} {
+			sa.URLs[size], sa.ExpiresAt = h.signedURL(a.ID, size)
+		}
+		attachments = append(attachments, sa)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("query attachments error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string][]SignedAttachment{
+		"attachments": attachments,
+	})
+}
+
+// Download streams an attachment from a URL GetSpenderAttachments signed,
+// it needs no other credentials.
+func (h handler) Download(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid attachment id")
+	}
+	size := c.QueryParam("size")
+	if err := h.signer.Verify(downloadResource(id, size), c.QueryParams()); err != nil {
+		return c.JSON(http.StatusForbidden, err.Error())
+	}
+
+	a, err := scanAttachment(h.db.QueryRowContext(ctx, getAttachmentStmt, id))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "attachment not found")
+	} else if err != nil {
+		logger.Error("get attachment error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return h.serve(c, a, size)
+}
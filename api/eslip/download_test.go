@@ -0,0 +1,127 @@
+package eslip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/signurl"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedDownload(t *testing.T) {
+	content, err := os.ReadFile("../../e-slip1.png")
+	assert.NoError(t, err)
+	key := storage.ContentKey(content, ".png")
+	store := storage.NewMemory()
+	store.Put(context.Background(), key, content, TypePNG)
+	keys := []signurl.Key{{ID: "k1", Secret: []byte("0123456789abcdef0123")}}
+
+	columns := []string{"id", "spender_id", "filename", "location", "transaction_ref", "created_at", "transaction_id"}
+	expectAttachment := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(getAttachmentStmt).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 1, "slip.png", key, "", "2024-05-20T10:00:00Z", nil))
+	}
+
+	// urls lists the signed URLs of the attachment of spender 1
+	urls := func(t *testing.T, ttl time.Duration) map[string]string {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(listAttachmentsStmt).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 1, "slip.png", key, "", "2024-05-20T10:00:00Z", 9))
+		h := New(limits, db, store, nil).WithSigner(signurl.New(keys, ttl))
+
+		rec := callWithID(t, h.GetSpenderAttachments, "/", "1")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var res struct {
+			Attachments []SignedAttachment `json:"attachments"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Len(t, res.Attachments, 1)
+		assert.Equal(t, int64(9), *res.Attachments[0].TransactionID)
+		assert.WithinDuration(t, time.Now().Add(ttl), res.Attachments[0].ExpiresAt, 2*time.Second)
+		return res.Attachments[0].URLs
+	}
+
+	download := func(t *testing.T, h *handler, rawURL string) *httptest.ResponseRecorder {
+		u, err := url.Parse(rawURL)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(u.Path, downloadPath))
+		return callWithID(t, h.Download, "/?"+u.RawQuery, strings.TrimPrefix(u.Path, downloadPath))
+	}
+
+	t.Run("should download from a signed URL", func(t *testing.T) {
+		signed := urls(t, 15*time.Minute)
+		db, mock := slipDB(t)
+		expectAttachment(mock)
+
+		rec := download(t, New(limits, db, store, nil).WithSigner(signurl.New(keys, time.Minute)), signed["original"])
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, TypePNG, rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, content, rec.Body.Bytes())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should download a thumbnail from its signed URL", func(t *testing.T) {
+		signed := urls(t, 15*time.Minute)
+		db, mock := slipDB(t)
+		expectAttachment(mock)
+
+		rec := download(t, New(limits, db, store, nil).WithSigner(signurl.New(keys, time.Minute)), signed["thumb"])
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, TypeJPEG, rec.Header().Get(echo.HeaderContentType))
+	})
+
+	t.Run("should refuse an expired URL", func(t *testing.T) {
+		signed := urls(t, -time.Minute)
+
+		rec := download(t, New(limits, nil, store, nil).WithSigner(signurl.New(keys, time.Minute)), signed["original"])
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), signurl.ErrExpired.Error())
+	})
+
+	t.Run("should refuse a URL signed for another size", func(t *testing.T) {
+		signed := urls(t, 15*time.Minute)
+		tampered := strings.Replace(signed["thumb"], "size=thumb", "size=original", 1)
+
+		rec := download(t, New(limits, nil, store, nil).WithSigner(signurl.New(keys, time.Minute)), tampered)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), signurl.ErrInvalid.Error())
+	})
+
+	t.Run("should refuse a URL signed with a dropped key", func(t *testing.T) {
+		signed := urls(t, 15*time.Minute)
+		rotated := []signurl.Key{{ID: "k2", Secret: []byte("fedcba9876543210fedc")}}
+
+		rec := download(t, New(limits, nil, store, nil).WithSigner(signurl.New(rotated, time.Minute)), signed["original"])
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func callWithID(t *testing.T, fn echo.HandlerFunc, target, id string) *httptest.ResponseRecorder {
+	e := echo.New()
+	defer e.Close()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+
+	assert.NoError(t, fn(c))
+	return rec
+}
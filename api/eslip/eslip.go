@@ -1,72 +1,362 @@
 package eslip
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"mime/multipart"
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/job"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/signurl"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
-func Upload(c echo.Context) error {
+// Transfer is what the bank knows about the transfer a slip refers to.
+type Transfer struct {
+	Amount float64
+	Date   time.Time
+}
+
+// Verifier looks the transfer of a slip up, e.g. with a bank slip
+// verification API, since the QR code carries neither amount nor date.
+type Verifier interface {
+	Verify(ctx context.Context, slip Slip) (Transfer, error)
+}
+
+// File is the upload result of one image. Error tells why it was refused,
+// the other files of the request are uploaded anyway.
+type File struct {
+	Filename     string     `json:"filename"`
+	Location     string     `json:"location,omitempty"`
+	ContentType  string     `json:"content_type,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	JobID        int64      `json:"job_id,omitempty"`
+	Duplicate    *Duplicate `json:"duplicate,omitempty"`
+	AttachmentID int64      `json:"attachment_id,omitempty"`
+	Slip         *Slip      `json:"slip,omitempty"`
+	SlipError    string     `json:"slip_error,omitempty"`
+	// Draft is an expense prefilled from the slip for the spender to
+	// review and create, MissingFields lists what is left to fill.
+	Draft         *transaction.Transaction `json:"draft,omitempty"`
+	MissingFields []string                 `json:"missing_fields,omitempty"`
+}
+
+// upload is an image of the request being processed.
+type upload struct {
+	filename    string
+	contentType string
+	content     []byte
+	err         error
+	dup         *Duplicate
+	slip        *Slip
+	slipErr     error
+	// hash is only set for images without a readable slip.
+	hash *uint64
+}
+
+type handler struct {
+	cfg       config.Upload
+	db        *sql.DB
+	store     storage.Storage
+	verifier  Verifier
+	signer    *signurl.Signer
+	jobs      *job.Runner
+	extractor Extractor
+	now       func() time.Time
+}
+
+// New takes a nil verifier when none is available, drafts then leave the
+// amount and date to the spender.
+func New(cfg config.Upload, db *sql.DB, store storage.Storage, verifier Verifier) *handler {
+	return &handler{cfg: cfg, db: db, store: store, verifier: verifier, now: time.Now}
+}
+
+// Upload stores e-slip images. Only PNG, JPEG, HEIC and PDF files are
+// accepted, by content whatever their name, and images are stored without
+// their metadata and scaled down to the configured size, along with their
+// thumbnails. Every file gets its own result, the request fails only if
+// none could be uploaded.
+//
+// With ?qr=true the slip QR code of every image is decoded, and ?draft=true
+// also drafts an expense.
+//
+// With ?spender_id=N the images are recorded as the spender attachments,
+// and slips the spender uploaded before are refused unless ?override=true.
+//
+// With ?async=true&spender_id=N the checked files are processed in the
+// background instead: the response is 202 with a job per file, whose
+// status and drafted expense are served by the jobs API.
+func (h handler) Upload(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	draft := c.QueryParam("draft") == "true"
+	async := c.QueryParam("async") == "true"
+	override := c.QueryParam("override") == "true"
+	var spenderID int64
+	if v := c.QueryParam("spender_id"); v != "" || draft || async {
+		var err error
+		spenderID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"message": "spender_id must be a number, it is required to draft expenses",
+			})
+		}
+	}
+	if async && h.jobs == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "asynchronous processing is not available",
+		})
+	}
+	// duplicates are found by transaction reference first, jobs decode on
+	// their own
+	decode := !async && (draft || spenderID != 0 || c.QueryParam("qr") == "true")
+
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, h.cfg.MaxRequestSize)
 	form, err := c.MultipartForm()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		return c.JSON(status, map[string]string{
 			"message": "Failed to parse form",
 			"error":   err.Error(),
 		})
 	}
-	images := form.File["images"]
-	var locations []string
-	for _, image := range images {
-		fmt.Printf("Uploading file: %+v\n", image.Filename)
-		src, err := image.Open()
+	defer form.RemoveAll()
+
+	var uploads []*upload
+	for _, fh := range form.File["images"] {
+		u := h.read(fh)
+		if u.err == nil && decode {
+			u.decode()
+		}
+		uploads = append(uploads, u)
+	}
+
+	if async {
+		return h.enqueue(c, spenderID, override, uploads)
+	}
+
+	var dups []Duplicate
+	if spenderID != 0 && !override {
+		dups, err = findDuplicates(ctx, h.db, spenderID, uploads)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				"message": "Failed to parse form",
+			logger.Error("find duplicate slips error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"message": "Failed to upload image",
 				"error":   err.Error(),
 			})
 		}
-		defer src.Close()
+	}
+
+	var locations []string
+	files := []File{}
+	for _, u := range uploads {
+		f := File{Filename: u.filename, ContentType: u.contentType, Duplicate: u.dup}
+		switch {
+		case u.err != nil:
+			f.Error = u.err.Error()
+		case u.dup != nil:
+			f.Error = duplicateMessage
+		}
+		if f.Error != "" {
+			files = append(files, f)
+			continue
+		}
 
-		// upload to AWS S3 bucket
-		loc, err := UploadToS3(c, image.Filename, src)
+		f.Location = storage.ContentKey(u.content, extensions[u.contentType])
+		err := h.store.Put(ctx, f.Location, u.content, u.contentType)
 		if err != nil {
+			logger.Error("store image error", zap.String("key", f.Location), zap.Error(err))
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"message": "Failed to upload image",
 				"error":   err.Error(),
 			})
 		}
-		locations = append(locations, loc)
+		if u.contentType == TypePNG || u.contentType == TypeJPEG {
+			// thumbnails missing are made when first requested
+			if err := makeThumbnails(ctx, h.store, f.Location, u.content); err != nil {
+				logger.Warn("make thumbnails error", zap.String("key", f.Location), zap.Error(err))
+			}
+		}
+
+		f.Slip = u.slip
+		if u.slipErr != nil {
+			f.SlipError = u.slipErr.Error()
+		}
+		if spenderID != 0 {
+			f.AttachmentID, err = createAttachment(ctx, h.db, spenderID, u, f.Location, override)
+			if err == errDuplicateSlip {
+				// another request recorded it since findDuplicates
+				if u.dup, err = refDuplicate(ctx, h.db, spenderID, u); err == nil {
+					f.Location, f.Slip, f.SlipError = "", nil, ""
+					f.Duplicate, f.Error = u.dup, duplicateMessage
+					dups = append(dups, *u.dup)
+					files = append(files, f)
+					continue
+				}
+			}
+			if err != nil {
+				logger.Error("create attachment error", zap.Error(err))
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"message": "Failed to upload image",
+					"error":   err.Error(),
+				})
+			}
+		}
+		locations = append(locations, f.Location)
+		if draft && f.Slip != nil {
+			h.draft(ctx, logger, &f, spenderID)
+		}
+		files = append(files, f)
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	res := map[string]interface{}{
 		"message":   "Image uploaded successfully",
 		"locations": strings.Join(locations, ","),
-	})
+		"files":     files,
+	}
+	if len(dups) > 0 {
+		res["duplicates"] = dups
+	}
+	switch {
+	case len(locations) > 0:
+		return c.JSON(http.StatusOK, res)
+	case len(dups) > 0:
+		res["message"] = "Slip already uploaded, retry with override=true to upload it again"
+		return c.JSON(http.StatusConflict, res)
+	default:
+		res["message"] = "No image uploaded"
+		return c.JSON(http.StatusBadRequest, res)
+	}
+}
+
+const duplicateMessage = "slip already uploaded, retry with override=true to upload it again"
+
+// read loads, checks and sanitizes a file of the request, u.err tells why
+// it is refused.
+func (h handler) read(fh *multipart.FileHeader) *upload {
+	u := &upload{filename: cleanFilename(fh.Filename)}
+	content, err := readFile(fh, h.cfg.MaxFileSize)
+	if err != nil {
+		u.err = err
+		return u
+	}
+	if u.contentType, u.err = DetectType(content); u.err != nil {
+		return u
+	}
+	u.content, u.err = Sanitize(content, u.contentType, h.cfg.MaxImageSide)
+	return u
+}
+
+func readFile(fh *multipart.FileHeader, maxSize int64) ([]byte, error) {
+	tooLarge := fmt.Errorf("file is larger than %d bytes", maxSize)
+	if fh.Size > maxSize {
+		return nil, tooLarge
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, tooLarge
+	}
+	return content, nil
 }
 
-func UploadToS3(c echo.Context, filename string, src multipart.File) (string, error) {
-	// Assume that the file is uploaded to S3 bucket successfully
-	return "location/on/s3/bucket/" + filename, nil
-	// Create an AWS session
-	// sess, err := session.NewSession(&aws.Config{
-	// 	Region: aws.String(os.Getenv("AWS_REGION")),
-	// })
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// Upload the file to S3
-	// result, err = s3.New(sess).PutObject(&s3.PutObjectInput{
-	// 	Bucket: aws.String(os.Getenv("AWS_BUCKET")),
-	// 	Key:    aws.String(filename),
-	// 	Body:   src,
-	// })
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// return result.Location, nil
+// cleanFilename keeps the base name the client sent, without control
+// characters, to be recorded with the attachment.
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	if name == "" || name == "." || name == "/" {
+		return "upload"
+	}
+	return name
+}
+
+// decode reads the slip QR code of the image, or its hash when there is
+// none. Files that cannot be decoded, e.g. PDF and HEIC, are left as they
+// are.
+func (u *upload) decode() {
+	img, _, err := image.Decode(bytes.NewReader(u.content))
+	if err != nil {
+		u.slipErr = err
+		return
+	}
+	u.slip, u.slipErr = readSlip(img)
+	if u.slip == nil {
+		hash := Hash(img)
+		u.hash = &hash
+	}
+}
+
+func readSlip(img image.Image) (*Slip, error) {
+	payload, err := DecodeQR(img)
+	if err != nil {
+		return nil, err
+	}
+	slip, err := ParseSlip(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &slip, nil
+}
+
+func (h handler) draft(ctx context.Context, logger *zap.Logger, f *File, spenderID int64) {
+	f.Draft = &transaction.Transaction{
+		TransactionType: "expense",
+		Note:            "slip " + f.Slip.TransactionRef,
+		ImageURL:        f.Location,
+		SpenderId:       spenderID,
+	}
+	f.MissingFields = []string{"category"}
+
+	if h.verifier != nil {
+		transfer, err := h.verifier.Verify(ctx, *f.Slip)
+		if err == nil {
+			f.Draft.Amount = transfer.Amount
+			f.Draft.Date = transfer.Date.Format(time.RFC3339)
+			return
+		}
+		logger.Warn("slip verification error", zap.String("transaction_ref", f.Slip.TransactionRef), zap.Error(err))
+	}
+	f.MissingFields = append(f.MissingFields, "amount", "date")
 }
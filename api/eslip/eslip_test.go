@@ -2,39 +2,33 @@ package eslip
 
 import (
 	"bytes"
-	"io"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
 )
 
-func TestUploadToS3(t *testing.T) {
-	t.Run("should able to upload image to S3 bucket", func(t *testing.T) {
-		f, _ := os.CreateTemp("", "eslip1.jpg")
-		defer f.Close()
-		defer os.Remove(f.Name())
-
-		e := echo.New()
-		defer e.Close()
-
-		req := httptest.NewRequest(http.MethodPost, "/", nil)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-
-		loc, err := UploadToS3(c, "eslip1.jpg", f)
-
-		assert.NoError(t, err)
-		assert.Equal(t, "location/on/s3/bucket/eslip1.jpg", loc)
-	})
-
-}
-
 func TestUpload(t *testing.T) {
 	t.Run("should able to upload image", func(t *testing.T) {
 		e := echo.New()
@@ -44,7 +38,7 @@ func TestUpload(t *testing.T) {
 		writer := multipart.NewWriter(body)
 		part, err := writer.CreateFormFile("images", "test.jpg")
 		assert.NoError(t, err)
-		_, err = io.Copy(part, strings.NewReader("fake image content"))
+		_, err = part.Write(gradientPNG(t))
 		assert.NoError(t, err)
 		writer.Close()
 
@@ -53,10 +47,401 @@ func TestUpload(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		Upload(c)
+		New(limits, nil, storage.NewMemory(), nil).Upload(c)
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 		assert.Contains(t, rec.Body.String(), "Image uploaded successfully")
 	})
+
+	t.Run("should store the image under its content key", func(t *testing.T) {
+		store := storage.NewMemory()
+		rec := postImage(t, New(limits, nil, store, nil), "/", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, slipKey(t), uploadedFiles(t, rec)[0].Location)
+		key := slipKey(t)
+		assert.ElementsMatch(t, []string{key, thumbnailKey(key, "thumb"), thumbnailKey(key, "preview")}, store.Keys())
+	})
+
+	t.Run("should report a storage failure", func(t *testing.T) {
+		rec := postImage(t, New(limits, nil, failingStorage{}, nil), "/", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "storage: s3 put")
+	})
+
+	t.Run("should decode the slip QR code", func(t *testing.T) {
+		rec := postImage(t, New(limits, nil, storage.NewMemory(), nil), "/?qr=true", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := uploadedFiles(t, rec)
+		assert.Equal(t, "012048104549301021", files[0].Slip.TransactionRef)
+		assert.Equal(t, "KBANK", files[0].Slip.SendingBankName)
+		assert.Nil(t, files[0].Draft)
+	})
+
+	t.Run("should report an image without a slip QR code", func(t *testing.T) {
+		rec := postContent(t, New(limits, nil, storage.NewMemory(), nil), "/?qr=true", gradientPNG(t))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := uploadedFiles(t, rec)
+		assert.Nil(t, files[0].Slip)
+		assert.Equal(t, ErrNoQR.Error(), files[0].SlipError)
+	})
+
+	t.Run("should draft an expense from the verified transfer", func(t *testing.T) {
+		verifier := fakeVerifier{transfer: Transfer{Amount: 888.88, Date: time.Date(2022, 9, 1, 16, 30, 0, 0, time.UTC)}}
+		db, mock := slipDB(t)
+		expectNewSlip(t, mock)
+		rec := postImage(t, New(limits, db, storage.NewMemory(), verifier), "/?draft=true&spender_id=1", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := uploadedFiles(t, rec)
+		assert.Equal(t, 888.88, files[0].Draft.Amount)
+		assert.Equal(t, "2022-09-01T16:30:00Z", files[0].Draft.Date)
+		assert.Equal(t, "expense", files[0].Draft.TransactionType)
+		assert.Equal(t, int64(1), files[0].Draft.SpenderId)
+		assert.Equal(t, []string{"category"}, files[0].MissingFields)
+	})
+
+	t.Run("should leave amount and date to the spender when the transfer is unknown", func(t *testing.T) {
+		verifier := fakeVerifier{err: errors.New("not found")}
+		db, mock := slipDB(t)
+		expectNewSlip(t, mock)
+		rec := postImage(t, New(limits, db, storage.NewMemory(), verifier), "/?draft=true&spender_id=1", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := uploadedFiles(t, rec)
+		assert.Equal(t, "slip 012048104549301021", files[0].Draft.Note)
+		assert.Equal(t, []string{"category", "amount", "date"}, files[0].MissingFields)
+	})
+
+	t.Run("should require the spender to draft", func(t *testing.T) {
+		rec := postImage(t, New(limits, nil, storage.NewMemory(), nil), "/?draft=true", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestUploadLimits(t *testing.T) {
+	t.Run("should upload the good files and report the bad ones", func(t *testing.T) {
+		store := storage.NewMemory()
+		rec := postFiles(t, New(limits, nil, store, nil), "/", map[string][]byte{
+			"a.png":  gradientPNG(t),
+			"b.png":  []byte("#!/bin/sh\nrm -rf /"),
+			"c.jpg":  bytes.Repeat([]byte{0xFF, 0xD8, 0xFF}, 400_000),
+			"d.heic": []byte("not a heic file"),
+		})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := map[string]File{}
+		for _, f := range filesOf(t, rec) {
+			files[f.Filename] = f
+		}
+		assert.Equal(t, TypePNG, files["a.png"].ContentType)
+		assert.Empty(t, files["a.png"].Error)
+		assert.Equal(t, ErrUnsupportedType.Error(), files["b.png"].Error)
+		assert.Equal(t, "file is larger than 1048576 bytes", files["c.jpg"].Error)
+		assert.Equal(t, ErrUnsupportedType.Error(), files["d.heic"].Error)
+		// a.png and its thumbnails
+		assert.Len(t, store.Keys(), 3)
+	})
+
+	t.Run("should refuse a request without any good file", func(t *testing.T) {
+		rec := postFiles(t, New(limits, nil, storage.NewMemory(), nil), "/", map[string][]byte{
+			"a.exe": []byte("MZ"),
+		})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, ErrUnsupportedType.Error(), filesOf(t, rec)[0].Error)
+	})
+
+	t.Run("should refuse a request over the size limit", func(t *testing.T) {
+		small := config.Upload{MaxFileSize: 1 << 20, MaxRequestSize: 1 << 10, MaxImageSide: 1024}
+		rec := postFiles(t, New(small, nil, storage.NewMemory(), nil), "/", map[string][]byte{
+			"a.png": bytes.Repeat([]byte{0}, 4<<10),
+		})
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("should store a clean file name and extension from the content", func(t *testing.T) {
+		store := storage.NewMemory()
+		rec := postFiles(t, New(limits, nil, store, nil), "/", map[string][]byte{
+			"../../etc/ slip.exe ": gradientPNG(t),
+		})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := filesOf(t, rec)
+		assert.Equal(t, "slip.exe", files[0].Filename)
+		assert.True(t, strings.HasSuffix(files[0].Location, ".png"))
+	})
+}
+
+func TestUploadDuplicate(t *testing.T) {
+	created := "2024-05-20T10:00:00Z"
+
+	t.Run("should refuse a slip with a known transaction reference", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(getByRefStmt).WithArgs(int64(1), "012048104549301021").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "filename", "location", "transaction_ref", "created_at", "transaction_id"}).
+				AddRow(3, 1, "slip.png", "location/on/s3/bucket/slip.png", "012048104549301021", created, 9))
+
+		rec := postImage(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		var res struct {
+			Duplicates []Duplicate `json:"duplicates"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, matchedByRef, res.Duplicates[0].MatchedBy)
+		assert.Equal(t, int64(3), res.Duplicates[0].Attachment.ID)
+		assert.Equal(t, int64(9), *res.Duplicates[0].Attachment.TransactionID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should refuse a similar image without QR code", func(t *testing.T) {
+		content := gradientPNG(t)
+		img, _ := png.Decode(bytes.NewReader(content))
+
+		db, mock := slipDB(t)
+		mock.ExpectQuery(hashesStmt).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "image_hash"}).AddRow(2, 0).AddRow(4, int64(Hash(img)^1)))
+		mock.ExpectQuery(getAttachmentStmt).WithArgs(int64(4)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "filename", "location", "transaction_ref", "created_at", "transaction_id"}).
+				AddRow(4, 1, "receipt.png", "location/on/s3/bucket/receipt.png", "", created, nil))
+
+		rec := postContent(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", content)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"matched_by":"image_hash"`)
+		assert.NotContains(t, rec.Body.String(), "transaction_id")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not take another slip of the same bank for a duplicate", func(t *testing.T) {
+		f, err := os.Open("../../e-slip1.png")
+		assert.NoError(t, err)
+		defer f.Close()
+		slip, err := png.Decode(f)
+		assert.NoError(t, err)
+		content := otherSlipPNG(t)
+		other, _ := png.Decode(bytes.NewReader(content))
+		// the layout is the same, the hash cannot tell them apart
+		assert.True(t, SameImage(Hash(slip), Hash(other)))
+
+		db, mock := slipDB(t)
+		// e-slip1.png has a transaction reference, it is left out
+		mock.ExpectQuery(hashesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id", "image_hash"}))
+		mock.ExpectQuery(cAttachmentStmt).WithArgs(int64(1), "e-slip.png", sqlmock.AnyArg(), "", int64(Hash(other))).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+		rec := postContent(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", content)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should refuse a slip another request recorded meanwhile", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(getByRefStmt).WithArgs(int64(1), "012048104549301021").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(cAttachmentStmt).WithArgs(int64(1), "e-slip.png", slipKey(t), "012048104549301021", nil).
+			WillReturnError(&pq.Error{Code: "23505", Constraint: refIndex})
+		mock.ExpectQuery(getByRefStmt).WithArgs(int64(1), "012048104549301021").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "filename", "location", "transaction_ref", "created_at", "transaction_id"}).
+				AddRow(3, 1, "slip.png", "location/on/s3/bucket/slip.png", "012048104549301021", created, nil))
+
+		rec := postImage(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		files := uploadedFiles(t, rec)
+		assert.Equal(t, int64(3), files[0].Duplicate.Attachment.ID)
+		assert.Empty(t, files[0].Location)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should upload a slip sent twice in a request once", func(t *testing.T) {
+		content, err := os.ReadFile("../../e-slip1.png")
+		assert.NoError(t, err)
+
+		db, mock := slipDB(t)
+		mock.ExpectQuery(getByRefStmt).WithArgs(int64(1), "012048104549301021").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(cAttachmentStmt).WithArgs(int64(1), sqlmock.AnyArg(), slipKey(t), "012048104549301021", nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+		rec := postFiles(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", map[string][]byte{
+			"a.png": content,
+			"b.png": content,
+		})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := filesOf(t, rec)
+		assert.Len(t, files, 2)
+		first, second := files[0], files[1]
+		assert.Equal(t, int64(5), first.AttachmentID)
+		assert.Equal(t, "same slip as "+first.Filename+" in this request", second.Error)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should upload a duplicate again with override", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(overrideStmt).WithArgs(int64(1), "e-slip.png", slipKey(t), "012048104549301021", nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+		rec := postImage(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1&override=true", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int64(5), uploadedFiles(t, rec)[0].AttachmentID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func slipDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db, mock
+}
+
+var limits = config.Upload{MaxFileSize: 1 << 20, MaxRequestSize: 2 << 20, MaxImageSide: 1024}
+
+// slipKey is where e-slip1.png is stored, once stripped of its metadata.
+func slipKey(t *testing.T) string {
+	content, err := os.ReadFile("../../e-slip1.png")
+	assert.NoError(t, err)
+	content, err = stripPNG(content)
+	assert.NoError(t, err)
+	return storage.ContentKey(content, ".png")
+}
+
+// expectNewSlip expects e-slip1.png to be recorded as a new attachment.
+func expectNewSlip(t *testing.T, mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(getByRefStmt).WithArgs(int64(1), "012048104549301021").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(cAttachmentStmt).WithArgs(int64(1), "e-slip.png", slipKey(t), "012048104549301021", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
+func gradientPNG(t *testing.T) []byte {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*x + y*3) % 256)})
+		}
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, img))
+	return buf.Bytes()
+}
+
+// otherSlipPNG is e-slip1.png made another transfer of the same bank: its
+// date, reference and amount are written over and its QR code is blanked.
+func otherSlipPNG(t *testing.T) []byte {
+	f, err := os.Open("../../e-slip1.png")
+	assert.NoError(t, err)
+	defer f.Close()
+	slip, err := png.Decode(f)
+	assert.NoError(t, err)
+
+	img := image.NewRGBA(slip.Bounds())
+	draw.Draw(img, img.Bounds(), slip, image.Point{}, draw.Src)
+	texts := []struct {
+		box  image.Rectangle
+		text string
+	}{
+		{image.Rect(20, 30, 180, 55), "15 Mar 24 9:05 AM"},
+		{image.Rect(60, 262, 228, 280), "015075091234567890"},
+		{image.Rect(130, 298, 225, 315), "12,450.00"},
+		{image.Rect(130, 343, 225, 360), "12,450.00"},
+		{image.Rect(232, 288, 326, 374), ""},
+	}
+	d := font.Drawer{Dst: img, Src: image.Black, Face: basicfont.Face7x13}
+	for _, tt := range texts {
+		draw.Draw(img, tt.box, image.White, image.Point{}, draw.Src)
+		d.Dot = fixed.P(tt.box.Min.X+5, tt.box.Max.Y-4)
+		d.DrawString(tt.text)
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, img))
+	return buf.Bytes()
+}
+
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	return errors.New("storage: s3 put " + key + ": 503 Service Unavailable")
+}
+
+type fakeVerifier struct {
+	transfer Transfer
+	err      error
+}
+
+func (v fakeVerifier) Verify(ctx context.Context, slip Slip) (Transfer, error) {
+	return v.transfer, v.err
+}
+
+func postImage(t *testing.T, h *handler, target string, path string) *httptest.ResponseRecorder {
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return postContent(t, h, target, content)
+}
+
+func postContent(t *testing.T, h *handler, target string, content []byte) *httptest.ResponseRecorder {
+	e := echo.New()
+	defer e.Close()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("images", "e-slip.png")
+	assert.NoError(t, err)
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	assert.NoError(t, h.Upload(c))
+	return rec
+}
+
+func postFiles(t *testing.T, h *handler, target string, files map[string][]byte) *httptest.ResponseRecorder {
+	e := echo.New()
+	defer e.Close()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("images", name)
+		assert.NoError(t, err)
+		part.Write(content)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	assert.NoError(t, h.Upload(c))
+	return rec
+}
+
+func filesOf(t *testing.T, rec *httptest.ResponseRecorder) []File {
+	var res struct {
+		Files []File `json:"files"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return res.Files
+}
+
+func uploadedFiles(t *testing.T, rec *httptest.ResponseRecorder) []File {
+	files := filesOf(t, rec)
+	assert.Len(t, files, 1)
+	return files
 }
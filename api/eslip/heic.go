@@ -0,0 +1,229 @@
+package eslip
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errInvalidHEIC = errors.New("invalid HEIC")
+
+// box is an ISO base media file format box, data excludes its header.
+type box struct {
+	typ  string
+	data []byte
+	// offset of data in the file
+	offset int
+}
+
+func readBoxes(content []byte, offset int) ([]box, error) {
+	var boxes []box
+	for i := 0; i < len(content); {
+		if i+8 > len(content) {
+			return nil, errInvalidHEIC
+		}
+		size := uint64(binary.BigEndian.Uint32(content[i:]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(content) - i)
+		case 1:
+			if i+16 > len(content) {
+				return nil, errInvalidHEIC
+			}
+			size = binary.BigEndian.Uint64(content[i+8:])
+			header = 16
+		}
+		// compared before adding to i, a 64 bit size would overflow it
+		if size < header || size > uint64(len(content)-i) {
+			return nil, errInvalidHEIC
+		}
+		boxes = append(boxes, box{
+			typ:    string(content[i+4 : i+8]),
+			data:   content[i+int(header) : i+int(size)],
+			offset: offset + i + int(header),
+		})
+		i += int(size)
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// blankHEICExif zeroes the Exif items of a HEIC file, GPS position included.
+// The file keeps its layout so no offset has to be rewritten.
+func blankHEICExif(content []byte) ([]byte, error) {
+	boxes, err := readBoxes(content, 0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := findBox(boxes, "meta")
+	if !ok || len(meta.data) < 4 {
+		return nil, errInvalidHEIC
+	}
+	// meta is a full box, its children follow version and flags
+	children, err := readBoxes(meta.data[4:], meta.offset+4)
+	if err != nil {
+		return nil, err
+	}
+
+	iinf, ok := findBox(children, "iinf")
+	if !ok {
+		return content, nil
+	}
+	exif, err := exifItems(iinf)
+	if err != nil || len(exif) == 0 {
+		return content, err
+	}
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return nil, errInvalidHEIC
+	}
+	// items of construction method 1 are stored in idat, not mdat
+	idat, hasIdat := findBox(children, "idat")
+	idatOffset := -1
+	if hasIdat {
+		idatOffset = idat.offset
+	}
+	extents, err := itemExtents(iloc, exif, idatOffset, len(idat.data))
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(nil), content...)
+	for _, e := range extents {
+		if e[0] < 0 || e[1] < 0 || e[0] > len(out) || e[1] > len(out)-e[0] {
+			return nil, errInvalidHEIC
+		}
+		clear(out[e[0] : e[0]+e[1]])
+	}
+	return out, nil
+}
+
+// exifItems returns the ids of the Exif items listed in an iinf box.
+func exifItems(iinf box) (map[uint32]bool, error) {
+	d := iinf.data
+	if len(d) < 6 {
+		return nil, errInvalidHEIC
+	}
+	skip := 6
+	if d[0] > 0 {
+		skip = 8
+	}
+	entries, err := readBoxes(d[skip:], iinf.offset+skip)
+	if err != nil {
+		return nil, err
+	}
+
+	items := map[uint32]bool{}
+	for _, infe := range entries {
+		e := infe.data
+		// versions before 2 carry no item type
+		if infe.typ != "infe" || len(e) < 4 || e[0] < 2 {
+			continue
+		}
+		var id uint32
+		var typ []byte
+		if e[0] == 2 && len(e) >= 12 {
+			id, typ = uint32(binary.BigEndian.Uint16(e[4:])), e[8:12]
+		} else if e[0] == 3 && len(e) >= 14 {
+			id, typ = binary.BigEndian.Uint32(e[4:]), e[10:14]
+		}
+		if string(typ) == "Exif" {
+			items[id] = true
+		}
+	}
+	return items, nil
+}
+
+// itemExtents returns the file offset and length of every extent of items
+// as listed in an iloc box. Extents in the idat box, at idatOffset of the
+// file and of idatSize bytes, are offset from it; idatOffset is -1 when
+// there is none. Items stored any other way are refused, their bytes could
+// not be blanked.
+func itemExtents(iloc box, items map[uint32]bool, idatOffset, idatSize int) ([][2]int, error) {
+	d := iloc.data
+	if len(d) < 8 {
+		return nil, errInvalidHEIC
+	}
+	version := d[0]
+	offsetSize, lengthSize := int(d[4]>>4), int(d[4]&0xF)
+	baseOffsetSize, indexSize := int(d[5]>>4), int(d[5]&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	r := reader{d: d, i: 6}
+	var count uint64
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+
+	var extents [][2]int
+	for n := uint64(0); n < count && r.err == nil; n++ {
+		var id uint64
+		if version < 2 {
+			id = r.uint(2)
+		} else {
+			id = r.uint(4)
+		}
+		method := uint64(0)
+		if version > 0 {
+			method = r.uint(2) & 0xF
+		}
+		r.uint(2) // data reference index
+		base := r.uint(baseOffsetSize)
+		extentCount := r.uint(2)
+		for k := uint64(0); k < extentCount && r.err == nil; k++ {
+			r.uint(indexSize)
+			offset, length := r.uint(offsetSize), r.uint(lengthSize)
+			if !items[uint32(id)] {
+				continue
+			}
+			switch method {
+			case 0:
+				extents = append(extents, [2]int{int(base + offset), int(length)})
+			case 1:
+				start := base + offset
+				if idatOffset < 0 || start > uint64(idatSize) || length > uint64(idatSize)-start {
+					return nil, errInvalidHEIC
+				}
+				extents = append(extents, [2]int{idatOffset + int(start), int(length)})
+			default:
+				return nil, errInvalidHEIC
+			}
+		}
+	}
+	return extents, r.err
+}
+
+type reader struct {
+	d   []byte
+	i   int
+	err error
+}
+
+// uint reads a big endian unsigned integer of size bytes.
+func (r *reader) uint(size int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.i+size > len(r.d) {
+		r.err = errInvalidHEIC
+		return 0
+	}
+	var v uint64
+	for _, b := range r.d[r.i : r.i+size] {
+		v = v<<8 | uint64(b)
+	}
+	r.i += size
+	return v
+}
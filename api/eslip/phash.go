@@ -0,0 +1,44 @@
+package eslip
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+
+	"golang.org/x/image/draw"
+)
+
+// maxHashDistance is how many of the 64 bits two hashes may differ by and
+// still be the same slip, e.g. once re-compressed by a chat app. Halving
+// e-slip1.png and saving it as JPEG moves up to 7 bits, while another slip
+// of the same bank hashes the same: the hash only tells layouts apart, so it
+// stands in for the transaction reference only when that cannot be read.
+const maxHashDistance = 6
+
+// Hash is the difference hash of img: it shrinks the image to 9x8 gray
+// pixels and sets a bit for every pixel brighter than its right neighbour,
+// so it survives resizing and compression but not a different slip.
+func Hash(img image.Image) uint64 {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if gray(small, x, y) > gray(small, x+1, y) {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// SameImage tells whether two hashes are close enough to be the same image.
+func SameImage(a, b uint64) bool {
+	return bits.OnesCount64(a^b) <= maxHashDistance
+}
+
+func gray(img *image.Gray, x, y int) uint8 {
+	return img.At(x, y).(color.Gray).Y
+}
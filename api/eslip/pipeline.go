@@ -0,0 +1,287 @@
+package eslip
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/job"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rule"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// KindReceipt is the kind of the jobs processing uploaded receipts.
+const KindReceipt = "receipt"
+
+// categoryStmt finds the category the spender uses most for a vendor, $2
+// is a pattern made with likePrefix.
+const categoryStmt = `SELECT category FROM transaction WHERE spender_id = $1 AND transaction_type = 'expense' AND note ILIKE $2 GROUP BY category ORDER BY COUNT(*) DESC, MAX(id) DESC LIMIT 1;`
+
+// Extraction is what an Extractor read from a receipt, fields it could not
+// read are left empty.
+type Extraction struct {
+	Vendor   string  `json:"vendor,omitempty"`
+	Amount   float64 `json:"amount,omitempty"`
+	Date     string  `json:"date,omitempty"`
+	Category string  `json:"category,omitempty"`
+	// Tags come from the spender rule the expense meets, if any.
+	Tags []string `json:"tags,omitempty"`
+	Slip *Slip    `json:"slip,omitempty"`
+	// VerifyError tells why the slip transfer could not be looked up.
+	VerifyError string `json:"verify_error,omitempty"`
+}
+
+// Extractor reads a receipt, e.g. with OCR. Errors that reading again
+// would not fix should be wrapped with job.Permanent.
+type Extractor interface {
+	Extract(ctx context.Context, content []byte, contentType string) (Extraction, error)
+}
+
+// SlipExtractor reads the QR code of bank slips, and looks the amount and
+// date up with Verifier when there is one. Other receipts, and those it
+// cannot decode such as HEIC and PDF, get an empty extraction so they are
+// still stored and drafted.
+type SlipExtractor struct {
+	Verifier Verifier
+}
+
+func (x SlipExtractor) Extract(ctx context.Context, content []byte, contentType string) (Extraction, error) {
+	if contentType != TypePNG && contentType != TypeJPEG {
+		return Extraction{}, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return Extraction{}, job.Permanent(fmt.Errorf("cannot read %s: %w", contentType, err))
+	}
+	slip, err := readSlip(img)
+	if err != nil {
+		return Extraction{}, nil
+	}
+
+	ext := Extraction{Slip: slip}
+	if x.Verifier != nil {
+		transfer, err := x.Verifier.Verify(ctx, *slip)
+		if err != nil {
+			ext.VerifyError = err.Error()
+			return ext, nil
+		}
+		ext.Amount = transfer.Amount
+		ext.Date = transfer.Date.Format(time.RFC3339)
+	}
+	return ext, nil
+}
+
+// Receipt is the result of a receipt job. The job does not create the
+// expense: the draft is kept with the job result until the spender reviews
+// it, fills the MissingFields and creates it with POST /transactions.
+type Receipt struct {
+	Filename     string     `json:"filename"`
+	Location     string     `json:"location"`
+	AttachmentID int64      `json:"attachment_id"`
+	Extraction   Extraction `json:"extraction"`
+	// Draft is the body of the expense to create, MissingFields lists what
+	// is left to fill.
+	Draft         *transaction.Transaction `json:"draft"`
+	MissingFields []string                 `json:"missing_fields,omitempty"`
+}
+
+// WithJobs makes ?async=true uploads run in the background on runner,
+// reading receipts with extractor.
+func (h *handler) WithJobs(runner *job.Runner, extractor Extractor) *handler {
+	h.jobs = runner
+	h.extractor = extractor
+	return h
+}
+
+// enqueue queues a receipt job for every upload that passed the checks,
+// the files are stored by the jobs.
+func (h handler) enqueue(c echo.Context, spenderID int64, override bool, uploads []*upload) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	files := []File{}
+	var queued int
+	for _, u := range uploads {
+		f := File{Filename: u.filename, ContentType: u.contentType}
+		if u.err != nil {
+			f.Error = u.err.Error()
+			files = append(files, f)
+			continue
+		}
+
+		r := &receiptJob{h: h, logger: logger, spenderID: spenderID, override: override, u: u}
+		id, err := h.jobs.Enqueue(ctx, KindReceipt, r.run)
+		if err != nil {
+			logger.Error("enqueue receipt job error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"message": "Failed to upload image",
+				"error":   err.Error(),
+			})
+		}
+		f.JobID = id
+		files = append(files, f)
+		queued++
+	}
+
+	res := map[string]interface{}{
+		"message": "Images queued for processing",
+		"files":   files,
+	}
+	if queued == 0 {
+		res["message"] = "No image uploaded"
+		return c.JSON(http.StatusBadRequest, res)
+	}
+	return c.JSON(http.StatusAccepted, res)
+}
+
+// receiptJob stores, extracts, categorizes and drafts an expense from an
+// upload, the draft is its result and is not saved as a transaction. It
+// remembers the steps done so a retry goes on from the failed one.
+type receiptJob struct {
+	h         handler
+	logger    *zap.Logger
+	spenderID int64
+	override  bool
+	u         *upload
+	res       Receipt
+}
+
+func (r *receiptJob) run(ctx context.Context, step func(name string)) (interface{}, error) {
+	u := r.u
+	r.res.Filename = u.filename
+
+	if r.res.Location == "" {
+		step("store")
+		loc := storage.ContentKey(u.content, extensions[u.contentType])
+		if err := r.h.store.Put(ctx, loc, u.content, u.contentType); err != nil {
+			return nil, err
+		}
+		if u.contentType == TypePNG || u.contentType == TypeJPEG {
+			if err := makeThumbnails(ctx, r.h.store, loc, u.content); err != nil {
+				r.logger.Warn("make thumbnails error", zap.String("key", loc), zap.Error(err))
+			}
+		}
+		r.res.Location = loc
+	}
+
+	if r.res.AttachmentID == 0 {
+		step("extract")
+		ext, err := r.h.extractor.Extract(ctx, u.content, u.contentType)
+		if err != nil {
+			return nil, err
+		}
+		r.res.Extraction = ext
+		u.slip = ext.Slip
+		if u.slip == nil {
+			if img, _, err := image.Decode(bytes.NewReader(u.content)); err == nil {
+				hash := Hash(img)
+				u.hash = &hash
+			}
+		}
+
+		if !r.override {
+			dups, err := findDuplicates(ctx, r.h.db, r.spenderID, []*upload{u})
+			if err != nil {
+				return nil, err
+			}
+			if len(dups) > 0 {
+				return nil, job.Permanent(fmt.Errorf("slip already uploaded as attachment %d, upload it with override=true to process it again", dups[0].Attachment.ID))
+			}
+		}
+		r.res.AttachmentID, err = createAttachment(ctx, r.h.db, r.spenderID, u, r.res.Location, r.override)
+		if err == errDuplicateSlip {
+			dup, err := refDuplicate(ctx, r.h.db, r.spenderID, u)
+			if err != nil {
+				return nil, err
+			}
+			return nil, job.Permanent(fmt.Errorf("slip already uploaded as attachment %d, upload it with override=true to process it again", dup.Attachment.ID))
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	step("categorize")
+	ext := &r.res.Extraction
+	if err := categorize(ctx, r.h.db, r.spenderID, ext); err != nil {
+		return nil, err
+	}
+
+	step("draft")
+	r.res.Draft, r.res.MissingFields = draftFrom(*ext, r.res.Location, r.spenderID)
+	return r.res, nil
+}
+
+// categorize tags an expense read from a receipt with the first spender
+// rule it meets. When the receipt gave no category it takes the one of the
+// rule or else, going by its vendor, the category the spender uses most.
+func categorize(ctx context.Context, db *sql.DB, spenderID int64, ext *Extraction) error {
+	r, ok, err := rule.Match(ctx, db, spenderID, ext.Vendor, ext.Amount, category.TypeExpense)
+	if err != nil {
+		return err
+	}
+	if ok {
+		ext.Tags = rule.MergeTags(ext.Tags, r.Tags)
+	}
+	if ext.Category != "" {
+		return nil
+	}
+	if ok && r.Category != "" {
+		ext.Category = r.Category
+		return nil
+	}
+	if ext.Vendor == "" {
+		return nil
+	}
+	err = db.QueryRowContext(ctx, categoryStmt, spenderID, likePrefix(ext.Vendor)).Scan(&ext.Category)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, whose escape
+// character is the backslash by default.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likePrefix returns a LIKE pattern matching the text starting with s.
+func likePrefix(s string) string {
+	return likeEscaper.Replace(s) + "%"
+}
+
+func draftFrom(ext Extraction, location string, spenderID int64) (*transaction.Transaction, []string) {
+	t := &transaction.Transaction{
+		Date:            ext.Date,
+		Amount:          ext.Amount,
+		Category:        ext.Category,
+		TransactionType: "expense",
+		Note:            ext.Vendor,
+		ImageURL:        location,
+		SpenderId:       spenderID,
+		Tags:            ext.Tags,
+	}
+	if t.Note == "" && ext.Slip != nil {
+		t.Note = "slip " + ext.Slip.TransactionRef
+	}
+
+	var missing []string
+	if t.Category == "" {
+		missing = append(missing, "category")
+	}
+	if t.Amount == 0 {
+		missing = append(missing, "amount")
+	}
+	if t.Date == "" {
+		missing = append(missing, "date")
+	}
+	return t, missing
+}
@@ -0,0 +1,229 @@
+package eslip
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/job"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const (
+	stepStmt   = `UPDATE job SET status='running', step=$1, updated_at=NOW() WHERE id=$2;`
+	finishStmt = `UPDATE job SET status=$1, attempts=attempts+1, result=$2, error=$3, updated_at=NOW() WHERE id=$4;`
+	rulesStmt  = `SELECT r.id, r.spender_id, r.priority, r.note_contains, r.note_regex, r.min_amount, r.max_amount, r.transaction_type,
+	COALESCE(r.category_id, 0), COALESCE(c.name, ''), r.tags FROM category_rule r LEFT JOIN category c ON c.id = r.category_id WHERE r.spender_id = $1 ORDER BY r.priority, r.id;`
+)
+
+var ruleColumns = []string{"id", "spender_id", "priority", "note_contains", "note_regex", "min_amount", "max_amount", "transaction_type", "category_id", "category", "tags"}
+
+func TestUploadAsync(t *testing.T) {
+	extractor := fakeExtractor{ext: Extraction{Vendor: "Cafe Amazon", Amount: 65, Date: "2024-05-20T08:00:00Z"}}
+
+	t.Run("should queue a job that drafts an expense", func(t *testing.T) {
+		db, mock := slipDB(t)
+		runner := job.NewRunner(db, config.Jobs{Workers: 1, MaxAttempts: 1}, zap.NewNop())
+		store := storage.NewMemory()
+		var result capture
+
+		mock.ExpectQuery(`INSERT INTO job (kind) VALUES ($1) RETURNING id;`).WithArgs(KindReceipt).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		expectStep(mock, "store")
+		expectStep(mock, "extract")
+		mock.ExpectQuery(hashesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id", "image_hash"}))
+		mock.ExpectQuery(cAttachmentStmt).WithArgs(int64(1), "e-slip.png", sqlmock.AnyArg(), "", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		expectStep(mock, "categorize")
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(1), "Cafe Amazon%").
+			WillReturnRows(sqlmock.NewRows([]string{"category"}).AddRow("coffee"))
+		expectStep(mock, "draft")
+		mock.ExpectExec(finishStmt).WithArgs(job.StatusSucceeded, &result, "", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		h := New(limits, db, store, nil).WithJobs(runner, extractor)
+		rec := postContent(t, h, "/?async=true&spender_id=1", gradientPNG(t))
+		runner.Wait()
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, int64(7), uploadedFiles(t, rec)[0].JobID)
+		var receipt Receipt
+		assert.NoError(t, json.Unmarshal([]byte(result.value), &receipt))
+		assert.Equal(t, int64(3), receipt.AttachmentID)
+		assert.Equal(t, "coffee", receipt.Draft.Category)
+		assert.Equal(t, 65.0, receipt.Draft.Amount)
+		assert.Equal(t, "Cafe Amazon", receipt.Draft.Note)
+		assert.Empty(t, receipt.MissingFields)
+		assert.Contains(t, store.Keys(), receipt.Location)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should require the spender", func(t *testing.T) {
+		runner := job.NewRunner(nil, config.Jobs{}, zap.NewNop())
+		h := New(limits, nil, storage.NewMemory(), nil).WithJobs(runner, extractor)
+
+		rec := postContent(t, h, "/?async=true", gradientPNG(t))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should not queue refused files", func(t *testing.T) {
+		runner := job.NewRunner(nil, config.Jobs{}, zap.NewNop())
+		h := New(limits, nil, storage.NewMemory(), nil).WithJobs(runner, extractor)
+
+		rec := postContent(t, h, "/?async=true&spender_id=1", []byte("GIF89a"))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, ErrUnsupportedType.Error(), uploadedFiles(t, rec)[0].Error)
+	})
+}
+
+func TestCategorize(t *testing.T) {
+	t.Run("should match the vendor literally", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(1), `100\% Pure\_Juice \\ Co%`).
+			WillReturnRows(sqlmock.NewRows([]string{"category"}).AddRow("drinks"))
+
+		ext := &Extraction{Vendor: `100% Pure_Juice \ Co`}
+		err := categorize(context.Background(), db, 1, ext)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "drinks", ext.Category)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should add the rule tags to a receipt with a category", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns).
+			AddRow(4, 1, 0, "amazon", "", nil, nil, "expense", 19, "Coffee", "{coffee,work}"))
+
+		ext := &Extraction{Vendor: "Cafe Amazon", Category: "food", Tags: []string{"work"}}
+		err := categorize(context.Background(), db, 1, ext)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "food", ext.Category)
+		assert.Equal(t, []string{"work", "coffee"}, ext.Tags)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestReceiptJob(t *testing.T) {
+	noStep := func(string) {}
+
+	t.Run("should go on from the failed step when run again", func(t *testing.T) {
+		db, mock := slipDB(t)
+		store := storage.NewMemory()
+		extractor := &flakyExtractor{ext: Extraction{Category: "food", Amount: 120}}
+		u := &upload{filename: "receipt.png", contentType: TypePNG, content: gradientPNG(t)}
+		r := &receiptJob{h: handler{db: db, store: store, extractor: extractor}, logger: zap.NewNop(), spenderID: 1, override: true, u: u}
+
+		_, err := r.run(context.Background(), noStep)
+		assert.Error(t, err)
+
+		mock.ExpectQuery(overrideStmt).WithArgs(int64(1), "receipt.png", sqlmock.AnyArg(), "", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		var steps []string
+		res, err := r.run(context.Background(), func(name string) { steps = append(steps, name) })
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"extract", "categorize", "draft"}, steps)
+		assert.Equal(t, []string{"date"}, res.(Receipt).MissingFields)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should fail for good on a slip uploaded before", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(getByRefStmt).WithArgs(int64(1), "012048104549301021").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "filename", "location", "transaction_ref", "created_at", "transaction_id"}).
+				AddRow(3, 1, "slip.png", "ab/abcd.png", "012048104549301021", "2024-05-20T10:00:00Z", nil))
+		slip := &Slip{TransactionRef: "012048104549301021"}
+		u := &upload{filename: "slip.png", contentType: TypePNG, content: gradientPNG(t)}
+		r := &receiptJob{h: handler{db: db, store: storage.NewMemory(), extractor: fakeExtractor{ext: Extraction{Slip: slip}}}, logger: zap.NewNop(), spenderID: 1, u: u}
+
+		_, err := r.run(context.Background(), noStep)
+
+		assert.ErrorContains(t, err, "slip already uploaded as attachment 3")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should read the slip QR code by default", func(t *testing.T) {
+		content, err := os.ReadFile("../../e-slip1.png")
+		assert.NoError(t, err)
+		verifier := fakeVerifier{err: errors.New("not found")}
+
+		ext, err := SlipExtractor{Verifier: verifier}.Extract(context.Background(), content, TypePNG)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "012048104549301021", ext.Slip.TransactionRef)
+		assert.Equal(t, "not found", ext.VerifyError)
+	})
+
+	t.Run("should leave a receipt without QR code for the draft to list what is missing", func(t *testing.T) {
+		ext, err := SlipExtractor{}.Extract(context.Background(), gradientPNG(t), TypePNG)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Extraction{}, ext)
+	})
+
+	t.Run("should leave receipts it cannot decode", func(t *testing.T) {
+		ext, err := SlipExtractor{}.Extract(context.Background(), []byte("%PDF-1.7\n"), TypePDF)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Extraction{}, ext)
+	})
+
+	t.Run("should not retry a corrupt image", func(t *testing.T) {
+		_, err := SlipExtractor{}.Extract(context.Background(), []byte("\x89PNG\r\n\x1a\n"), TypePNG)
+
+		assert.ErrorContains(t, err, "cannot read image/png")
+	})
+}
+
+func expectStep(mock sqlmock.Sqlmock, name string) {
+	mock.ExpectExec(stepStmt).WithArgs(name, int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// capture matches any argument and keeps it.
+type capture struct {
+	value string
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	s, _ := v.(string)
+	c.value = s
+	return true
+}
+
+type fakeExtractor struct {
+	ext Extraction
+	err error
+}
+
+func (x fakeExtractor) Extract(ctx context.Context, content []byte, contentType string) (Extraction, error) {
+	return x.ext, x.err
+}
+
+// flakyExtractor fails the first time.
+type flakyExtractor struct {
+	ext   Extraction
+	calls int
+}
+
+func (x *flakyExtractor) Extract(ctx context.Context, content []byte, contentType string) (Extraction, error) {
+	x.calls++
+	if x.calls == 1 {
+		return Extraction{}, sql.ErrConnDone
+	}
+	return x.ext, nil
+}
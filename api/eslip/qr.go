@@ -0,0 +1,50 @@
+package eslip
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	xdraw "golang.org/x/image/draw"
+)
+
+// maxScanScale and maxScanSide bound how far a slip is upscaled while
+// looking for its QR code.
+const (
+	maxScanScale = 5
+	maxScanSide  = 2400
+)
+
+var ErrNoQR = errors.New("no QR code found")
+
+// DecodeQR returns the text of the QR code in img. Slip QR codes are small
+// and antialiased, so the image is upscaled until the code can be read.
+func DecodeQR(img image.Image) (string, error) {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() > side {
+		side = b.Dy()
+	}
+
+	reader := qrcode.NewQRCodeReader()
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	for scale := 1; scale == 1 || scale <= maxScanScale && side*scale <= maxScanSide; scale++ {
+		scaled := image.NewRGBA(image.Rect(0, 0, b.Dx()*scale, b.Dy()*scale))
+		if scale == 1 {
+			draw.Draw(scaled, scaled.Bounds(), img, b.Min, draw.Src)
+		} else {
+			xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, b, xdraw.Src, nil)
+		}
+
+		bmp, err := gozxing.NewBinaryBitmapFromImage(scaled)
+		if err != nil {
+			return "", err
+		}
+		if res, err := reader.Decode(bmp, hints); err == nil {
+			return res.GetText(), nil
+		}
+	}
+	return "", ErrNoQR
+}
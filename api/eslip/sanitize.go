@@ -0,0 +1,285 @@
+package eslip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// Types of the files accepted for upload.
+const (
+	TypePNG  = "image/png"
+	TypeJPEG = "image/jpeg"
+	TypeHEIC = "image/heic"
+	TypePDF  = "application/pdf"
+)
+
+var extensions = map[string]string{
+	TypePNG:  ".png",
+	TypeJPEG: ".jpg",
+	TypeHEIC: ".heic",
+	TypePDF:  ".pdf",
+}
+
+// maxPixels refuses images that would take too much memory to decode.
+const maxPixels = 50_000_000
+
+var (
+	ErrUnsupportedType = errors.New("unsupported file type, only PNG, JPEG, HEIC and PDF are accepted")
+	ErrTooManyPixels   = errors.New("image has too many pixels")
+)
+
+// DetectType tells the type of content from its first bytes, whatever the
+// file name says.
+func DetectType(content []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1a\n")):
+		return TypePNG, nil
+	case bytes.HasPrefix(content, []byte{0xFF, 0xD8, 0xFF}):
+		return TypeJPEG, nil
+	case bytes.HasPrefix(content, []byte("%PDF-")):
+		return TypePDF, nil
+	case isHEIC(content):
+		return TypeHEIC, nil
+	}
+	return "", ErrUnsupportedType
+}
+
+func isHEIC(content []byte) bool {
+	if len(content) < 12 || string(content[4:8]) != "ftyp" {
+		return false
+	}
+	switch string(content[8:12]) {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+		return true
+	}
+	return false
+}
+
+// Sanitize removes the metadata of images, GPS position included, and
+// shrinks them to fit maxSide. Images are only re-encoded when they must be
+// resized or rotated, otherwise the metadata is cut out losslessly. HEIC
+// cannot be decoded here, so its Exif is blanked out but its size is kept.
+func Sanitize(content []byte, contentType string, maxSide int) ([]byte, error) {
+	switch contentType {
+	case TypeJPEG:
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		orientation := jpegOrientation(content)
+		if orientation <= 1 && !tooLarge(cfg, maxSide) {
+			return stripJPEG(content)
+		}
+		if cfg.Width*cfg.Height > maxPixels {
+			return nil, ErrTooManyPixels
+		}
+		img, err := jpeg.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, fit(orient(img, orientation), maxSide), &jpeg.Options{Quality: 90})
+		return buf.Bytes(), err
+	case TypePNG:
+		cfg, err := png.DecodeConfig(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		if !tooLarge(cfg, maxSide) {
+			return stripPNG(content)
+		}
+		if cfg.Width*cfg.Height > maxPixels {
+			return nil, ErrTooManyPixels
+		}
+		img, err := png.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = png.Encode(&buf, fit(img, maxSide))
+		return buf.Bytes(), err
+	case TypeHEIC:
+		return blankHEICExif(content)
+	}
+	return content, nil
+}
+
+func tooLarge(cfg image.Config, maxSide int) bool {
+	return maxSide > 0 && (cfg.Width > maxSide || cfg.Height > maxSide)
+}
+
+// fit scales img down, keeping its aspect ratio, so no side exceeds maxSide.
+func fit(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	if maxSide <= 0 || b.Dx() <= maxSide && b.Dy() <= maxSide {
+		return img
+	}
+
+	w, h := maxSide, b.Dy()*maxSide/b.Dx()
+	if b.Dy() > b.Dx() {
+		w, h = b.Dx()*maxSide/b.Dy(), maxSide
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient turns img upright according to an Exif orientation, which is lost
+// along with the rest of the metadata.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegSegments calls fn with the marker and whole bytes of every segment
+// before the image data, and returns where the image data starts.
+func jpegSegments(content []byte, fn func(marker byte, segment []byte)) (int, error) {
+	i := 2 // SOI
+	for {
+		if i+4 > len(content) || content[i] != 0xFF {
+			return 0, errors.New("invalid JPEG")
+		}
+		marker := content[i+1]
+		if marker == 0xFF {
+			// fill byte
+			i++
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(content[i+2:]))
+		if n < 2 || i+2+n > len(content) {
+			return 0, errors.New("invalid JPEG")
+		}
+		if marker == 0xDA { // SOS, the entropy coded data follows
+			return i, nil
+		}
+		fn(marker, content[i:i+2+n])
+		i += 2 + n
+	}
+}
+
+// stripJPEG drops the APP1 (Exif, XMP), APP13 (IPTC) and comment segments.
+func stripJPEG(content []byte) ([]byte, error) {
+	out := append([]byte(nil), content[:2]...)
+	start, err := jpegSegments(content, func(marker byte, segment []byte) {
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out = append(out, segment...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// stop at the end of image marker, whatever follows could be anything
+	scan := content[start:]
+	if end := bytes.Index(scan, []byte{0xFF, 0xD9}); end >= 0 {
+		scan = scan[:end+2]
+	}
+	return append(out, scan...), nil
+}
+
+func jpegOrientation(content []byte) int {
+	orientation := 1
+	jpegSegments(content, func(marker byte, segment []byte) {
+		if marker == 0xE1 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+			if o, ok := exifOrientation(segment[10:]); ok {
+				orientation = o
+			}
+		}
+	})
+	return orientation
+}
+
+// exifOrientation reads the orientation tag of the first IFD of a TIFF
+// structure.
+func exifOrientation(tiff []byte) (int, bool) {
+	if len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0, false
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			return int(order.Uint16(tiff[e+8:])), true
+		}
+	}
+	return 0, false
+}
+
+// stripPNG drops the chunks that carry metadata: eXIf, the text chunks and
+// the modification time.
+func stripPNG(content []byte) ([]byte, error) {
+	const signature = 8
+	out := append([]byte(nil), content[:signature]...)
+	for i := signature; i < len(content); {
+		if i+12 > len(content) {
+			return nil, errors.New("invalid PNG")
+		}
+		n := int(binary.BigEndian.Uint32(content[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(content) {
+			return nil, errors.New("invalid PNG")
+		}
+		switch string(content[i+4 : i+8]) {
+		case "eXIf", "tEXt", "iTXt", "zTXt", "tIME":
+		default:
+			out = append(out, content[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
@@ -0,0 +1,241 @@
+package eslip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+		err     error
+	}{
+		{"png", []byte("\x89PNG\r\n\x1a\n...."), TypePNG, nil},
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, TypeJPEG, nil},
+		{"pdf", []byte("%PDF-1.7\n"), TypePDF, nil},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), TypeHEIC, nil},
+		{"mp4", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x00\x00"), "", ErrUnsupportedType},
+		{"gif", []byte("GIF89a"), "", ErrUnsupportedType},
+		{"empty", nil, "", ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectType(tt.content)
+
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	t.Run("should strip the Exif of a JPEG", func(t *testing.T) {
+		content := withExif(t, encodeJPEG(t, 40, 20), 1)
+
+		got, err := Sanitize(content, TypeJPEG, 1024)
+
+		assert.NoError(t, err)
+		assert.NotContains(t, string(got), "Exif")
+		assert.NotContains(t, string(got), "GPS")
+		assert.Equal(t, image.Pt(40, 20), size(t, got))
+	})
+
+	t.Run("should drop the bytes after the end of a JPEG", func(t *testing.T) {
+		content := append(encodeJPEG(t, 40, 20), "GPS 13.7563N 100.5018E"...)
+
+		got, err := Sanitize(content, TypeJPEG, 1024)
+
+		assert.NoError(t, err)
+		assert.NotContains(t, string(got), "GPS")
+		assert.Equal(t, []byte{0xFF, 0xD9}, got[len(got)-2:])
+	})
+
+	t.Run("should turn a JPEG upright before dropping its orientation", func(t *testing.T) {
+		content := withExif(t, encodeJPEG(t, 40, 20), 6)
+
+		got, err := Sanitize(content, TypeJPEG, 1024)
+
+		assert.NoError(t, err)
+		assert.NotContains(t, string(got), "Exif")
+		assert.Equal(t, image.Pt(20, 40), size(t, got))
+	})
+
+	t.Run("should scale a large image down", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		assert.NoError(t, png.Encode(buf, image.NewGray(image.Rect(0, 0, 3000, 150))))
+
+		got, err := Sanitize(buf.Bytes(), TypePNG, 1000)
+
+		assert.NoError(t, err)
+		assert.Equal(t, image.Pt(1000, 50), size(t, got))
+	})
+
+	t.Run("should strip the metadata chunks of a PNG", func(t *testing.T) {
+		content, err := os.ReadFile("../../e-slip1.png")
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "eXIf")
+
+		got, err := Sanitize(content, TypePNG, 1024)
+
+		assert.NoError(t, err)
+		assert.NotContains(t, string(got), "eXIf")
+		assert.NotContains(t, string(got), "iTXt")
+		assert.Equal(t, size(t, content), size(t, got))
+	})
+
+	t.Run("should blank the Exif of a HEIC", func(t *testing.T) {
+		content := heicWithExif("Exif\x00\x00GPS 13.7563N 100.5018E")
+
+		got, err := Sanitize(content, TypeHEIC, 1024)
+
+		assert.NoError(t, err)
+		assert.Len(t, got, len(content))
+		assert.NotContains(t, string(got), "GPS")
+		assert.Contains(t, string(content), "GPS")
+	})
+
+	t.Run("should blank the Exif of a HEIC stored in idat", func(t *testing.T) {
+		content := heicWithIdatExif("Exif\x00\x00GPS 13.7563N 100.5018E", 1)
+
+		got, err := Sanitize(content, TypeHEIC, 1024)
+
+		assert.NoError(t, err)
+		assert.Len(t, got, len(content))
+		assert.NotContains(t, string(got), "GPS")
+		assert.Contains(t, string(got), "idat")
+	})
+
+	t.Run("should reject a HEIC Exif it cannot locate", func(t *testing.T) {
+		// construction method 2 points into another item
+		_, err := Sanitize(heicWithIdatExif("Exif\x00\x00GPS 13.7563N 100.5018E", 2), TypeHEIC, 1024)
+
+		assert.Equal(t, errInvalidHEIC, err)
+	})
+
+	t.Run("should reject a HEIC box of a 64 bit size beyond the file", func(t *testing.T) {
+		content := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+		content = append(content, "\x00\x00\x00\x01meta\x7F\xFF\xFF\xFF\xFF\xFF\xFF\xFF\x00\x00\x00\x00"...)
+
+		_, err := Sanitize(content, TypeHEIC, 1024)
+
+		assert.Equal(t, errInvalidHEIC, err)
+	})
+
+	t.Run("should keep a PDF as it is", func(t *testing.T) {
+		got, err := Sanitize([]byte("%PDF-1.7\n"), TypePDF, 1024)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "%PDF-1.7\n", string(got))
+	})
+}
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.White)
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buf, img, nil))
+	return buf.Bytes()
+}
+
+// withExif adds an APP1 segment with an orientation and a fake GPS tag
+// after the start of image marker.
+func withExif(t *testing.T, content []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	// orientation, SHORT, count 1, value
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 13.7563N 100.5018E"...)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(app1)+2))
+	segment = append(segment, app1...)
+
+	out := append([]byte(nil), content[:2]...)
+	out = append(out, segment...)
+	return append(out, content[2:]...)
+}
+
+// heicWithExif builds the boxes of a HEIC file with one Exif item.
+func heicWithExif(exif string) []byte {
+	mkbox := func(typ string, data []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(data)+8))
+		return append(append(b, typ...), data...)
+	}
+	ftyp := mkbox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	// version 2, item 1, no protection, type Exif, empty name
+	infe := mkbox("infe", []byte("\x02\x00\x00\x00\x00\x01\x00\x00Exif\x00"))
+	iinf := mkbox("iinf", append([]byte("\x00\x00\x00\x00\x00\x01"), infe...))
+
+	iloc := func(offset uint32) []byte {
+		// version 0, offset and length of 4 bytes, no base offset
+		d := []byte{0, 0, 0, 0, 0x44, 0x00}
+		d = binary.BigEndian.AppendUint16(d, 1) // item count
+		d = binary.BigEndian.AppendUint16(d, 1) // item id
+		d = binary.BigEndian.AppendUint16(d, 0) // data reference
+		d = binary.BigEndian.AppendUint16(d, 1) // extent count
+		d = binary.BigEndian.AppendUint32(d, offset)
+		d = binary.BigEndian.AppendUint32(d, uint32(len(exif)))
+		return mkbox("iloc", d)
+	}
+	meta := func(offset uint32) []byte {
+		return mkbox("meta", append(append([]byte{0, 0, 0, 0}, iinf...), iloc(offset)...))
+	}
+
+	// the Exif is in mdat, right after its header
+	offset := uint32(len(ftyp) + len(meta(0)) + 8)
+	out := append(ftyp, meta(offset)...)
+	return append(out, mkbox("mdat", []byte(exif))...)
+}
+
+// heicWithIdatExif builds the boxes of a HEIC file with one Exif item of
+// construction method, in the idat box of meta for method 1.
+func heicWithIdatExif(exif string, method uint16) []byte {
+	mkbox := func(typ string, data []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(data)+8))
+		return append(append(b, typ...), data...)
+	}
+	ftyp := mkbox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	infe := mkbox("infe", []byte("\x02\x00\x00\x00\x00\x01\x00\x00Exif\x00"))
+	iinf := mkbox("iinf", append([]byte("\x00\x00\x00\x00\x00\x01"), infe...))
+
+	// version 1, offset and length of 4 bytes, no base offset
+	d := []byte{1, 0, 0, 0, 0x44, 0x00}
+	d = binary.BigEndian.AppendUint16(d, 1)      // item count
+	d = binary.BigEndian.AppendUint16(d, 1)      // item id
+	d = binary.BigEndian.AppendUint16(d, method) // construction method
+	d = binary.BigEndian.AppendUint16(d, 0)      // data reference
+	d = binary.BigEndian.AppendUint16(d, 1)      // extent count
+	d = binary.BigEndian.AppendUint32(d, 0)      // offset in idat
+	d = binary.BigEndian.AppendUint32(d, uint32(len(exif)))
+	iloc := mkbox("iloc", d)
+
+	meta := append([]byte{0, 0, 0, 0}, iinf...)
+	meta = append(meta, iloc...)
+	meta = append(meta, mkbox("idat", []byte(exif))...)
+	return append(ftyp, mkbox("meta", meta)...)
+}
+
+func size(t *testing.T, content []byte) image.Point {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	assert.NoError(t, err)
+	return image.Pt(cfg.Width, cfg.Height)
+}
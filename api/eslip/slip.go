@@ -0,0 +1,110 @@
+package eslip
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/emvco"
+)
+
+// Slip is the payload of the mini-QR Thai banks print on transfer slips.
+// It only references the transfer, the amount and date are not part of it.
+type Slip struct {
+	APIID           string `json:"api_id"`
+	SendingBank     string `json:"sending_bank"`
+	SendingBankName string `json:"sending_bank_name,omitempty"`
+	TransactionRef  string `json:"transaction_ref"`
+	Country         string `json:"country"`
+	Payload         string `json:"payload"`
+}
+
+const (
+	tagSlip    = "00"
+	tagCountry = "51"
+	tagCRC     = "91"
+
+	subTagAPIID          = "00"
+	subTagSendingBank    = "01"
+	subTagTransactionRef = "02"
+)
+
+// banks maps the Bank of Thailand codes to the usual short names.
+var banks = map[string]string{
+	"002": "BBL",
+	"004": "KBANK",
+	"006": "KTB",
+	"011": "TTB",
+	"014": "SCB",
+	"022": "CIMBT",
+	"024": "UOBT",
+	"025": "BAY",
+	"030": "GSB",
+	"033": "GHB",
+	"034": "BAAC",
+	"067": "TISCO",
+	"069": "KKP",
+	"073": "LHB",
+}
+
+var ErrNotSlip = errors.New("not a bank slip QR code")
+
+// ParseSlip reads the tag-length-value fields of a slip payload and checks
+// its CRC.
+func ParseSlip(payload string) (Slip, error) {
+	fields, err := parseTLV(payload)
+	if err != nil {
+		return Slip{}, err
+	}
+
+	crc, ok := fields[tagCRC]
+	if !ok {
+		return Slip{}, ErrNotSlip
+	}
+	// the CRC covers everything up to and including its own tag and length
+	signed := payload[:len(payload)-len(crc)]
+	if want := fmt.Sprintf("%04X", emvco.CRC16(signed)); !strings.EqualFold(crc, want) {
+		return Slip{}, errors.New("slip QR code checksum mismatch")
+	}
+
+	sub, err := parseTLV(fields[tagSlip])
+	if err != nil {
+		return Slip{}, err
+	}
+	slip := Slip{
+		APIID:          sub[subTagAPIID],
+		SendingBank:    sub[subTagSendingBank],
+		TransactionRef: sub[subTagTransactionRef],
+		Country:        fields[tagCountry],
+		Payload:        payload,
+	}
+	if slip.APIID == "" || slip.TransactionRef == "" {
+		return Slip{}, ErrNotSlip
+	}
+	slip.SendingBankName = banks[slip.SendingBank]
+	return slip, nil
+}
+
+func parseTLV(s string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for len(s) > 0 {
+		if len(s) < 4 {
+			return nil, ErrNotSlip
+		}
+		// the length is two digits, Atoi would also take "-1" or "+1"
+		if !isDigit(s[2]) || !isDigit(s[3]) {
+			return nil, ErrNotSlip
+		}
+		n := int(s[2]-'0')*10 + int(s[3]-'0')
+		if len(s) < 4+n {
+			return nil, ErrNotSlip
+		}
+		fields[s[:2]] = s[4 : 4+n]
+		s = s[4+n:]
+	}
+	return fields, nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
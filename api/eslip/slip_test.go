@@ -0,0 +1,82 @@
+package eslip
+
+import (
+	"image"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/draw"
+)
+
+// slipPayload is the QR code of e-slip1.png and e-slip2.png.
+const slipPayload = "00390006000001010300402180120481045493010215102TH91047C66"
+
+func TestParseSlip(t *testing.T) {
+	t.Run("read the slip fields", func(t *testing.T) {
+		slip, err := ParseSlip(slipPayload)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Slip{
+			APIID:           "000001",
+			SendingBank:     "004",
+			SendingBankName: "KBANK",
+			TransactionRef:  "012048104549301021",
+			Country:         "TH",
+			Payload:         slipPayload,
+		}, slip)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		_, err := ParseSlip(slipPayload[:len(slipPayload)-4] + "0000")
+
+		assert.EqualError(t, err, "slip QR code checksum mismatch")
+	})
+
+	t.Run("not a slip", func(t *testing.T) {
+		_, err := ParseSlip("https://example.com")
+
+		assert.ErrorIs(t, err, ErrNotSlip)
+	})
+
+	t.Run("bad field length", func(t *testing.T) {
+		for _, payload := range []string{"00-1abcd9104ABCD", "00+1abcd9104ABCD", "00 1a9104ABCD"} {
+			_, err := ParseSlip(payload)
+
+			assert.ErrorIs(t, err, ErrNotSlip, payload)
+		}
+	})
+}
+
+func TestDecodeQR(t *testing.T) {
+	f, err := os.Open("../../e-slip1.png")
+	assert.NoError(t, err)
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	assert.NoError(t, err)
+
+	payload, err := DecodeQR(img)
+
+	assert.NoError(t, err)
+	assert.Equal(t, slipPayload, payload)
+}
+
+func TestHash(t *testing.T) {
+	f, err := os.Open("../../e-slip1.png")
+	assert.NoError(t, err)
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	assert.NoError(t, err)
+
+	half := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx()/2, img.Bounds().Dy()/2))
+	draw.ApproxBiLinear.Scale(half, half.Bounds(), img, img.Bounds(), draw.Src, nil)
+	flipped := image.NewRGBA(img.Bounds())
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			flipped.Set(img.Bounds().Dx()-1-x, y, img.At(x, y))
+		}
+	}
+
+	assert.True(t, SameImage(Hash(img), Hash(half)))
+	assert.False(t, SameImage(Hash(img), Hash(flipped)))
+}
@@ -0,0 +1,323 @@
+package eslip
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// minConfidence is the Textract confidence, in percent, under which a field
+// is returned for the spender to confirm.
+const minConfidence = 90.0
+
+// AnalyzeExpense is the part of an Amazon Textract AnalyzeExpense response
+// that is read, other fields are ignored.
+type AnalyzeExpense struct {
+	ExpenseDocuments []ExpenseDocument `json:"ExpenseDocuments"`
+}
+
+type ExpenseDocument struct {
+	SummaryFields  []ExpenseField `json:"SummaryFields"`
+	LineItemGroups []struct {
+		LineItems []struct {
+			LineItemExpenseFields []ExpenseField `json:"LineItemExpenseFields"`
+		} `json:"LineItems"`
+	} `json:"LineItemGroups"`
+}
+
+type ExpenseField struct {
+	Type            ExpenseDetection `json:"Type"`
+	ValueDetection  ExpenseDetection `json:"ValueDetection"`
+	GroupProperties []struct {
+		Types []string `json:"Types"`
+	} `json:"GroupProperties"`
+}
+
+type ExpenseDetection struct {
+	Text       string  `json:"Text"`
+	Confidence float64 `json:"Confidence"`
+}
+
+// Text is a field read from a receipt with the confidence of the reading,
+// in percent.
+type Text struct {
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+type Amount struct {
+	Value      float64 `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+type LineItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity,omitempty"`
+	UnitPrice   float64 `json:"unit_price,omitempty"`
+	Price       float64 `json:"price"`
+	// Confidence is the lowest of the fields of the item.
+	Confidence float64 `json:"confidence"`
+}
+
+// Expense is what a Textract AnalyzeExpense document says of a receipt,
+// fields that were not found are nil.
+type Expense struct {
+	Vendor    *Text      `json:"vendor"`
+	Date      *Text      `json:"date"`
+	Total     *Amount    `json:"total"`
+	Tax       *Amount    `json:"tax"`
+	LineItems []LineItem `json:"line_items"`
+}
+
+var ErrNoExpense = errors.New("no expense document in the AnalyzeExpense output")
+
+// ParseExpense reads the first expense document of doc. Of the fields found
+// more than once, the one Textract is the most confident about is kept.
+// Two digit years are read as of now.
+func ParseExpense(doc AnalyzeExpense, now time.Time) (Expense, error) {
+	if len(doc.ExpenseDocuments) == 0 {
+		return Expense{}, ErrNoExpense
+	}
+	d := doc.ExpenseDocuments[0]
+
+	fields := map[string]ExpenseDetection{}
+	for _, f := range d.SummaryFields {
+		typ := f.Type.Text
+		// the name of the vendor comes as a NAME of the VENDOR group
+		if typ == "NAME" && f.inGroup("VENDOR") {
+			typ = "VENDOR_NAME"
+		}
+		if cur, ok := fields[typ]; !ok || f.ValueDetection.Confidence > cur.Confidence {
+			fields[typ] = f.ValueDetection
+		}
+	}
+
+	e := Expense{LineItems: []LineItem{}}
+	if v, ok := fields["VENDOR_NAME"]; ok {
+		e.Vendor = &Text{strings.Join(strings.Fields(v.Text), " "), v.Confidence}
+	}
+	if v, ok := fields["INVOICE_RECEIPT_DATE"]; ok {
+		if date, err := parseReceiptDate(v.Text, now); err == nil {
+			e.Date = &Text{date.Format("2006-01-02"), v.Confidence}
+		}
+	}
+	for _, typ := range []string{"TOTAL", "AMOUNT_PAID", "AMOUNT_DUE"} {
+		if e.Total = amountField(fields, typ); e.Total != nil {
+			break
+		}
+	}
+	e.Tax = amountField(fields, "TAX")
+
+	for _, g := range d.LineItemGroups {
+		for _, li := range g.LineItems {
+			if item, ok := lineItem(li.LineItemExpenseFields); ok {
+				e.LineItems = append(e.LineItems, item)
+			}
+		}
+	}
+	return e, nil
+}
+
+func (f ExpenseField) inGroup(group string) bool {
+	for _, g := range f.GroupProperties {
+		for _, t := range g.Types {
+			if t == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func amountField(fields map[string]ExpenseDetection, typ string) *Amount {
+	v, ok := fields[typ]
+	if !ok {
+		return nil
+	}
+	amount, err := parseAmount(v.Text)
+	if err != nil {
+		return nil
+	}
+	return &Amount{amount, v.Confidence}
+}
+
+func lineItem(fields []ExpenseField) (LineItem, bool) {
+	item := LineItem{Confidence: 100}
+	var found bool
+	for _, f := range fields {
+		v := f.ValueDetection
+		switch f.Type.Text {
+		case "ITEM":
+			item.Description = strings.Join(strings.Fields(v.Text), " ")
+		case "PRICE":
+			p, err := parseAmount(v.Text)
+			if err != nil {
+				continue
+			}
+			item.Price, found = p, true
+		case "QUANTITY":
+			item.Quantity, _ = parseAmount(v.Text)
+		case "UNIT_PRICE":
+			item.UnitPrice, _ = parseAmount(v.Text)
+		default:
+			continue
+		}
+		item.Confidence = math.Min(item.Confidence, v.Confidence)
+	}
+	return item, found && item.Description != ""
+}
+
+// parseAmount reads amounts the way receipts print them, e.g. "฿1,234.50".
+func parseAmount(s string) (float64, error) {
+	s = strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+	return strconv.ParseFloat(strings.Trim(s, ".-"), 64)
+}
+
+var receiptDateLayouts = []string{
+	"2006-01-02",
+	"02/01/2006",
+	"2/1/2006",
+	"02/01/06",
+	"2/1/06",
+	"02-01-2006",
+	"02.01.2006",
+	"2006/01/02",
+	"2 Jan 2006",
+	"02 Jan 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+}
+
+// parseReceiptDate reads the dates of Thai receipts, day first and years
+// of the Buddhist era included. Two digit years after the year of now are
+// of the Buddhist era.
+func parseReceiptDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	// a time may follow the date
+	if i := strings.IndexAny(s, " T"); i > 0 && strings.Count(s[:i], "/")+strings.Count(s[:i], "-") == 2 {
+		s = s[:i]
+	}
+	for _, layout := range receiptDateLayouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(layout, "/06") {
+			// two digit years beyond the current one are of the Buddhist
+			// era, 20/05/67 is 20 May 2567
+			yy := t.Year() % 100
+			year := 2000 + yy
+			if yy > now.Year()%100 {
+				year = 2500 + yy
+			}
+			t = time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		if t.Year() > 2400 {
+			t = t.AddDate(-543, 0, 0)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.New("unknown date format " + strconv.Quote(s))
+}
+
+// lowConfidence lists the fields of e to be confirmed by the spender.
+func lowConfidence(e Expense, min float64) []string {
+	fields := []string{}
+	if e.Vendor != nil && e.Vendor.Confidence < min {
+		fields = append(fields, "vendor")
+	}
+	if e.Date != nil && e.Date.Confidence < min {
+		fields = append(fields, "date")
+	}
+	if e.Total != nil && e.Total.Confidence < min {
+		fields = append(fields, "total")
+	}
+	if e.Tax != nil && e.Tax.Confidence < min {
+		fields = append(fields, "tax")
+	}
+	for i, item := range e.LineItems {
+		if item.Confidence < min {
+			fields = append(fields, "line_items["+strconv.Itoa(i)+"]")
+		}
+	}
+	return fields
+}
+
+// TextractReceipt is a receipt read by Textract, with the expense drafted
+// from it.
+type TextractReceipt struct {
+	Expense Expense                  `json:"expense"`
+	Draft   *transaction.Transaction `json:"draft"`
+	// MissingFields are the draft fields left to fill, LowConfidenceFields
+	// the expense fields to confirm.
+	MissingFields       []string `json:"missing_fields"`
+	LowConfidenceFields []string `json:"low_confidence_fields"`
+}
+
+// Textract drafts an expense of ?spender_id=N from the raw output of
+// Textract AnalyzeExpense, categorized like the spender past expenses at
+// the same vendor.
+func (h handler) Textract(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	spenderID, err := strconv.ParseInt(c.QueryParam("spender_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "spender_id must be a number")
+	}
+
+	var doc AnalyzeExpense
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, h.cfg.MaxFileSize)
+	if err := json.NewDecoder(body).Decode(&doc); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	e, err := ParseExpense(doc, h.now())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	ext := Extraction{}
+	if e.Vendor != nil {
+		ext.Vendor = e.Vendor.Value
+	}
+	if e.Date != nil {
+		date, _ := time.Parse("2006-01-02", e.Date.Value)
+		ext.Date = date.Format(time.RFC3339)
+	}
+	if e.Total != nil {
+		ext.Amount = e.Total.Value
+	}
+	if err := categorize(ctx, h.db, spenderID, &ext); err != nil {
+		logger.Error("categorize receipt error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	draft, missing := draftFrom(ext, "", spenderID)
+	if missing == nil {
+		missing = []string{}
+	}
+	return c.JSON(http.StatusOK, TextractReceipt{
+		Expense:             e,
+		Draft:               draft,
+		MissingFields:       missing,
+		LowConfidenceFields: lowConfidence(e, minConfidence),
+	})
+}
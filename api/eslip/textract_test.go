@@ -0,0 +1,181 @@
+package eslip
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiptNow is when the receipts of the tests are read, two digit years
+// depend on it.
+var receiptNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParseExpense(t *testing.T) {
+	t.Run("should read a receipt", func(t *testing.T) {
+		e, err := ParseExpense(loadTextract(t, "textract_7eleven.json"), receiptNow)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &Text{"7-Eleven", 99.2}, e.Vendor)
+		assert.Equal(t, &Text{"2024-05-20", 97.5}, e.Date)
+		assert.Equal(t, &Amount{100, 99.1}, e.Total)
+		assert.Equal(t, &Amount{6.54, 95}, e.Tax)
+		assert.Equal(t, []LineItem{
+			{Description: "Coca-Cola 325ml", Quantity: 2, UnitPrice: 15, Price: 30, Confidence: 96},
+			{Description: "Onigiri Tuna", Price: 35, Confidence: 98.1},
+			{Description: "Sandwlch Ham", Price: 35, Confidence: 72.4},
+		}, e.LineItems)
+		assert.Equal(t, []string{"line_items[2]"}, lowConfidence(e, minConfidence))
+	})
+
+	t.Run("should fall back to the amount paid", func(t *testing.T) {
+		e, err := ParseExpense(loadTextract(t, "textract_low_confidence.json"), receiptNow)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &Amount{65, 85}, e.Total)
+		assert.Nil(t, e.Date)
+		assert.Nil(t, e.Tax)
+		assert.Equal(t, []string{"vendor", "total"}, lowConfidence(e, minConfidence))
+	})
+
+	t.Run("should refuse a document without expense", func(t *testing.T) {
+		_, err := ParseExpense(AnalyzeExpense{}, receiptNow)
+
+		assert.Equal(t, ErrNoExpense, err)
+	})
+}
+
+func TestParseReceiptDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"2024-05-20", "2024-05-20"},
+		{"20/05/2024", "2024-05-20"},
+		{"20/05/2567 14:32", "2024-05-20"},
+		{"5/6/2024", "2024-06-05"},
+		{"20/05/24", "2024-05-20"},
+		{"20/05/67", "2024-05-20"},
+		{"20-05-2024", "2024-05-20"},
+		{"20 May 2024", "2024-05-20"},
+		{"May 20, 2024", "2024-05-20"},
+		{"2024-05-20T08:00:00", "2024-05-20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseReceiptDate(tt.in, receiptNow)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Format("2006-01-02"))
+		})
+	}
+
+	t.Run("should read two digit years after the current one as Buddhist era", func(t *testing.T) {
+		got, err := parseReceiptDate("20/05/25", receiptNow)
+		assert.NoError(t, err)
+		assert.Equal(t, "1982-05-20", got.Format("2006-01-02"))
+
+		got, err = parseReceiptDate("20/05/25", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, "2025-05-20", got.Format("2006-01-02"))
+	})
+
+	_, err := parseReceiptDate("yesterday", receiptNow)
+	assert.Error(t, err)
+}
+
+func TestTextract(t *testing.T) {
+	t.Run("should draft an expense from the receipt", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(1), "7-Eleven%").
+			WillReturnRows(sqlmock.NewRows([]string{"category"}).AddRow("groceries"))
+
+		rec := postTextract(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", "textract_7eleven.json")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var res TextractReceipt
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 100.0, res.Draft.Amount)
+		assert.Equal(t, time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC).Format(time.RFC3339), res.Draft.Date)
+		assert.Equal(t, "groceries", res.Draft.Category)
+		assert.Equal(t, "7-Eleven", res.Draft.Note)
+		assert.Equal(t, "expense", res.Draft.TransactionType)
+		assert.Equal(t, []string{}, res.MissingFields)
+		assert.Equal(t, []string{"line_items[2]"}, res.LowConfidenceFields)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should categorize with the spender rules first", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns).
+			AddRow(4, 1, 0, "7-eleven", "", nil, nil, "expense", 20, "Groceries", "{convenience}"))
+
+		rec := postTextract(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", "textract_7eleven.json")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var res TextractReceipt
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, "Groceries", res.Draft.Category)
+		assert.Equal(t, []string{"convenience"}, res.Draft.Tags)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should report what is missing and uncertain", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(1), "Cafe Amazon%").WillReturnRows(sqlmock.NewRows([]string{"category"}))
+
+		rec := postTextract(t, New(limits, db, storage.NewMemory(), nil), "/?spender_id=1", "textract_low_confidence.json")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var res TextractReceipt
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, []string{"category", "date"}, res.MissingFields)
+		assert.Equal(t, []string{"vendor", "total"}, res.LowConfidenceFields)
+	})
+
+	t.Run("should require the spender", func(t *testing.T) {
+		rec := postTextract(t, New(limits, nil, storage.NewMemory(), nil), "/", "textract_7eleven.json")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should refuse a document that is not JSON", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/?spender_id=1", bytes.NewBufferString("<xml/>"))
+		rec := httptest.NewRecorder()
+
+		assert.NoError(t, New(limits, nil, storage.NewMemory(), nil).Textract(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func loadTextract(t *testing.T, name string) AnalyzeExpense {
+	content, err := os.ReadFile("testdata/" + name)
+	assert.NoError(t, err)
+	var doc AnalyzeExpense
+	assert.NoError(t, json.Unmarshal(content, &doc))
+	return doc
+}
+
+func postTextract(t *testing.T, h *handler, target, fixture string) *httptest.ResponseRecorder {
+	content, err := os.ReadFile("testdata/" + fixture)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(content))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	assert.NoError(t, h.Textract(e.NewContext(req, rec)))
+	return rec
+}
@@ -0,0 +1,172 @@
+package eslip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Sizes of the thumbnails made of every image, by longest side in pixels.
+var thumbnailSizes = map[string]int{
+	"thumb":   160,
+	"preview": 640,
+}
+
+var ErrNoThumbnail = errors.New("thumbnails are only made of PNG and JPEG images")
+
+// thumbnailKey is where the thumbnail of the file stored under key is kept,
+// next to it: ab/abcd.png has its thumb under ab/abcd.thumb.jpg.
+func thumbnailKey(key, size string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "." + size + ".jpg"
+}
+
+// Thumbnail scales an image down to fit side, as a JPEG.
+func Thumbnail(content []byte, side int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, ErrNoThumbnail
+	}
+	img = fit(img, side)
+
+	// JPEG has no transparency, it is laid on white
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	return buf.Bytes(), err
+}
+
+// makeThumbnails stores every thumbnail of the image stored under key.
+func makeThumbnails(ctx context.Context, store storage.Storage, key string, content []byte) error {
+	for size := range thumbnailSizes {
+		if _, err := makeThumbnail(ctx, store, key, size, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func makeThumbnail(ctx context.Context, store storage.Storage, key, size string, content []byte) ([]byte, error) {
+	thumb, err := Thumbnail(content, thumbnailSizes[size])
+	if err != nil {
+		return nil, err
+	}
+	return thumb, store.Put(ctx, thumbnailKey(key, size), thumb, TypeJPEG)
+}
+
+// GetAttachment serves the file of an attachment, or with ?size=thumb or
+// ?size=preview its thumbnail. Thumbnails missing for files uploaded
+// before they existed are made on the first request.
+//
+// Files are stored under their content hash so they never change, clients
+// may keep them for good.
+func (h handler) GetAttachment(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid attachment id")
+	}
+	size := c.QueryParam("size")
+	if _, ok := thumbnailSizes[size]; !ok && size != "" && size != "original" {
+		return c.JSON(http.StatusBadRequest, "size must be thumb, preview or original")
+	}
+
+	a, err := scanAttachment(h.db.QueryRowContext(ctx, getAttachmentStmt, id))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "attachment not found")
+	} else if err != nil {
+		logger.Error("get attachment error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return h.serve(c, a, size)
+}
+
+// serve streams the file of a, or its thumbnail of size.
+func (h handler) serve(c echo.Context, a Attachment, size string) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	key := a.Location
+	if _, ok := thumbnailSizes[size]; ok {
+		key = thumbnailKey(a.Location, size)
+	}
+	etag := `"` + path.Base(key) + `"`
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, max-age=31536000, immutable")
+	c.Response().Header().Set("ETag", etag)
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	r, err := h.store.Get(ctx, key)
+	if err == storage.ErrNotFound && key != a.Location {
+		// made on the first request for files uploaded before thumbnails
+		var thumb []byte
+		thumb, err = h.thumbnail(ctx, a.Location, size)
+		if err == nil {
+			return c.Blob(http.StatusOK, TypeJPEG, thumb)
+		}
+	}
+	if err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, "attachment file not found")
+	} else if err == ErrNoThumbnail {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("read attachment error", zap.String("key", key), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	defer r.Close()
+
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	return c.Stream(http.StatusOK, contentType(key, head), br)
+}
+
+func (h handler) thumbnail(ctx context.Context, original, size string) ([]byte, error) {
+	content, err := read(ctx, h.store, original)
+	if err != nil {
+		return nil, err
+	}
+	return makeThumbnail(ctx, h.store, original, size, content)
+}
+
+func read(ctx context.Context, store storage.Storage, key string) ([]byte, error) {
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// contentType tells the type of a stored file from its extension, files
+// stored before uploads were checked may have any extension and are told
+// by their first bytes.
+func contentType(key string, head []byte) string {
+	for t, ext := range extensions {
+		if strings.EqualFold(path.Ext(key), ext) {
+			return t
+		}
+	}
+	return http.DetectContentType(head)
+}
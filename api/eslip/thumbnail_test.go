@@ -0,0 +1,115 @@
+package eslip
+
+import (
+	"context"
+	"database/sql"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAttachment(t *testing.T) {
+	content, err := os.ReadFile("../../e-slip1.png")
+	assert.NoError(t, err)
+	key := storage.ContentKey(content, ".png")
+
+	expectAttachment := func(mock sqlmock.Sqlmock, location string) {
+		mock.ExpectQuery(getAttachmentStmt).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "filename", "location", "transaction_ref", "created_at", "transaction_id"}).
+				AddRow(1, 1, "slip.png", location, "", "2024-05-20T10:00:00Z", nil))
+	}
+
+	t.Run("should serve the original with caching headers", func(t *testing.T) {
+		db, mock := slipDB(t)
+		expectAttachment(mock, key)
+		store := storage.NewMemory()
+		store.Put(context.Background(), key, content, TypePNG)
+
+		rec := getAttachment(t, New(limits, db, store, nil), "1", "", "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, TypePNG, rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "private, max-age=31536000, immutable", rec.Header().Get(echo.HeaderCacheControl))
+		assert.Equal(t, content, rec.Body.Bytes())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should make a missing thumbnail and keep it", func(t *testing.T) {
+		db, mock := slipDB(t)
+		expectAttachment(mock, key)
+		store := storage.NewMemory()
+		store.Put(context.Background(), key, content, TypePNG)
+
+		rec := getAttachment(t, New(limits, db, store, nil), "1", "thumb", "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, TypeJPEG, rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `"`+thumbnailKey(key, "thumb")[3:]+`"`, rec.Header().Get("ETag"))
+		cfg, _, err := image.DecodeConfig(rec.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, 160, max(cfg.Width, cfg.Height))
+		assert.ElementsMatch(t, []string{key, thumbnailKey(key, "thumb")}, store.Keys())
+	})
+
+	t.Run("should answer not modified to a client with the file", func(t *testing.T) {
+		db, mock := slipDB(t)
+		expectAttachment(mock, key)
+
+		etag := `"` + thumbnailKey(key, "preview")[3:] + `"`
+		rec := getAttachment(t, New(limits, db, storage.NewMemory(), nil), "1", "preview", etag)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.Bytes())
+	})
+
+	t.Run("should not make thumbnails of a PDF", func(t *testing.T) {
+		db, mock := slipDB(t)
+		expectAttachment(mock, "ab/abcd.pdf")
+		store := storage.NewMemory()
+		store.Put(context.Background(), "ab/abcd.pdf", []byte("%PDF-1.7\n"), TypePDF)
+
+		rec := getAttachment(t, New(limits, db, store, nil), "1", "thumb", "")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), ErrNoThumbnail.Error())
+	})
+
+	t.Run("should refuse an unknown size", func(t *testing.T) {
+		rec := getAttachment(t, New(limits, nil, storage.NewMemory(), nil), "1", "huge", "")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should return not found for an unknown attachment", func(t *testing.T) {
+		db, mock := slipDB(t)
+		mock.ExpectQuery(getAttachmentStmt).WithArgs(int64(1)).WillReturnError(sql.ErrNoRows)
+
+		rec := getAttachment(t, New(limits, db, storage.NewMemory(), nil), "1", "thumb", "")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func getAttachment(t *testing.T, h *handler, id, size, etag string) *httptest.ResponseRecorder {
+	e := echo.New()
+	defer e.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/?size="+size, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+
+	assert.NoError(t, h.GetAttachment(c))
+	return rec
+}
@@ -0,0 +1,122 @@
+package eslip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+)
+
+var ErrTransferNotFound = errors.New("slip transfer not found")
+
+// NewVerifier creates the verifier selected by cfg, nil for none.
+func NewVerifier(cfg config.SlipVerify) (Verifier, error) {
+	switch cfg.Backend {
+	case "", "none":
+		return nil, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("slip verify: http needs a URL")
+		}
+		return HTTPVerifier{URL: cfg.URL, APIKey: cfg.APIKey, Client: &http.Client{Timeout: cfg.Timeout}}, nil
+	case "file":
+		v, err := NewFileVerifier(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("slip verify: unknown backend %q", cfg.Backend)
+	}
+}
+
+// transfer is how verification APIs and files give a Transfer.
+type transfer struct {
+	Amount float64   `json:"amount"`
+	Date   time.Time `json:"date"`
+}
+
+// HTTPVerifier posts the slip to a verification API at URL, with APIKey as
+// bearer token when set. The API answers 200 with the amount and RFC 3339
+// date of the transfer, or 404 when the bank does not know it.
+type HTTPVerifier struct {
+	URL    string
+	APIKey string
+	Client *http.Client
+}
+
+func (v HTTPVerifier) Verify(ctx context.Context, slip Slip) (Transfer, error) {
+	body, err := json.Marshal(slip)
+	if err != nil {
+		return Transfer{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, bytes.NewReader(body))
+	if err != nil {
+		return Transfer{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+v.APIKey)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return Transfer{}, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return Transfer{}, ErrTransferNotFound
+	case res.StatusCode != http.StatusOK:
+		return Transfer{}, fmt.Errorf("slip verify: %s", res.Status)
+	}
+	var t transfer
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return Transfer{}, fmt.Errorf("slip verify: %w", err)
+	}
+	if t.Amount <= 0 || t.Date.IsZero() {
+		return Transfer{}, fmt.Errorf("slip verify: no amount or date")
+	}
+	return Transfer{Amount: t.Amount, Date: t.Date}, nil
+}
+
+// FileVerifier looks the transfers up in a fixed list, keyed by
+// transaction reference.
+type FileVerifier map[string]Transfer
+
+// NewFileVerifier reads the transfers of a JSON file such as
+// {"012048104549301021": {"amount": 888.88, "date": "2022-09-01T16:30:00+07:00"}}.
+func NewFileVerifier(path string) (FileVerifier, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("slip verify: %w", err)
+	}
+	var transfers map[string]transfer
+	if err := json.Unmarshal(content, &transfers); err != nil {
+		return nil, fmt.Errorf("slip verify: %s: %w", path, err)
+	}
+	v := FileVerifier{}
+	for ref, t := range transfers {
+		v[ref] = Transfer{Amount: t.Amount, Date: t.Date}
+	}
+	return v, nil
+}
+
+func (v FileVerifier) Verify(ctx context.Context, slip Slip) (Transfer, error) {
+	t, ok := v[slip.TransactionRef]
+	if !ok {
+		return Transfer{}, ErrTransferNotFound
+	}
+	return t, nil
+}
@@ -0,0 +1,97 @@
+package eslip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVerifier(t *testing.T) {
+	t.Run("should have none by default", func(t *testing.T) {
+		v, err := NewVerifier(config.SlipVerify{})
+
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+	})
+
+	t.Run("should require the URL of the API", func(t *testing.T) {
+		_, err := NewVerifier(config.SlipVerify{Backend: "http"})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should refuse an unknown backend", func(t *testing.T) {
+		_, err := NewVerifier(config.SlipVerify{Backend: "ocr"})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestHTTPVerifier(t *testing.T) {
+	t.Run("should fill the draft amount and date from the API", func(t *testing.T) {
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var slip Slip
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&slip))
+			assert.Equal(t, "012048104549301021", slip.TransactionRef)
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"amount": 888.88, "date": "2022-09-01T16:30:00+07:00"}`))
+		}))
+		defer api.Close()
+		v, err := NewVerifier(config.SlipVerify{Backend: "http", URL: api.URL, APIKey: "secret", Timeout: time.Second})
+		assert.NoError(t, err)
+
+		db, mock := slipDB(t)
+		expectNewSlip(t, mock)
+		rec := postImage(t, New(limits, db, storage.NewMemory(), v), "/?draft=true&spender_id=1", "../../e-slip1.png")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		files := uploadedFiles(t, rec)
+		assert.Equal(t, 888.88, files[0].Draft.Amount)
+		assert.Equal(t, "2022-09-01T16:30:00+07:00", files[0].Draft.Date)
+		assert.Equal(t, []string{"category"}, files[0].MissingFields)
+	})
+
+	t.Run("should tell a transfer the bank does not know", func(t *testing.T) {
+		api := httptest.NewServer(http.NotFoundHandler())
+		defer api.Close()
+
+		_, err := HTTPVerifier{URL: api.URL}.Verify(context.Background(), Slip{TransactionRef: "1"})
+
+		assert.Equal(t, ErrTransferNotFound, err)
+	})
+
+	t.Run("should fail on an answer without amount", func(t *testing.T) {
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"date": "2022-09-01T16:30:00+07:00"}`))
+		}))
+		defer api.Close()
+
+		_, err := HTTPVerifier{URL: api.URL}.Verify(context.Background(), Slip{TransactionRef: "1"})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestFileVerifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slips.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"012048104549301021": {"amount": 120.5, "date": "2022-09-01T16:30:00Z"}}`), 0o600))
+
+	v, err := NewVerifier(config.SlipVerify{Backend: "file", File: path})
+	assert.NoError(t, err)
+
+	transfer, err := v.Verify(context.Background(), Slip{TransactionRef: "012048104549301021"})
+	assert.NoError(t, err)
+	assert.Equal(t, Transfer{Amount: 120.5, Date: time.Date(2022, 9, 1, 16, 30, 0, 0, time.UTC)}, transfer)
+
+	_, err = v.Verify(context.Background(), Slip{TransactionRef: "1"})
+	assert.Equal(t, ErrTransferNotFound, err)
+}
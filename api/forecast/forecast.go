@@ -0,0 +1,278 @@
+package forecast
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	// lookbackDays is how much history is used to detect patterns.
+	lookbackDays = 180
+	// discretionaryDays is the window used for the average daily spend.
+	discretionaryDays = 90
+	// minRecurringMonths is how many distinct months a pattern has to show
+	// up in before it is treated as recurring.
+	minRecurringMonths = 3
+	// maxAmountSpread is the highest coefficient of variation for amounts
+	// of a recurring pattern.
+	maxAmountSpread = 0.2
+	maxHorizonDays  = 366
+)
+
+// Entry is a past transaction as far as the forecast is concerned.
+type Entry struct {
+	Date            time.Time
+	Amount          float64
+	Category        string
+	TransactionType string
+}
+
+// Recurring is a monthly income or expense detected from history.
+type Recurring struct {
+	Category        string  `json:"category"`
+	TransactionType string  `json:"transaction_type"`
+	DayOfMonth      int     `json:"day_of_month"`
+	Amount          float64 `json:"amount"`
+}
+
+type Point struct {
+	Date        string  `json:"date"`
+	Expected    float64 `json:"expected"`
+	Pessimistic float64 `json:"pessimistic"`
+}
+
+type Forecast struct {
+	CurrentBalance     float64     `json:"current_balance"`
+	Until              string      `json:"until"`
+	DailyDiscretionary float64     `json:"daily_discretionary"`
+	Recurring          []Recurring `json:"recurring"`
+	Points             []Point     `json:"points"`
+}
+
+type patternKey struct {
+	category        string
+	transactionType string
+}
+
+// DetectRecurring finds income and expenses that show up about once a
+// budget month of p with a similar amount. The second result tells which
+// entries belong to a recurring pattern.
+func DetectRecurring(history []Entry, p spender.Preferences) ([]Recurring, []bool) {
+	loc := p.Location()
+	groups := make(map[patternKey][]int)
+	for i, e := range history {
+		k := patternKey{e.Category, e.TransactionType}
+		groups[k] = append(groups[k], i)
+	}
+
+	recurring := []Recurring{}
+	inPattern := make([]bool, len(history))
+	for k, idx := range groups {
+		months := make(map[string]bool)
+		days := make([]int, 0, len(idx))
+		amounts := make([]float64, 0, len(idx))
+		for _, i := range idx {
+			from, _ := p.MonthOf(history[i].Date)
+			months[from.Format("2006-01")] = true
+			days = append(days, history[i].Date.In(loc).Day())
+			amounts = append(amounts, history[i].Amount)
+		}
+		// more than one entry a month on average is day-to-day spending
+		if len(months) < minRecurringMonths || len(idx) > len(months) {
+			continue
+		}
+
+		mean, stddev := meanStdDev(amounts)
+		if mean == 0 || stddev/mean > maxAmountSpread {
+			continue
+		}
+
+		sort.Ints(days)
+		recurring = append(recurring, Recurring{
+			Category:        k.category,
+			TransactionType: k.transactionType,
+			DayOfMonth:      days[len(days)/2],
+			Amount:          round(mean),
+		})
+		for _, i := range idx {
+			inPattern[i] = true
+		}
+	}
+
+	sort.Slice(recurring, func(i, j int) bool {
+		if recurring[i].DayOfMonth != recurring[j].DayOfMonth {
+			return recurring[i].DayOfMonth < recurring[j].DayOfMonth
+		}
+		return recurring[i].Category < recurring[j].Category
+	})
+	return recurring, inPattern
+}
+
+// Project builds the day by day balance from the day after today until
+// the given day, both in the time zone of p. The pessimistic curve spends
+// one standard deviation more than the average discretionary day.
+func Project(history []Entry, balance float64, today, until time.Time, p spender.Preferences) Forecast {
+	recurring, inPattern := DetectRecurring(history, p)
+
+	start := truncateDay(today).AddDate(0, 0, -discretionaryDays)
+	daily := make([]float64, discretionaryDays)
+	for i, e := range history {
+		if inPattern[i] || e.TransactionType == "income" || e.Date.Before(start) {
+			continue
+		}
+		d := int(truncateDay(e.Date.In(today.Location())).Sub(start).Hours() / 24)
+		if d >= 0 && d < discretionaryDays {
+			daily[d] += e.Amount
+		}
+	}
+	mean, stddev := meanStdDev(daily)
+
+	f := Forecast{
+		CurrentBalance:     round(balance),
+		Until:              until.Format(time.DateOnly),
+		DailyDiscretionary: round(mean),
+		Recurring:          recurring,
+		Points:             []Point{},
+	}
+
+	expected, pessimistic := balance, balance
+	for day := truncateDay(today).AddDate(0, 0, 1); !day.After(until); day = day.AddDate(0, 0, 1) {
+		expected -= mean
+		pessimistic -= mean + stddev
+		for _, r := range recurring {
+			if dueOn(r.DayOfMonth, day) {
+				if r.TransactionType == "income" {
+					expected += r.Amount
+					pessimistic += r.Amount
+				} else {
+					expected -= r.Amount
+					pessimistic -= r.Amount
+				}
+			}
+		}
+		f.Points = append(f.Points, Point{
+			Date:        day.Format(time.DateOnly),
+			Expected:    round(expected),
+			Pessimistic: round(pessimistic),
+		})
+	}
+
+	return f
+}
+
+// dueOn reports whether a monthly pattern falls on day, moving days that
+// do not exist in short months to the last day of the month.
+func dueOn(dayOfMonth int, day time.Time) bool {
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	if dayOfMonth > last {
+		dayOfMonth = last
+	}
+	return day.Day() == dayOfMonth
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+type handler struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func New(db *sql.DB) *handler {
+	return &handler{db, time.Now}
+}
+
+const (
+	balanceStmt = `SELECT COALESCE(SUM(CASE WHEN transaction_type = 'income' THEN amount ELSE -amount END), 0) FROM transaction WHERE spender_id = $1;`
+	historyStmt = `SELECT date, amount, category, transaction_type FROM transaction WHERE spender_id = $1 AND date >= $2 ORDER BY date, id;`
+)
+
+// GetSpenderForecast projects the balance of the spender in its time zone,
+// until the end of its current budget month by default.
+func (h handler) GetSpenderForecast(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+	spenderID := c.Param("id")
+
+	p, err := spender.GetPreferences(ctx, h.db, spenderID)
+	if err != nil && err != spender.ErrNotFound {
+		logger.Error("query preferences error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	loc := p.Location()
+
+	now := h.now().In(loc)
+	today := truncateDay(now)
+	_, end := p.MonthOf(now)
+	until := end.AddDate(0, 0, -1)
+	if v := c.QueryParam("until"); v != "" {
+		t, err := time.ParseInLocation(time.DateOnly, v, loc)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "until must be YYYY-MM-DD")
+		}
+		until = t
+	}
+	if !until.After(today) || until.Sub(today) > maxHorizonDays*24*time.Hour {
+		return c.JSON(http.StatusBadRequest, "until must be within a year after today")
+	}
+
+	var balance float64
+	if err := h.db.QueryRowContext(ctx, balanceStmt, spenderID).Scan(&balance); err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	rows, err := h.db.QueryContext(ctx, historyStmt, spenderID, today.AddDate(0, 0, -lookbackDays))
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	var history []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.Date, &e.Amount, &e.Category, &e.TransactionType); err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		e.Date = e.Date.In(loc)
+		history = append(history, e)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("rows error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, Project(history, balance, today, until, p))
+}
@@ -0,0 +1,217 @@
+package forecast
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func day(s string) time.Time {
+	t, _ := time.Parse(time.DateOnly, s)
+	return t
+}
+
+const prefsStmt = `SELECT timezone, locale, currency, month_start_day FROM spender WHERE id = $1;`
+
+func prefsRows(timezone string, monthStartDay int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"timezone", "locale", "currency", "month_start_day"}).AddRow(timezone, "th-TH", "THB", monthStartDay)
+}
+
+func salaryAndRent() []Entry {
+	return []Entry{
+		{day("2024-02-25"), 30000, "Salary", "income"},
+		{day("2024-03-01"), 8000, "Rent", "expense"},
+		{day("2024-03-25"), 30000, "Salary", "income"},
+		{day("2024-04-01"), 8000, "Rent", "expense"},
+		{day("2024-04-25"), 30500, "Salary", "income"},
+		{day("2024-05-01"), 8000, "Rent", "expense"},
+		{day("2024-05-10"), 100, "Food", "expense"},
+	}
+}
+
+func TestDetectRecurring(t *testing.T) {
+	recurring, inPattern := DetectRecurring(salaryAndRent(), spender.DefaultPreferences)
+
+	assert.Equal(t, []Recurring{
+		{Category: "Rent", TransactionType: "expense", DayOfMonth: 1, Amount: 8000},
+		{Category: "Salary", TransactionType: "income", DayOfMonth: 25, Amount: 30166.67},
+	}, recurring)
+	assert.Equal(t, []bool{true, true, true, true, true, true, false}, inPattern)
+
+	t.Run("should count the budget months of the spender", func(t *testing.T) {
+		p := spender.Preferences{Timezone: "Asia/Bangkok", MonthStartDay: 25}
+		// the first two fall in the budget month starting on 25 February
+		history := []Entry{
+			{day("2024-02-26"), 500, "Gym", "expense"},
+			{day("2024-03-24"), 500, "Gym", "expense"},
+			{day("2024-04-20"), 500, "Gym", "expense"},
+		}
+
+		recurring, _ := DetectRecurring(history, p)
+
+		assert.Empty(t, recurring)
+	})
+
+	t.Run("should read the day in the spender time zone", func(t *testing.T) {
+		bkk, _ := time.LoadLocation("Asia/Bangkok")
+		history := []Entry{
+			{time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC).In(bkk), 8000, "Rent", "expense"},
+			{time.Date(2024, 3, 31, 18, 0, 0, 0, time.UTC).In(bkk), 8000, "Rent", "expense"},
+			{time.Date(2024, 4, 30, 18, 0, 0, 0, time.UTC).In(bkk), 8000, "Rent", "expense"},
+		}
+
+		recurring, _ := DetectRecurring(history, spender.DefaultPreferences)
+
+		assert.Equal(t, []Recurring{{Category: "Rent", TransactionType: "expense", DayOfMonth: 1, Amount: 8000}}, recurring)
+	})
+}
+
+func TestProject(t *testing.T) {
+	p := spender.Preferences{Timezone: "UTC", MonthStartDay: 1}
+	f := Project(salaryAndRent(), 1000, day("2024-05-23"), day("2024-05-26"), p)
+
+	assert.Equal(t, 1000.0, f.CurrentBalance)
+	assert.Equal(t, "2024-05-26", f.Until)
+	// a single 100 food expense within the last 90 days
+	assert.Equal(t, 1.11, f.DailyDiscretionary)
+	assert.Len(t, f.Points, 3)
+	assert.Equal(t, "2024-05-24", f.Points[0].Date)
+	assert.Equal(t, 998.89, f.Points[0].Expected)
+	assert.Equal(t, "2024-05-25", f.Points[1].Date)
+	assert.Equal(t, 31164.45, f.Points[1].Expected)
+	assert.Less(t, f.Points[2].Pessimistic, f.Points[2].Expected)
+}
+
+func TestDueOn(t *testing.T) {
+	assert.True(t, dueOn(31, day("2024-02-29")))
+	assert.False(t, dueOn(31, day("2024-02-28")))
+	assert.True(t, dueOn(15, day("2024-02-15")))
+}
+
+func TestGetSpenderForecast(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+	now := func() time.Time { return time.Date(2024, 5, 23, 10, 0, 0, 0, time.UTC) }
+	bkk, _ := time.LoadLocation("Asia/Bangkok")
+
+	t.Run("forecast until end of month by default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/forecast", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+		mock.ExpectQuery(balanceStmt).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(1000.0))
+		mock.ExpectQuery(historyStmt).WithArgs("1", time.Date(2023, 11, 25, 0, 0, 0, 0, bkk)).
+			WillReturnRows(sqlmock.NewRows([]string{"date", "amount", "category", "transaction_type"}).
+				AddRow(day("2024-05-10"), 100.0, "Food", "expense"))
+
+		h := &handler{db, now}
+		err := h.GetSpenderForecast(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"until":"2024-05-31"`)
+		assert.Contains(t, rec.Body.String(), `{"date":"2024-05-31","expected":991.11,"pessimistic":`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("forecast until the end of the budget month", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/forecast", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		// already 25 May in Bangkok, the first day of a budget month
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 25))
+		mock.ExpectQuery(balanceStmt).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(1000.0))
+		mock.ExpectQuery(historyStmt).WithArgs("1", time.Date(2023, 11, 27, 0, 0, 0, 0, bkk)).
+			WillReturnRows(sqlmock.NewRows([]string{"date", "amount", "category", "transaction_type"}))
+
+		h := &handler{db, func() time.Time { return time.Date(2024, 5, 24, 18, 0, 0, 0, time.UTC) }}
+		err := h.GetSpenderForecast(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"until":"2024-06-24"`)
+		assert.Contains(t, rec.Body.String(), `{"date":"2024-05-26",`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("until in the past", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/forecast?until=2024-05-01", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnError(sql.ErrNoRows)
+
+		h := &handler{db, now}
+		err := h.GetSpenderForecast(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("history rows error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/forecast", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+		mock.ExpectQuery(balanceStmt).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(1000.0))
+		mock.ExpectQuery(historyStmt).WithArgs("1", time.Date(2023, 11, 25, 0, 0, 0, 0, bkk)).
+			WillReturnRows(sqlmock.NewRows([]string{"date", "amount", "category", "transaction_type"}).
+				AddRow(day("2024-05-10"), 100.0, "Food", "expense").
+				RowError(0, assert.AnError))
+
+		h := &handler{db, now}
+		err := h.GetSpenderForecast(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("balance query error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/forecast?until=2024-06-30", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+		mock.ExpectQuery(balanceStmt).WithArgs("1").WillReturnError(assert.AnError)
+
+		h := &handler{db, now}
+		err := h.GetSpenderForecast(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
@@ -0,0 +1,519 @@
+package household
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mailer"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// ActorHeader names the spender a request is made for. Basic auth tells the
+// client is trusted, the header tells which member it acts as.
+//
+// The header is not authenticated: every client shares the one basic auth
+// credential, so any of them may act as any spender, and the roles only
+// guard honest clients. Nor do they cover the unscoped routes such as
+// PUT /transactions/:id, which let a viewer edit the transactions of the
+// household. Only trusted clients, such as the HongJot app, may be given
+// the credential until spenders log in with their own.
+const ActorHeader = "X-Spender-ID"
+
+var (
+	ErrNoActor        = errors.New(ActorHeader + " header must be the id of the acting spender")
+	ErrUnknownActor   = errors.New("acting spender not found")
+	ErrNotFound       = errors.New("household not found")
+	ErrMemberNotFound = errors.New("member not found")
+	ErrReadOnly       = errors.New("viewers cannot change the household")
+	ErrNotOwner       = errors.New("only owners can manage the household")
+	ErrInvalidName    = errors.New("name is required, at most 100 characters")
+	ErrInvalidRole    = errors.New("role must be owner, member or viewer")
+	ErrLastOwner      = errors.New("a household must keep an owner")
+)
+
+// Role is what a member may do in a household.
+type Role string
+
+const (
+	// RoleOwner manages the household on top of what members do.
+	RoleOwner Role = "owner"
+	// RoleMember reads the household and edits the transactions of its
+	// members.
+	RoleMember Role = "member"
+	// RoleViewer only reads the household.
+	RoleViewer Role = "viewer"
+)
+
+func (r Role) valid() bool {
+	return r == RoleOwner || r == RoleMember || r == RoleViewer
+}
+
+func (r Role) canWrite() bool {
+	return r == RoleOwner || r == RoleMember
+}
+
+const (
+	cStmt         = `INSERT INTO household (name) VALUES ($1) RETURNING id, created_at;`
+	getStmt       = `SELECT id, name, created_at FROM household WHERE id = $1;`
+	listStmt      = `SELECT h.id, h.name, h.created_at, m.role FROM household h JOIN household_member m ON m.household_id = h.id WHERE m.spender_id = $1 ORDER BY h.id;`
+	renameStmt    = `UPDATE household SET name = $1 WHERE id = $2 RETURNING created_at;`
+	deleteStmt    = `DELETE FROM household WHERE id = $1;`
+	spenderStmt   = `SELECT email FROM spender WHERE id = $1;`
+	roleStmt      = `SELECT role FROM household_member WHERE household_id = $1 AND spender_id = $2;`
+	membersStmt   = `SELECT s.id, s.name, s.email, m.role, m.joined_at FROM household_member m JOIN spender s ON s.id = m.spender_id WHERE m.household_id = $1 ORDER BY m.joined_at, s.id;`
+	addMemberStmt = `INSERT INTO household_member (household_id, spender_id, role) VALUES ($1, $2, $3) ON CONFLICT (household_id, spender_id) DO UPDATE SET role = EXCLUDED.role;`
+	setRoleStmt   = `UPDATE household_member SET role = $1 WHERE household_id = $2 AND spender_id = $3;`
+	removeStmt    = `DELETE FROM household_member WHERE household_id = $1 AND spender_id = $2;`
+	// ownersStmt locks the owners so two of them cannot step down at once.
+	ownersStmt = `SELECT spender_id FROM household_member WHERE household_id = $1 AND role = 'owner' FOR UPDATE;`
+)
+
+type Household struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role is that of the acting spender.
+	Role    Role     `json:"role,omitempty"`
+	Members []Member `json:"members,omitempty"`
+}
+
+type Member struct {
+	SpenderID int64     `json:"spender_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+// Service is the household business logic. Every call is made by an acting
+// spender and checks its role first.
+type Service struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+	now  func() time.Time
+}
+
+func NewService(cfg config.FeatureFlag, db *sql.DB) Service {
+	return Service{cfg, db, time.Now}
+}
+
+func validName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// role is that of actor in the household, ErrNotFound for outsiders so they
+// do not learn which households exist.
+func (s Service) role(ctx context.Context, q queryer, id, actor int64) (Role, error) {
+	var r Role
+	err := q.QueryRowContext(ctx, roleStmt, id, actor).Scan(&r)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return r, err
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s Service) canRead(ctx context.Context, id, actor int64) (Role, error) {
+	return s.role(ctx, s.db, id, actor)
+}
+
+func (s Service) canWrite(ctx context.Context, id, actor int64) (Role, error) {
+	r, err := s.role(ctx, s.db, id, actor)
+	if err == nil && !r.canWrite() {
+		return r, ErrReadOnly
+	}
+	return r, err
+}
+
+func (s Service) canManage(ctx context.Context, q queryer, id, actor int64) error {
+	r, err := s.role(ctx, q, id, actor)
+	if err == nil && r != RoleOwner {
+		return ErrNotOwner
+	}
+	return err
+}
+
+// Create makes a household with actor as its owner.
+func (s Service) Create(ctx context.Context, actor int64, name string) (Household, error) {
+	name, err := validName(name)
+	if err != nil {
+		return Household{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Household{}, err
+	}
+	defer tx.Rollback()
+
+	var email string
+	if err := tx.QueryRowContext(ctx, spenderStmt, actor).Scan(&email); err == sql.ErrNoRows {
+		return Household{}, ErrUnknownActor
+	} else if err != nil {
+		return Household{}, err
+	}
+
+	hh := Household{Name: name, Role: RoleOwner}
+	if err := tx.QueryRowContext(ctx, cStmt, name).Scan(&hh.ID, &hh.CreatedAt); err != nil {
+		return Household{}, err
+	}
+	if _, err := tx.ExecContext(ctx, addMemberStmt, hh.ID, actor, RoleOwner); err != nil {
+		return Household{}, err
+	}
+	return hh, tx.Commit()
+}
+
+// List returns the households actor is a member of.
+func (s Service) List(ctx context.Context, actor int64) ([]Household, error) {
+	rows, err := s.db.QueryContext(ctx, listStmt, actor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	households := []Household{}
+	for rows.Next() {
+		var hh Household
+		if err := rows.Scan(&hh.ID, &hh.Name, &hh.CreatedAt, &hh.Role); err != nil {
+			return nil, err
+		}
+		households = append(households, hh)
+	}
+	return households, rows.Err()
+}
+
+// Get returns the household along with its members.
+func (s Service) Get(ctx context.Context, id, actor int64) (Household, error) {
+	r, err := s.canRead(ctx, id, actor)
+	if err != nil {
+		return Household{}, err
+	}
+
+	hh := Household{Role: r}
+	if err := s.db.QueryRowContext(ctx, getStmt, id).Scan(&hh.ID, &hh.Name, &hh.CreatedAt); err == sql.ErrNoRows {
+		return Household{}, ErrNotFound
+	} else if err != nil {
+		return Household{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, membersStmt, id)
+	if err != nil {
+		return Household{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.SpenderID, &m.Name, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			return Household{}, err
+		}
+		hh.Members = append(hh.Members, m)
+	}
+	return hh, rows.Err()
+}
+
+func (s Service) Rename(ctx context.Context, id, actor int64, name string) (Household, error) {
+	name, err := validName(name)
+	if err != nil {
+		return Household{}, err
+	}
+	if err := s.canManage(ctx, s.db, id, actor); err != nil {
+		return Household{}, err
+	}
+
+	hh := Household{ID: id, Name: name, Role: RoleOwner}
+	if err := s.db.QueryRowContext(ctx, renameStmt, name, id).Scan(&hh.CreatedAt); err == sql.ErrNoRows {
+		return Household{}, ErrNotFound
+	} else if err != nil {
+		return Household{}, err
+	}
+	return hh, nil
+}
+
+// Delete removes the household, the transactions of its members stay with
+// them.
+func (s Service) Delete(ctx context.Context, id, actor int64) error {
+	if err := s.canManage(ctx, s.db, id, actor); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, deleteStmt, id)
+	return err
+}
+
+// SetRole changes the role of a member, only owners may.
+func (s Service) SetRole(ctx context.Context, id, actor, spenderID int64, role Role) error {
+	if !role.valid() {
+		return ErrInvalidRole
+	}
+	return s.changeMember(ctx, id, actor, spenderID, role)
+}
+
+// RemoveMember takes a spender out of the household. Owners remove anyone,
+// other members only themselves.
+func (s Service) RemoveMember(ctx context.Context, id, actor, spenderID int64) error {
+	return s.changeMember(ctx, id, actor, spenderID, "")
+}
+
+// changeMember sets the role of spenderID, or removes it when role is
+// empty, making sure an owner is left.
+func (s Service) changeMember(ctx context.Context, id, actor, spenderID int64, role Role) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// leaving is the one change members make on their own
+	if role != "" || actor != spenderID {
+		if err := s.canManage(ctx, tx, id, actor); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, ownersStmt, id)
+	if err != nil {
+		return err
+	}
+	var owners []int64
+	for rows.Next() {
+		var owner int64
+		if err := rows.Scan(&owner); err != nil {
+			rows.Close()
+			return err
+		}
+		owners = append(owners, owner)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(owners) == 1 && owners[0] == spenderID && role != RoleOwner {
+		return ErrLastOwner
+	}
+
+	var res sql.Result
+	if role == "" {
+		res, err = tx.ExecContext(ctx, removeStmt, id, spenderID)
+	} else {
+		res, err = tx.ExecContext(ctx, setRoleStmt, role, id, spenderID)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrMemberNotFound
+	}
+	return tx.Commit()
+}
+
+type handler struct {
+	flag   config.FeatureFlag
+	db     *sql.DB
+	mailer mailer.Mailer
+}
+
+func New(cfg config.FeatureFlag, db *sql.DB) *handler {
+	return &handler{flag: cfg, db: db}
+}
+
+// WithMailer tells invited spenders about their invitations through m.
+func (h *handler) WithMailer(m mailer.Mailer) *handler {
+	h.mailer = m
+	return h
+}
+
+func (h handler) service() Service {
+	return NewService(h.flag, h.db)
+}
+
+// actor reads the acting spender of ActorHeader, trusting the client as
+// told there.
+func actor(c echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Request().Header.Get(ActorHeader), 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrNoActor
+	}
+	return id, nil
+}
+
+// params reads the acting spender and the household id of the path.
+func params(c echo.Context) (id, act int64, err error) {
+	act, err = actor(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	id, err = strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, 0, errBadID
+	}
+	return id, act, nil
+}
+
+var errBadID = errors.New("invalid household id")
+
+// status is the HTTP status of the errors of the package.
+func status(err error) int {
+	switch err {
+	case ErrNoActor, errBadID, ErrInvalidName, ErrInvalidRole, spender.ErrInvalidEmail, ErrNotMember, transaction.ErrInvalidMonth,
+		category.ErrUnknownCategory, category.ErrTypeMismatch:
+		return http.StatusBadRequest
+	case ErrUnknownActor, ErrReadOnly, ErrNotOwner:
+		return http.StatusForbidden
+	case ErrNotFound, ErrMemberNotFound, ErrInvitationNotFound, transaction.ErrNotFound:
+		return http.StatusNotFound
+	case ErrLastOwner, ErrAlreadyMember, transaction.ErrSpenderInactive:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// fail answers with err, logging those that are not the caller's fault.
+func fail(c echo.Context, msg string, err error) error {
+	code := status(err)
+	if code == http.StatusInternalServerError {
+		mlog.L(c).Error(msg, zap.Error(err))
+	}
+	return c.JSON(code, err.Error())
+}
+
+func (h handler) Create(c echo.Context) error {
+	act, err := actor(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	hh, err := h.service().Create(c.Request().Context(), act, req.Name)
+	if err != nil {
+		return fail(c, "create household error", err)
+	}
+	return c.JSON(http.StatusCreated, hh)
+}
+
+func (h handler) GetAll(c echo.Context) error {
+	act, err := actor(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	households, err := h.service().List(c.Request().Context(), act)
+	if err != nil {
+		return fail(c, "query households error", err)
+	}
+	return c.JSON(http.StatusOK, households)
+}
+
+func (h handler) Get(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	hh, err := h.service().Get(c.Request().Context(), id, act)
+	if err != nil {
+		return fail(c, "query household error", err)
+	}
+	return c.JSON(http.StatusOK, hh)
+}
+
+func (h handler) Rename(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	hh, err := h.service().Rename(c.Request().Context(), id, act, req.Name)
+	if err != nil {
+		return fail(c, "rename household error", err)
+	}
+	return c.JSON(http.StatusOK, hh)
+}
+
+func (h handler) Delete(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	if err := h.service().Delete(c.Request().Context(), id, act); err != nil {
+		return fail(c, "delete household error", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func memberID(c echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("spender_id"), 10, 64)
+	if err != nil {
+		return 0, ErrMemberNotFound
+	}
+	return id, nil
+}
+
+func (h handler) SetRole(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	spenderID, err := memberID(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var req struct {
+		Role Role `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.service().SetRole(c.Request().Context(), id, act, spenderID, req.Role); err != nil {
+		return fail(c, "set member role error", err)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"spender_id": spenderID, "role": req.Role})
+}
+
+func (h handler) RemoveMember(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	spenderID, err := memberID(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	if err := h.service().RemoveMember(c.Request().Context(), id, act, spenderID); err != nil {
+		return fail(c, "remove member error", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
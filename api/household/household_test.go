@@ -0,0 +1,235 @@
+package household
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// call makes a request acting as actor, an empty actor sends no header.
+// params are the path parameter names and values, in pairs.
+func call(method, body, actor string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if actor != "" {
+		req.Header.Set(ActorHeader, actor)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names, values = append(names, params[i]), append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	return c, rec
+}
+
+func roleRows(role Role) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"role"}).AddRow(role)
+}
+
+func TestCreateHousehold(t *testing.T) {
+	t.Run("the creator owns the household", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"name": " Jot family "}`, "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		at := time.Date(2024, 5, 18, 10, 0, 0, 0, time.UTC)
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("hong@jot.ok"))
+		mock.ExpectQuery(cStmt).WithArgs("Jot family").WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, at))
+		mock.ExpectExec(addMemberStmt).WithArgs(int64(7), int64(1), RoleOwner).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 7, "name": "Jot family", "created_at": "2024-05-18T10:00:00Z", "role": "owner"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("without acting spender", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"name": "Jot family"}`, "")
+
+		err := New(config.FeatureFlag{}, nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("unknown acting spender", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"name": "Jot family"}`, "9")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderStmt).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows([]string{"email"}))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("without name", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"name": "  "}`, "1")
+
+		err := New(config.FeatureFlag{}, nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestGetHousehold(t *testing.T) {
+	t.Run("with its members", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "", "2", "id", "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		at := time.Date(2024, 5, 18, 10, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleViewer))
+		mock.ExpectQuery(getStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(7, "Jot family", at))
+		mock.ExpectQuery(membersStmt).WithArgs(int64(7)).WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "email", "role", "joined_at"}).
+				AddRow(1, "Hong", "hong@jot.ok", "owner", at).
+				AddRow(2, "Jot", "jot@hong.ok", "viewer", at))
+
+		err := New(config.FeatureFlag{}, db).Get(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 7, "name": "Jot family", "created_at": "2024-05-18T10:00:00Z", "role": "viewer", "members": [
+			{"spender_id": 1, "name": "Hong", "email": "hong@jot.ok", "role": "owner", "joined_at": "2024-05-18T10:00:00Z"},
+			{"spender_id": 2, "name": "Jot", "email": "jot@hong.ok", "role": "viewer", "joined_at": "2024-05-18T10:00:00Z"}
+		]}`, rec.Body.String())
+	})
+
+	t.Run("outsiders do not see it", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "", "3", "id", "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(3)).WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+		err := New(config.FeatureFlag{}, db).Get(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestRenameHouseholdOwnersOnly(t *testing.T) {
+	for _, role := range []Role{RoleMember, RoleViewer} {
+		t.Run(string(role), func(t *testing.T) {
+			c, rec := call(http.MethodPatch, `{"name": "Jot family"}`, "2", "id", "7")
+
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+			mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(role))
+
+			err := New(config.FeatureFlag{}, db).Rename(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestChangeMembers(t *testing.T) {
+	owners := func(ids ...int64) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"spender_id"})
+		for _, id := range ids {
+			rows.AddRow(id)
+		}
+		return rows
+	}
+
+	t.Run("owner makes a member viewer", func(t *testing.T) {
+		c, rec := call(http.MethodPut, `{"role": "viewer"}`, "1", "id", "7", "spender_id", "2")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(ownersStmt).WithArgs(int64(7)).WillReturnRows(owners(1))
+		mock.ExpectExec(setRoleStmt).WithArgs(RoleViewer, int64(7), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).SetRole(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"spender_id": 2, "role": "viewer"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("the last owner cannot step down", func(t *testing.T) {
+		c, rec := call(http.MethodPut, `{"role": "member"}`, "1", "id", "7", "spender_id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(ownersStmt).WithArgs(int64(7)).WillReturnRows(owners(1))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).SetRole(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("an owner leaves when another is left", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "", "1", "id", "7", "spender_id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(ownersStmt).WithArgs(int64(7)).WillReturnRows(owners(1, 3))
+		mock.ExpectExec(removeStmt).WithArgs(int64(7), int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).RemoveMember(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a member cannot remove another", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "", "2", "id", "7", "spender_id", "3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleMember))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).RemoveMember(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		c, rec := call(http.MethodPut, `{"role": "admin"}`, "1", "id", "7", "spender_id", "2")
+
+		err := New(config.FeatureFlag{}, nil).SetRole(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,295 @@
+package household
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mailer"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// invitationTTL is how long an invitation may be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrAlreadyMember      = errors.New("spender is a member already")
+)
+
+const (
+	// inviteStmt renews the pending invitation of the email, if any.
+	inviteStmt = `INSERT INTO household_invitation (household_id, email, role, invited_by, expires_at) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (household_id, email) WHERE accepted_at IS NULL
+DO UPDATE SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by, created_at = NOW(), expires_at = EXCLUDED.expires_at
+RETURNING id, created_at;`
+	isMemberStmt      = `SELECT EXISTS (SELECT 1 FROM household_member m JOIN spender s ON s.id = m.spender_id WHERE m.household_id = $1 AND s.email = $2);`
+	invitationColumns = `i.id, i.household_id, h.name, i.email, i.role, i.created_at, i.expires_at`
+	invitationsStmt   = `SELECT ` + invitationColumns + `
+FROM household_invitation i JOIN household h ON h.id = i.household_id
+WHERE i.household_id = $1 AND i.accepted_at IS NULL AND i.expires_at > NOW()
+ORDER BY i.id;`
+	pendingStmt = `SELECT ` + invitationColumns + `
+FROM household_invitation i JOIN household h ON h.id = i.household_id JOIN spender s ON s.email = i.email
+WHERE s.id = $1 AND i.accepted_at IS NULL AND i.expires_at > NOW()
+ORDER BY i.id;`
+	revokeStmt = `DELETE FROM household_invitation WHERE id = $1 AND household_id = $2 AND accepted_at IS NULL;`
+	acceptStmt = `UPDATE household_invitation i SET accepted_at = NOW() FROM spender s
+WHERE i.id = $1 AND s.id = $2 AND s.email = i.email AND i.accepted_at IS NULL AND i.expires_at > NOW()
+RETURNING i.household_id, i.role;`
+	declineStmt = `DELETE FROM household_invitation i USING spender s WHERE i.id = $1 AND s.id = $2 AND s.email = i.email AND i.accepted_at IS NULL;`
+)
+
+// Invitation asks whoever owns Email to join a household with Role.
+type Invitation struct {
+	ID          int64 `json:"id"`
+	HouseholdID int64 `json:"household_id"`
+	// Household is the name of the household.
+	Household string    `json:"household,omitempty"`
+	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Invite asks the spender with email to join the household, only owners
+// may. Inviting an email again renews its invitation.
+func (s Service) Invite(ctx context.Context, id, actor int64, email string, role Role) (Invitation, error) {
+	email, err := spender.NormalizeEmail(email)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if !role.valid() {
+		return Invitation{}, ErrInvalidRole
+	}
+	if err := s.canManage(ctx, s.db, id, actor); err != nil {
+		return Invitation{}, err
+	}
+
+	var member bool
+	if err := s.db.QueryRowContext(ctx, isMemberStmt, id, email).Scan(&member); err != nil {
+		return Invitation{}, err
+	} else if member {
+		return Invitation{}, ErrAlreadyMember
+	}
+
+	inv := Invitation{HouseholdID: id, Email: email, Role: role, ExpiresAt: s.now().Add(invitationTTL).UTC()}
+	var created time.Time
+	if err := s.db.QueryRowContext(ctx, getStmt, id).Scan(&inv.HouseholdID, &inv.Household, &created); err == sql.ErrNoRows {
+		return Invitation{}, ErrNotFound
+	} else if err != nil {
+		return Invitation{}, err
+	}
+	err = s.db.QueryRowContext(ctx, inviteStmt, id, email, role, actor, inv.ExpiresAt).Scan(&inv.ID, &inv.CreatedAt)
+	return inv, err
+}
+
+// Invitations returns the pending invitations of the household.
+func (s Service) Invitations(ctx context.Context, id, actor int64) ([]Invitation, error) {
+	if _, err := s.canRead(ctx, id, actor); err != nil {
+		return nil, err
+	}
+	return s.invitations(ctx, invitationsStmt, id)
+}
+
+// Pending returns the invitations sent to the email of actor.
+func (s Service) Pending(ctx context.Context, actor int64) ([]Invitation, error) {
+	return s.invitations(ctx, pendingStmt, actor)
+}
+
+func (s Service) invitations(ctx context.Context, stmt string, arg int64) ([]Invitation, error) {
+	rows, err := s.db.QueryContext(ctx, stmt, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var inv Invitation
+		if err := rows.Scan(&inv.ID, &inv.HouseholdID, &inv.Household, &inv.Email, &inv.Role, &inv.CreatedAt, &inv.ExpiresAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// Revoke withdraws a pending invitation, only owners may.
+func (s Service) Revoke(ctx context.Context, id, actor, invitationID int64) error {
+	if err := s.canManage(ctx, s.db, id, actor); err != nil {
+		return err
+	}
+	return affected(s.db.ExecContext(ctx, revokeStmt, invitationID, id))
+}
+
+// Accept makes actor a member with the role it was invited with, when the
+// invitation was sent to its email.
+func (s Service) Accept(ctx context.Context, invitationID, actor int64) (Household, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Household{}, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var role Role
+	if err := tx.QueryRowContext(ctx, acceptStmt, invitationID, actor).Scan(&id, &role); err == sql.ErrNoRows {
+		return Household{}, ErrInvitationNotFound
+	} else if err != nil {
+		return Household{}, err
+	}
+	if _, err := tx.ExecContext(ctx, addMemberStmt, id, actor, role); err != nil {
+		return Household{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Household{}, err
+	}
+	return s.Get(ctx, id, actor)
+}
+
+// Decline drops an invitation sent to the email of actor.
+func (s Service) Decline(ctx context.Context, invitationID, actor int64) error {
+	return affected(s.db.ExecContext(ctx, declineStmt, invitationID, actor))
+}
+
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+func invitationID(c echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("invitation_id"), 10, 64)
+	if err != nil {
+		return 0, ErrInvitationNotFound
+	}
+	return id, nil
+}
+
+func (h handler) Invite(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var req struct {
+		Email string `json:"email"`
+		Role  Role   `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.Role == "" {
+		req.Role = RoleMember
+	}
+
+	ctx := c.Request().Context()
+	inv, err := h.service().Invite(ctx, id, act, req.Email, req.Role)
+	if err != nil {
+		return fail(c, "invite error", err)
+	}
+
+	// the invitation is saved already and listed to the invitee, a failed
+	// email must not fail the call
+	if h.mailer != nil {
+		err := h.mailer.Send(ctx, mailer.Message{
+			To:      inv.Email,
+			Subject: "You are invited to " + inv.Household + " on HongJot",
+			Body: fmt.Sprintf("Hi,\n\nYou are invited to join the household %s as %s.\n\nAccept it from the HongJot app before %s.\n",
+				inv.Household, inv.Role, inv.ExpiresAt.Format(time.RFC1123)),
+		})
+		if err != nil {
+			mlog.L(c).Error("send invitation email error", zap.Error(err))
+		}
+	}
+	return c.JSON(http.StatusCreated, inv)
+}
+
+func (h handler) GetInvitations(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	invitations, err := h.service().Invitations(c.Request().Context(), id, act)
+	if err != nil {
+		return fail(c, "query invitations error", err)
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+func (h handler) Revoke(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	invID, err := invitationID(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	if err := h.service().Revoke(c.Request().Context(), id, act, invID); err != nil {
+		return fail(c, "revoke invitation error", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetPendingInvitations lists the invitations of the acting spender.
+func (h handler) GetPendingInvitations(c echo.Context) error {
+	act, err := actor(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	invitations, err := h.service().Pending(c.Request().Context(), act)
+	if err != nil {
+		return fail(c, "query invitations error", err)
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+func (h handler) Accept(c echo.Context) error {
+	act, err := actor(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	invID, err := invitationID(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	hh, err := h.service().Accept(c.Request().Context(), invID, act)
+	if err != nil {
+		return fail(c, "accept invitation error", err)
+	}
+	return c.JSON(http.StatusOK, hh)
+}
+
+func (h handler) Decline(c echo.Context) error {
+	act, err := actor(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	invID, err := invitationID(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	if err := h.service().Decline(c.Request().Context(), invID, act); err != nil {
+		return fail(c, "decline invitation error", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package household
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvite(t *testing.T) {
+	now := time.Date(2024, 5, 18, 10, 0, 0, 0, time.UTC)
+
+	t.Run("owner invites an email", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(isMemberStmt).WithArgs(int64(7), "jot@hong.ok").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(getStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(7, "Jot family", now))
+		mock.ExpectQuery(inviteStmt).WithArgs(int64(7), "jot@hong.ok", RoleViewer, int64(1), now.Add(invitationTTL)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, now))
+
+		s := NewService(config.FeatureFlag{}, db)
+		s.now = func() time.Time { return now }
+		inv, err := s.Invite(context.Background(), 7, 1, " Jot@Hong.OK ", RoleViewer)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Invitation{ID: 3, HouseholdID: 7, Household: "Jot family", Email: "jot@hong.ok", Role: RoleViewer, CreatedAt: now, ExpiresAt: now.Add(invitationTTL)}, inv)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("the invitee is told by email", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"email": "jot@hong.ok"}`, "1", "id", "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(isMemberStmt).WithArgs(int64(7), "jot@hong.ok").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(getStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(7, "Jot family", now))
+		mock.ExpectQuery(inviteStmt).WithArgs(int64(7), "jot@hong.ok", RoleMember, int64(1), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, now))
+
+		var messages []mailer.Message
+		h := New(config.FeatureFlag{}, db).WithMailer(mailer.Func(func(_ context.Context, m mailer.Message) error {
+			messages = append(messages, m)
+			return nil
+		}))
+		err := h.Invite(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		if assert.Len(t, messages, 1) {
+			assert.Equal(t, "jot@hong.ok", messages[0].To)
+			assert.Contains(t, messages[0].Body, "Jot family as member")
+		}
+	})
+
+	t.Run("a member already", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(isMemberStmt).WithArgs(int64(7), "jot@hong.ok").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		_, err := NewService(config.FeatureFlag{}, db).Invite(context.Background(), 7, 1, "jot@hong.ok", RoleMember)
+
+		assert.Equal(t, ErrAlreadyMember, err)
+	})
+
+	t.Run("members cannot invite", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleMember))
+
+		_, err := NewService(config.FeatureFlag{}, db).Invite(context.Background(), 7, 2, "jot@hong.ok", RoleMember)
+
+		assert.Equal(t, ErrNotOwner, err)
+	})
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	t.Run("join with the invited role", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "", "2", "invitation_id", "3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		at := time.Date(2024, 5, 18, 10, 0, 0, 0, time.UTC)
+		mock.ExpectBegin()
+		mock.ExpectQuery(acceptStmt).WithArgs(int64(3), int64(2)).WillReturnRows(sqlmock.NewRows([]string{"household_id", "role"}).AddRow(7, "viewer"))
+		mock.ExpectExec(addMemberStmt).WithArgs(int64(7), int64(2), RoleViewer).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleViewer))
+		mock.ExpectQuery(getStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(7, "Jot family", at))
+		mock.ExpectQuery(membersStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "role", "joined_at"}))
+
+		err := New(config.FeatureFlag{}, db).Accept(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 7, "name": "Jot family", "created_at": "2024-05-18T10:00:00Z", "role": "viewer"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("sent to another email, used or expired", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "", "4", "invitation_id", "3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(acceptStmt).WithArgs(int64(3), int64(4)).WillReturnRows(sqlmock.NewRows([]string{"household_id", "role"}))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Accept(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDeclineInvitation(t *testing.T) {
+	c, rec := call(http.MethodPost, "", "2", "invitation_id", "3")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectExec(declineStmt).WithArgs(int64(3), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := New(config.FeatureFlag{}, db).Decline(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,387 @@
+package household
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/labstack/echo/v4"
+)
+
+var ErrNotMember = errors.New("spender_id must be a member of the household")
+
+// The household ledger is the transactions of its current members, of any
+// role. Amounts are summed as recorded, members are expected to share a
+// currency, and dates are read with the preferences of the acting spender.
+const (
+	memberTransactions = `FROM transaction t JOIN household_member m ON m.spender_id = t.spender_id
+WHERE m.household_id = $1 AND ($2::timestamptz IS NULL OR t.date >= $2) AND ($3::timestamptz IS NULL OR t.date < $3)`
+	ledgerStmt = `SELECT t.id, t.date, t.amount, t.category, t.transaction_type, t.note, t.image_url, t.spender_id
+` + memberTransactions + `
+ORDER BY t.date, t.id
+LIMIT $4 OFFSET $5;`
+	ledgerTotalsStmt = `SELECT
+	COALESCE(SUM(t.amount) FILTER (WHERE t.transaction_type = 'income'), 0),
+	COALESCE(SUM(t.amount) FILTER (WHERE t.transaction_type <> 'income'), 0),
+	COUNT(*)
+` + memberTransactions + `;`
+	memberTotalsStmt = `SELECT s.id, s.name,
+	COALESCE(SUM(t.amount) FILTER (WHERE t.transaction_type = 'income'), 0),
+	COALESCE(SUM(t.amount) FILTER (WHERE t.transaction_type <> 'income'), 0)
+FROM household_member m JOIN spender s ON s.id = m.spender_id
+LEFT JOIN transaction t ON t.spender_id = m.spender_id AND ($2::timestamptz IS NULL OR t.date >= $2) AND ($3::timestamptz IS NULL OR t.date < $3)
+WHERE m.household_id = $1
+GROUP BY s.id, s.name
+ORDER BY s.id;`
+	categoriesStmt = `SELECT COALESCE(t.category_id, 0), t.category, t.transaction_type, SUM(t.amount), COUNT(*)
+` + memberTransactions + `
+GROUP BY t.category_id, t.category, t.transaction_type;`
+	transactionSpenderStmt = `SELECT t.spender_id FROM transaction t JOIN household_member m ON m.spender_id = t.spender_id WHERE m.household_id = $1 AND t.id = $2;`
+)
+
+type Ledger struct {
+	Transactions []transaction.Transaction `json:"transactions"`
+	Summary      transaction.Summary       `json:"summary"`
+	Pagination   transaction.Pagination    `json:"pagination"`
+}
+
+type MemberSummary struct {
+	SpenderID     int64   `json:"spender_id"`
+	Name          string  `json:"name"`
+	TotalIncome   float64 `json:"total_income"`
+	TotalExpenses float64 `json:"total_expenses"`
+	Net           float64 `json:"net"`
+}
+
+// Report sums up the household and each of its members.
+type Report struct {
+	Summary transaction.Summary `json:"summary"`
+	// Period is the budget month summed up, unset for the whole history.
+	Period  *transaction.Period `json:"period,omitempty"`
+	Members []MemberSummary     `json:"members"`
+}
+
+type CategoryReport struct {
+	Currency   string              `json:"currency"`
+	Period     *transaction.Period `json:"period,omitempty"`
+	Categories []*category.Node    `json:"categories"`
+}
+
+func (s Service) transactions() transaction.Service {
+	return transaction.NewService(s.flag, s.db)
+}
+
+func (s Service) preferences(ctx context.Context, actor int64) (spender.Preferences, error) {
+	p, err := spender.GetPreferences(ctx, s.db, strconv.FormatInt(actor, 10))
+	if err == spender.ErrNotFound {
+		return p, nil
+	}
+	return p, err
+}
+
+// window is the budget month of actor named by month, or the whole history
+// when month is empty.
+func (s Service) window(ctx context.Context, actor int64, month string) (spender.Preferences, *transaction.Period, error) {
+	p, err := s.preferences(ctx, actor)
+	if err != nil || month == "" {
+		return p, nil, err
+	}
+	period, err := s.transactions().Period(p, month)
+	if err != nil {
+		return p, nil, err
+	}
+	return p, &period, nil
+}
+
+func bounds(period *transaction.Period) (from, to *time.Time) {
+	if period == nil {
+		return nil, nil
+	}
+	return &period.From, &period.To
+}
+
+// Transactions returns a page of the household ledger, q is expected to
+// come from transaction.NewHistoryQuery.
+func (s Service) Transactions(ctx context.Context, id, actor int64, q transaction.HistoryQuery) (Ledger, error) {
+	if _, err := s.canRead(ctx, id, actor); err != nil {
+		return Ledger{}, err
+	}
+	p, err := s.preferences(ctx, actor)
+	if err != nil {
+		return Ledger{}, err
+	}
+	q = q.In(p.Location())
+
+	var income, expenses float64
+	var total int
+	if err := s.db.QueryRowContext(ctx, ledgerTotalsStmt, id, q.From, q.To).Scan(&income, &expenses, &total); err != nil {
+		return Ledger{}, err
+	}
+
+	limit, offset := q.Window()
+	rows, err := s.db.QueryContext(ctx, ledgerStmt, id, q.From, q.To, limit, offset)
+	if err != nil {
+		return Ledger{}, err
+	}
+	defer rows.Close()
+
+	ledger := Ledger{
+		Transactions: []transaction.Transaction{},
+		Summary: transaction.Summary{
+			TotalIncome:    income,
+			TotalExpenses:  expenses,
+			CurrentBalance: income - expenses,
+			Currency:       p.Currency,
+		},
+		Pagination: q.Pagination(total),
+	}
+	for rows.Next() {
+		var t transaction.Transaction
+		if err := rows.Scan(&t.ID, &t.Date, &t.Amount, &t.Category, &t.TransactionType, &t.Note, &t.ImageURL, &t.SpenderId); err != nil {
+			return Ledger{}, err
+		}
+		ledger.Transactions = append(ledger.Transactions, t)
+	}
+	return ledger, rows.Err()
+}
+
+// Summary returns the totals of the household and its members, over the
+// whole history or one budget month when month is "current" or YYYY-MM.
+func (s Service) Summary(ctx context.Context, id, actor int64, month string) (Report, error) {
+	if _, err := s.canRead(ctx, id, actor); err != nil {
+		return Report{}, err
+	}
+	p, period, err := s.window(ctx, actor, month)
+	if err != nil {
+		return Report{}, err
+	}
+	from, to := bounds(period)
+
+	rows, err := s.db.QueryContext(ctx, memberTotalsStmt, id, from, to)
+	if err != nil {
+		return Report{}, err
+	}
+	defer rows.Close()
+
+	report := Report{Summary: transaction.Summary{Currency: p.Currency}, Period: period, Members: []MemberSummary{}}
+	for rows.Next() {
+		var m MemberSummary
+		if err := rows.Scan(&m.SpenderID, &m.Name, &m.TotalIncome, &m.TotalExpenses); err != nil {
+			return Report{}, err
+		}
+		m.Net = m.TotalIncome - m.TotalExpenses
+		report.Summary.TotalIncome += m.TotalIncome
+		report.Summary.TotalExpenses += m.TotalExpenses
+		report.Members = append(report.Members, m)
+	}
+	report.Summary.CurrentBalance = report.Summary.TotalIncome - report.Summary.TotalExpenses
+	return report, rows.Err()
+}
+
+// Categories returns the household totals by category, largest first, with
+// subcategories under their parents and the totals rolled up.
+func (s Service) Categories(ctx context.Context, id, actor int64, month string) (CategoryReport, error) {
+	if _, err := s.canRead(ctx, id, actor); err != nil {
+		return CategoryReport{}, err
+	}
+	p, period, err := s.window(ctx, actor, month)
+	if err != nil {
+		return CategoryReport{}, err
+	}
+	from, to := bounds(period)
+
+	rows, err := s.db.QueryContext(ctx, categoriesStmt, id, from, to)
+	if err != nil {
+		return CategoryReport{}, err
+	}
+	defer rows.Close()
+
+	var totals []category.Total
+	for rows.Next() {
+		var t category.Total
+		if err := rows.Scan(&t.CategoryID, &t.Category, &t.TransactionType, &t.Total, &t.Count); err != nil {
+			return CategoryReport{}, err
+		}
+		totals = append(totals, t)
+	}
+	if err := rows.Err(); err != nil {
+		return CategoryReport{}, err
+	}
+
+	cats, err := category.Ancestry(ctx, s.db, category.IDs(totals))
+	if err != nil {
+		return CategoryReport{}, err
+	}
+	return CategoryReport{Currency: p.Currency, Period: period, Categories: category.Tree(cats, totals)}, nil
+}
+
+// member checks spenderID is in the household.
+func (s Service) member(ctx context.Context, id, spenderID int64) error {
+	if _, err := s.role(ctx, s.db, id, spenderID); err == ErrNotFound {
+		return ErrNotMember
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// transactionOf checks the transaction belongs to a member of the household.
+func (s Service) transactionOf(ctx context.Context, id, transactionID int64) error {
+	var spenderID int64
+	err := s.db.QueryRowContext(ctx, transactionSpenderStmt, id, transactionID).Scan(&spenderID)
+	if err == sql.ErrNoRows {
+		return transaction.ErrNotFound
+	}
+	return err
+}
+
+// CreateTransaction records a transaction for a member, the acting one when
+// t has no spender.
+func (s Service) CreateTransaction(ctx context.Context, id, actor int64, t transaction.Transaction) (transaction.Transaction, error) {
+	if _, err := s.canWrite(ctx, id, actor); err != nil {
+		return t, err
+	}
+	if t.SpenderId == 0 {
+		t.SpenderId = actor
+	}
+	if err := s.member(ctx, id, t.SpenderId); err != nil {
+		return t, err
+	}
+	return s.transactions().Create(ctx, t)
+}
+
+// UpdateTransaction changes a transaction of a member, which may only be
+// moved to another member.
+func (s Service) UpdateTransaction(ctx context.Context, id, actor, transactionID int64, t transaction.PutTransaction) (transaction.PutTransaction, error) {
+	if _, err := s.canWrite(ctx, id, actor); err != nil {
+		return t, err
+	}
+	if err := s.transactionOf(ctx, id, transactionID); err != nil {
+		return t, err
+	}
+	if err := s.member(ctx, id, int64(t.SpenderId)); err != nil {
+		return t, err
+	}
+	return s.transactions().Update(ctx, transactionID, t)
+}
+
+func (s Service) DeleteTransaction(ctx context.Context, id, actor, transactionID int64) error {
+	if _, err := s.canWrite(ctx, id, actor); err != nil {
+		return err
+	}
+	if err := s.transactionOf(ctx, id, transactionID); err != nil {
+		return err
+	}
+	return s.transactions().Delete(ctx, transactionID)
+}
+
+func (h handler) GetTransactions(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	q, err := transaction.ParseHistoryQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	ledger, err := h.service().Transactions(c.Request().Context(), id, act, q)
+	if err != nil {
+		return fail(c, "query household transactions error", err)
+	}
+	return c.JSON(http.StatusOK, ledger)
+}
+
+func (h handler) GetSummary(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	report, err := h.service().Summary(c.Request().Context(), id, act, c.QueryParam("month"))
+	if err != nil {
+		return fail(c, "query household summary error", err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h handler) GetCategories(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	report, err := h.service().Categories(c.Request().Context(), id, act, c.QueryParam("month"))
+	if err != nil {
+		return fail(c, "query household categories error", err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func transactionID(c echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("transaction_id"), 10, 64)
+	if err != nil {
+		return 0, transaction.ErrNotFound
+	}
+	return id, nil
+}
+
+func (h handler) CreateTransaction(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var req transaction.Transaction
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+
+	t, err := h.service().CreateTransaction(c.Request().Context(), id, act, req)
+	if err != nil {
+		return fail(c, "create household transaction error", err)
+	}
+	return c.JSON(http.StatusCreated, t)
+}
+
+func (h handler) UpdateTransaction(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	txID, err := transactionID(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var req transaction.PutTransaction
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+
+	req, err = h.service().UpdateTransaction(c.Request().Context(), id, act, txID, req)
+	if err != nil {
+		return fail(c, "update household transaction error", err)
+	}
+	return c.JSON(http.StatusOK, req)
+}
+
+func (h handler) DeleteTransaction(c echo.Context) error {
+	id, act, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	txID, err := transactionID(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+
+	if err := h.service().DeleteTransaction(c.Request().Context(), id, act, txID); err != nil {
+		return fail(c, "delete household transaction error", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
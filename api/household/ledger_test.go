@@ -0,0 +1,212 @@
+package household
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const prefsStmt = `SELECT timezone, locale, currency, month_start_day FROM spender WHERE id = $1;`
+
+const ancestryStmt = `WITH RECURSIVE up AS (
+	SELECT * FROM category WHERE id = ANY($1)
+	UNION
+	SELECT c.* FROM category c JOIN up ON c.id = up.parent_id
+) SELECT id, COALESCE(spender_id, 0), COALESCE(parent_id, 0), name, icon, color, type FROM up;`
+
+func prefsRows(timezone string, monthStartDay int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"timezone", "locale", "currency", "month_start_day"}).
+		AddRow(timezone, "th-TH", "THB", monthStartDay)
+}
+
+func TestGetHouseholdTransactions(t *testing.T) {
+	c, rec := call(http.MethodGet, "", "2", "id", "7")
+	c.QueryParams().Set("from", "2024-05-01")
+	c.QueryParams().Set("limit", "1")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	bangkok, _ := time.LoadLocation("Asia/Bangkok")
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, bangkok)
+	mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleViewer))
+	mock.ExpectQuery(prefsStmt).WithArgs("2").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+	mock.ExpectQuery(ledgerTotalsStmt).WithArgs(int64(7), &from, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"income", "expenses", "count"}).AddRow(1000.0, 250.0, 2))
+	mock.ExpectQuery(ledgerStmt).WithArgs(int64(7), &from, nil, 1, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
+			AddRow(1, "2024-05-02T00:00:00Z", 1000.0, "Salary", "income", "", "", 1))
+
+	err := New(config.FeatureFlag{}, db).GetTransactions(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"transactions": [{"id":1,"date":"2024-05-02T00:00:00Z","amount":1000,"category":"Salary","transaction_type":"income","note":"","image_url":"","spender_id":1}],
+		"summary": {"total_income":1000,"total_expenses":250,"current_balance":750,"currency":"THB"},
+		"pagination": {"current_page":1,"total_pages":2,"per_page":1}
+	}`, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetHouseholdSummary(t *testing.T) {
+	t.Run("members and their total in a budget month", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "", "1", "id", "7")
+		c.QueryParams().Set("month", "2024-05")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("UTC", 25))
+		mock.ExpectQuery(memberTotalsStmt).
+			WithArgs(int64(7), time.Date(2024, 5, 25, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 25, 0, 0, 0, 0, time.UTC)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "income", "expenses"}).
+				AddRow(1, "Hong", 30000.0, 1200.0).
+				AddRow(2, "Jot", 0.0, 800.0))
+
+		err := New(config.FeatureFlag{}, db).GetSummary(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"summary": {"total_income":30000,"total_expenses":2000,"current_balance":28000,"currency":"THB"},
+			"period": {"month":"2024-05","from":"2024-05-25T00:00:00Z","to":"2024-06-25T00:00:00Z"},
+			"members": [
+				{"spender_id":1,"name":"Hong","total_income":30000,"total_expenses":1200,"net":28800},
+				{"spender_id":2,"name":"Jot","total_income":0,"total_expenses":800,"net":-800}
+			]
+		}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("an invalid month", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "", "1", "id", "7")
+		c.QueryParams().Set("month", "May")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("UTC", 1))
+
+		err := New(config.FeatureFlag{}, db).GetSummary(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestGetHouseholdCategories(t *testing.T) {
+	c, rec := call(http.MethodGet, "", "2", "id", "7")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleViewer))
+	mock.ExpectQuery(prefsStmt).WithArgs("2").WillReturnRows(prefsRows("UTC", 1))
+	mock.ExpectQuery(categoriesStmt).WithArgs(int64(7), nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"category_id", "category", "transaction_type", "total", "count"}).
+			AddRow(12, "Salary", "income", 30000.0, 1).
+			AddRow(19, "Restaurants", "expense", 800.5, 5).
+			AddRow(20, "Groceries", "expense", 400.25, 3).
+			AddRow(0, "Gadgets", "expense", 1500.0, 1))
+	mock.ExpectQuery(ancestryStmt).WithArgs("{12,19,20}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "parent_id", "name", "icon", "color", "type"}).
+			AddRow(12, 0, 0, "Salary", "payments", "#4CAF50", "income").
+			AddRow(19, 0, 1, "Restaurants", "restaurant_menu", "#FF9800", "expense").
+			AddRow(20, 0, 1, "Groceries", "local_grocery_store", "#FF9800", "expense").
+			AddRow(1, 0, 0, "Food", "restaurant", "#FF9800", "expense"))
+
+	err := New(config.FeatureFlag{}, db).GetCategories(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"currency":"THB","categories":[
+		{"category_id":12,"category":"Salary","transaction_type":"income","total":30000,"count":1},
+		{"category":"Gadgets","transaction_type":"expense","total":1500,"count":1},
+		{"category_id":1,"category":"Food","transaction_type":"expense","total":1200.75,"count":8,"children":[
+			{"category_id":19,"category":"Restaurants","transaction_type":"expense","total":800.5,"count":5},
+			{"category_id":20,"category":"Groceries","transaction_type":"expense","total":400.25,"count":3}
+		]}
+	]}`, rec.Body.String())
+}
+
+func TestHouseholdTransactionWrites(t *testing.T) {
+	t.Run("viewers cannot record transactions", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"amount": 100, "category": "Food", "transaction_type": "expense"}`, "2", "id", "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleViewer))
+
+		err := New(config.FeatureFlag{}, db).CreateTransaction(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("viewers cannot delete transactions", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "", "2", "id", "7", "transaction_id", "5")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(2)).WillReturnRows(roleRows(RoleViewer))
+
+		err := New(config.FeatureFlag{}, db).DeleteTransaction(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("only for members of the household", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"amount": 100, "category": "Food", "transaction_type": "expense", "spender_id": 9}`, "1", "id", "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleMember))
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(9)).WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+		err := New(config.FeatureFlag{}, db).CreateTransaction(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a member deletes the transaction of another", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "", "1", "id", "7", "transaction_id", "5")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleMember))
+		mock.ExpectQuery(transactionSpenderStmt).WithArgs(int64(7), int64(5)).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(2))
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM transaction WHERE id = $1 RETURNING spender_id;`).WithArgs(int64(5)).
+			WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(2))
+		mock.ExpectExec(`INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`).
+			WithArgs("transaction.deleted", `{"id":5,"spender_id":2}`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).DeleteTransaction(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not a transaction of the household", func(t *testing.T) {
+		c, rec := call(http.MethodDelete, "", "1", "id", "7", "transaction_id", "6")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(roleStmt).WithArgs(int64(7), int64(1)).WillReturnRows(roleRows(RoleOwner))
+		mock.ExpectQuery(transactionSpenderStmt).WithArgs(int64(7), int64(6)).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}))
+
+		err := New(config.FeatureFlag{}, db).DeleteTransaction(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
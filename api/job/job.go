@@ -0,0 +1,255 @@
+// Package job runs slow work like receipt processing in the background of
+// the API process, keeping the status of every job in the database.
+package job
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	cJobStmt      = `INSERT INTO job (kind) VALUES ($1) RETURNING id;`
+	stepStmt      = `UPDATE job SET status='running', step=$1, updated_at=NOW() WHERE id=$2;`
+	finishStmt    = `UPDATE job SET status=$1, attempts=attempts+1, result=$2, error=$3, updated_at=NOW() WHERE id=$4;`
+	interruptStmt = `UPDATE job SET status='failed', error=$1, updated_at=NOW() WHERE id=$2;`
+	abandonStmt   = `UPDATE job SET status='failed', error=$1, updated_at=NOW() WHERE status IN ('queued', 'running');`
+	getJobStmt    = `SELECT id, kind, status, step, attempts, result, error, created_at, updated_at FROM job WHERE id = $1;`
+)
+
+var ErrNotFound = errors.New("job not found")
+
+// Job is the status of a job, and its result once it succeeded.
+type Job struct {
+	ID        int64           `json:"id"`
+	Kind      string          `json:"kind"`
+	Status    string          `json:"status"`
+	Step      string          `json:"step,omitempty"`
+	Attempts  int             `json:"attempts"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Func does the work of a job and returns its result. It calls step when it
+// starts a step so the status tells how far it went. A failed Func is run
+// again, it should skip what it did already.
+type Func func(ctx context.Context, step func(name string)) (interface{}, error)
+
+type permanent struct{ error }
+
+func (p permanent) Unwrap() error { return p.error }
+
+// Permanent marks an error that running the job again would not fix.
+func Permanent(err error) error {
+	return permanent{err}
+}
+
+// Runner runs jobs with a bounded number of workers, retrying failed ones
+// with exponential backoff.
+type Runner struct {
+	db          *sql.DB
+	logger      *zap.Logger
+	slots       chan struct{}
+	maxAttempts int
+	backoff     time.Duration
+	wg          sync.WaitGroup
+	quit        chan struct{}
+	once        sync.Once
+}
+
+func NewRunner(db *sql.DB, cfg config.Jobs, logger *zap.Logger) *Runner {
+	return &Runner{
+		db:          db,
+		logger:      logger,
+		slots:       make(chan struct{}, max(cfg.Workers, 1)),
+		maxAttempts: max(cfg.MaxAttempts, 1),
+		backoff:     time.Second,
+		quit:        make(chan struct{}),
+	}
+}
+
+// Enqueue records a job of kind and runs fn as soon as a worker is free.
+func (r *Runner) Enqueue(ctx context.Context, kind string, fn Func) (int64, error) {
+	var id int64
+	if err := r.db.QueryRowContext(ctx, cJobStmt, kind).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run(id, fn)
+	}()
+	return id, nil
+}
+
+func (r *Runner) run(id int64, fn Func) {
+	// jobs run on their own, not on the request that queued them
+	ctx := context.Background()
+	step := func(name string) {
+		if _, err := r.db.Exec(stepStmt, name, id); err != nil {
+			r.logger.Error("update job step error", zap.Int64("job_id", id), zap.Error(err))
+		}
+	}
+
+	for attempt := 1; attempt <= r.maxAttempts; attempt++ {
+		select {
+		case r.slots <- struct{}{}:
+		case <-r.quit:
+			r.interrupt(id)
+			return
+		}
+		result, err := r.attempt(ctx, id, fn, step)
+		<-r.slots
+
+		status, payload, lastErr := StatusSucceeded, []byte(nil), ""
+		if err == nil {
+			payload, err = json.Marshal(result)
+		}
+		if err != nil {
+			status, payload, lastErr = StatusQueued, nil, err.Error()
+			var p permanent
+			if attempt == r.maxAttempts || errors.As(err, &p) {
+				status = StatusFailed
+			}
+		}
+
+		if _, err := r.db.Exec(finishStmt, status, nullJSON(payload), lastErr, id); err != nil {
+			r.logger.Error("update job error", zap.Int64("job_id", id), zap.Error(err))
+		}
+		if status != StatusQueued {
+			return
+		}
+
+		select {
+		case <-time.After(r.backoff << (attempt - 1)):
+		case <-r.quit:
+			r.interrupt(id)
+			return
+		}
+	}
+}
+
+// attempt runs fn once. A panic fails the attempt like an error instead of
+// taking the whole process down.
+func (r *Runner) attempt(ctx context.Context, id int64, fn Func, step func(string)) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.logger.Error("job panic", zap.Int64("job_id", id), zap.Any("panic", p), zap.Stack("stack"))
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return fn(ctx, step)
+}
+
+// interrupt fails a job that shutdown stopped before it was done.
+func (r *Runner) interrupt(id int64) {
+	if _, err := r.db.Exec(interruptStmt, "interrupted by a server shutdown, submit it again", id); err != nil {
+		r.logger.Error("update job error", zap.Int64("job_id", id), zap.Error(err))
+	}
+}
+
+// FailAbandoned fails the jobs a previous process left queued or running,
+// e.g. after a crash: their work only lived in its memory. Call it once
+// before jobs are enqueued.
+func (r *Runner) FailAbandoned(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, abandonStmt, "interrupted by a server restart, submit it again")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func nullJSON(payload []byte) interface{} {
+	if payload == nil {
+		return nil
+	}
+	return string(payload)
+}
+
+// Wait blocks until every job is done.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Shutdown stops starting jobs and retries and waits for the running ones.
+// Jobs that did not get to run are marked as failed.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.once.Do(func() { close(r.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns ErrNotFound for an unknown job.
+func Get(ctx context.Context, db *sql.DB, id int64) (Job, error) {
+	var j Job
+	var result []byte
+	err := db.QueryRowContext(ctx, getJobStmt, id).
+		Scan(&j.ID, &j.Kind, &j.Status, &j.Step, &j.Attempts, &result, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return Job{}, ErrNotFound
+	}
+	if result != nil {
+		j.Result = result
+	}
+	return j, err
+}
+
+type handler struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *handler {
+	return &handler{db}
+}
+
+func (h handler) GetJob(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid job id")
+	}
+
+	j, err := Get(ctx, h.db, id)
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("get job error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, j)
+}
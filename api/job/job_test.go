@@ -0,0 +1,229 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestRunner(t *testing.T, workers int) (*Runner, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	t.Cleanup(func() { db.Close() })
+
+	r := NewRunner(db, config.Jobs{Workers: workers, MaxAttempts: 3}, zap.NewNop())
+	r.backoff = time.Millisecond
+	return r, mock
+}
+
+func TestRunner(t *testing.T) {
+	t.Run("should record the steps and result of a job", func(t *testing.T) {
+		r, mock := newTestRunner(t, 1)
+		mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(stepStmt).WithArgs("store", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(finishStmt).WithArgs(StatusSucceeded, `{"amount":100}`, "", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		id, err := r.Enqueue(context.Background(), "receipt", func(ctx context.Context, step func(string)) (interface{}, error) {
+			step("store")
+			return map[string]int{"amount": 100}, nil
+		})
+		r.Wait()
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should retry a failed job", func(t *testing.T) {
+		r, mock := newTestRunner(t, 1)
+		mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(finishStmt).WithArgs(StatusQueued, nil, "timeout", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(finishStmt).WithArgs(StatusSucceeded, "true", "", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var calls int
+		r.Enqueue(context.Background(), "receipt", func(ctx context.Context, step func(string)) (interface{}, error) {
+			calls++
+			if calls == 1 {
+				return nil, errors.New("timeout")
+			}
+			return true, nil
+		})
+		r.Wait()
+
+		assert.Equal(t, 2, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should give up after the last attempt", func(t *testing.T) {
+		r, mock := newTestRunner(t, 1)
+		mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(finishStmt).WithArgs(StatusQueued, nil, "timeout", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(finishStmt).WithArgs(StatusQueued, nil, "timeout", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(finishStmt).WithArgs(StatusFailed, nil, "timeout", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		r.Enqueue(context.Background(), "receipt", func(ctx context.Context, step func(string)) (interface{}, error) {
+			return nil, errors.New("timeout")
+		})
+		r.Wait()
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should fail the attempt of a panicking job", func(t *testing.T) {
+		r, mock := newTestRunner(t, 1)
+		mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(finishStmt).WithArgs(StatusQueued, nil, "job panicked: slice bounds out of range", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(finishStmt).WithArgs(StatusSucceeded, "true", "", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var calls int
+		r.Enqueue(context.Background(), "receipt", func(ctx context.Context, step func(string)) (interface{}, error) {
+			calls++
+			if calls == 1 {
+				panic("slice bounds out of range")
+			}
+			return true, nil
+		})
+		r.Wait()
+
+		assert.Equal(t, 2, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not retry a permanent error", func(t *testing.T) {
+		r, mock := newTestRunner(t, 1)
+		mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(finishStmt).WithArgs(StatusFailed, nil, "no QR code", int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		r.Enqueue(context.Background(), "receipt", func(ctx context.Context, step func(string)) (interface{}, error) {
+			return nil, Permanent(errors.New("no QR code"))
+		})
+		r.Wait()
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run no more jobs at once than workers", func(t *testing.T) {
+		r, mock := newTestRunner(t, 2)
+		mock.MatchExpectationsInOrder(false)
+		for i := 1; i <= 6; i++ {
+			mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(i))
+			mock.ExpectExec(finishStmt).WithArgs(StatusSucceeded, "null", "", int64(i)).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+
+		var running, most int32
+		var mu sync.Mutex
+		for i := 0; i < 6; i++ {
+			r.Enqueue(context.Background(), "receipt", func(ctx context.Context, step func(string)) (interface{}, error) {
+				n := atomic.AddInt32(&running, 1)
+				mu.Lock()
+				most = max(most, n)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil, nil
+			})
+		}
+		r.Wait()
+
+		assert.Equal(t, int32(2), most)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should fail the jobs waiting for a worker on shutdown", func(t *testing.T) {
+		r, mock := newTestRunner(t, 1)
+		mock.MatchExpectationsInOrder(false)
+		mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(cJobStmt).WithArgs("receipt").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectExec(finishStmt).WithArgs(StatusSucceeded, "null", "", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(interruptStmt).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		fn := func(ctx context.Context, step func(string)) (interface{}, error) {
+			started <- struct{}{}
+			<-release
+			return nil, nil
+		}
+		r.Enqueue(context.Background(), "receipt", fn)
+		r.Enqueue(context.Background(), "receipt", fn)
+		<-started
+
+		done := make(chan error)
+		go func() { done <- r.Shutdown(context.Background()) }()
+		// the waiting job is failed before the running one is done
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+
+		assert.NoError(t, <-done)
+		assert.Len(t, started, 0)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestFailAbandoned(t *testing.T) {
+	r, mock := newTestRunner(t, 1)
+	mock.ExpectExec(abandonStmt).WithArgs("interrupted by a server restart, submit it again").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := r.FailAbandoned(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetJob(t *testing.T) {
+	columns := []string{"id", "kind", "status", "step", "attempts", "result", "error", "created_at", "updated_at"}
+	at := time.Date(2024, 5, 20, 10, 0, 0, 0, time.UTC)
+
+	get := func(db *sql.DB, id string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		New(db).GetJob(c)
+		return rec
+	}
+
+	t.Run("should return the job with its result", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getJobStmt).WithArgs(int64(7)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(7, "receipt", StatusSucceeded, "draft", 1, []byte(`{"attachment_id":3}`), "", at, at))
+
+		rec := get(db, "7")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":7,"kind":"receipt","status":"succeeded","step":"draft","attempts":1,"result":{"attachment_id":3},
+			"created_at":"2024-05-20T10:00:00Z","updated_at":"2024-05-20T10:00:00Z"}`, rec.Body.String())
+	})
+
+	t.Run("should return not found for an unknown job", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getJobStmt).WithArgs(int64(7)).WillReturnError(sql.ErrNoRows)
+
+		rec := get(db, "7")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("should refuse an invalid id", func(t *testing.T) {
+		rec := get(nil, "abc")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,136 @@
+// Package mailer sends emails through SMTP, or writes them to files where
+// no mail server is at hand like in development and tests.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Func adapts a function to the Mailer interface.
+type Func func(ctx context.Context, m Message) error
+
+func (f Func) Send(ctx context.Context, m Message) error {
+	return f(ctx, m)
+}
+
+// New creates the mailer selected by cfg.
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Backend {
+	case "", "file":
+		return NewFile(cfg.Dir, cfg.From), nil
+	case "smtp":
+		if cfg.SMTPAddr == "" {
+			return nil, fmt.Errorf("mailer: smtp needs an address")
+		}
+		return NewSMTP(cfg.SMTPAddr, cfg.From, cfg.Username, cfg.Password), nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown backend %q", cfg.Backend)
+	}
+}
+
+// format renders m as an RFC 5322 message.
+func format(from string, m Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// validHeader refuses values that would add headers to the message.
+func validHeader(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("mailer: invalid header value %q", v)
+		}
+	}
+	return nil
+}
+
+// File writes every message to a .eml file of Dir.
+type File struct {
+	Dir  string
+	from string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewFile(dir, from string) *File {
+	return &File{Dir: dir, from: from}
+}
+
+func (f *File) Send(ctx context.Context, m Message) error {
+	if err := validHeader(m.To, m.Subject); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.seq++
+	seq := f.seq
+	f.mu.Unlock()
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%d.eml", now.Format("20060102T150405.000000000"), seq)
+	return os.WriteFile(filepath.Join(f.Dir, name), format(f.from, m, now), 0o644)
+}
+
+// SMTP sends messages through the server at Addr, authenticating when a
+// username is set.
+type SMTP struct {
+	Addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTP(addr, from, username, password string) *SMTP {
+	s := &SMTP{Addr: addr, from: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	if err := validHeader(m.To, m.Subject); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, s.auth, envelope(s.from), []string{m.To}, format(s.from, m, time.Now()))
+}
+
+// envelope is the address of from, which may have a display name.
+func envelope(from string) string {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return from
+	}
+	return addr.Address
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFile(dir, "HongJot <no-reply@hongjot.local>")
+
+	err := m.Send(context.Background(), Message{To: "hong@jot.ok", Subject: "Hello", Body: "line 1\nline 2"})
+	assert.NoError(t, err)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 1)
+	content, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(content), "To: hong@jot.ok\r\n")
+	assert.Contains(t, string(content), "Subject: Hello\r\n")
+	assert.True(t, strings.HasSuffix(string(content), "\r\n\r\nline 1\r\nline 2"))
+}
+
+func TestHeaderInjection(t *testing.T) {
+	m := NewFile(t.TempDir(), "no-reply@hongjot.local")
+
+	err := m.Send(context.Background(), Message{To: "hong@jot.ok\r\nBcc: all@jot.ok", Subject: "Hello"})
+
+	assert.Error(t, err)
+}
+
+// fakeSMTP accepts one message and returns what it received.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake")
+		var got strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			got.WriteString(line)
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					got.WriteString(line)
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				received <- got.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return lis.Addr().String(), received
+}
+
+func TestSMTP(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	m, err := New(config.Mail{Backend: "smtp", SMTPAddr: addr, From: "HongJot <no-reply@hongjot.local>"})
+	assert.NoError(t, err)
+
+	err = m.Send(context.Background(), Message{To: "hong@jot.ok", Subject: "Hello", Body: "Hi"})
+	assert.NoError(t, err)
+
+	got := <-received
+	assert.Contains(t, got, "MAIL FROM:<no-reply@hongjot.local>")
+	assert.Contains(t, got, "RCPT TO:<hong@jot.ok>")
+	assert.Contains(t, got, "Subject: Hello\r\n")
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(config.Mail{Backend: "smtp"})
+	assert.Error(t, err)
+
+	_, err = New(config.Mail{Backend: "pigeon"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+// Package openapi serves the OpenAPI document of the API and validates
+// requests against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.json
+var document []byte
+
+type Spec struct {
+	Servers    []Server                        `json:"servers"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []interface{}      `json:"enum"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *Schema            `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	AllOf                []*Schema          `json:"allOf"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema   `json:"schemas"`
+	Parameters map[string]Parameter `json:"parameters"`
+}
+
+// Load parses the embedded document.
+func Load() (*Spec, error) {
+	var spec Spec
+	if err := json.Unmarshal(document, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Serve returns the document as is.
+func Serve(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, document)
+}
+
+// Operation finds the operation of an Echo route, e.g. GET
+// /api/v1/spenders/:id.
+func (s *Spec) Operation(method, route string) (Operation, bool) {
+	op, ok := s.Paths[s.Path(route)][strings.ToLower(method)]
+	return op, ok
+}
+
+// Path turns an Echo route into its OpenAPI path, relative to the server URL
+// and with {name} path parameters.
+func (s *Spec) Path(route string) string {
+	for _, server := range s.Servers {
+		if rest, ok := strings.CutPrefix(route, server.URL); ok && strings.HasPrefix(rest, "/") {
+			route = rest
+			break
+		}
+	}
+
+	segments := strings.Split(route, "/")
+	for i, seg := range segments {
+		if name, ok := strings.CutPrefix(seg, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *Spec) parameter(p Parameter) Parameter {
+	if name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/"); ok {
+		return s.Components.Parameters[name]
+	}
+	return p
+}
+
+func (s *Spec) schema(schema *Schema) *Schema {
+	if name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/"); ok {
+		return s.Components.Schemas[name]
+	}
+	return schema
+}
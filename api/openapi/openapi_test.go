@@ -0,0 +1,97 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	spec, err := Load()
+	assert.NoError(t, err)
+
+	// every reference must resolve, a typo would silently skip validation
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			for _, p := range op.Parameters {
+				assert.NotEmpty(t, spec.parameter(p).Name, "%s %s", method, path)
+			}
+		}
+	}
+	for name, schema := range spec.Components.Schemas {
+		for prop, s := range schema.Properties {
+			assert.NotNil(t, spec.schema(s), "%s.%s", name, prop)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	spec, _ := Load()
+
+	assert.Equal(t, "/spenders/{id}/transactions", spec.Path("/api/v1/spenders/:id/transactions"))
+	assert.Equal(t, "/health", spec.Path("/api/v1/health"))
+}
+
+func TestValidator(t *testing.T) {
+	spec, _ := Load()
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   string
+	}{
+		{"valid transaction", http.MethodPost, "/api/v1/transactions",
+			`{"date":"2024-05-20","amount":100,"category":"Food","transaction_type":"expense","spender_id":1}`, ""},
+		{"missing field", http.MethodPost, "/api/v1/transactions",
+			`{"date":"2024-05-20","amount":100,"transaction_type":"expense","spender_id":1}`, "body.category is required"},
+		{"wrong enum", http.MethodPost, "/api/v1/transactions",
+			`{"date":"2024-05-20","amount":100,"category":"Food","transaction_type":"gift","spender_id":1}`, "body.transaction_type must be one of [income expense]"},
+		{"float for integer", http.MethodPost, "/api/v1/transactions",
+			`{"date":"2024-05-20","amount":100,"category":"Food","transaction_type":"expense","spender_id":1.5}`, "body.spender_id must be an integer"},
+		{"invalid json", http.MethodPost, "/api/v1/transactions", `{`, "request body is not valid JSON"},
+		{"bad date-time", http.MethodPut, "/api/v1/transactions/1",
+			`{"date":"2024-05-20","amount":100,"category":"Food","transaction_type":"expense","spender_id":1}`, "body.date must be an RFC3339 date-time"},
+		{"query out of range", http.MethodGet, "/api/v1/spenders/1/transactions?limit=500", "", "limit must be at most 100"},
+		{"boolean query", http.MethodPost, "/api/v1/upload?qr=yes", "", "qr must be a boolean"},
+		{"path not an integer", http.MethodGet, "/api/v1/spenders/abc", "", "id must be an integer"},
+		{"route not documented", http.MethodGet, "/api/v1/unknown", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			e.Use(Validator(spec))
+			var got string
+			handler := func(c echo.Context) error {
+				b, err := io.ReadAll(c.Request().Body)
+				got = string(b)
+				return err
+			}
+			e.POST("/api/v1/transactions", handler)
+			e.PUT("/api/v1/transactions/:id", handler)
+			e.GET("/api/v1/spenders/:id", handler)
+			e.GET("/api/v1/spenders/:id/transactions", handler)
+			e.GET("/api/v1/unknown", handler)
+			e.POST("/api/v1/upload", handler)
+
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if tc.want == "" {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, tc.body, got, "the handler still reads the body")
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, `"`+tc.want+`"`+"\n", rec.Body.String())
+		})
+	}
+}
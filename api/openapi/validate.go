@@ -0,0 +1,258 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Validator rejects with 400 the requests whose parameters or JSON body do
+// not match the operation of their route. Routes missing from the spec are
+// let through.
+func Validator(spec *Spec) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			op, ok := spec.Operation(c.Request().Method, c.Path())
+			if !ok {
+				return next(c)
+			}
+			if err := spec.validateRequest(c, op); err != nil {
+				return c.JSON(http.StatusBadRequest, err.Error())
+			}
+			return next(c)
+		}
+	}
+}
+
+func (s *Spec) validateRequest(c echo.Context, op Operation) error {
+	req := c.Request()
+
+	for _, p := range op.Parameters {
+		p = s.parameter(p)
+
+		var value string
+		switch p.In {
+		case "path":
+			value = c.Param(p.Name)
+		case "query":
+			value = c.QueryParam(p.Name)
+		case "header":
+			value = req.Header.Get(p.Name)
+		}
+
+		if value == "" {
+			if p.Required {
+				return fmt.Errorf("%s is required", p.Name)
+			}
+			continue
+		}
+		if err := s.validateParam(p.Schema, value); err != nil {
+			return fmt.Errorf("%s %v", p.Name, err)
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+	media, ok := op.RequestBody.Content[echo.MIMEApplicationJSON]
+	if !ok || !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	// the handler binds the body again
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("request body is not valid JSON")
+	}
+	return s.validate(media.Schema, v, "body")
+}
+
+func (s *Spec) validateParam(schema *Schema, value string) error {
+	if schema == nil {
+		return nil
+	}
+	schema = s.schema(schema)
+
+	switch schema.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		return checkRange(schema, float64(n))
+	case "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		return checkRange(schema, n)
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		return nil
+	}
+	return s.validate(schema, value, "")
+}
+
+// validate checks v, decoded with UseNumber, against the subset of JSON
+// Schema used by the document.
+func (s *Spec) validate(schema *Schema, v interface{}, at string) error {
+	if schema == nil {
+		return nil
+	}
+	schema = s.schema(schema)
+
+	for _, sub := range schema.AllOf {
+		if err := s.validate(sub, v, at); err != nil {
+			return err
+		}
+	}
+
+	if len(schema.Enum) > 0 && !contains(schema.Enum, v) {
+		return errorAt(at, "must be one of %v", schema.Enum)
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return errorAt(at, "must be an object")
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return errorAt(join(at, name), "is required")
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		// report the same error first every time
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				prop = schema.AdditionalProperties
+			}
+			if err := s.validate(prop, obj[name], join(at, name)); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return errorAt(at, "must be an array")
+		}
+		for i, item := range arr {
+			if err := s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return errorAt(at, "must be a string")
+		}
+		if err := checkFormat(schema.Format, str); err != nil {
+			return errorAt(at, "%v", err)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return errorAt(at, "must be an integer")
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return errorAt(at, "must be an integer")
+		}
+		if err := checkRange(schema, float64(i)); err != nil {
+			return errorAt(at, "%v", err)
+		}
+	case "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return errorAt(at, "must be a number")
+		}
+		f, _ := n.Float64()
+		if err := checkRange(schema, f); err != nil {
+			return errorAt(at, "%v", err)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return errorAt(at, "must be a boolean")
+		}
+	}
+	return nil
+}
+
+func checkRange(schema *Schema, n float64) error {
+	if schema.Minimum != nil && n < *schema.Minimum {
+		return fmt.Errorf("must be at least %v", *schema.Minimum)
+	}
+	if schema.Maximum != nil && n > *schema.Maximum {
+		return fmt.Errorf("must be at most %v", *schema.Maximum)
+	}
+	return nil
+}
+
+func checkFormat(format, v string) error {
+	switch format {
+	case "date":
+		if _, err := time.Parse(time.DateOnly, v); err != nil {
+			return fmt.Errorf("must be a date as YYYY-MM-DD")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return fmt.Errorf("must be an RFC3339 date-time")
+		}
+	}
+	return nil
+}
+
+func contains(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func join(at, name string) string {
+	if at == "" {
+		return name
+	}
+	return at + "." + name
+}
+
+func errorAt(at, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if at == "" {
+		return fmt.Errorf("%s", msg)
+	}
+	return fmt.Errorf("%s %s", at, msg)
+}
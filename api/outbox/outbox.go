@@ -0,0 +1,48 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventTransactionCreated = "transaction.created"
+	EventTransactionUpdated = "transaction.updated"
+	EventTransactionDeleted = "transaction.deleted"
+	EventSpenderCreated     = "spender.created"
+	EventSpenderUpdated     = "spender.updated"
+	EventSpenderDeleted     = "spender.deleted"
+)
+
+var EventTypes = []string{
+	EventTransactionCreated,
+	EventTransactionUpdated,
+	EventTransactionDeleted,
+	EventSpenderCreated,
+	EventSpenderUpdated,
+	EventSpenderDeleted,
+}
+
+// Event is a domain event waiting in, or relayed from, the outbox table.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+const cStmt = `INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`
+
+// Write stores an event in the outbox as part of tx, so the event exists
+// if and only if the change it describes was committed.
+func Write(ctx context.Context, tx *sql.Tx, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, cStmt, eventType, string(payload))
+	return err
+}
@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestWrite(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(cStmt).WithArgs(EventSpenderCreated, `{"id":1}`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, _ := db.Begin()
+	err := Write(context.Background(), tx, EventSpenderCreated, map[string]int{"id": 1})
+	tx.Commit()
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func pendingRows() *sqlmock.Rows {
+	created := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	return sqlmock.NewRows([]string{"id", "event_type", "payload", "created_at"}).
+		AddRow(1, EventTransactionCreated, `{"id":1}`, created).
+		AddRow(2, EventTransactionUpdated, `{"id":1}`, created).
+		AddRow(3, EventTransactionDeleted, `{"id":1}`, created)
+}
+
+func TestRelayBatch(t *testing.T) {
+	t.Run("publish events in order", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(pendingStmt).WithArgs(100).WillReturnRows(pendingRows())
+		mock.ExpectExec(publishedStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(publishedStmt).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(publishedStmt).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		var got []string
+		sink := SinkFunc(func(ctx context.Context, e Event) error {
+			got = append(got, e.Type)
+			return nil
+		})
+
+		n, err := NewRelay(db, sink, zap.NewNop()).RelayBatch(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, []string{EventTransactionCreated, EventTransactionUpdated, EventTransactionDeleted}, got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("stop at the first rejected event", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(pendingStmt).WithArgs(100).WillReturnRows(pendingRows())
+		mock.ExpectExec(publishedStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		sinkErr := errors.New("sink is down")
+		sink := SinkFunc(func(ctx context.Context, e Event) error {
+			if e.ID == 2 {
+				return sinkErr
+			}
+			return nil
+		})
+
+		n, err := NewRelay(db, sink, zap.NewNop()).RelayBatch(context.Background())
+
+		assert.ErrorIs(t, err, sinkErr)
+		assert.Equal(t, 1, n)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRelayBatchNotify(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	committed := false
+	mock.ExpectBegin()
+	mock.ExpectQuery(pendingStmt).WithArgs(100).WillReturnRows(pendingRows())
+	mock.ExpectExec(publishedStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	sink := SinkFunc(func(ctx context.Context, e Event) error {
+		if e.ID == 2 {
+			return errors.New("sink is down")
+		}
+		return nil
+	})
+	var notified []int64
+	notify := SinkFunc(func(ctx context.Context, e Event) error {
+		committed = mock.ExpectationsWereMet() == nil
+		notified = append(notified, e.ID)
+		return nil
+	})
+
+	_, err := NewRelay(db, sink, zap.NewNop()).WithNotify(notify).RelayBatch(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, []int64{1}, notified, "only the published events")
+	assert.True(t, committed, "after they are marked as published")
+}
+
+func TestDrain(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	// Run stops right away on a cancelled context, Drain still relays
+	mock.ExpectBegin()
+	mock.ExpectQuery(pendingStmt).WithArgs(100).WillReturnRows(pendingRows())
+	for i := 1; i <= 3; i++ {
+		mock.ExpectExec(publishedStmt).WithArgs(int64(i)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	r := NewRelay(db, SinkFunc(func(ctx context.Context, e Event) error { return nil }), zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(ctx)
+
+	err := r.Drain(context.Background())
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+
+	err := sink.Send(context.Background(), Event{
+		ID:        1,
+		Type:      EventSpenderCreated,
+		Payload:   []byte(`{"id":1}`),
+		CreatedAt: time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":1,"type":"spender.created","payload":{"id":1},"created_at":"2024-05-20T00:00:00Z"}`+"\n", buf.String())
+}
@@ -0,0 +1,142 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// pendingStmt locks the oldest unpublished events so that only one
+	// relay works on them at a time and they go out in insertion order.
+	pendingStmt   = `SELECT id, event_type, payload, created_at FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE;`
+	publishedStmt = `UPDATE outbox SET published_at = NOW() WHERE id = $1;`
+)
+
+// Relay moves committed events from the outbox to a Sink. An event is
+// marked as published only after the sink accepted it, so a crash in
+// between sends it again: delivery is at least once.
+type Relay struct {
+	db        *sql.DB
+	sink      Sink
+	notify    Sink
+	logger    *zap.Logger
+	interval  time.Duration
+	batchSize int
+	done      chan struct{}
+}
+
+func NewRelay(db *sql.DB, sink Sink, logger *zap.Logger) *Relay {
+	return &Relay{
+		db:        db,
+		sink:      sink,
+		logger:    logger,
+		interval:  time.Second,
+		batchSize: 100,
+		done:      make(chan struct{}),
+	}
+}
+
+// WithNotify also hands the events to notify once they are marked as
+// published, e.g. for live streams that replay published events to the
+// clients reconnecting: an event is then either replayed or streamed. Its
+// errors are only logged.
+func (r *Relay) WithNotify(notify Sink) *Relay {
+	r.notify = notify
+	return r
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayBatch(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("relay outbox error", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain waits for Run to stop and then relays what is left in the outbox
+// until it is empty or ctx expires.
+func (r *Relay) Drain(ctx context.Context) error {
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		n, err := r.RelayBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n < r.batchSize {
+			return nil
+		}
+	}
+}
+
+// RelayBatch sends the next batch of events in order and reports how many
+// were published. It stops at the first event the sink rejects so that no
+// later event overtakes it.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, pendingStmt, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	rows.Close()
+
+	published := 0
+	var sendErr error
+	for _, e := range events {
+		if sendErr = r.sink.Send(ctx, e); sendErr != nil {
+			break
+		}
+		if _, err := tx.ExecContext(ctx, publishedStmt, e.ID); err != nil {
+			return 0, err
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if r.notify != nil {
+		for _, e := range events[:published] {
+			if err := r.notify.Send(ctx, e); err != nil {
+				r.logger.Warn("notify published event error", zap.Int64("id", e.ID), zap.Error(err))
+			}
+		}
+	}
+	return published, sendErr
+}
@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink is where the relay publishes outbox events. Send must be safe to
+// call again with an event it has already seen.
+type Sink interface {
+	Send(ctx context.Context, e Event) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(ctx context.Context, e Event) error
+
+func (f SinkFunc) Send(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// WriterSink writes every event as a line of JSON, which is handy to watch
+// events during development.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink appends events to the file at path.
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(f), nil
+}
+
+func (s *WriterSink) Send(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+type multiSink []Sink
+
+// Multi sends every event to each of sinks in turn. When one of them fails
+// the event is relayed again later, so the sinks before it may see it twice.
+func Multi(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Send(ctx context.Context, e Event) error {
+	for _, s := range m {
+		if err := s.Send(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
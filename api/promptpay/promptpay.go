@@ -0,0 +1,107 @@
+package promptpay
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/emvco"
+)
+
+var (
+	ErrInvalidID     = errors.New("promptpay_id must be a Thai mobile number or a 13 digit national ID")
+	ErrInvalidAmount = errors.New("amount must be positive and less than 10,000,000,000")
+	ErrNoID          = errors.New("spender has no promptpay_id")
+)
+
+// maxAmount keeps the amount within the 13 characters of its field.
+const maxAmount = 1e10
+
+// EMVCo merchant presented QR tags used by PromptPay.
+const (
+	tagVersion   = "00"
+	tagInitiate  = "01"
+	tagMerchant  = "29"
+	tagCountry   = "58"
+	tagCurrency  = "53"
+	tagAmount    = "54"
+	tagCRC       = "63"
+	subTagAID    = "00"
+	subTagPhone  = "01"
+	subTagIDCard = "02"
+
+	aid = "A000000677010111"
+	// a static QR can be paid many times, one with an amount only once
+	initiateStatic  = "11"
+	initiateDynamic = "12"
+	currencyTHB     = "764"
+)
+
+// NormalizeID returns a PromptPay id as its digits, 0XXXXXXXXX for mobile
+// numbers, +66 included, and 13 digits for national or tax IDs.
+func NormalizeID(id string) (string, error) {
+	id = strings.NewReplacer(" ", "", "-", "").Replace(id)
+	if strings.HasPrefix(id, "+66") {
+		id = "0" + id[3:]
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidID
+		}
+	}
+
+	switch {
+	case len(id) == 10 && id[0] == '0' && id[1] != '0':
+		return id, nil
+	case len(id) == 13 && validIDCard(id):
+		return id, nil
+	}
+	return "", ErrInvalidID
+}
+
+// validIDCard checks the check digit of a Thai national or tax ID.
+func validIDCard(id string) bool {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += int(id[i]-'0') * (13 - i)
+	}
+	return int(id[12]-'0') == (11-sum%11)%10
+}
+
+// Payload is the EMVCo QR payload of a PromptPay transfer to id, with the
+// amount filled in when it is not 0.
+func Payload(id string, amount float64) (string, error) {
+	id, err := NormalizeID(id)
+	if err != nil {
+		return "", err
+	}
+	amount = math.Round(amount*100) / 100
+	if amount < 0 || amount >= maxAmount {
+		return "", ErrInvalidAmount
+	}
+
+	account := emvco.Field(subTagIDCard, id)
+	if len(id) == 10 {
+		// mobile numbers go with the country code, zero padded to 13 digits
+		account = emvco.Field(subTagPhone, "0066"+id[1:])
+	}
+	initiate := initiateStatic
+	if amount > 0 {
+		initiate = initiateDynamic
+	}
+
+	var b strings.Builder
+	b.WriteString(emvco.Field(tagVersion, "01"))
+	b.WriteString(emvco.Field(tagInitiate, initiate))
+	b.WriteString(emvco.Field(tagMerchant, emvco.Field(subTagAID, aid)+account))
+	b.WriteString(emvco.Field(tagCountry, "TH"))
+	b.WriteString(emvco.Field(tagCurrency, currencyTHB))
+	if amount > 0 {
+		b.WriteString(emvco.Field(tagAmount, fmt.Sprintf("%.2f", amount)))
+	}
+	// the CRC covers everything up to and including its own tag and length
+	b.WriteString(tagCRC + "04")
+	fmt.Fprintf(&b, "%04X", emvco.CRC16(b.String()))
+	return b.String(), nil
+}
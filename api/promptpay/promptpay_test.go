@@ -0,0 +1,66 @@
+package promptpay
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/emvco"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+		err  error
+	}{
+		{"0812345678", "0812345678", nil},
+		{"081-234-5678", "0812345678", nil},
+		{"+66 81 234 5678", "0812345678", nil},
+		{"1-1037-00123-45-8", "1103700123458", nil},
+		{"1103700123451", "", ErrInvalidID},
+		{"812345678", "", ErrInvalidID},
+		{"0012345678", "", ErrInvalidID},
+		{"08123456789", "", ErrInvalidID},
+		{"08l2345678", "", ErrInvalidID},
+		{"", "", ErrInvalidID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := NormalizeID(tt.id)
+
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPayload(t *testing.T) {
+	t.Run("mobile number without amount", func(t *testing.T) {
+		got, err := Payload("080-123-4567", 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "00020101021129370016A000000677010111011300668012345675802TH530376463046197", got)
+	})
+
+	t.Run("national ID with amount", func(t *testing.T) {
+		got, err := Payload("1103700123458", 1337.5)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "00020101021229370016A000000677010111021311037001234585802TH53037645407"+"1337.50"+"6304", got[:len(got)-4])
+		assert.Equal(t, fmt.Sprintf("%04X", emvco.CRC16(got[:len(got)-4])), got[len(got)-4:])
+	})
+
+	t.Run("amount rounded to the satang", func(t *testing.T) {
+		got, err := Payload("0801234567", 10.006)
+
+		assert.NoError(t, err)
+		assert.Contains(t, got, "540510.01")
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		_, err := Payload("0801234567", -1)
+
+		assert.Equal(t, ErrInvalidAmount, err)
+	})
+}
@@ -0,0 +1,157 @@
+package promptpay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/makiuchi-d/gozxing/qrcode/decoder"
+	"github.com/makiuchi-d/gozxing/qrcode/encoder"
+)
+
+// quietZone is the blank border around the code, in modules, that scanners
+// need to find it.
+const quietZone = 4
+
+// Sizes of the PNG codes, in pixels.
+const (
+	DefaultSize = 300
+	minSize     = 100
+	maxSize     = 1000
+)
+
+// Formats of the codes.
+const (
+	FormatPNG  = "png"
+	FormatSVG  = "svg"
+	FormatJSON = "json"
+)
+
+// Content types of the codes.
+const (
+	TypePNG = "image/png"
+	TypeSVG = "image/svg+xml"
+)
+
+var (
+	ErrInvalidFormat = errors.New("format must be png, svg or json")
+	ErrInvalidSize   = errors.New("size must be between 100 and 1000 pixels")
+)
+
+// modules lays out payload as a QR code, true for the dark modules. Medium
+// error correction is what the banks print.
+func modules(payload string) ([][]bool, error) {
+	code, err := encoder.Encoder_encodeWithoutHint(payload, decoder.ErrorCorrectionLevel_M)
+	if err != nil {
+		return nil, err
+	}
+	m := code.GetMatrix()
+	rows := make([][]bool, m.GetHeight())
+	for y := range rows {
+		rows[y] = make([]bool, m.GetWidth())
+		for x := range rows[y] {
+			rows[y][x] = m.Get(x, y) == 1
+		}
+	}
+	return rows, nil
+}
+
+// PNG writes payload as a QR code of at most size pixels a side, each
+// module a whole number of pixels so it stays sharp.
+func PNG(w io.Writer, payload string, size int) error {
+	rows, err := modules(payload)
+	if err != nil {
+		return err
+	}
+	side := len(rows) + 2*quietZone
+	scale := max(size/side, 1)
+
+	img := image.NewPaletted(image.Rect(0, 0, side*scale, side*scale), color.Palette{color.White, color.Black})
+	for y, row := range rows {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// SVG writes payload as a QR code scaling to whatever size it is shown at,
+// one module a user unit.
+func SVG(w io.Writer, payload string) error {
+	rows, err := modules(payload)
+	if err != nil {
+		return err
+	}
+	side := len(rows) + 2*quietZone
+
+	var path strings.Builder
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// runs of dark modules make a single rectangle
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", x+quietZone, y+quietZone, run, run)
+			x += run - 1
+		}
+	}
+	_, err = fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`, side, side, path.String())
+	return err
+}
+
+// Respond renders payload in the ?format of the request, a PNG of ?size
+// pixels by default.
+func Respond(c echo.Context, payload string) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = FormatPNG
+	}
+	size := DefaultSize
+	if v := c.QueryParam("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minSize || n > maxSize {
+			return c.JSON(http.StatusBadRequest, ErrInvalidSize.Error())
+		}
+		size = n
+	}
+
+	var b bytes.Buffer
+	var err error
+	switch format {
+	case FormatJSON:
+		return c.JSON(http.StatusOK, map[string]string{"payload": payload})
+	case FormatPNG:
+		err = PNG(&b, payload, size)
+	case FormatSVG:
+		err = SVG(&b, payload)
+	default:
+		return c.JSON(http.StatusBadRequest, ErrInvalidFormat.Error())
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if format == FormatSVG {
+		return c.Blob(http.StatusOK, TypeSVG, b.Bytes())
+	}
+	return c.Blob(http.StatusOK, TypePNG, b.Bytes())
+}
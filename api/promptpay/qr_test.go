@@ -0,0 +1,71 @@
+package promptpay
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/stretchr/testify/assert"
+)
+
+const payload = "00020101021129370016A000000677010111011300668012345675802TH530376463046197"
+
+func TestPNG(t *testing.T) {
+	var b bytes.Buffer
+
+	err := PNG(&b, payload, DefaultSize)
+
+	assert.NoError(t, err)
+	img, err := png.Decode(&b)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, img.Bounds().Dx(), DefaultSize)
+	assert.Equal(t, img.Bounds().Dx(), img.Bounds().Dy())
+	bmp, _ := gozxing.NewBinaryBitmapFromImage(img)
+	res, err := qrcode.NewQRCodeReader().Decode(bmp, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, res.GetText())
+}
+
+func TestSVG(t *testing.T) {
+	var b bytes.Buffer
+
+	err := SVG(&b, payload)
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(b.String(), `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 41 41"`))
+	assert.Contains(t, b.String(), `<path fill="#000" d="M4 4h7v1h-7z`)
+}
+
+func TestRespond(t *testing.T) {
+	tests := []struct {
+		query       string
+		code        int
+		contentType string
+	}{
+		{"", http.StatusOK, TypePNG},
+		{"?format=png&size=120", http.StatusOK, TypePNG},
+		{"?format=svg", http.StatusOK, TypeSVG},
+		{"?format=json", http.StatusOK, echo.MIMEApplicationJSON},
+		{"?format=gif", http.StatusBadRequest, echo.MIMEApplicationJSON},
+		{"?size=5000", http.StatusBadRequest, echo.MIMEApplicationJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			err := Respond(c, payload)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, rec.Code)
+			assert.True(t, strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), tt.contentType))
+		})
+	}
+}
@@ -0,0 +1,619 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: hongjot.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	SpenderService_CreateSpender_FullMethodName     = "/hongjot.v1.SpenderService/CreateSpender"
+	SpenderService_ListSpenders_FullMethodName      = "/hongjot.v1.SpenderService/ListSpenders"
+	SpenderService_GetSpender_FullMethodName        = "/hongjot.v1.SpenderService/GetSpender"
+	SpenderService_UpdateSpender_FullMethodName     = "/hongjot.v1.SpenderService/UpdateSpender"
+	SpenderService_PatchSpender_FullMethodName      = "/hongjot.v1.SpenderService/PatchSpender"
+	SpenderService_DeactivateSpender_FullMethodName = "/hongjot.v1.SpenderService/DeactivateSpender"
+	SpenderService_ReactivateSpender_FullMethodName = "/hongjot.v1.SpenderService/ReactivateSpender"
+	SpenderService_DeleteSpender_FullMethodName     = "/hongjot.v1.SpenderService/DeleteSpender"
+)
+
+// SpenderServiceClient is the client API for SpenderService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SpenderServiceClient interface {
+	CreateSpender(ctx context.Context, in *CreateSpenderRequest, opts ...grpc.CallOption) (*Spender, error)
+	ListSpenders(ctx context.Context, in *ListSpendersRequest, opts ...grpc.CallOption) (*ListSpendersResponse, error)
+	GetSpender(ctx context.Context, in *GetSpenderRequest, opts ...grpc.CallOption) (*Spender, error)
+	UpdateSpender(ctx context.Context, in *UpdateSpenderRequest, opts ...grpc.CallOption) (*Spender, error)
+	PatchSpender(ctx context.Context, in *PatchSpenderRequest, opts ...grpc.CallOption) (*Spender, error)
+	DeactivateSpender(ctx context.Context, in *DeactivateSpenderRequest, opts ...grpc.CallOption) (*Spender, error)
+	ReactivateSpender(ctx context.Context, in *ReactivateSpenderRequest, opts ...grpc.CallOption) (*Spender, error)
+	DeleteSpender(ctx context.Context, in *DeleteSpenderRequest, opts ...grpc.CallOption) (*DeleteSpenderResponse, error)
+}
+
+type spenderServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSpenderServiceClient(cc grpc.ClientConnInterface) SpenderServiceClient {
+	return &spenderServiceClient{cc}
+}
+
+func (c *spenderServiceClient) CreateSpender(ctx context.Context, in *CreateSpenderRequest, opts ...grpc.CallOption) (*Spender, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Spender)
+	err := c.cc.Invoke(ctx, SpenderService_CreateSpender_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spenderServiceClient) ListSpenders(ctx context.Context, in *ListSpendersRequest, opts ...grpc.CallOption) (*ListSpendersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSpendersResponse)
+	err := c.cc.Invoke(ctx, SpenderService_ListSpenders_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spenderServiceClient) GetSpender(ctx context.Context, in *GetSpenderRequest, opts ...grpc.CallOption) (*Spender, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Spender)
+	err := c.cc.Invoke(ctx, SpenderService_GetSpender_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spenderServiceClient) UpdateSpender(ctx context.Context, in *UpdateSpenderRequest, opts ...grpc.CallOption) (*Spender, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Spender)
+	err := c.cc.Invoke(ctx, SpenderService_UpdateSpender_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spenderServiceClient) PatchSpender(ctx context.Context, in *PatchSpenderRequest, opts ...grpc.CallOption) (*Spender, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Spender)
+	err := c.cc.Invoke(ctx, SpenderService_PatchSpender_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spenderServiceClient) DeactivateSpender(ctx context.Context, in *DeactivateSpenderRequest, opts ...grpc.CallOption) (*Spender, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Spender)
+	err := c.cc.Invoke(ctx, SpenderService_DeactivateSpender_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spenderServiceClient) ReactivateSpender(ctx context.Context, in *ReactivateSpenderRequest, opts ...grpc.CallOption) (*Spender, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Spender)
+	err := c.cc.Invoke(ctx, SpenderService_ReactivateSpender_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spenderServiceClient) DeleteSpender(ctx context.Context, in *DeleteSpenderRequest, opts ...grpc.CallOption) (*DeleteSpenderResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteSpenderResponse)
+	err := c.cc.Invoke(ctx, SpenderService_DeleteSpender_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SpenderServiceServer is the server API for SpenderService service.
+// All implementations must embed UnimplementedSpenderServiceServer
+// for forward compatibility
+type SpenderServiceServer interface {
+	CreateSpender(context.Context, *CreateSpenderRequest) (*Spender, error)
+	ListSpenders(context.Context, *ListSpendersRequest) (*ListSpendersResponse, error)
+	GetSpender(context.Context, *GetSpenderRequest) (*Spender, error)
+	UpdateSpender(context.Context, *UpdateSpenderRequest) (*Spender, error)
+	PatchSpender(context.Context, *PatchSpenderRequest) (*Spender, error)
+	DeactivateSpender(context.Context, *DeactivateSpenderRequest) (*Spender, error)
+	ReactivateSpender(context.Context, *ReactivateSpenderRequest) (*Spender, error)
+	DeleteSpender(context.Context, *DeleteSpenderRequest) (*DeleteSpenderResponse, error)
+	mustEmbedUnimplementedSpenderServiceServer()
+}
+
+// UnimplementedSpenderServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSpenderServiceServer struct {
+}
+
+func (UnimplementedSpenderServiceServer) CreateSpender(context.Context, *CreateSpenderRequest) (*Spender, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSpender not implemented")
+}
+func (UnimplementedSpenderServiceServer) ListSpenders(context.Context, *ListSpendersRequest) (*ListSpendersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSpenders not implemented")
+}
+func (UnimplementedSpenderServiceServer) GetSpender(context.Context, *GetSpenderRequest) (*Spender, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSpender not implemented")
+}
+func (UnimplementedSpenderServiceServer) UpdateSpender(context.Context, *UpdateSpenderRequest) (*Spender, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateSpender not implemented")
+}
+func (UnimplementedSpenderServiceServer) PatchSpender(context.Context, *PatchSpenderRequest) (*Spender, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PatchSpender not implemented")
+}
+func (UnimplementedSpenderServiceServer) DeactivateSpender(context.Context, *DeactivateSpenderRequest) (*Spender, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeactivateSpender not implemented")
+}
+func (UnimplementedSpenderServiceServer) ReactivateSpender(context.Context, *ReactivateSpenderRequest) (*Spender, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReactivateSpender not implemented")
+}
+func (UnimplementedSpenderServiceServer) DeleteSpender(context.Context, *DeleteSpenderRequest) (*DeleteSpenderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSpender not implemented")
+}
+func (UnimplementedSpenderServiceServer) mustEmbedUnimplementedSpenderServiceServer() {}
+
+// UnsafeSpenderServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SpenderServiceServer will
+// result in compilation errors.
+type UnsafeSpenderServiceServer interface {
+	mustEmbedUnimplementedSpenderServiceServer()
+}
+
+func RegisterSpenderServiceServer(s grpc.ServiceRegistrar, srv SpenderServiceServer) {
+	s.RegisterService(&SpenderService_ServiceDesc, srv)
+}
+
+func _SpenderService_CreateSpender_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSpenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).CreateSpender(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_CreateSpender_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).CreateSpender(ctx, req.(*CreateSpenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpenderService_ListSpenders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSpendersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).ListSpenders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_ListSpenders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).ListSpenders(ctx, req.(*ListSpendersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpenderService_GetSpender_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSpenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).GetSpender(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_GetSpender_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).GetSpender(ctx, req.(*GetSpenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpenderService_UpdateSpender_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateSpenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).UpdateSpender(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_UpdateSpender_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).UpdateSpender(ctx, req.(*UpdateSpenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpenderService_PatchSpender_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchSpenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).PatchSpender(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_PatchSpender_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).PatchSpender(ctx, req.(*PatchSpenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpenderService_DeactivateSpender_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeactivateSpenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).DeactivateSpender(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_DeactivateSpender_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).DeactivateSpender(ctx, req.(*DeactivateSpenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpenderService_ReactivateSpender_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReactivateSpenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).ReactivateSpender(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_ReactivateSpender_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).ReactivateSpender(ctx, req.(*ReactivateSpenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpenderService_DeleteSpender_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSpenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpenderServiceServer).DeleteSpender(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SpenderService_DeleteSpender_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpenderServiceServer).DeleteSpender(ctx, req.(*DeleteSpenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SpenderService_ServiceDesc is the grpc.ServiceDesc for SpenderService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SpenderService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hongjot.v1.SpenderService",
+	HandlerType: (*SpenderServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSpender",
+			Handler:    _SpenderService_CreateSpender_Handler,
+		},
+		{
+			MethodName: "ListSpenders",
+			Handler:    _SpenderService_ListSpenders_Handler,
+		},
+		{
+			MethodName: "GetSpender",
+			Handler:    _SpenderService_GetSpender_Handler,
+		},
+		{
+			MethodName: "UpdateSpender",
+			Handler:    _SpenderService_UpdateSpender_Handler,
+		},
+		{
+			MethodName: "PatchSpender",
+			Handler:    _SpenderService_PatchSpender_Handler,
+		},
+		{
+			MethodName: "DeactivateSpender",
+			Handler:    _SpenderService_DeactivateSpender_Handler,
+		},
+		{
+			MethodName: "ReactivateSpender",
+			Handler:    _SpenderService_ReactivateSpender_Handler,
+		},
+		{
+			MethodName: "DeleteSpender",
+			Handler:    _SpenderService_DeleteSpender_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "hongjot.proto",
+}
+
+const (
+	TransactionService_CreateTransaction_FullMethodName            = "/hongjot.v1.TransactionService/CreateTransaction"
+	TransactionService_UpdateTransaction_FullMethodName            = "/hongjot.v1.TransactionService/UpdateTransaction"
+	TransactionService_DeleteTransaction_FullMethodName            = "/hongjot.v1.TransactionService/DeleteTransaction"
+	TransactionService_ListSpenderTransactions_FullMethodName      = "/hongjot.v1.TransactionService/ListSpenderTransactions"
+	TransactionService_GetSpenderTransactionSummary_FullMethodName = "/hongjot.v1.TransactionService/GetSpenderTransactionSummary"
+)
+
+// TransactionServiceClient is the client API for TransactionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TransactionServiceClient interface {
+	CreateTransaction(ctx context.Context, in *CreateTransactionRequest, opts ...grpc.CallOption) (*Transaction, error)
+	UpdateTransaction(ctx context.Context, in *UpdateTransactionRequest, opts ...grpc.CallOption) (*Transaction, error)
+	DeleteTransaction(ctx context.Context, in *DeleteTransactionRequest, opts ...grpc.CallOption) (*DeleteTransactionResponse, error)
+	ListSpenderTransactions(ctx context.Context, in *ListSpenderTransactionsRequest, opts ...grpc.CallOption) (*ListSpenderTransactionsResponse, error)
+	GetSpenderTransactionSummary(ctx context.Context, in *GetSpenderTransactionSummaryRequest, opts ...grpc.CallOption) (*Summary, error)
+}
+
+type transactionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTransactionServiceClient(cc grpc.ClientConnInterface) TransactionServiceClient {
+	return &transactionServiceClient{cc}
+}
+
+func (c *transactionServiceClient) CreateTransaction(ctx context.Context, in *CreateTransactionRequest, opts ...grpc.CallOption) (*Transaction, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, TransactionService_CreateTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) UpdateTransaction(ctx context.Context, in *UpdateTransactionRequest, opts ...grpc.CallOption) (*Transaction, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, TransactionService_UpdateTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) DeleteTransaction(ctx context.Context, in *DeleteTransactionRequest, opts ...grpc.CallOption) (*DeleteTransactionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteTransactionResponse)
+	err := c.cc.Invoke(ctx, TransactionService_DeleteTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) ListSpenderTransactions(ctx context.Context, in *ListSpenderTransactionsRequest, opts ...grpc.CallOption) (*ListSpenderTransactionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSpenderTransactionsResponse)
+	err := c.cc.Invoke(ctx, TransactionService_ListSpenderTransactions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) GetSpenderTransactionSummary(ctx context.Context, in *GetSpenderTransactionSummaryRequest, opts ...grpc.CallOption) (*Summary, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Summary)
+	err := c.cc.Invoke(ctx, TransactionService_GetSpenderTransactionSummary_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TransactionServiceServer is the server API for TransactionService service.
+// All implementations must embed UnimplementedTransactionServiceServer
+// for forward compatibility
+type TransactionServiceServer interface {
+	CreateTransaction(context.Context, *CreateTransactionRequest) (*Transaction, error)
+	UpdateTransaction(context.Context, *UpdateTransactionRequest) (*Transaction, error)
+	DeleteTransaction(context.Context, *DeleteTransactionRequest) (*DeleteTransactionResponse, error)
+	ListSpenderTransactions(context.Context, *ListSpenderTransactionsRequest) (*ListSpenderTransactionsResponse, error)
+	GetSpenderTransactionSummary(context.Context, *GetSpenderTransactionSummaryRequest) (*Summary, error)
+	mustEmbedUnimplementedTransactionServiceServer()
+}
+
+// UnimplementedTransactionServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedTransactionServiceServer struct {
+}
+
+func (UnimplementedTransactionServiceServer) CreateTransaction(context.Context, *CreateTransactionRequest) (*Transaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTransaction not implemented")
+}
+func (UnimplementedTransactionServiceServer) UpdateTransaction(context.Context, *UpdateTransactionRequest) (*Transaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTransaction not implemented")
+}
+func (UnimplementedTransactionServiceServer) DeleteTransaction(context.Context, *DeleteTransactionRequest) (*DeleteTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTransaction not implemented")
+}
+func (UnimplementedTransactionServiceServer) ListSpenderTransactions(context.Context, *ListSpenderTransactionsRequest) (*ListSpenderTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSpenderTransactions not implemented")
+}
+func (UnimplementedTransactionServiceServer) GetSpenderTransactionSummary(context.Context, *GetSpenderTransactionSummaryRequest) (*Summary, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSpenderTransactionSummary not implemented")
+}
+func (UnimplementedTransactionServiceServer) mustEmbedUnimplementedTransactionServiceServer() {}
+
+// UnsafeTransactionServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TransactionServiceServer will
+// result in compilation errors.
+type UnsafeTransactionServiceServer interface {
+	mustEmbedUnimplementedTransactionServiceServer()
+}
+
+func RegisterTransactionServiceServer(s grpc.ServiceRegistrar, srv TransactionServiceServer) {
+	s.RegisterService(&TransactionService_ServiceDesc, srv)
+}
+
+func _TransactionService_CreateTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).CreateTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_CreateTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).CreateTransaction(ctx, req.(*CreateTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_UpdateTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).UpdateTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_UpdateTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).UpdateTransaction(ctx, req.(*UpdateTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_DeleteTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).DeleteTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_DeleteTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).DeleteTransaction(ctx, req.(*DeleteTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_ListSpenderTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSpenderTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).ListSpenderTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_ListSpenderTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).ListSpenderTransactions(ctx, req.(*ListSpenderTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_GetSpenderTransactionSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSpenderTransactionSummaryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).GetSpenderTransactionSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_GetSpenderTransactionSummary_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).GetSpenderTransactionSummary(ctx, req.(*GetSpenderTransactionSummaryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TransactionService_ServiceDesc is the grpc.ServiceDesc for TransactionService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TransactionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hongjot.v1.TransactionService",
+	HandlerType: (*TransactionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTransaction",
+			Handler:    _TransactionService_CreateTransaction_Handler,
+		},
+		{
+			MethodName: "UpdateTransaction",
+			Handler:    _TransactionService_UpdateTransaction_Handler,
+		},
+		{
+			MethodName: "DeleteTransaction",
+			Handler:    _TransactionService_DeleteTransaction_Handler,
+		},
+		{
+			MethodName: "ListSpenderTransactions",
+			Handler:    _TransactionService_ListSpenderTransactions_Handler,
+		},
+		{
+			MethodName: "GetSpenderTransactionSummary",
+			Handler:    _TransactionService_GetSpenderTransactionSummary_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "hongjot.proto",
+}
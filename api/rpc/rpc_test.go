@@ -0,0 +1,250 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rpc/pb"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func dial(t *testing.T, db *sql.DB, cfg config.Config) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	s := New(db, cfg, zap.NewNop())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func authorized(username, password string) context.Context {
+	token := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+token)
+}
+
+func TestAuth(t *testing.T) {
+	conn := dial(t, nil, config.Config{})
+	client := pb.NewSpenderServiceClient(conn)
+
+	_, err := client.GetSpender(context.Background(), &pb.GetSpenderRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.GetSpender(authorized("user", "wrong-secret"), &pb.GetSpenderRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+var spenderColumns = []string{"id", "name", "email", "active", "email_verified", "timezone", "locale", "currency", "month_start_day", "promptpay_id"}
+
+func TestSpenderService(t *testing.T) {
+	t.Run("get spender", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(`SELECT id, name, email, active, email_verified_at IS NOT NULL, timezone, locale, currency, month_start_day, COALESCE(promptpay_id, '') FROM spender WHERE id = $1;`).WithArgs("1").
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "HongJot", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, "0812345678"))
+
+		client := pb.NewSpenderServiceClient(dial(t, db, config.Config{}))
+		got, err := client.GetSpender(authorized("user", "secret"), &pb.GetSpenderRequest{Id: 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "HongJot", got.GetName())
+		assert.Equal(t, "hong@jot.ok", got.GetEmail())
+		assert.True(t, got.GetActive())
+		assert.Equal(t, "0812345678", got.GetPromptpayId())
+	})
+
+	t.Run("spender not found", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(`SELECT id, name, email, active, email_verified_at IS NOT NULL, timezone, locale, currency, month_start_day, COALESCE(promptpay_id, '') FROM spender WHERE id = $1;`).WithArgs("9").
+			WillReturnError(sql.ErrNoRows)
+
+		client := pb.NewSpenderServiceClient(dial(t, db, config.Config{}))
+		_, err := client.GetSpender(authorized("user", "secret"), &pb.GetSpenderRequest{Id: 9})
+
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("create spender with preferences and PromptPay id", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO spender`).WithArgs("HongJot", "hong@jot.ok", "Asia/Tokyo", "ja-JP", "JPY", 25, "0812345678").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec(`INSERT INTO outbox`).WithArgs("spender.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		cfg := config.Config{FeatureFlag: config.FeatureFlag{EnableCreateSpender: true}}
+		client := pb.NewSpenderServiceClient(dial(t, db, cfg))
+		got, err := client.CreateSpender(authorized("user", "secret"), &pb.CreateSpenderRequest{
+			Name:        "HongJot",
+			Email:       "hong@jot.ok",
+			Preferences: &pb.Preferences{Timezone: "Asia/Tokyo", Locale: "ja-JP", Currency: "JPY", MonthStartDay: 25},
+			PromptpayId: "081-234-5678",
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), got.GetId())
+		assert.Equal(t, "JPY", got.GetPreferences().GetCurrency())
+		assert.Equal(t, "0812345678", got.GetPromptpayId())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create spender with an invalid PromptPay id", func(t *testing.T) {
+		cfg := config.Config{FeatureFlag: config.FeatureFlag{EnableCreateSpender: true}}
+		client := pb.NewSpenderServiceClient(dial(t, nil, cfg))
+		_, err := client.CreateSpender(authorized("user", "secret"), &pb.CreateSpenderRequest{Name: "HongJot", Email: "hong@jot.ok", PromptpayId: "12"})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("patch the name of a spender", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE spender SET name`).WithArgs("Jot", nil, nil, int64(1)).
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "Jot", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, ""))
+		mock.ExpectExec(`INSERT INTO outbox`).WithArgs("spender.updated", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		name := "Jot"
+		client := pb.NewSpenderServiceClient(dial(t, db, config.Config{}))
+		got, err := client.PatchSpender(authorized("user", "secret"), &pb.PatchSpenderRequest{Id: 1, Name: &name})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Jot", got.GetName())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update a spender without email", func(t *testing.T) {
+		client := pb.NewSpenderServiceClient(dial(t, nil, config.Config{}))
+		_, err := client.UpdateSpender(authorized("user", "secret"), &pb.UpdateSpenderRequest{Id: 1, Name: "HongJot"})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("deactivate a missing spender", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE spender SET active`).WithArgs(false, int64(9)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		client := pb.NewSpenderServiceClient(dial(t, db, config.Config{}))
+		_, err := client.DeactivateSpender(authorized("user", "secret"), &pb.DeactivateSpenderRequest{Id: 9})
+
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete a spender with an unknown policy", func(t *testing.T) {
+		client := pb.NewSpenderServiceClient(dial(t, nil, config.Config{}))
+		_, err := client.DeleteSpender(authorized("user", "secret"), &pb.DeleteSpenderRequest{Id: 1, Policy: "forget"})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("create spender when disabled", func(t *testing.T) {
+		client := pb.NewSpenderServiceClient(dial(t, nil, config.Config{}))
+		_, err := client.CreateSpender(authorized("user", "secret"), &pb.CreateSpenderRequest{Name: "HongJot"})
+
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
+
+func TestTransactionService(t *testing.T) {
+	t.Run("get summary", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery(`SELECT timezone`).WithArgs("1").
+			WillReturnRows(sqlmock.NewRows([]string{"timezone", "locale", "currency", "month_start_day"}).AddRow("Asia/Bangkok", "th-TH", "THB", 25))
+		mock.ExpectQuery(`SELECT`).WithArgs("1", nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"income", "expenses"}).AddRow(1000.0, 250.0))
+
+		client := pb.NewTransactionServiceClient(dial(t, db, config.Config{}))
+		got, err := client.GetSpenderTransactionSummary(authorized("user", "secret"), &pb.GetSpenderTransactionSummaryRequest{SpenderId: 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1000.0, got.GetTotalIncome())
+		assert.Equal(t, 250.0, got.GetTotalExpenses())
+		assert.Equal(t, 750.0, got.GetCurrentBalance())
+		assert.Equal(t, "THB", got.GetCurrency())
+	})
+
+	t.Run("summary of an invalid month", func(t *testing.T) {
+		client := pb.NewTransactionServiceClient(dial(t, nil, config.Config{}))
+		_, err := client.GetSpenderTransactionSummary(authorized("user", "secret"), &pb.GetSpenderTransactionSummaryRequest{SpenderId: 1, Month: "May"})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("list with an invalid range", func(t *testing.T) {
+		client := pb.NewTransactionServiceClient(dial(t, nil, config.Config{}))
+		_, err := client.ListSpenderTransactions(authorized("user", "secret"), &pb.ListSpenderTransactionsRequest{SpenderId: 1, From: "yesterday"})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("update returns the category as named in the catalog", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, COALESCE\(spender_id, 0\)`).WithArgs(int64(1), "coffee", "expense").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "parent_id", "name", "icon", "color", "type"}).AddRow(19, 0, 0, "Coffee", "", "#795548", "expense"))
+		mock.ExpectExec(`UPDATE transaction`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		client := pb.NewTransactionServiceClient(dial(t, db, config.Config{}))
+		got, err := client.UpdateTransaction(authorized("user", "secret"), &pb.UpdateTransactionRequest{
+			Id:          1,
+			Transaction: &pb.Transaction{Date: "2024-05-20T08:00:00Z", Amount: 65, Category: "  coffee ", TransactionType: "expense", SpenderId: 1},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Coffee", got.GetCategory())
+		assert.Equal(t, int64(19), got.GetCategoryId())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update with a fractional amount", func(t *testing.T) {
+		client := pb.NewTransactionServiceClient(dial(t, nil, config.Config{}))
+		_, err := client.UpdateTransaction(authorized("user", "secret"), &pb.UpdateTransactionRequest{
+			Id:          1,
+			Transaction: &pb.Transaction{Date: "2024-05-20T08:00:00Z", Amount: 99.5, SpenderId: 1},
+		})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("delete a missing transaction", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM transaction WHERE id = $1 RETURNING spender_id;`).WithArgs(int64(7)).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		client := pb.NewTransactionServiceClient(dial(t, db, config.Config{}))
+		_, err := client.DeleteTransaction(authorized("user", "secret"), &pb.DeleteTransactionRequest{Id: 7})
+
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,70 @@
+// Package rpc serves the spender and transaction APIs over gRPC, next to the
+// Echo REST API and on top of the same services.
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rpc/pb"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func New(db *sql.DB, cfg config.Config, logger *zap.Logger) *grpc.Server {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(logErrors(logger), basicAuth))
+
+	pb.RegisterSpenderServiceServer(s, &spenderServer{
+		service: spender.NewService(cfg.FeatureFlag, db),
+	})
+	pb.RegisterTransactionServiceServer(s, &transactionServer{
+		service: transaction.NewService(cfg.FeatureFlag, db),
+	})
+
+	return s
+}
+
+// basicAuth checks the same credentials as the REST API, sent as an
+// "authorization: Basic ..." metadata entry.
+func basicAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		scheme, credentials, ok := strings.Cut(v, " ")
+		if !ok || !strings.EqualFold(scheme, "basic") {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			continue
+		}
+		username, password, ok := strings.Cut(string(b), ":")
+		if ok && auth.Check(username, password) {
+			return handler(ctx, req)
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+}
+
+func logErrors(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if status.Code(err) == codes.Internal {
+			logger.Error("grpc error", zap.String("method", info.FullMethod), zap.Error(err))
+		}
+		return resp, err
+	}
+}
+
+// internal reports an unexpected error, logErrors logs it on the way out.
+func internal(err error) error {
+	return status.Error(codes.Internal, err.Error())
+}
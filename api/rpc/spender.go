@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/promptpay"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rpc/pb"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type spenderServer struct {
+	pb.UnimplementedSpenderServiceServer
+	service spender.Service
+}
+
+func (s *spenderServer) CreateSpender(ctx context.Context, req *pb.CreateSpenderRequest) (*pb.Spender, error) {
+	p := req.GetPreferences()
+	sp, err := s.service.Create(ctx, spender.Spender{
+		Name:  req.GetName(),
+		Email: req.GetEmail(),
+		Preferences: spender.Preferences{
+			Timezone:      p.GetTimezone(),
+			Locale:        p.GetLocale(),
+			Currency:      p.GetCurrency(),
+			MonthStartDay: int(p.GetMonthStartDay()),
+		},
+		PromptPayID: req.GetPromptpayId(),
+	})
+	if err == spender.ErrCreateDisabled {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return spenderResult(sp, err)
+}
+
+func (s *spenderServer) ListSpenders(ctx context.Context, _ *pb.ListSpendersRequest) (*pb.ListSpendersResponse, error) {
+	sps, err := s.service.GetAll(ctx)
+	if err != nil {
+		return nil, internal(err)
+	}
+
+	res := &pb.ListSpendersResponse{}
+	for _, sp := range sps {
+		res.Spenders = append(res.Spenders, toSpender(sp))
+	}
+	return res, nil
+}
+
+func (s *spenderServer) GetSpender(ctx context.Context, req *pb.GetSpenderRequest) (*pb.Spender, error) {
+	sp, err := s.service.GetByID(ctx, strconv.FormatInt(req.GetId(), 10))
+	if err == spender.ErrNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, internal(err)
+	}
+	return toSpender(sp), nil
+}
+
+func (s *spenderServer) UpdateSpender(ctx context.Context, req *pb.UpdateSpenderRequest) (*pb.Spender, error) {
+	name, email := req.GetName(), req.GetEmail()
+	if name == "" || email == "" {
+		return nil, status.Error(codes.InvalidArgument, spender.ErrNameEmailMissing.Error())
+	}
+	return spenderResult(s.service.Update(ctx, req.GetId(), spender.Patch{Name: &name, Email: &email}))
+}
+
+func (s *spenderServer) PatchSpender(ctx context.Context, req *pb.PatchSpenderRequest) (*pb.Spender, error) {
+	p := spender.Patch{Name: req.Name, Email: req.Email, PromptPayID: req.PromptpayId}
+	if p.Name != nil && *p.Name == "" || p.Email != nil && *p.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, spender.ErrNameEmailMissing.Error())
+	}
+	return spenderResult(s.service.Update(ctx, req.GetId(), p))
+}
+
+func (s *spenderServer) DeactivateSpender(ctx context.Context, req *pb.DeactivateSpenderRequest) (*pb.Spender, error) {
+	return spenderResult(s.service.SetActive(ctx, req.GetId(), false))
+}
+
+func (s *spenderServer) ReactivateSpender(ctx context.Context, req *pb.ReactivateSpenderRequest) (*pb.Spender, error) {
+	return spenderResult(s.service.SetActive(ctx, req.GetId(), true))
+}
+
+func (s *spenderServer) DeleteSpender(ctx context.Context, req *pb.DeleteSpenderRequest) (*pb.DeleteSpenderResponse, error) {
+	policy := req.GetPolicy()
+	if policy == "" {
+		policy = spender.PolicyRestrict
+	}
+	err := s.service.Delete(ctx, req.GetId(), policy)
+	switch err {
+	case nil:
+		return &pb.DeleteSpenderResponse{}, nil
+	case spender.ErrUnknownPolicy:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case spender.ErrNotFound:
+		return nil, status.Error(codes.NotFound, err.Error())
+	case spender.ErrHasTransactions, spender.ErrSharesBills:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return nil, internal(err)
+	}
+}
+
+// spenderResult maps the errors of the spender changes to their codes.
+func spenderResult(sp spender.Spender, err error) (*pb.Spender, error) {
+	switch {
+	case err == nil:
+		return toSpender(sp), nil
+	case err == spender.ErrInvalidEmail, err == promptpay.ErrInvalidID, spender.IsInvalidPreferences(err):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err == spender.ErrNotFound:
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err == spender.ErrEmailTaken:
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return nil, internal(err)
+	}
+}
+
+func toSpender(sp spender.Spender) *pb.Spender {
+	return &pb.Spender{
+		Id:            sp.ID,
+		Name:          sp.Name,
+		Email:         sp.Email,
+		Active:        sp.Active,
+		EmailVerified: sp.EmailVerified,
+		Preferences: &pb.Preferences{
+			Timezone:      sp.Preferences.Timezone,
+			Locale:        sp.Preferences.Locale,
+			Currency:      sp.Preferences.Currency,
+			MonthStartDay: int32(sp.Preferences.MonthStartDay),
+		},
+		PromptpayId: sp.PromptPayID,
+	}
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rpc/pb"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type transactionServer struct {
+	pb.UnimplementedTransactionServiceServer
+	service transaction.Service
+}
+
+func (s *transactionServer) CreateTransaction(ctx context.Context, req *pb.CreateTransactionRequest) (*pb.Transaction, error) {
+	t := fromTransaction(req.GetTransaction())
+	t, err := s.service.Create(ctx, t)
+	if err == category.ErrUnknownCategory || err == category.ErrTypeMismatch {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err == transaction.ErrSpenderInactive {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
+		return nil, internal(err)
+	}
+	return toTransaction(t), nil
+}
+
+func (s *transactionServer) UpdateTransaction(ctx context.Context, req *pb.UpdateTransactionRequest) (*pb.Transaction, error) {
+	t := req.GetTransaction()
+	date, err := time.Parse(time.RFC3339, t.GetDate())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "date must be RFC3339")
+	}
+	// PutTransaction amounts are whole, do not drop the satang silently
+	amount := t.GetAmount()
+	if amount != math.Trunc(amount) {
+		return nil, status.Error(codes.InvalidArgument, "amount must be a whole number")
+	}
+
+	updated, err := s.service.Update(ctx, req.GetId(), transaction.PutTransaction{
+		Date:            date,
+		Amount:          int(amount),
+		Category:        t.GetCategory(),
+		TransactionType: t.GetTransactionType(),
+		Note:            t.GetNote(),
+		ImageUrl:        t.GetImageUrl(),
+		SpenderId:       int(t.GetSpenderId()),
+		CategoryID:      t.GetCategoryId(),
+	})
+	if err == category.ErrUnknownCategory || err == category.ErrTypeMismatch {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err == transaction.ErrNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, internal(err)
+	}
+
+	res := fromTransaction(t)
+	res.ID = req.GetId()
+	res.Category = updated.Category
+	res.CategoryID = updated.CategoryID
+	// Update keeps the tags, those of the request are not saved
+	res.Tags = nil
+	return toTransaction(res), nil
+}
+
+func (s *transactionServer) DeleteTransaction(ctx context.Context, req *pb.DeleteTransactionRequest) (*pb.DeleteTransactionResponse, error) {
+	err := s.service.Delete(ctx, req.GetId())
+	if err == transaction.ErrNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, internal(err)
+	}
+	return &pb.DeleteTransactionResponse{}, nil
+}
+
+func (s *transactionServer) ListSpenderTransactions(ctx context.Context, req *pb.ListSpenderTransactionsRequest) (*pb.ListSpenderTransactionsResponse, error) {
+	q, err := transaction.NewHistoryQuery(int(req.GetPage()), int(req.GetLimit()), req.GetFrom(), req.GetTo())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	history, err := s.service.History(ctx, strconv.FormatInt(req.GetSpenderId(), 10), q)
+	if err != nil {
+		return nil, internal(err)
+	}
+
+	res := &pb.ListSpenderTransactionsResponse{
+		Summary: toSummary(history.Summary),
+		Balance: &pb.Balance{
+			OpeningBalance: history.Balance.Opening,
+			ClosingBalance: history.Balance.Closing,
+		},
+		Pagination: &pb.Pagination{
+			CurrentPage: int32(history.Pagination.CurrentPage),
+			TotalPages:  int32(history.Pagination.TotalPages),
+			PerPage:     int32(history.Pagination.PerPage),
+		},
+	}
+	for _, t := range history.Transactions {
+		res.Transactions = append(res.Transactions, &pb.TransactionWithBalance{
+			Transaction:    toTransaction(t.Transaction),
+			RunningBalance: t.RunningBalance,
+		})
+	}
+	return res, nil
+}
+
+func (s *transactionServer) GetSpenderTransactionSummary(ctx context.Context, req *pb.GetSpenderTransactionSummaryRequest) (*pb.Summary, error) {
+	summary, _, err := s.service.Summary(ctx, strconv.FormatInt(req.GetSpenderId(), 10), req.GetMonth())
+	if err == transaction.ErrInvalidMonth {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, internal(err)
+	}
+	return toSummary(summary), nil
+}
+
+func fromTransaction(t *pb.Transaction) transaction.Transaction {
+	return transaction.Transaction{
+		ID:              t.GetId(),
+		Date:            t.GetDate(),
+		Amount:          t.GetAmount(),
+		Category:        t.GetCategory(),
+		TransactionType: t.GetTransactionType(),
+		Note:            t.GetNote(),
+		ImageURL:        t.GetImageUrl(),
+		SpenderId:       t.GetSpenderId(),
+		CategoryID:      t.GetCategoryId(),
+		Tags:            t.GetTags(),
+	}
+}
+
+func toTransaction(t transaction.Transaction) *pb.Transaction {
+	return &pb.Transaction{
+		Id:              t.ID,
+		Date:            t.Date,
+		Amount:          t.Amount,
+		Category:        t.Category,
+		TransactionType: t.TransactionType,
+		Note:            t.Note,
+		ImageUrl:        t.ImageURL,
+		SpenderId:       t.SpenderId,
+		CategoryId:      t.CategoryID,
+		Tags:            t.Tags,
+	}
+}
+
+func toSummary(s transaction.Summary) *pb.Summary {
+	return &pb.Summary{
+		TotalIncome:    s.TotalIncome,
+		TotalExpenses:  s.TotalExpenses,
+		CurrentBalance: s.CurrentBalance,
+		Currency:       s.Currency,
+	}
+}
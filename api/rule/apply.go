@@ -0,0 +1,117 @@
+package rule
+
+import (
+	"context"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/lib/pq"
+)
+
+const (
+	// pastStmt reads the transactions of $1 rules may change, only those
+	// without category unless $2.
+	pastStmt = `SELECT id, date, amount, category, COALESCE(category_id, 0), transaction_type, note, tags
+FROM transaction
+WHERE spender_id = $1 AND ($2 OR (category_id IS NULL AND TRIM(category) = ''))
+ORDER BY date, id`
+	recategorizeStmt = `UPDATE transaction SET category_id = NULLIF($1, 0), category = $2, tags = $3 WHERE id = $4;`
+)
+
+// Change is what the rules do to a past transaction.
+type Change struct {
+	TransactionID   int64     `json:"transaction_id"`
+	Date            time.Time `json:"date"`
+	Amount          float64   `json:"amount"`
+	Note            string    `json:"note"`
+	TransactionType string    `json:"transaction_type"`
+	RuleID          int64     `json:"rule_id"`
+	FromCategory    string    `json:"from_category"`
+	CategoryID      int64     `json:"category_id,omitempty"`
+	Category        string    `json:"category"`
+	FromTags        []string  `json:"from_tags"`
+	Tags            []string  `json:"tags"`
+}
+
+// Result lists the changes of Apply, Committed when they are saved.
+type Result struct {
+	Committed bool     `json:"committed"`
+	Changes   []Change `json:"changes"`
+}
+
+// Apply runs the rules of the spender over its past transactions, those
+// without category or, with overwrite, all of them. It only lists the
+// changes unless commit, then they are saved in one go.
+func (s Service) Apply(ctx context.Context, spenderID int64, overwrite, commit bool) (Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	rules, err := ForSpender(ctx, tx, spenderID)
+	if err != nil {
+		return Result{}, err
+	}
+	stmt := pastStmt + `;`
+	if commit {
+		stmt = pastStmt + ` FOR UPDATE;`
+	}
+	rows, err := tx.QueryContext(ctx, stmt, spenderID, overwrite)
+	if err != nil {
+		return Result{}, err
+	}
+	defer rows.Close()
+
+	res := Result{Changes: []Change{}}
+	for rows.Next() {
+		var c Change
+		if err := rows.Scan(&c.TransactionID, &c.Date, &c.Amount, &c.FromCategory, &c.CategoryID, &c.TransactionType,
+			&c.Note, pq.Array(&c.FromTags)); err != nil {
+			return Result{}, err
+		}
+		r, ok := First(rules, c.Note, c.Amount, c.TransactionType)
+		if !ok {
+			continue
+		}
+		if c.FromTags == nil {
+			c.FromTags = []string{}
+		}
+		fromID := c.CategoryID
+		c.RuleID, c.Category, c.Tags = r.ID, c.FromCategory, MergeTags(c.FromTags, r.Tags)
+		if r.CategoryID != 0 {
+			c.CategoryID, c.Category = r.CategoryID, r.Category
+		}
+		// tags are only ever added, the same count means the same tags
+		if c.CategoryID == fromID && len(c.Tags) == len(c.FromTags) {
+			continue
+		}
+		res.Changes = append(res.Changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return Result{}, err
+	}
+	rows.Close()
+	if !commit {
+		return res, nil
+	}
+
+	for _, c := range res.Changes {
+		if _, err := tx.ExecContext(ctx, recategorizeStmt, c.CategoryID, c.Category, pq.Array(c.Tags), c.TransactionID); err != nil {
+			return Result{}, err
+		}
+		err := outbox.Write(ctx, tx, outbox.EventTransactionUpdated, map[string]interface{}{
+			"id":          c.TransactionID,
+			"spender_id":  spenderID,
+			"transaction": c,
+		})
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Result{}, err
+	}
+	res.Committed = true
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package rule
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var errBadID = errors.New("invalid spender or rule id")
+
+type handler struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+}
+
+func New(cfg config.FeatureFlag, db *sql.DB) *handler {
+	return &handler{cfg, db}
+}
+
+func (h handler) service() Service {
+	return NewService(h.flag, h.db)
+}
+
+// params reads the spender id and, when the route has one, the rule id.
+func params(c echo.Context) (spenderID, id int64, err error) {
+	if spenderID, err = strconv.ParseInt(c.Param("id"), 10, 64); err != nil {
+		return 0, 0, errBadID
+	}
+	if v := c.Param("rule_id"); v != "" {
+		if id, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, 0, errBadID
+		}
+	}
+	return spenderID, id, nil
+}
+
+func status(err error) int {
+	switch err {
+	case errBadID, ErrNoCondition, ErrNoAction, ErrInvalidNote, ErrInvalidRegex, ErrInvalidRange, ErrInvalidType, ErrInvalidTags,
+		category.ErrUnknownCategory, category.ErrTypeMismatch:
+		return http.StatusBadRequest
+	case ErrNotFound, ErrUnknownSpender:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func fail(c echo.Context, msg string, err error) error {
+	code := status(err)
+	if code == http.StatusInternalServerError {
+		mlog.L(c).Error(msg, zap.Error(err))
+	}
+	return c.JSON(code, err.Error())
+}
+
+// GetAll lists the rules of the spender in the order they are tried.
+func (h handler) GetAll(c echo.Context) error {
+	spenderID, _, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	rules, err := h.service().List(c.Request().Context(), spenderID)
+	if err != nil {
+		return fail(c, "query rules error", err)
+	}
+	return c.JSON(http.StatusOK, map[string][]Rule{"rules": rules})
+}
+
+func (h handler) Create(c echo.Context) error {
+	spenderID, _, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var r Rule
+	if err := c.Bind(&r); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+	r.SpenderID = spenderID
+
+	r, err = h.service().Create(c.Request().Context(), r)
+	if err != nil {
+		return fail(c, "create rule error", err)
+	}
+	return c.JSON(http.StatusCreated, r)
+}
+
+// Update replaces a rule, the fields left out are cleared.
+func (h handler) Update(c echo.Context) error {
+	spenderID, id, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var r Rule
+	if err := c.Bind(&r); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+
+	r, err = h.service().Update(c.Request().Context(), spenderID, id, r)
+	if err != nil {
+		return fail(c, "update rule error", err)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+func (h handler) Delete(c echo.Context) error {
+	spenderID, id, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	if err := h.service().Delete(c.Request().Context(), spenderID, id); err != nil {
+		return fail(c, "delete rule error", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Apply runs the rules over the past transactions of the spender, those
+// without category or all of them with ?overwrite=true. It previews the
+// changes unless ?commit=true.
+func (h handler) Apply(c echo.Context) error {
+	spenderID, _, err := params(c)
+	if err != nil {
+		return fail(c, "", err)
+	}
+	var overwrite, commit bool
+	if v := c.QueryParam("overwrite"); v != "" {
+		if overwrite, err = strconv.ParseBool(v); err != nil {
+			return c.JSON(http.StatusBadRequest, "overwrite must be a boolean")
+		}
+	}
+	if v := c.QueryParam("commit"); v != "" {
+		if commit, err = strconv.ParseBool(v); err != nil {
+			return c.JSON(http.StatusBadRequest, "commit must be a boolean")
+		}
+	}
+
+	res, err := h.service().Apply(c.Request().Context(), spenderID, overwrite, commit)
+	if err != nil {
+		return fail(c, "apply rules error", err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
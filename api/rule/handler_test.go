@@ -0,0 +1,196 @@
+package rule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	categoryStmt = `SELECT id, COALESCE(spender_id, 0), COALESCE(parent_id, 0), name, icon, color, type FROM category WHERE (spender_id IS NULL OR spender_id = $1) AND id = $2;`
+	outboxStmt   = `INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`
+)
+
+var (
+	ruleColumns     = []string{"id", "spender_id", "priority", "note_contains", "note_regex", "min_amount", "max_amount", "transaction_type", "category_id", "category", "tags"}
+	categoryColumns = []string{"id", "spender_id", "parent_id", "name", "icon", "color", "type"}
+	pastColumns     = []string{"id", "date", "amount", "category", "category_id", "transaction_type", "note", "tags"}
+)
+
+func call(method, target, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names, values = append(names, params[i]), append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	return c, rec
+}
+
+func TestGetAll(t *testing.T) {
+	c, rec := call(http.MethodGet, "/", "", "id", "1")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectQuery(listStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(ruleColumns).
+		AddRow(3, 1, 0, "grab", "", nil, 300.0, "expense", 2, "Transport", "{}").
+		AddRow(4, 1, 10, "", "", 1000.0, nil, "", 0, "", "{big,review}"))
+
+	err := New(config.FeatureFlag{}, db).GetAll(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"rules": [
+		{"id": 3, "spender_id": 1, "priority": 0, "note_contains": "grab", "max_amount": 300, "transaction_type": "expense", "category_id": 2, "category": "Transport", "tags": []},
+		{"id": 4, "spender_id": 1, "priority": 10, "min_amount": 1000, "tags": ["big", "review"]}
+	]}`, rec.Body.String())
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("takes the type of its category", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"note_contains": " Grab ", "max_amount": 300, "category_id": 2, "tags": ["taxi", "Taxi"]}`, "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(1), int64(2)).WillReturnRows(sqlmock.NewRows(categoryColumns).
+			AddRow(2, 0, 0, "Transport", "directions_car", "#2196F3", "expense"))
+		mock.ExpectQuery(cStmt).WithArgs(int64(1), 0, "Grab", "", nil, 300.0, "expense", int64(2), "{\"taxi\"}").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 3, "spender_id": 1, "priority": 0, "note_contains": "Grab", "max_amount": 300, "transaction_type": "expense", "category_id": 2, "category": "Transport", "tags": ["taxi"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("category of another type", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"note_contains": "bonus", "transaction_type": "income", "category_id": 2}`, "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(1), int64(2)).WillReturnRows(sqlmock.NewRows(categoryColumns).
+			AddRow(2, 0, 0, "Transport", "directions_car", "#2196F3", "expense"))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("invalid rule", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/", `{"note_regex": "(", "tags": ["taxi"]}`, "id", "1")
+
+		err := New(config.FeatureFlag{}, nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "note_regex")
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	c, rec := call(http.MethodPut, "/", `{"min_amount": 1000, "tags": ["big"]}`, "id", "1", "rule_id", "9")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectExec(updateStmt).WithArgs(0, "", "", 1000.0, nil, "", int64(0), "{\"big\"}", int64(9), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := New(config.FeatureFlag{}, db).Update(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDelete(t *testing.T) {
+	c, rec := call(http.MethodDelete, "/", "", "id", "1", "rule_id", "9")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectExec(deleteStmt).WithArgs(int64(9), int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := New(config.FeatureFlag{}, db).Delete(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestApply(t *testing.T) {
+	date := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	rules := func() *sqlmock.Rows {
+		return sqlmock.NewRows(ruleColumns).
+			AddRow(3, 1, 0, "grab", "", nil, nil, "expense", 2, "Transport", "{taxi}").
+			AddRow(4, 1, 10, "", "", 1000.0, nil, "", 0, "", "{big}")
+	}
+	past := func() *sqlmock.Rows {
+		return sqlmock.NewRows(pastColumns).
+			AddRow(11, date, 150.0, "", 0, "expense", "Grab to work", "{}").
+			AddRow(12, date, 50.0, "", 0, "expense", "Coffee", "{}").
+			AddRow(13, date, 120.0, "Transport", 2, "expense", "Grab home", "{taxi}")
+	}
+
+	t.Run("previews the changes", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/?overwrite=true", "", "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(listStmt).WithArgs(int64(1)).WillReturnRows(rules())
+		mock.ExpectQuery(pastStmt+`;`).WithArgs(int64(1), true).WillReturnRows(past())
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Apply(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"committed": false, "changes": [
+			{"transaction_id": 11, "date": "2024-06-01T00:00:00Z", "amount": 150, "note": "Grab to work", "transaction_type": "expense",
+			 "rule_id": 3, "from_category": "", "category_id": 2, "category": "Transport", "from_tags": [], "tags": ["taxi"]}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("commits the changes", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/?commit=true", "", "id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(listStmt).WithArgs(int64(1)).WillReturnRows(rules())
+		mock.ExpectQuery(pastStmt+` FOR UPDATE;`).WithArgs(int64(1), false).WillReturnRows(sqlmock.NewRows(pastColumns).
+			AddRow(11, date, 1500.0, "", 0, "expense", "Grab to the airport", "{}"))
+		mock.ExpectExec(recategorizeStmt).WithArgs(int64(2), "Transport", "{\"taxi\"}", int64(11)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.updated", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Apply(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"committed":true`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid commit", func(t *testing.T) {
+		c, rec := call(http.MethodPost, "/?commit=maybe", "", "id", "1")
+
+		err := New(config.FeatureFlag{}, nil).Apply(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
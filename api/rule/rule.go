@@ -0,0 +1,308 @@
+package rule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/lib/pq"
+)
+
+// Limits of the tags a rule adds.
+const (
+	maxTags      = 10
+	maxTagLength = 32
+)
+
+var (
+	ErrNotFound       = errors.New("rule not found")
+	ErrUnknownSpender = errors.New("spender not found")
+	ErrNoCondition    = errors.New("a rule needs a note_contains, note_regex, min_amount, max_amount or transaction_type condition")
+	ErrNoAction       = errors.New("a rule needs a category_id or tags")
+	ErrInvalidNote    = errors.New("note_contains must be at most 255 characters")
+	ErrInvalidRegex   = errors.New("note_regex must be a valid regular expression of at most 255 characters")
+	ErrInvalidRange   = errors.New("amounts must not be negative and min_amount not above max_amount")
+	ErrInvalidType    = errors.New("transaction_type must be income or expense")
+	ErrInvalidTags    = errors.New("a rule adds at most 10 tags of at most 32 characters")
+)
+
+const (
+	// columns are read by scanRule, along with the name of the category.
+	columns = `r.id, r.spender_id, r.priority, r.note_contains, r.note_regex, r.min_amount, r.max_amount, r.transaction_type,
+	COALESCE(r.category_id, 0), COALESCE(c.name, ''), r.tags`
+	from = `FROM category_rule r LEFT JOIN category c ON c.id = r.category_id`
+
+	listStmt   = `SELECT ` + columns + ` ` + from + ` WHERE r.spender_id = $1 ORDER BY r.priority, r.id;`
+	getStmt    = `SELECT ` + columns + ` ` + from + ` WHERE r.spender_id = $1 AND r.id = $2;`
+	cStmt      = `INSERT INTO category_rule (spender_id, priority, note_contains, note_regex, min_amount, max_amount, transaction_type, category_id, tags) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
+	updateStmt = `UPDATE category_rule SET priority = $1, note_contains = $2, note_regex = $3, min_amount = $4, max_amount = $5, transaction_type = $6, category_id = NULLIF($7, 0), tags = $8 WHERE id = $9 AND spender_id = $10;`
+	deleteStmt = `DELETE FROM category_rule WHERE id = $1 AND spender_id = $2;`
+)
+
+// Rule categorizes and tags the transactions of its spender that meet all
+// of its conditions, those left empty are met by any.
+type Rule struct {
+	ID        int64 `json:"id"`
+	SpenderID int64 `json:"spender_id"`
+	// Priority orders the rules of a spender, the lowest first.
+	Priority        int      `json:"priority"`
+	NoteContains    string   `json:"note_contains,omitempty"`
+	NoteRegex       string   `json:"note_regex,omitempty"`
+	MinAmount       *float64 `json:"min_amount,omitempty"`
+	MaxAmount       *float64 `json:"max_amount,omitempty"`
+	TransactionType string   `json:"transaction_type,omitempty"`
+	CategoryID      int64    `json:"category_id,omitempty"`
+	// Category is the name of CategoryID, read only.
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags"`
+
+	re *regexp.Regexp
+}
+
+// Queryer reads the rules, a *sql.DB or a *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(row scanner) (Rule, error) {
+	var r Rule
+	var min, max sql.NullFloat64
+	err := row.Scan(&r.ID, &r.SpenderID, &r.Priority, &r.NoteContains, &r.NoteRegex, &min, &max, &r.TransactionType,
+		&r.CategoryID, &r.Category, pq.Array(&r.Tags))
+	if err != nil {
+		return r, err
+	}
+	if min.Valid {
+		r.MinAmount = &min.Float64
+	}
+	if max.Valid {
+		r.MaxAmount = &max.Float64
+	}
+	if r.Tags == nil {
+		r.Tags = []string{}
+	}
+	// a rule saved with a regex Go no longer compiles never matches
+	if r.NoteRegex != "" {
+		r.re, _ = regexp.Compile(r.NoteRegex)
+	}
+	return r, nil
+}
+
+// Matches tells whether a transaction meets every condition of r. Notes
+// contain the text of r whatever its case, regexes are case sensitive
+// unless they start with (?i).
+func (r Rule) Matches(note string, amount float64, transactionType string) bool {
+	if r.TransactionType != "" && !strings.EqualFold(r.TransactionType, transactionType) {
+		return false
+	}
+	if r.MinAmount != nil && amount < *r.MinAmount {
+		return false
+	}
+	if r.MaxAmount != nil && amount > *r.MaxAmount {
+		return false
+	}
+	if r.NoteContains != "" && !strings.Contains(strings.ToLower(note), strings.ToLower(r.NoteContains)) {
+		return false
+	}
+	if r.NoteRegex != "" && (r.re == nil || !r.re.MatchString(note)) {
+		return false
+	}
+	return true
+}
+
+// First returns the first of rules, in priority order, a transaction meets.
+func First(rules []Rule, note string, amount float64, transactionType string) (Rule, bool) {
+	for _, r := range rules {
+		if r.Matches(note, amount, transactionType) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// ForSpender returns the rules of the spender in priority order.
+func ForSpender(ctx context.Context, q Queryer, spenderID int64) ([]Rule, error) {
+	rows, err := q.QueryContext(ctx, listStmt, spenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// Match returns the first rule of the spender a transaction meets, false
+// when none does.
+func Match(ctx context.Context, q Queryer, spenderID int64, note string, amount float64, transactionType string) (Rule, bool, error) {
+	rules, err := ForSpender(ctx, q, spenderID)
+	if err != nil {
+		return Rule{}, false, err
+	}
+	r, ok := First(rules, note, amount, transactionType)
+	return r, ok, nil
+}
+
+// MergeTags returns tags followed by those of more it does not have yet,
+// never nil.
+func MergeTags(tags, more []string) []string {
+	merged := []string{}
+	seen := map[string]bool{}
+	for _, t := range append(append([]string{}, tags...), more...) {
+		if t = strings.TrimSpace(t); t != "" && !seen[strings.ToLower(t)] {
+			seen[strings.ToLower(t)] = true
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+func (r *Rule) normalize() error {
+	r.NoteContains = strings.TrimSpace(r.NoteContains)
+	r.TransactionType = strings.ToLower(strings.TrimSpace(r.TransactionType))
+	r.Tags = MergeTags(r.Tags, nil)
+
+	if r.NoteContains == "" && r.NoteRegex == "" && r.MinAmount == nil && r.MaxAmount == nil && r.TransactionType == "" {
+		return ErrNoCondition
+	}
+	if r.CategoryID == 0 && len(r.Tags) == 0 {
+		return ErrNoAction
+	}
+	if utf8.RuneCountInString(r.NoteContains) > 255 {
+		return ErrInvalidNote
+	}
+	if r.NoteRegex != "" {
+		re, err := regexp.Compile(r.NoteRegex)
+		if err != nil || utf8.RuneCountInString(r.NoteRegex) > 255 {
+			return ErrInvalidRegex
+		}
+		r.re = re
+	}
+	if (r.MinAmount != nil && *r.MinAmount < 0) || (r.MaxAmount != nil && *r.MaxAmount < 0) ||
+		(r.MinAmount != nil && r.MaxAmount != nil && *r.MinAmount > *r.MaxAmount) {
+		return ErrInvalidRange
+	}
+	if r.TransactionType != "" && r.TransactionType != category.TypeIncome && r.TransactionType != category.TypeExpense {
+		return ErrInvalidType
+	}
+	if len(r.Tags) > maxTags {
+		return ErrInvalidTags
+	}
+	for _, t := range r.Tags {
+		if utf8.RuneCountInString(t) > maxTagLength {
+			return ErrInvalidTags
+		}
+	}
+	return nil
+}
+
+type Service struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+}
+
+func NewService(cfg config.FeatureFlag, db *sql.DB) Service {
+	return Service{cfg, db}
+}
+
+func (s Service) List(ctx context.Context, spenderID int64) ([]Rule, error) {
+	return ForSpender(ctx, s.db, spenderID)
+}
+
+func (s Service) Get(ctx context.Context, spenderID, id int64) (Rule, error) {
+	r, err := scanRule(s.db.QueryRowContext(ctx, getStmt, spenderID, id))
+	if err == sql.ErrNoRows {
+		return r, ErrNotFound
+	}
+	return r, err
+}
+
+// check validates r and its category, a rule with a category only applies
+// to transactions of the type of its category.
+func (s Service) check(ctx context.Context, r *Rule) error {
+	if err := r.normalize(); err != nil {
+		return err
+	}
+	if r.CategoryID == 0 {
+		r.Category = ""
+		return nil
+	}
+	c, err := category.NewService(s.flag, s.db).Get(ctx, r.SpenderID, r.CategoryID)
+	if err == category.ErrNotFound {
+		return category.ErrUnknownCategory
+	} else if err != nil {
+		return err
+	}
+	if r.TransactionType == "" {
+		r.TransactionType = c.Type
+	} else if r.TransactionType != c.Type {
+		return category.ErrTypeMismatch
+	}
+	r.Category = c.Name
+	return nil
+}
+
+func isUnknownSpender(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+func (s Service) Create(ctx context.Context, r Rule) (Rule, error) {
+	if err := s.check(ctx, &r); err != nil {
+		return r, err
+	}
+	err := s.db.QueryRowContext(ctx, cStmt, r.SpenderID, r.Priority, r.NoteContains, r.NoteRegex, r.MinAmount, r.MaxAmount,
+		r.TransactionType, r.CategoryID, pq.Array(r.Tags)).Scan(&r.ID)
+	if isUnknownSpender(err) {
+		return r, ErrUnknownSpender
+	}
+	return r, err
+}
+
+// Update replaces the rule id of the spender with r.
+func (s Service) Update(ctx context.Context, spenderID, id int64, r Rule) (Rule, error) {
+	r.ID, r.SpenderID = id, spenderID
+	if err := s.check(ctx, &r); err != nil {
+		return r, err
+	}
+	res, err := s.db.ExecContext(ctx, updateStmt, r.Priority, r.NoteContains, r.NoteRegex, r.MinAmount, r.MaxAmount,
+		r.TransactionType, r.CategoryID, pq.Array(r.Tags), id, spenderID)
+	if err != nil {
+		return r, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return r, err
+	} else if n == 0 {
+		return r, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s Service) Delete(ctx context.Context, spenderID, id int64) error {
+	res, err := s.db.ExecContext(ctx, deleteStmt, id, spenderID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
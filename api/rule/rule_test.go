@@ -0,0 +1,81 @@
+package rule
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func amount(v float64) *float64 { return &v }
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		note string
+		amt  float64
+		typ  string
+		want bool
+	}{
+		{"note contains whatever the case", Rule{NoteContains: "grab"}, "GrabFood lunch", 120, "expense", true},
+		{"note does not contain", Rule{NoteContains: "grab"}, "Lineman lunch", 120, "expense", false},
+		{"regex", Rule{NoteRegex: `^7-?Eleven`, re: regexp.MustCompile(`^7-?Eleven`)}, "7Eleven #1234", 45, "expense", true},
+		{"regex is case sensitive", Rule{NoteRegex: `^7-?Eleven`, re: regexp.MustCompile(`^7-?Eleven`)}, "7-eleven", 45, "expense", false},
+		{"regex that does not compile", Rule{NoteRegex: `(`}, "(", 45, "expense", false},
+		{"within the amounts", Rule{MinAmount: amount(100), MaxAmount: amount(500)}, "", 500, "expense", true},
+		{"below min_amount", Rule{MinAmount: amount(100)}, "", 99.99, "expense", false},
+		{"above max_amount", Rule{MaxAmount: amount(500)}, "", 500.01, "expense", false},
+		{"transaction type", Rule{TransactionType: "income"}, "", 1, "Income", true},
+		{"other transaction type", Rule{TransactionType: "income"}, "", 1, "expense", false},
+		{"every condition", Rule{NoteContains: "grab", MaxAmount: amount(100), TransactionType: "expense"}, "grab", 150, "expense", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rule.Matches(tt.note, tt.amt, tt.typ))
+		})
+	}
+}
+
+func TestFirst(t *testing.T) {
+	rules := []Rule{
+		{ID: 1, NoteContains: "grab", MinAmount: amount(1000)},
+		{ID: 2, NoteContains: "grab"},
+		{ID: 3, TransactionType: "expense"},
+	}
+
+	r, ok := First(rules, "Grab to the airport", 300, "expense")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), r.ID)
+
+	_, ok = First(rules, "Salary", 30000, "income")
+	assert.False(t, ok)
+}
+
+func TestMergeTags(t *testing.T) {
+	assert.Equal(t, []string{"work", "Coffee"}, MergeTags([]string{"work", " Coffee "}, []string{"coffee", "", "WORK"}))
+	assert.Equal(t, []string{}, MergeTags(nil, nil))
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		err  error
+	}{
+		{"valid", Rule{NoteContains: " grab ", Tags: []string{"taxi"}}, nil},
+		{"no condition", Rule{Tags: []string{"taxi"}}, ErrNoCondition},
+		{"no action", Rule{NoteContains: "grab", Tags: []string{" "}}, ErrNoAction},
+		{"invalid regex", Rule{NoteRegex: `(`, CategoryID: 2}, ErrInvalidRegex},
+		{"negative amount", Rule{MinAmount: amount(-1), CategoryID: 2}, ErrInvalidRange},
+		{"min_amount above max_amount", Rule{MinAmount: amount(10), MaxAmount: amount(5), CategoryID: 2}, ErrInvalidRange},
+		{"unknown type", Rule{TransactionType: "transfer", CategoryID: 2}, ErrInvalidType},
+		{"too many tags", Rule{NoteContains: "grab", Tags: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}}, ErrInvalidTags},
+		{"tag too long", Rule{NoteContains: "grab", Tags: []string{"abcdefghijklmnopqrstuvwxyz0123456"}}, ErrInvalidTags},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.err, tt.rule.normalize())
+		})
+	}
+}
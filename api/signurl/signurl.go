@@ -0,0 +1,107 @@
+// Package signurl signs URLs with HMAC-SHA256 so they can be handed out
+// without credentials and stop working once they expire.
+package signurl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("invalid signature")
+	ErrExpired = errors.New("signature expired")
+)
+
+// Key is a signing secret and the id URLs name it by.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKeys reads "id:secret" pairs separated by commas.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || len(secret) < 16 {
+			return nil, errors.New("signing keys must be id:secret pairs with secrets of 16 characters at least")
+		}
+		keys = append(keys, Key{id, []byte(secret)})
+	}
+	return keys, nil
+}
+
+// RandomKey makes a key for when none is configured, the URLs it signs
+// only work with this process.
+func RandomKey() Key {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return Key{"random", []byte(hex.EncodeToString(secret))}
+}
+
+// Signer signs with its first key and verifies with all of them, a key is
+// rotated by putting the new one first and dropping the old one once the
+// URLs it signed have expired.
+type Signer struct {
+	keys []Key
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+func New(keys []Key, ttl time.Duration) Signer {
+	return Signer{keys, ttl, time.Now}
+}
+
+// Sign returns the query parameters to add to the URL of resource, and
+// when they expire.
+func (s Signer) Sign(resource string) (url.Values, time.Time) {
+	expires := s.now().Add(s.ttl).Truncate(time.Second)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	key := s.keys[0]
+	return url.Values{
+		"expires": {exp},
+		"kid":     {key.ID},
+		"sig":     {sign(key, resource, exp)},
+	}, expires
+}
+
+// Verify checks the query parameters Sign returned for resource.
+func (s Signer) Verify(resource string, q url.Values) error {
+	exp := q.Get("expires")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	for _, key := range s.keys {
+		if key.ID != q.Get("kid") {
+			continue
+		}
+		if !hmac.Equal([]byte(sign(key, resource, exp)), []byte(q.Get("sig"))) {
+			return ErrInvalid
+		}
+		if s.now().Unix() > expires {
+			return ErrExpired
+		}
+		return nil
+	}
+	return ErrInvalid
+}
+
+func sign(key Key, resource, expires string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(resource + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
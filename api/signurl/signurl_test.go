@@ -0,0 +1,70 @@
+package signurl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeys(t *testing.T) {
+	t.Run("should read id and secret pairs", func(t *testing.T) {
+		keys, err := ParseKeys("k2:0123456789abcdef0123, k1:fedcba9876543210fedc")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Key{{"k2", []byte("0123456789abcdef0123")}, {"k1", []byte("fedcba9876543210fedc")}}, keys)
+	})
+
+	t.Run("should refuse a short secret", func(t *testing.T) {
+		_, err := ParseKeys("k1:secret")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should refuse a key without id", func(t *testing.T) {
+		_, err := ParseKeys("0123456789abcdef0123")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2024, 5, 20, 10, 0, 0, 0, time.UTC)
+	old := Key{"k1", []byte("fedcba9876543210fedc")}
+	current := Key{"k2", []byte("0123456789abcdef0123")}
+
+	signer := func(at time.Time, keys ...Key) Signer {
+		s := New(keys, 15*time.Minute)
+		s.now = func() time.Time { return at }
+		return s
+	}
+
+	t.Run("should verify what it signed until it expires", func(t *testing.T) {
+		q, expires := signer(now, current).Sign("attachments/1")
+
+		assert.Equal(t, now.Add(15*time.Minute), expires)
+		assert.Equal(t, "k2", q.Get("kid"))
+		assert.NoError(t, signer(now.Add(15*time.Minute), current).Verify("attachments/1", q))
+		assert.Equal(t, ErrExpired, signer(now.Add(16*time.Minute), current).Verify("attachments/1", q))
+	})
+
+	t.Run("should refuse another resource", func(t *testing.T) {
+		q, _ := signer(now, current).Sign("attachments/1")
+
+		assert.Equal(t, ErrInvalid, signer(now, current).Verify("attachments/2", q))
+	})
+
+	t.Run("should refuse a pushed back expiry", func(t *testing.T) {
+		q, _ := signer(now, current).Sign("attachments/1")
+		q.Set("expires", "4102444800")
+
+		assert.Equal(t, ErrInvalid, signer(now, current).Verify("attachments/1", q))
+	})
+
+	t.Run("should verify with a rotated key", func(t *testing.T) {
+		q, _ := signer(now, old).Sign("attachments/1")
+
+		assert.NoError(t, signer(now, current, old).Verify("attachments/1", q))
+		assert.Equal(t, ErrInvalid, signer(now, current).Verify("attachments/1", q))
+	})
+}
@@ -0,0 +1,94 @@
+package spender
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidEmail = errors.New("email is not a valid address")
+	ErrEmailTaken   = errors.New("email is used by another spender")
+)
+
+const (
+	// emailIndex is the unique index on spender emails.
+	emailIndex = "spender_email_key"
+
+	conflictsStmt = `SELECT c.spender_id, c.email, c.kept_spender_id, c.created_at, s.id IS NULL OR s.email <> 'duplicate-' || s.id || '@invalid' FROM spender_email_conflict c LEFT JOIN spender s ON s.id = c.spender_id ORDER BY c.kept_spender_id, c.spender_id;`
+)
+
+// NormalizeEmail checks email is a bare address, without a display name,
+// and lower-cases it so the same mailbox is not registered twice with a
+// different case.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email || len(email) > 255 {
+		return "", ErrInvalidEmail
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(email), nil
+}
+
+// isEmailTaken tells if err is a write that broke the unique email index.
+func isEmailTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == emailIndex
+}
+
+// EmailConflict is a spender whose email was taken by an older spender when
+// emails became unique. Its email was replaced with a placeholder, it is
+// Resolved once the spender has another email or is deleted.
+type EmailConflict struct {
+	SpenderID     int64     `json:"spender_id"`
+	Email         string    `json:"email"`
+	KeptSpenderID int64     `json:"kept_spender_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Resolved      bool      `json:"resolved"`
+}
+
+func (s Service) EmailConflicts(ctx context.Context) ([]EmailConflict, error) {
+	rows, err := s.db.QueryContext(ctx, conflictsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conflicts := []EmailConflict{}
+	for rows.Next() {
+		var c EmailConflict
+		if err := rows.Scan(&c.SpenderID, &c.Email, &c.KeptSpenderID, &c.CreatedAt, &c.Resolved); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+// GetEmailConflicts reports the spenders that lost their email when emails
+// became unique.
+func (h handler) GetEmailConflicts(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	conflicts, err := h.service().EmailConflicts(ctx)
+	if err != nil {
+		logger.Error("query email conflicts error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string][]EmailConflict{
+		"conflicts": conflicts,
+	})
+}
@@ -0,0 +1,134 @@
+package spender
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+		err   error
+	}{
+		{"hong@jot.ok", "hong@jot.ok", nil},
+		{"  Hong.Jot@Example.COM ", "hong.jot@example.com", nil},
+		{"hong+slips@jot.ok", "hong+slips@jot.ok", nil},
+		{"", "", ErrInvalidEmail},
+		{"hong", "", ErrInvalidEmail},
+		{"hong@localhost", "", ErrInvalidEmail},
+		{"hong@jot.", "", ErrInvalidEmail},
+		{"HongJot <hong@jot.ok>", "", ErrInvalidEmail},
+		{"hong@jot.ok, jot@hong.ok", "", ErrInvalidEmail},
+		{strings.Repeat("a", 250) + "@jot.ok", "", ErrInvalidEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.email)
+
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCreateSpenderEmail(t *testing.T) {
+	create := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return echo.New().NewContext(req, rec), rec
+	}
+	cfg := config.FeatureFlag{EnableCreateSpender: true}
+
+	t.Run("store the normalized email", func(t *testing.T) {
+		c, rec := create(`{"name": "HongJot", "email": " Hong@Jot.OK "}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "Asia/Bangkok", "th-TH", "THB", 1, "").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec(outboxStmt).WithArgs("spender.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(cfg, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuse an invalid email", func(t *testing.T) {
+		c, rec := create(`{"name": "HongJot", "email": "hong at jot"}`)
+
+		err := New(cfg, nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("refuse an email used by another spender", func(t *testing.T) {
+		c, rec := create(`{"name": "HongJot", "email": "hong@jot.ok"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "Asia/Bangkok", "th-TH", "THB", 1, "").
+			WillReturnError(&pq.Error{Code: "23505", Constraint: emailIndex})
+		mock.ExpectRollback()
+
+		err := New(cfg, db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, `"email is used by another spender"`, strings.TrimSpace(rec.Body.String()))
+	})
+}
+
+func TestPatchSpenderEmailTaken(t *testing.T) {
+	c, rec := callWithID(http.MethodPatch, `{"email": "Jot@Hong.ok"}`, "1")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery(updateStmt).WithArgs(nil, "jot@hong.ok", nil, int64(1)).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: emailIndex})
+	mock.ExpectRollback()
+
+	err := New(config.FeatureFlag{}, db).Patch(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestGetEmailConflicts(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/spenders/email-conflicts", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	at := time.Date(2024, 5, 18, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(conflictsStmt).WillReturnRows(
+		sqlmock.NewRows([]string{"spender_id", "email", "kept_spender_id", "created_at", "resolved"}).
+			AddRow(3, "Hong@Jot.ok", 1, at, false).
+			AddRow(4, "hong@jot.ok ", 1, at, true))
+
+	err := New(config.FeatureFlag{}, db).GetEmailConflicts(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"conflicts": [
+		{"spender_id": 3, "email": "Hong@Jot.ok", "kept_spender_id": 1, "created_at": "2024-05-18T10:00:00Z", "resolved": false},
+		{"spender_id": 4, "email": "hong@jot.ok ", "kept_spender_id": 1, "created_at": "2024-05-18T10:00:00Z", "resolved": true}
+	]}`, rec.Body.String())
+}
@@ -0,0 +1,224 @@
+package spender
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidTimezone      = errors.New("timezone must be an IANA time zone like Asia/Bangkok")
+	ErrInvalidLocale        = errors.New("locale must be a language tag like th-TH")
+	ErrInvalidCurrency      = errors.New("currency must be an ISO 4217 code like THB")
+	ErrInvalidMonthStartDay = errors.New("month_start_day must be between 1 and 28")
+)
+
+const (
+	prefsStmt       = `SELECT timezone, locale, currency, month_start_day FROM spender WHERE id = $1;`
+	updatePrefsStmt = `UPDATE spender SET timezone = COALESCE($1, timezone), locale = COALESCE($2, locale), currency = COALESCE($3, currency), month_start_day = COALESCE($4, month_start_day) WHERE id = $5 RETURNING ` + columns + `;`
+)
+
+// Preferences are how a spender wants its dates and amounts read. Reports
+// bucket dates by month in Timezone, months starting on MonthStartDay, and
+// amounts are in Currency.
+type Preferences struct {
+	Timezone      string `json:"timezone"`
+	Locale        string `json:"locale"`
+	Currency      string `json:"currency"`
+	MonthStartDay int    `json:"month_start_day"`
+}
+
+// DefaultPreferences are those of spenders who did not choose, they match
+// the defaults of the spender table.
+var DefaultPreferences = Preferences{
+	Timezone:      "Asia/Bangkok",
+	Locale:        "th-TH",
+	Currency:      "THB",
+	MonthStartDay: 1,
+}
+
+var (
+	localeRe   = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+	currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+func validTimezone(tz string) error {
+	// Local is wherever the server runs, which is what preferences avoid
+	if tz == "" || tz == "Local" {
+		return ErrInvalidTimezone
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return ErrInvalidTimezone
+	}
+	return nil
+}
+
+func validLocale(locale string) error {
+	if !localeRe.MatchString(locale) {
+		return ErrInvalidLocale
+	}
+	return nil
+}
+
+func validCurrency(currency string) error {
+	if !currencyRe.MatchString(currency) {
+		return ErrInvalidCurrency
+	}
+	return nil
+}
+
+// Days after the 28th are not in every month.
+func validMonthStartDay(day int) error {
+	if day < 1 || day > 28 {
+		return ErrInvalidMonthStartDay
+	}
+	return nil
+}
+
+// withDefaults fills in what is not set and checks the result.
+func (p Preferences) withDefaults() (Preferences, error) {
+	if p.Timezone == "" {
+		p.Timezone = DefaultPreferences.Timezone
+	}
+	if p.Locale == "" {
+		p.Locale = DefaultPreferences.Locale
+	}
+	if p.Currency == "" {
+		p.Currency = DefaultPreferences.Currency
+	}
+	if p.MonthStartDay == 0 {
+		p.MonthStartDay = DefaultPreferences.MonthStartDay
+	}
+	p.Currency = strings.ToUpper(p.Currency)
+
+	for _, err := range []error{validTimezone(p.Timezone), validLocale(p.Locale), validCurrency(p.Currency), validMonthStartDay(p.MonthStartDay)} {
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// Location is the time zone of the spender.
+func (p Preferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Month is the budget month starting in year and month of the calendar, it
+// runs from its start day at midnight to the same day of the next month.
+func (p Preferences) Month(year int, month time.Month) (from, to time.Time) {
+	day := max(p.MonthStartDay, 1)
+	from = time.Date(year, month, day, 0, 0, 0, 0, p.Location())
+	return from, from.AddDate(0, 1, 0)
+}
+
+// MonthOf is the budget month t is in.
+func (p Preferences) MonthOf(t time.Time) (from, to time.Time) {
+	t = t.In(p.Location())
+	year, month, day := t.Date()
+	if day < p.MonthStartDay {
+		month--
+	}
+	return p.Month(year, month)
+}
+
+// GetPreferences reads the preferences of a spender, ErrNotFound when
+// there is no such spender.
+func GetPreferences(ctx context.Context, db *sql.DB, id string) (Preferences, error) {
+	var p Preferences
+	err := db.QueryRowContext(ctx, prefsStmt, id).Scan(&p.Timezone, &p.Locale, &p.Currency, &p.MonthStartDay)
+	if err == sql.ErrNoRows {
+		return DefaultPreferences, ErrNotFound
+	}
+	return p, err
+}
+
+// PreferencesPatch changes the preferences that are set.
+type PreferencesPatch struct {
+	Timezone      *string `json:"timezone"`
+	Locale        *string `json:"locale"`
+	Currency      *string `json:"currency"`
+	MonthStartDay *int    `json:"month_start_day"`
+}
+
+func (p PreferencesPatch) validate() error {
+	if p.Timezone != nil {
+		if err := validTimezone(*p.Timezone); err != nil {
+			return err
+		}
+	}
+	if p.Locale != nil {
+		if err := validLocale(*p.Locale); err != nil {
+			return err
+		}
+	}
+	if p.Currency != nil {
+		if err := validCurrency(*p.Currency); err != nil {
+			return err
+		}
+	}
+	if p.MonthStartDay != nil {
+		if err := validMonthStartDay(*p.MonthStartDay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdatePreferences changes the preferences of a spender, those that are
+// nil in patch are kept.
+func (s Service) UpdatePreferences(ctx context.Context, id int64, patch PreferencesPatch) (Spender, error) {
+	if patch.Currency != nil {
+		currency := strings.ToUpper(*patch.Currency)
+		patch.Currency = &currency
+	}
+	if err := patch.validate(); err != nil {
+		return Spender{}, err
+	}
+	return s.change(ctx, updatePrefsStmt, patch.Timezone, patch.Locale, patch.Currency, patch.MonthStartDay, id)
+}
+
+// IsInvalidPreferences tells the errors of preferences the client got wrong.
+func IsInvalidPreferences(err error) bool {
+	return err == ErrInvalidTimezone || err == ErrInvalidLocale || err == ErrInvalidCurrency || err == ErrInvalidMonthStartDay
+}
+
+// PatchPreferences changes the preferences of a spender, the fields left
+// out are kept.
+func (h handler) PatchPreferences(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+	var p PreferencesPatch
+	if err := c.Bind(&p); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	sp, err := h.service().UpdatePreferences(ctx, id, p)
+	if IsInvalidPreferences(err) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	} else if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("update spender preferences error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, sp)
+}
@@ -0,0 +1,114 @@
+package spender
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreferencesWithDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Preferences
+		want Preferences
+		err  error
+	}{
+		{"nothing set", Preferences{}, DefaultPreferences, nil},
+		{"lower case currency", Preferences{Currency: "usd"}, Preferences{"Asia/Bangkok", "th-TH", "USD", 1}, nil},
+		{"everything set", Preferences{"Europe/Paris", "fr-FR", "EUR", 25}, Preferences{"Europe/Paris", "fr-FR", "EUR", 25}, nil},
+		{"unknown time zone", Preferences{Timezone: "Mars/Olympus"}, Preferences{}, ErrInvalidTimezone},
+		{"server time zone", Preferences{Timezone: "Local"}, Preferences{}, ErrInvalidTimezone},
+		{"bad locale", Preferences{Locale: "thai"}, Preferences{}, ErrInvalidLocale},
+		{"bad currency", Preferences{Currency: "BAHT"}, Preferences{}, ErrInvalidCurrency},
+		{"start day past the 28th", Preferences{MonthStartDay: 31}, Preferences{}, ErrInvalidMonthStartDay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.in.withDefaults()
+
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPreferencesMonthOf(t *testing.T) {
+	p := Preferences{Timezone: "Asia/Bangkok", MonthStartDay: 25}
+	bangkok := p.Location()
+
+	tests := []struct {
+		name string
+		at   time.Time
+		from time.Time
+	}{
+		{"before the start day", time.Date(2024, 1, 10, 12, 0, 0, 0, bangkok), time.Date(2023, 12, 25, 0, 0, 0, 0, bangkok)},
+		{"on the start day", time.Date(2024, 1, 25, 0, 0, 0, 0, bangkok), time.Date(2024, 1, 25, 0, 0, 0, 0, bangkok)},
+		{"still the 24th in Bangkok", time.Date(2024, 1, 24, 16, 59, 0, 0, time.UTC), time.Date(2023, 12, 25, 0, 0, 0, 0, bangkok)},
+		{"already the 25th in Bangkok", time.Date(2024, 1, 24, 17, 0, 0, 0, time.UTC), time.Date(2024, 1, 25, 0, 0, 0, 0, bangkok)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := p.MonthOf(tt.at)
+
+			assert.Equal(t, tt.from, from)
+			assert.Equal(t, tt.from.AddDate(0, 1, 0), to)
+		})
+	}
+}
+
+func TestPatchPreferences(t *testing.T) {
+	t.Run("change the preferences that are set", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPatch, `{"timezone": "Europe/Paris", "currency": "eur", "month_start_day": 25}`, "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(updatePrefsStmt).WithArgs("Europe/Paris", nil, "EUR", 25, int64(1)).
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "HongJot", "hong@jot.ok", true, false, "Europe/Paris", "th-TH", "EUR", 25, ""))
+		mock.ExpectExec(outboxStmt).WithArgs("spender.updated", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).PatchPreferences(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":1,"name":"HongJot","email":"hong@jot.ok","active":true,"email_verified":false,
+			"preferences":{"timezone":"Europe/Paris","locale":"th-TH","currency":"EUR","month_start_day":25}}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	for _, body := range []string{`{"timezone": "Bangkok"}`, `{"locale": "th_TH"}`, `{"currency": "฿"}`, `{"month_start_day": 0}`} {
+		t.Run("refuse "+body, func(t *testing.T) {
+			c, rec := callWithID(http.MethodPatch, body, "1")
+
+			err := New(config.FeatureFlag{}, nil).PatchPreferences(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+
+	t.Run("spender not found", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPatch, `{"locale": "en-US"}`, "9")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(updatePrefsStmt).WithArgs(nil, "en-US", nil, nil, int64(9)).
+			WillReturnRows(sqlmock.NewRows(spenderColumns))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).PatchPreferences(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.True(t, strings.Contains(rec.Body.String(), ErrNotFound.Error()))
+	})
+}
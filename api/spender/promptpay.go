@@ -0,0 +1,43 @@
+package spender
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/promptpay"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// GetPromptPayQR renders a QR code to pay the spender with PromptPay, for
+// ?amount when set or any amount the payer enters otherwise.
+func (h handler) GetPromptPayQR(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var amount float64
+	if v := c.QueryParam("amount"); v != "" {
+		var err error
+		if amount, err = strconv.ParseFloat(v, 64); err != nil {
+			return c.JSON(http.StatusBadRequest, promptpay.ErrInvalidAmount.Error())
+		}
+	}
+
+	sp, err := h.service().GetByID(ctx, c.Param("id"))
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if sp.PromptPayID == "" {
+		return c.JSON(http.StatusNotFound, promptpay.ErrNoID.Error())
+	}
+
+	payload, err := promptpay.Payload(sp.PromptPayID, amount)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	return promptpay.Respond(c, payload)
+}
@@ -0,0 +1,86 @@
+package spender
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/promptpay"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchPromptPayID(t *testing.T) {
+	t.Run("keeps the digits of the mobile number", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPatch, `{"promptpay_id": "+66 80-123-4567"}`, "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(updateStmt).WithArgs(nil, nil, "0801234567", int64(1)).
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "Hong", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, "0801234567"))
+		mock.ExpectExec(outboxStmt).WithArgs("spender.updated", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"promptpay_id":"0801234567"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPatch, `{"promptpay_id": "1234"}`, "1")
+
+		err := New(config.FeatureFlag{}, nil).Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `"`+promptpay.ErrInvalidID.Error()+`"`, rec.Body.String())
+	})
+}
+
+func TestGetPromptPayQR(t *testing.T) {
+	t.Run("payload with the amount", func(t *testing.T) {
+		c, rec := callWithID(http.MethodGet, "", "1")
+		c.QueryParams().Set("amount", "1337")
+		c.QueryParams().Set("format", "json")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs("1").
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "Hong", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, "0801234567"))
+
+		err := New(config.FeatureFlag{}, db).GetPromptPayQR(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		want, _ := promptpay.Payload("0801234567", 1337)
+		assert.JSONEq(t, `{"payload": "`+want+`"}`, rec.Body.String())
+	})
+
+	t.Run("spender without promptpay id", func(t *testing.T) {
+		c, rec := callWithID(http.MethodGet, "", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs("1").
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "Hong", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, ""))
+
+		err := New(config.FeatureFlag{}, db).GetPromptPayQR(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		c, rec := callWithID(http.MethodGet, "", "1")
+		c.QueryParams().Set("amount", "ten")
+
+		err := New(config.FeatureFlag{}, nil).GetPromptPayQR(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,287 @@
+package spender
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/promptpay"
+)
+
+var (
+	ErrCreateDisabled   = errors.New("create new spender feature is disabled")
+	ErrNotFound         = errors.New("spender not found")
+	ErrHasTransactions  = errors.New("spender has transactions, delete with policy=cascade or policy=anonymize")
+	ErrSharesBills      = errors.New("spender shares bills or settlements with other spenders, deactivate it instead")
+	ErrUnknownPolicy    = errors.New("policy must be restrict, cascade or anonymize")
+	ErrNameEmailMissing = errors.New("name and email are required")
+)
+
+// Policies of Delete for the transactions of the spender.
+const (
+	// PolicyRestrict refuses to delete a spender with transactions.
+	PolicyRestrict = "restrict"
+	// PolicyCascade deletes the transactions along with the spender.
+	PolicyCascade = "cascade"
+	// PolicyAnonymize keeps the transactions, for totals, but removes what
+	// tells whose they were.
+	PolicyAnonymize = "anonymize"
+)
+
+const (
+	// updateStmt keeps the email verified only when it does not change.
+	updateStmt = `UPDATE spender SET name = COALESCE($1, name), email = COALESCE($2, email), email_verified_at = CASE WHEN $2 IS NULL OR $2 = email THEN email_verified_at END, promptpay_id = CASE WHEN $3 IS NULL THEN promptpay_id ELSE NULLIF($3, '') END WHERE id = $4 RETURNING ` + columns + `;`
+	activeStmt = `UPDATE spender SET active = $1 WHERE id = $2 RETURNING ` + columns + `;`
+	// lockStmt keeps transactions from being added while the spender is deleted.
+	lockStmt               = `SELECT id FROM spender WHERE id = $1 FOR UPDATE;`
+	countTransactionStmt   = `SELECT COUNT(*) FROM transaction WHERE spender_id = $1;`
+	deleteTransactionsStmt = `DELETE FROM transaction WHERE spender_id = $1 RETURNING id;`
+	anonymizeStmt          = `UPDATE transaction SET spender_id = NULL, note = '', image_url = '' WHERE spender_id = $1 RETURNING id;`
+	deleteAnomaliesStmt    = `DELETE FROM anomaly WHERE spender_id = $1;`
+	deleteAttachmentsStmt  = `DELETE FROM attachment WHERE spender_id = $1;`
+	deleteStmt             = `DELETE FROM spender WHERE id = $1;`
+
+	// sharedStmt tells whether the spender is in a bill or a settlement,
+	// those make the balances of other spenders too.
+	sharedStmt = `SELECT EXISTS (SELECT 1 FROM bill WHERE payer_id = $1)
+	OR EXISTS (SELECT 1 FROM bill_share WHERE spender_id = $1)
+	OR EXISTS (SELECT 1 FROM settlement WHERE from_id = $1 OR to_id = $1);`
+)
+
+// Patch changes the fields that are set.
+type Patch struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+	// PromptPayID is removed when empty.
+	PromptPayID *string `json:"promptpay_id"`
+}
+
+// Service is the spender business logic shared by the REST and gRPC APIs.
+type Service struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+}
+
+func NewService(cfg config.FeatureFlag, db *sql.DB) Service {
+	return Service{cfg, db}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSpender(row scanner) (Spender, error) {
+	var sp Spender
+	p := &sp.Preferences
+	err := row.Scan(&sp.ID, &sp.Name, &sp.Email, &sp.Active, &sp.EmailVerified, &p.Timezone, &p.Locale, &p.Currency, &p.MonthStartDay, &sp.PromptPayID)
+	return sp, err
+}
+
+func (s Service) Create(ctx context.Context, sp Spender) (Spender, error) {
+	if !s.flag.EnableCreateSpender {
+		return sp, ErrCreateDisabled
+	}
+	email, err := NormalizeEmail(sp.Email)
+	if err != nil {
+		return sp, err
+	}
+	sp.Email = email
+	if sp.PromptPayID != "" {
+		if sp.PromptPayID, err = promptpay.NormalizeID(sp.PromptPayID); err != nil {
+			return sp, err
+		}
+	}
+	if sp.Preferences, err = sp.Preferences.withDefaults(); err != nil {
+		return sp, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sp, err
+	}
+	defer tx.Rollback()
+
+	p := sp.Preferences
+	err = tx.QueryRowContext(ctx, cStmt, sp.Name, sp.Email, p.Timezone, p.Locale, p.Currency, p.MonthStartDay, sp.PromptPayID).Scan(&sp.ID)
+	if isEmailTaken(err) {
+		return sp, ErrEmailTaken
+	} else if err != nil {
+		return sp, err
+	}
+	sp.Active = true
+	if err := outbox.Write(ctx, tx, outbox.EventSpenderCreated, sp); err != nil {
+		return sp, err
+	}
+	return sp, tx.Commit()
+}
+
+func (s Service) GetAll(ctx context.Context) ([]Spender, error) {
+	rows, err := s.db.QueryContext(ctx, getAllStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sps []Spender
+	for rows.Next() {
+		sp, err := scanSpender(rows)
+		if err != nil {
+			return nil, err
+		}
+		sps = append(sps, sp)
+	}
+	return sps, nil
+}
+
+func (s Service) GetByID(ctx context.Context, id string) (Spender, error) {
+	sp, err := scanSpender(s.db.QueryRowContext(ctx, getStmt, id))
+	if err == sql.ErrNoRows {
+		return sp, ErrNotFound
+	}
+	return sp, err
+}
+
+// Update changes the name, email and PromptPay id of a spender, those that
+// are nil in patch are kept.
+func (s Service) Update(ctx context.Context, id int64, patch Patch) (Spender, error) {
+	if patch.Email != nil {
+		email, err := NormalizeEmail(*patch.Email)
+		if err != nil {
+			return Spender{}, err
+		}
+		patch.Email = &email
+	}
+	if patch.PromptPayID != nil && *patch.PromptPayID != "" {
+		id, err := promptpay.NormalizeID(*patch.PromptPayID)
+		if err != nil {
+			return Spender{}, err
+		}
+		patch.PromptPayID = &id
+	}
+	return s.change(ctx, updateStmt, patch.Name, patch.Email, patch.PromptPayID, id)
+}
+
+// SetActive deactivates or reactivates a spender.
+func (s Service) SetActive(ctx context.Context, id int64, active bool) (Spender, error) {
+	return s.change(ctx, activeStmt, active, id)
+}
+
+func (s Service) change(ctx context.Context, stmt string, args ...interface{}) (Spender, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Spender{}, err
+	}
+	defer tx.Rollback()
+
+	sp, err := scanSpender(tx.QueryRowContext(ctx, stmt, args...))
+	if err == sql.ErrNoRows {
+		return sp, ErrNotFound
+	} else if isEmailTaken(err) {
+		return sp, ErrEmailTaken
+	} else if err != nil {
+		return sp, err
+	}
+	if err := outbox.Write(ctx, tx, outbox.EventSpenderUpdated, sp); err != nil {
+		return sp, err
+	}
+	return sp, tx.Commit()
+}
+
+// Delete removes a spender, what happens to its transactions depends on
+// policy. Anomalies and attachments records go with the spender, the
+// stored files are kept since other spenders may have uploaded them too.
+// Spenders sharing bills or settlements are never deleted, whatever the
+// policy, as the balances of the others would change.
+func (s Service) Delete(ctx context.Context, id int64, policy string) error {
+	if policy != PolicyRestrict && policy != PolicyCascade && policy != PolicyAnonymize {
+		return ErrUnknownPolicy
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, lockStmt, id).Scan(&id); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var shared bool
+	if err := tx.QueryRowContext(ctx, sharedStmt, id).Scan(&shared); err != nil {
+		return err
+	}
+	if shared {
+		return ErrSharesBills
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, countTransactionStmt, id).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		if policy == PolicyRestrict {
+			return ErrHasTransactions
+		}
+		if err := s.dropTransactions(ctx, tx, id, policy); err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range []string{deleteAnomaliesStmt, deleteAttachmentsStmt, deleteStmt} {
+		if _, err := tx.ExecContext(ctx, stmt, id); err != nil {
+			return err
+		}
+	}
+	err = outbox.Write(ctx, tx, outbox.EventSpenderDeleted, map[string]interface{}{
+		"id":           id,
+		"policy":       policy,
+		"transactions": count,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// dropTransactions deletes or anonymizes the transactions of the spender
+// with one transaction event each, anonymized ones keep the spender_id
+// they had in their event so its subscribers hear of them.
+func (s Service) dropTransactions(ctx context.Context, tx *sql.Tx, spenderID int64, policy string) error {
+	stmt, event := deleteTransactionsStmt, outbox.EventTransactionDeleted
+	if policy == PolicyAnonymize {
+		stmt, event = anonymizeStmt, outbox.EventTransactionUpdated
+	}
+	rows, err := tx.QueryContext(ctx, stmt, spenderID)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		payload := map[string]interface{}{"id": id, "spender_id": spenderID}
+		if policy == PolicyAnonymize {
+			payload["anonymized"] = true
+		}
+		if err := outbox.Write(ctx, tx, event, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
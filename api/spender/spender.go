@@ -3,8 +3,12 @@ package spender
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
 
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mailer"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/promptpay"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/signurl"
 	"github.com/kkgo-software-engineering/workshop/mlog"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -14,11 +18,22 @@ type Spender struct {
 	ID    int64  `json:"id"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
+	// Active is false for deactivated spenders, they cannot record new
+	// transactions.
+	Active        bool        `json:"active"`
+	EmailVerified bool        `json:"email_verified"`
+	Preferences   Preferences `json:"preferences"`
+	// PromptPayID is where the spender is paid back, see promptpay.NormalizeID.
+	PromptPayID string `json:"promptpay_id,omitempty"`
 }
 
 type handler struct {
-	flag config.FeatureFlag
-	db   *sql.DB
+	flag   config.FeatureFlag
+	db     *sql.DB
+	signer *signurl.Signer
+	mailer mailer.Mailer
+	// linkBase is the scheme and host of the links emailed.
+	linkBase string
 }
 
 type Category struct {
@@ -26,18 +41,27 @@ type Category struct {
 }
 
 func New(cfg config.FeatureFlag, db *sql.DB) *handler {
-	return &handler{cfg, db}
+	return &handler{flag: cfg, db: db}
+}
+
+func (h handler) service() Service {
+	return NewService(h.flag, h.db)
 }
 
 const (
-	cStmt      = `INSERT INTO spender (name, email) VALUES ($1, $2) RETURNING id;`
-	getStmt    = `SELECT id, name, email FROM spender WHERE id = $1;`
-	getAllCats = `SELECT DISTINCT category FROM transaction;`
+	// columns are read by scanSpender.
+	columns    = `id, name, email, active, email_verified_at IS NOT NULL, timezone, locale, currency, month_start_day, COALESCE(promptpay_id, '')`
+	cStmt      = `INSERT INTO spender (name, email, timezone, locale, currency, month_start_day, promptpay_id) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')) RETURNING id;`
+	getStmt    = `SELECT ` + columns + ` FROM spender WHERE id = $1;`
+	getAllStmt = `SELECT ` + columns + ` FROM spender`
+	// getAllCats lists the system categories, spenders add their own to
+	// theirs, see the category package.
+	getAllCats = `SELECT DISTINCT name FROM category WHERE spender_id IS NULL ORDER BY name;`
 )
 
 func (h handler) Create(c echo.Context) error {
 	if !h.flag.EnableCreateSpender {
-		return c.JSON(http.StatusForbidden, "create new spender feature is disabled")
+		return c.JSON(http.StatusForbidden, ErrCreateDisabled.Error())
 	}
 
 	logger := mlog.L(c)
@@ -49,15 +73,17 @@ func (h handler) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
 
-	var lastInsertId int64
-	err = h.db.QueryRowContext(ctx, cStmt, sp.Name, sp.Email).Scan(&lastInsertId)
-	if err != nil {
-		logger.Error("query row error", zap.Error(err))
+	sp, err = h.service().Create(ctx, sp)
+	if err == ErrInvalidEmail || err == promptpay.ErrInvalidID || IsInvalidPreferences(err) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	} else if err == ErrEmailTaken {
+		return c.JSON(http.StatusConflict, err.Error())
+	} else if err != nil {
+		logger.Error("create spender error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	logger.Info("create successfully", zap.Int64("id", lastInsertId))
-	sp.ID = lastInsertId
+	logger.Info("create successfully", zap.Int64("id", sp.ID))
 	return c.JSON(http.StatusCreated, sp)
 }
 
@@ -65,23 +91,11 @@ func (h handler) GetAll(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	rows, err := h.db.QueryContext(ctx, `SELECT id, name, email FROM spender`)
+	sps, err := h.service().GetAll(ctx)
 	if err != nil {
 		logger.Error("query error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
-	defer rows.Close()
-
-	var sps []Spender
-	for rows.Next() {
-		var sp Spender
-		err := rows.Scan(&sp.ID, &sp.Name, &sp.Email)
-		if err != nil {
-			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, err.Error())
-		}
-		sps = append(sps, sp)
-	}
 
 	return c.JSON(http.StatusOK, map[string][]Spender{
 		"spenders": sps,
@@ -93,10 +107,9 @@ func (h handler) GetSpenderByID(c echo.Context) error {
 	ctx := c.Request().Context()
 	spenderID := c.Param("id")
 
-	var sp Spender
-	err := h.db.QueryRowContext(ctx, getStmt, spenderID).Scan(&sp.ID, &sp.Name, &sp.Email)
-	if err == sql.ErrNoRows {
-		return c.JSON(http.StatusNotFound, "spender not found")
+	sp, err := h.service().GetByID(ctx, spenderID)
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
 	} else if err != nil {
 		logger.Error("query row error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
@@ -131,3 +144,114 @@ func (h handler) GetAllCategories(c echo.Context) error {
 		"categories": categories,
 	})
 }
+
+// Update replaces the name and email of a spender.
+func (h handler) Update(c echo.Context) error {
+	var sp Spender
+	if err := c.Bind(&sp); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if sp.Name == "" || sp.Email == "" {
+		return c.JSON(http.StatusBadRequest, ErrNameEmailMissing.Error())
+	}
+	return h.update(c, Patch{Name: &sp.Name, Email: &sp.Email})
+}
+
+// Patch changes the name, email or PromptPay id of a spender, the fields
+// left out are kept.
+func (h handler) Patch(c echo.Context) error {
+	var p Patch
+	if err := c.Bind(&p); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if p.Name != nil && *p.Name == "" || p.Email != nil && *p.Email == "" {
+		return c.JSON(http.StatusBadRequest, ErrNameEmailMissing.Error())
+	}
+	return h.update(c, p)
+}
+
+func (h handler) update(c echo.Context, p Patch) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+
+	sp, err := h.service().Update(ctx, id, p)
+	switch err {
+	case nil:
+		return c.JSON(http.StatusOK, sp)
+	case ErrInvalidEmail, promptpay.ErrInvalidID:
+		return c.JSON(http.StatusBadRequest, err.Error())
+	case ErrNotFound:
+		return c.JSON(http.StatusNotFound, err.Error())
+	case ErrEmailTaken:
+		return c.JSON(http.StatusConflict, err.Error())
+	default:
+		logger.Error("update spender error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Deactivate keeps a spender from recording new transactions, the past
+// ones stay as they are.
+func (h handler) Deactivate(c echo.Context) error {
+	return h.setActive(c, false)
+}
+
+func (h handler) Reactivate(c echo.Context) error {
+	return h.setActive(c, true)
+}
+
+func (h handler) setActive(c echo.Context, active bool) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+
+	sp, err := h.service().SetActive(ctx, id, active)
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("set spender active error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, sp)
+}
+
+// Delete removes a spender. Spenders with transactions are only deleted
+// with ?policy=cascade, deleting them too, or ?policy=anonymize, keeping
+// them without spender.
+func (h handler) Delete(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+	policy := c.QueryParam("policy")
+	if policy == "" {
+		policy = PolicyRestrict
+	}
+
+	err = h.service().Delete(ctx, id, policy)
+	switch err {
+	case nil:
+		return c.NoContent(http.StatusNoContent)
+	case ErrUnknownPolicy:
+		return c.JSON(http.StatusBadRequest, err.Error())
+	case ErrNotFound:
+		return c.JSON(http.StatusNotFound, err.Error())
+	case ErrHasTransactions, ErrSharesBills:
+		return c.JSON(http.StatusConflict, err.Error())
+	default:
+		logger.Error("delete spender error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -2,8 +2,10 @@ package spender
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -13,6 +15,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+var spenderColumns = []string{"id", "name", "email", "active", "email_verified", "timezone", "locale", "currency", "month_start_day", "promptpay_id"}
+
 func TestCreateSpender(t *testing.T) {
 
 	t.Run("create spender succesfully when feature toggle is enable", func(t *testing.T) {
@@ -28,7 +32,12 @@ func TestCreateSpender(t *testing.T) {
 		defer db.Close()
 
 		row := sqlmock.NewRows([]string{"id"}).AddRow(1)
-		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok").WillReturnRows(row)
+		mock.ExpectBegin()
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "Asia/Bangkok", "th-TH", "THB", 1, "").WillReturnRows(row)
+		mock.ExpectExec(`INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`).
+			WithArgs("spender.created", `{"id":1,"name":"HongJot","email":"hong@jot.ok","active":true,"email_verified":false,"preferences":{"timezone":"Asia/Bangkok","locale":"th-TH","currency":"THB","month_start_day":1}}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, db)
@@ -36,7 +45,7 @@ func TestCreateSpender(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusCreated, rec.Code)
-		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok"}`, rec.Body.String())
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "active": true, "email_verified": false, "preferences": {"timezone": "Asia/Bangkok", "locale": "th-TH", "currency": "THB", "month_start_day": 1}}`, rec.Body.String())
 	})
 
 	t.Run("create spender failed when feature toggle is disable", func(t *testing.T) {
@@ -87,7 +96,8 @@ func TestCreateSpender(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok").WillReturnError(assert.AnError)
+		mock.ExpectBegin()
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "Asia/Bangkok", "th-TH", "THB", 1, "").WillReturnError(assert.AnError)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, db)
@@ -113,7 +123,7 @@ func TestGetSpenderByID(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		row := sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(1, "HongJot", "hong@jot.ok")
+		row := sqlmock.NewRows(spenderColumns).AddRow(1, "HongJot", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, "")
 		mock.ExpectQuery(getStmt).WithArgs("1").WillReturnRows(row)
 		cfg := config.FeatureFlag{}
 
@@ -122,7 +132,7 @@ func TestGetSpenderByID(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok"}`, rec.Body.String())
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "active": true, "email_verified": false, "preferences": {"timezone": "Asia/Bangkok", "locale": "th-TH", "currency": "THB", "month_start_day": 1}}`, rec.Body.String())
 	})
 
 	t.Run("get spender not found", func(t *testing.T) {
@@ -252,14 +262,14 @@ func TestGetAll(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "name", "email"}).
-			AddRow(1, "HongJot", "hong@jot.ok")
-		mock.ExpectQuery(`SELECT id, name, email FROM spender`).WillReturnRows(rows)
+		rows := sqlmock.NewRows(spenderColumns).
+			AddRow(1, "HongJot", "hong@jot.ok", false, false, "Asia/Bangkok", "th-TH", "THB", 1, "")
+		mock.ExpectQuery(getAllStmt).WillReturnRows(rows)
 		h := New(config.FeatureFlag{}, db)
 		h.GetAll(c)
 
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `{"spenders": [{"id": 1, "name": "HongJot", "email": "hong@jot.ok"}]}`, rec.Body.String())
+		assert.JSONEq(t, `{"spenders": [{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "active": false, "email_verified": false, "preferences": {"timezone": "Asia/Bangkok", "locale": "th-TH", "currency": "THB", "month_start_day": 1}}]}`, rec.Body.String())
 	})
 
 	t.Run("get all query error", func(t *testing.T) {
@@ -271,7 +281,7 @@ func TestGetAll(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		mock.ExpectQuery(`SELECT id, name, email FROM spender`).WillReturnError(assert.AnError)
+		mock.ExpectQuery(getAllStmt).WillReturnError(assert.AnError)
 		h := New(config.FeatureFlag{}, db)
 		err := h.GetAll(c)
 
@@ -279,3 +289,238 @@ func TestGetAll(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 }
+
+func callWithID(method, body, id string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(method, "/spenders/"+id, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/spenders/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+const outboxStmt = `INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`
+
+func TestUpdateSpender(t *testing.T) {
+	t.Run("replace name and email", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPut, `{"name": "Hong", "email": "hong@jot.ok"}`, "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(updateStmt).WithArgs("Hong", "hong@jot.ok", nil, int64(1)).
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "Hong", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, ""))
+		mock.ExpectExec(outboxStmt).
+			WithArgs("spender.updated", `{"id":1,"name":"Hong","email":"hong@jot.ok","active":true,"email_verified":false,"preferences":{"timezone":"Asia/Bangkok","locale":"th-TH","currency":"THB","month_start_day":1}}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "name": "Hong", "email": "hong@jot.ok", "active": true, "email_verified": false, "preferences": {"timezone": "Asia/Bangkok", "locale": "th-TH", "currency": "THB", "month_start_day": 1}}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("replace without an email", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPut, `{"name": "Hong"}`, "1")
+
+		err := New(config.FeatureFlag{}, nil).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("patch the name only", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPatch, `{"name": "Hong"}`, "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(updateStmt).WithArgs("Hong", nil, nil, int64(1)).
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "Hong", "hong@jot.ok", true, false, "Asia/Bangkok", "th-TH", "THB", 1, ""))
+		mock.ExpectExec(outboxStmt).WithArgs("spender.updated", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("patch a missing spender", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPatch, `{"email": "hong@jot.ok"}`, "9")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(updateStmt).WithArgs(nil, "hong@jot.ok", nil, int64(9)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestSetActive(t *testing.T) {
+	t.Run("deactivate", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPost, "", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(activeStmt).WithArgs(false, int64(1)).
+			WillReturnRows(sqlmock.NewRows(spenderColumns).AddRow(1, "HongJot", "hong@jot.ok", false, false, "Asia/Bangkok", "th-TH", "THB", 1, ""))
+		mock.ExpectExec(outboxStmt).
+			WithArgs("spender.updated", `{"id":1,"name":"HongJot","email":"hong@jot.ok","active":false,"email_verified":false,"preferences":{"timezone":"Asia/Bangkok","locale":"th-TH","currency":"THB","month_start_day":1}}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Deactivate(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "active": false, "email_verified": false, "preferences": {"timezone": "Asia/Bangkok", "locale": "th-TH", "currency": "THB", "month_start_day": 1}}`, rec.Body.String())
+	})
+
+	t.Run("reactivate a missing spender", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPost, "", "9")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(activeStmt).WithArgs(true, int64(9)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Reactivate(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestDeleteSpender(t *testing.T) {
+	deleted := func(mock sqlmock.Sqlmock, policy string, count int) {
+		for _, stmt := range []string{deleteAnomaliesStmt, deleteAttachmentsStmt, deleteStmt} {
+			mock.ExpectExec(stmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(outboxStmt).
+			WithArgs("spender.deleted", `{"id":1,"policy":"`+policy+`","transactions":`+strconv.Itoa(count)+`}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+	locked := func(mock sqlmock.Sqlmock, count int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(sharedStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(countTransactionStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+	}
+
+	t.Run("delete a spender without transactions", func(t *testing.T) {
+		c, rec := callWithID(http.MethodDelete, "", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		locked(mock, 0)
+		deleted(mock, PolicyRestrict, 0)
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuse to delete a spender with transactions", func(t *testing.T) {
+		c, rec := callWithID(http.MethodDelete, "", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		locked(mock, 3)
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	policies := map[string]struct{ stmt, event, payload string }{
+		PolicyCascade:   {deleteTransactionsStmt, "transaction.deleted", `{"id":%d,"spender_id":1}`},
+		PolicyAnonymize: {anonymizeStmt, "transaction.updated", `{"anonymized":true,"id":%d,"spender_id":1}`},
+	}
+	for policy, p := range policies {
+		p := p
+		t.Run("delete with policy "+policy, func(t *testing.T) {
+			c, rec := callWithID(http.MethodDelete, "", "1")
+			c.QueryParams().Set("policy", policy)
+
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+			locked(mock, 3)
+			mock.ExpectQuery(p.stmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4).AddRow(5).AddRow(6))
+			for _, id := range []int{4, 5, 6} {
+				mock.ExpectExec(outboxStmt).WithArgs(p.event, fmt.Sprintf(p.payload, id)).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			deleted(mock, policy, 3)
+
+			err := New(config.FeatureFlag{}, db).Delete(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("refuse to delete a spender sharing bills whatever the policy", func(t *testing.T) {
+		c, rec := callWithID(http.MethodDelete, "", "1")
+		c.QueryParams().Set("policy", PolicyCascade)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(sharedStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.JSONEq(t, `"`+ErrSharesBills.Error()+`"`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete with an unknown policy", func(t *testing.T) {
+		c, rec := callWithID(http.MethodDelete, "", "1")
+		c.QueryParams().Set("policy", "shred")
+
+		err := New(config.FeatureFlag{}, nil).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("delete a missing spender", func(t *testing.T) {
+		c, rec := callWithID(http.MethodDelete, "", "9")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStmt).WithArgs(int64(9)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
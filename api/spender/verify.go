@@ -0,0 +1,151 @@
+package spender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mailer"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/signurl"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrAlreadyVerified      = errors.New("email is verified already")
+	ErrVerificationDisabled = errors.New("email verification is not set up")
+)
+
+const verifyStmt = `UPDATE spender SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1 AND email = $2 RETURNING ` + columns + `;`
+
+// Verification is a verification email on its way.
+type Verification struct {
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WithVerification enables email verification, links to linkBase are signed
+// by signer and sent through m.
+func (h *handler) WithVerification(signer signurl.Signer, m mailer.Mailer, linkBase string) *handler {
+	h.signer = &signer
+	h.mailer = m
+	h.linkBase = strings.TrimSuffix(linkBase, "/")
+	return h
+}
+
+// verifyResource ties a token to the email, so changing it voids the
+// tokens sent to the previous one.
+func verifyResource(id int64, email string) string {
+	return "spenders/" + strconv.FormatInt(id, 10) + "/email/" + email
+}
+
+// token packs the signature in a single query parameter.
+func token(q url.Values) string {
+	return q.Get("kid") + "." + q.Get("expires") + "." + q.Get("sig")
+}
+
+func parseToken(t string) url.Values {
+	q := url.Values{}
+	rest, sig, _ := cutLast(t)
+	kid, expires, _ := cutLast(rest)
+	q.Set("kid", kid)
+	q.Set("expires", expires)
+	q.Set("sig", sig)
+	return q
+}
+
+func cutLast(s string) (string, string, bool) {
+	i := strings.LastIndex(s, ".")
+	if i < 0 {
+		return "", s, false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// VerifyEmail marks email as verified, when it is still the spender email.
+func (s Service) VerifyEmail(ctx context.Context, id int64, email string) (Spender, error) {
+	return s.change(ctx, verifyStmt, id, email)
+}
+
+// SendVerification emails the spender a link to verify its email.
+func (h handler) SendVerification(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	if h.mailer == nil {
+		return c.JSON(http.StatusNotImplemented, ErrVerificationDisabled.Error())
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+
+	sp, err := h.service().GetByID(ctx, c.Param("id"))
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if sp.EmailVerified {
+		return c.JSON(http.StatusConflict, ErrAlreadyVerified.Error())
+	}
+
+	q, expires := h.signer.Sign(verifyResource(id, sp.Email))
+	link := h.linkBase + "/api/v1/spenders/" + strconv.FormatInt(id, 10) + "/email/verify?" +
+		url.Values{"token": {token(q)}}.Encode()
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      sp.Email,
+		Subject: "Verify your HongJot email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to verify your email:\n\n%s\n\nThe link expires on %s.\n",
+			sp.Name, link, expires.Format(time.RFC1123)),
+	})
+	if err != nil {
+		logger.Error("send verification email error", zap.Error(err))
+		return c.JSON(http.StatusBadGateway, err.Error())
+	}
+
+	return c.JSON(http.StatusAccepted, Verification{Email: sp.Email, ExpiresAt: expires})
+}
+
+// VerifyEmail is where the link of the verification email leads, the token
+// stands for credentials.
+func (h handler) VerifyEmail(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	if h.signer == nil {
+		return c.JSON(http.StatusNotImplemented, ErrVerificationDisabled.Error())
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+
+	sp, err := h.service().GetByID(ctx, c.Param("id"))
+	if err == ErrNotFound {
+		return c.JSON(http.StatusForbidden, signurl.ErrInvalid.Error())
+	} else if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.signer.Verify(verifyResource(id, sp.Email), parseToken(c.QueryParam("token"))); err != nil {
+		return c.JSON(http.StatusForbidden, err.Error())
+	}
+
+	sp, err = h.service().VerifyEmail(ctx, id, sp.Email)
+	if err == ErrNotFound {
+		// the email changed since it was read
+		return c.JSON(http.StatusForbidden, signurl.ErrInvalid.Error())
+	} else if err != nil {
+		logger.Error("verify email error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, sp)
+}
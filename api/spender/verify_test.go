@@ -0,0 +1,137 @@
+package spender
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mailer"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/signurl"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSigner = signurl.New([]signurl.Key{{ID: "k1", Secret: []byte("0123456789abcdef")}}, time.Hour)
+
+func spenderRow(verified bool) *sqlmock.Rows {
+	return sqlmock.NewRows(spenderColumns).
+		AddRow(1, "HongJot", "hong@jot.ok", true, verified, "Asia/Bangkok", "th-TH", "THB", 1, "")
+}
+
+// sent keeps the messages sent through it.
+func sent(messages *[]mailer.Message) mailer.Mailer {
+	return mailer.Func(func(ctx context.Context, m mailer.Message) error {
+		*messages = append(*messages, m)
+		return nil
+	})
+}
+
+var linkRe = regexp.MustCompile(`https?://\S+`)
+
+func TestSendVerification(t *testing.T) {
+	t.Run("email a link", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPost, "", "1")
+		// the link must not lead where the client says
+		c.Request().Host = "evil.example"
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs("1").WillReturnRows(spenderRow(false))
+		var messages []mailer.Message
+
+		err := New(config.FeatureFlag{}, db).WithVerification(testSigner, sent(&messages), "https://hongjot.example/").SendVerification(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Len(t, messages, 1)
+		assert.Equal(t, "hong@jot.ok", messages[0].To)
+		link, _ := url.Parse(linkRe.FindString(messages[0].Body))
+		assert.Equal(t, "https", link.Scheme)
+		assert.Equal(t, "hongjot.example", link.Host)
+		assert.Equal(t, "/api/v1/spenders/1/email/verify", link.Path)
+		assert.NoError(t, testSigner.Verify(verifyResource(1, "hong@jot.ok"), parseToken(link.Query().Get("token"))))
+	})
+
+	t.Run("email verified already", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPost, "", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs("1").WillReturnRows(spenderRow(true))
+		var messages []mailer.Message
+
+		err := New(config.FeatureFlag{}, db).WithVerification(testSigner, sent(&messages), "https://hongjot.example/").SendVerification(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Empty(t, messages)
+	})
+
+	t.Run("without a mailer", func(t *testing.T) {
+		c, rec := callWithID(http.MethodPost, "", "1")
+
+		err := New(config.FeatureFlag{}, nil).SendVerification(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	verify := func(tok string) (*httptest.ResponseRecorder, sqlmock.Sqlmock, func() error) {
+		c, rec := callWithID(http.MethodGet, "", "1")
+		c.QueryParams().Set("token", tok)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		return rec, mock, func() error {
+			defer db.Close()
+			return New(config.FeatureFlag{}, db).WithVerification(testSigner, nil, "https://hongjot.example").VerifyEmail(c)
+		}
+	}
+
+	t.Run("verify with a valid token", func(t *testing.T) {
+		q, _ := testSigner.Sign(verifyResource(1, "hong@jot.ok"))
+		rec, mock, call := verify(token(q))
+		mock.ExpectQuery(getStmt).WithArgs("1").WillReturnRows(spenderRow(false))
+		mock.ExpectBegin()
+		mock.ExpectQuery(verifyStmt).WithArgs(int64(1), "hong@jot.ok").WillReturnRows(spenderRow(true))
+		mock.ExpectExec(outboxStmt).
+			WithArgs("spender.updated", `{"id":1,"name":"HongJot","email":"hong@jot.ok","active":true,"email_verified":true,"preferences":{"timezone":"Asia/Bangkok","locale":"th-TH","currency":"THB","month_start_day":1}}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := call()
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("verify a token sent to a previous email", func(t *testing.T) {
+		q, _ := testSigner.Sign(verifyResource(1, "old@jot.ok"))
+		rec, mock, call := verify(token(q))
+		mock.ExpectQuery(getStmt).WithArgs("1").WillReturnRows(spenderRow(false))
+
+		err := call()
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("verify a tampered token", func(t *testing.T) {
+		q, _ := testSigner.Sign(verifyResource(1, "hong@jot.ok"))
+		q.Set("expires", "9999999999")
+		rec, mock, call := verify(token(q))
+		mock.ExpectQuery(getStmt).WithArgs("1").WillReturnRows(spenderRow(false))
+
+		err := call()
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
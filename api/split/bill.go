@@ -0,0 +1,218 @@
+package split
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotFound           = errors.New("bill not found")
+	ErrUnknownSpender     = errors.New("spender not found")
+	ErrInvalidDescription = errors.New("description must be at most 255 characters")
+)
+
+const (
+	billStmt       = `INSERT INTO bill (payer_id, description, amount, method, date) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at;`
+	shareStmt      = `INSERT INTO bill_share (bill_id, spender_id, value, amount) VALUES ($1, $2, $3, $4);`
+	getBillStmt    = `SELECT id, payer_id, description, amount, method, date, created_at FROM bill WHERE id = $1;`
+	getSharesStmt  = `SELECT spender_id, value, amount FROM bill_share WHERE bill_id = $1 ORDER BY spender_id;`
+	deleteBillStmt = `DELETE FROM bill WHERE id = $1;`
+)
+
+// Bill is an expense paid by one spender and shared with others, each share
+// but the payer's own is owed to the payer. The payer records the expense
+// itself as a transaction as usual.
+type Bill struct {
+	ID          int64     `json:"id"`
+	PayerID     int64     `json:"payer_id"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+	Method      Method    `json:"method"`
+	Date        time.Time `json:"date"`
+	Shares      []Share   `json:"shares"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Service struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+	now  func() time.Time
+}
+
+func NewService(cfg config.FeatureFlag, db *sql.DB) Service {
+	return Service{cfg, db, time.Now}
+}
+
+// isUnknownSpender tells a spender referred to does not exist.
+func isUnknownSpender(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// CreateBill splits b by its method and saves it with its shares.
+func (s Service) CreateBill(ctx context.Context, b Bill) (Bill, error) {
+	if len(b.Description) > 255 {
+		return b, ErrInvalidDescription
+	}
+	shares, err := Split(b.Amount, b.Method, b.Shares)
+	if err != nil {
+		return b, err
+	}
+	b.Shares = shares
+	b.Amount = baht(cents(b.Amount))
+	if b.Date.IsZero() {
+		b.Date = s.now()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return b, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, billStmt, b.PayerID, b.Description, b.Amount, b.Method, b.Date).Scan(&b.ID, &b.CreatedAt)
+	if isUnknownSpender(err) {
+		return b, ErrUnknownSpender
+	} else if err != nil {
+		return b, err
+	}
+	for _, sh := range b.Shares {
+		_, err := tx.ExecContext(ctx, shareStmt, b.ID, sh.SpenderID, sh.Value, sh.Amount)
+		if isUnknownSpender(err) {
+			return b, ErrUnknownSpender
+		} else if err != nil {
+			return b, err
+		}
+	}
+	return b, tx.Commit()
+}
+
+func (s Service) GetBill(ctx context.Context, id int64) (Bill, error) {
+	var b Bill
+	err := s.db.QueryRowContext(ctx, getBillStmt, id).Scan(&b.ID, &b.PayerID, &b.Description, &b.Amount, &b.Method, &b.Date, &b.CreatedAt)
+	if err == sql.ErrNoRows {
+		return b, ErrNotFound
+	} else if err != nil {
+		return b, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, getSharesStmt, id)
+	if err != nil {
+		return b, err
+	}
+	defer rows.Close()
+
+	b.Shares = []Share{}
+	for rows.Next() {
+		var sh Share
+		if err := rows.Scan(&sh.SpenderID, &sh.Value, &sh.Amount); err != nil {
+			return b, err
+		}
+		b.Shares = append(b.Shares, sh)
+	}
+	return b, rows.Err()
+}
+
+// DeleteBill removes a bill and what it made owed, settlements made for it
+// are kept.
+func (s Service) DeleteBill(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, deleteBillStmt, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type handler struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+}
+
+func New(cfg config.FeatureFlag, db *sql.DB) *handler {
+	return &handler{cfg, db}
+}
+
+func (h handler) service() Service {
+	return NewService(h.flag, h.db)
+}
+
+func isInvalidBill(err error) bool {
+	switch err {
+	case ErrInvalidMethod, ErrInvalidAmount, ErrNoShares, ErrDuplicateShare, ErrInvalidShare,
+		ErrExactMismatch, ErrPercentMismatch, ErrInvalidDescription, ErrUnknownSpender:
+		return true
+	}
+	return false
+}
+
+func (h handler) CreateBill(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var b Bill
+	if err := c.Bind(&b); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+
+	b, err := h.service().CreateBill(ctx, b)
+	if isInvalidBill(err) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		logger.Error("create bill error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusCreated, b)
+}
+
+func (h handler) GetBill(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid bill id")
+	}
+
+	b, err := h.service().GetBill(ctx, id)
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("query bill error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+func (h handler) DeleteBill(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid bill id")
+	}
+
+	err = h.service().DeleteBill(ctx, id)
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("delete bill error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
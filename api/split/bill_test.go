@@ -0,0 +1,131 @@
+package split
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func call(method, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names, values = append(names, params[i]), append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	return c, rec
+}
+
+func TestCreateBill(t *testing.T) {
+	t.Run("saves the bill with its shares", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"payer_id": 1, "description": "Dinner", "amount": 100, "method": "equal", "date": "2024-05-18T19:00:00Z", "shares": [{"spender_id": 1}, {"spender_id": 2}, {"spender_id": 3}]}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		date := time.Date(2024, 5, 18, 19, 0, 0, 0, time.UTC)
+		at := time.Date(2024, 5, 18, 20, 0, 0, 0, time.UTC)
+		mock.ExpectBegin()
+		mock.ExpectQuery(billStmt).WithArgs(int64(1), "Dinner", 100.0, MethodEqual, date).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, at))
+		mock.ExpectExec(shareStmt).WithArgs(int64(5), int64(1), 0.0, 33.34).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(shareStmt).WithArgs(int64(5), int64(2), 0.0, 33.33).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(shareStmt).WithArgs(int64(5), int64(3), 0.0, 33.33).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).CreateBill(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 5, "payer_id": 1, "description": "Dinner", "amount": 100, "method": "equal", "date": "2024-05-18T19:00:00Z",
+			"shares": [{"spender_id": 1, "amount": 33.34}, {"spender_id": 2, "amount": 33.33}, {"spender_id": 3, "amount": 33.33}],
+			"created_at": "2024-05-18T20:00:00Z"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("percentages not adding up", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"payer_id": 1, "amount": 100, "method": "percent", "shares": [{"spender_id": 1, "value": 50}, {"spender_id": 2, "value": 20}]}`)
+
+		err := New(config.FeatureFlag{}, nil).CreateBill(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `"percentages must add up to 100"`, rec.Body.String())
+	})
+
+	t.Run("unknown spender", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"payer_id": 1, "amount": 10, "method": "exact", "date": "2024-05-18T19:00:00Z", "shares": [{"spender_id": 9, "value": 10}]}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(billStmt).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, time.Now()))
+		mock.ExpectExec(shareStmt).WithArgs(int64(5), int64(9), 10.0, 10.0).WillReturnError(&pq.Error{Code: "23503"})
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).CreateBill(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetBill(t *testing.T) {
+	t.Run("with its shares", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "", "id", "5")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		date := time.Date(2024, 5, 18, 19, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(getBillStmt).WithArgs(int64(5)).WillReturnRows(sqlmock.NewRows([]string{"id", "payer_id", "description", "amount", "method", "date", "created_at"}).
+			AddRow(5, 1, "Dinner", 90, "shares", date, date))
+		mock.ExpectQuery(getSharesStmt).WithArgs(int64(5)).WillReturnRows(sqlmock.NewRows([]string{"spender_id", "value", "amount"}).
+			AddRow(1, 2, 60).AddRow(2, 1, 30))
+
+		err := New(config.FeatureFlag{}, db).GetBill(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 5, "payer_id": 1, "description": "Dinner", "amount": 90, "method": "shares", "date": "2024-05-18T19:00:00Z",
+			"shares": [{"spender_id": 1, "value": 2, "amount": 60}, {"spender_id": 2, "value": 1, "amount": 30}],
+			"created_at": "2024-05-18T19:00:00Z"}`, rec.Body.String())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "", "id", "5")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getBillStmt).WithArgs(int64(5)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		err := New(config.FeatureFlag{}, db).GetBill(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestDeleteBill(t *testing.T) {
+	c, rec := call(http.MethodDelete, "", "id", "5")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectExec(deleteBillStmt).WithArgs(int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := New(config.FeatureFlag{}, db).DeleteBill(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,398 @@
+package split
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/promptpay"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// maxGroup bounds the spenders of a settlement plan.
+const maxGroup = 50
+
+var (
+	ErrSameSpender  = errors.New("a spender cannot settle with itself")
+	ErrNothingOwed  = errors.New("nothing is owed")
+	ErrOverpay      = errors.New("amount is more than what is owed")
+	ErrInvalidGroup = errors.New("spenders must be between 2 and " + strconv.Itoa(maxGroup) + " comma separated spender ids")
+)
+
+// SettlementCategory is the category of the transactions of a settlement.
+const SettlementCategory = "Settlement"
+
+// debts is every debtor to creditor amount, a bill share owed to the payer
+// and a settlement paid back as the creditor owing the debtor.
+const debts = `(
+	SELECT s.spender_id AS debtor, b.payer_id AS creditor, s.amount FROM bill_share s JOIN bill b ON b.id = s.bill_id WHERE s.spender_id <> b.payer_id
+	UNION ALL
+	SELECT to_id, from_id, amount FROM settlement
+) d`
+
+const (
+	balancesStmt = `SELECT o.id, o.name, SUM(CASE WHEN d.creditor = $1 THEN d.amount ELSE -d.amount END) AS balance
+FROM ` + debts + ` JOIN spender o ON o.id = CASE WHEN d.creditor = $1 THEN d.debtor ELSE d.creditor END
+WHERE d.debtor = $1 OR d.creditor = $1
+GROUP BY o.id, o.name
+HAVING SUM(CASE WHEN d.creditor = $1 THEN d.amount ELSE -d.amount END) <> 0
+ORDER BY o.id;`
+	groupDebtsStmt = `SELECT d.debtor, d.creditor, SUM(d.amount) FROM ` + debts + `
+WHERE d.debtor = ANY($1) AND d.creditor = ANY($1)
+GROUP BY d.debtor, d.creditor
+ORDER BY d.debtor, d.creditor;`
+	owedStmt = `SELECT COALESCE(SUM(CASE WHEN d.debtor = $1 THEN d.amount ELSE -d.amount END), 0) FROM ` + debts + `
+WHERE (d.debtor = $1 AND d.creditor = $2) OR (d.debtor = $2 AND d.creditor = $1);`
+	// lockSpenderStmt keeps two settlements between the same spenders from
+	// both paying off the same debt.
+	lockSpenderStmt = `SELECT name FROM spender WHERE id = $1 FOR UPDATE;`
+	settlementStmt  = `INSERT INTO settlement (from_id, to_id, amount, date, from_transaction_id, to_transaction_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at;`
+)
+
+// Balance is where a spender stands with another one.
+type Balance struct {
+	SpenderID int64  `json:"spender_id"`
+	Name      string `json:"name"`
+	// Amount is what the other spender owes, negative when it is owed.
+	Amount float64 `json:"amount"`
+}
+
+type Balances struct {
+	SpenderID int64 `json:"spender_id"`
+	// Owed and Owing are the totals owed to and by the spender.
+	Owed     float64   `json:"owed"`
+	Owing    float64   `json:"owing"`
+	Balances []Balance `json:"balances"`
+}
+
+// Plan is the fewest transfers found to settle the debts of a group.
+type Plan struct {
+	// Debts are who owes whom before simplifying.
+	Debts     []Transfer `json:"debts"`
+	Transfers []Transfer `json:"transfers"`
+}
+
+type Settlement struct {
+	ID     int64   `json:"id"`
+	FromID int64   `json:"from_id"`
+	ToID   int64   `json:"to_id"`
+	Amount float64 `json:"amount"`
+	// Date is when the money was paid, now by default.
+	Date              time.Time `json:"date"`
+	FromTransactionID int64     `json:"from_transaction_id"`
+	ToTransactionID   int64     `json:"to_transaction_id"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// Balances returns who owes the spender and whom it owes.
+func (s Service) Balances(ctx context.Context, spenderID int64) (Balances, error) {
+	rows, err := s.db.QueryContext(ctx, balancesStmt, spenderID)
+	if err != nil {
+		return Balances{}, err
+	}
+	defer rows.Close()
+
+	res := Balances{SpenderID: spenderID, Balances: []Balance{}}
+	for rows.Next() {
+		var b Balance
+		if err := rows.Scan(&b.SpenderID, &b.Name, &b.Amount); err != nil {
+			return Balances{}, err
+		}
+		if b.Amount > 0 {
+			res.Owed += b.Amount
+		} else {
+			res.Owing -= b.Amount
+		}
+		res.Balances = append(res.Balances, b)
+	}
+	return res, rows.Err()
+}
+
+// Plan simplifies the debts between the spenders of a group, debts with
+// spenders out of the group are left alone.
+func (s Service) Plan(ctx context.Context, spenderIDs []int64) (Plan, error) {
+	rows, err := s.db.QueryContext(ctx, groupDebtsStmt, pq.Array(spenderIDs))
+	if err != nil {
+		return Plan{}, err
+	}
+	defer rows.Close()
+
+	// debts both ways between two spenders cancel out
+	pairs := map[[2]int64]int64{}
+	for rows.Next() {
+		var t Transfer
+		if err := rows.Scan(&t.From, &t.To, &t.Amount); err != nil {
+			return Plan{}, err
+		}
+		if t.From < t.To {
+			pairs[[2]int64{t.From, t.To}] += cents(t.Amount)
+		} else {
+			pairs[[2]int64{t.To, t.From}] -= cents(t.Amount)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{Debts: []Transfer{}}
+	for pair, c := range pairs {
+		if c > 0 {
+			plan.Debts = append(plan.Debts, Transfer{From: pair[0], To: pair[1], Amount: baht(c)})
+		} else if c < 0 {
+			plan.Debts = append(plan.Debts, Transfer{From: pair[1], To: pair[0], Amount: baht(-c)})
+		}
+	}
+	sortTransfers(plan.Debts)
+	plan.Transfers = Simplify(plan.Debts)
+	return plan, nil
+}
+
+func sortTransfers(t []Transfer) {
+	sort.Slice(t, func(i, j int) bool {
+		if t[i].From != t[j].From {
+			return t[i].From < t[j].From
+		}
+		return t[i].To < t[j].To
+	})
+}
+
+// SettleUp records that st.FromID paid st.ToID back, as an expense of the
+// one and an income of the other. A zero amount pays off the whole debt.
+func (s Service) SettleUp(ctx context.Context, st Settlement) (Settlement, error) {
+	if st.FromID == st.ToID {
+		return st, ErrSameSpender
+	}
+	if st.Amount < 0 {
+		return st, ErrInvalidAmount
+	}
+	if st.Date.IsZero() {
+		st.Date = s.now()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return st, err
+	}
+	defer tx.Rollback()
+
+	// locking in id order keeps two settlements from deadlocking
+	names := map[int64]string{}
+	for _, id := range []int64{min(st.FromID, st.ToID), max(st.FromID, st.ToID)} {
+		var name string
+		if err := tx.QueryRowContext(ctx, lockSpenderStmt, id).Scan(&name); err == sql.ErrNoRows {
+			return st, ErrUnknownSpender
+		} else if err != nil {
+			return st, err
+		}
+		names[id] = name
+	}
+
+	var owed float64
+	if err := tx.QueryRowContext(ctx, owedStmt, st.FromID, st.ToID).Scan(&owed); err != nil {
+		return st, err
+	}
+	if cents(owed) <= 0 {
+		return st, ErrNothingOwed
+	}
+	if st.Amount == 0 {
+		st.Amount = owed
+	}
+	st.Amount = baht(cents(st.Amount))
+	if st.Amount == 0 {
+		return st, ErrInvalidAmount
+	}
+	if cents(st.Amount) > cents(owed) {
+		return st, ErrOverpay
+	}
+
+	date := st.Date.Format(time.RFC3339)
+	paid, err := transaction.Insert(ctx, tx, transaction.Transaction{
+		Date:            date,
+		Amount:          st.Amount,
+		Category:        SettlementCategory,
+		TransactionType: "expense",
+		Note:            "Settle up with " + names[st.ToID],
+		SpenderId:       st.FromID,
+	})
+	if err != nil {
+		return st, err
+	}
+	received, err := transaction.Insert(ctx, tx, transaction.Transaction{
+		Date:            date,
+		Amount:          st.Amount,
+		Category:        SettlementCategory,
+		TransactionType: "income",
+		Note:            "Settle up from " + names[st.FromID],
+		SpenderId:       st.ToID,
+	})
+	if err != nil {
+		return st, err
+	}
+	st.FromTransactionID, st.ToTransactionID = paid.ID, received.ID
+
+	err = tx.QueryRowContext(ctx, settlementStmt, st.FromID, st.ToID, st.Amount, st.Date, st.FromTransactionID, st.ToTransactionID).
+		Scan(&st.ID, &st.CreatedAt)
+	if err != nil {
+		return st, err
+	}
+	return st, tx.Commit()
+}
+
+// PaymentRequest is the PromptPay payload for fromID to pay toID back, of
+// amount or the whole debt when it is 0.
+func (s Service) PaymentRequest(ctx context.Context, fromID, toID int64, amount float64) (string, error) {
+	if fromID == toID {
+		return "", ErrSameSpender
+	}
+	if amount < 0 {
+		return "", ErrInvalidAmount
+	}
+
+	to, err := spender.NewService(s.flag, s.db).GetByID(ctx, strconv.FormatInt(toID, 10))
+	if err == spender.ErrNotFound {
+		return "", ErrUnknownSpender
+	} else if err != nil {
+		return "", err
+	}
+	if to.PromptPayID == "" {
+		return "", promptpay.ErrNoID
+	}
+
+	var owed float64
+	if err := s.db.QueryRowContext(ctx, owedStmt, fromID, toID).Scan(&owed); err != nil {
+		return "", err
+	}
+	if cents(owed) <= 0 {
+		return "", ErrNothingOwed
+	}
+	if amount == 0 {
+		amount = owed
+	}
+	if cents(amount) > cents(owed) {
+		return "", ErrOverpay
+	}
+	return promptpay.Payload(to.PromptPayID, baht(cents(amount)))
+}
+
+func (h handler) GetSpenderBalances(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+
+	balances, err := h.service().Balances(ctx, id)
+	if err != nil {
+		logger.Error("query balances error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, balances)
+}
+
+func parseGroup(v string) ([]int64, error) {
+	var ids []int64
+	seen := map[int64]bool{}
+	for _, s := range strings.Split(v, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, ErrInvalidGroup
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 || len(ids) > maxGroup {
+		return nil, ErrInvalidGroup
+	}
+	return ids, nil
+}
+
+// GetSettlementPlan suggests the transfers settling the debts between the
+// spenders of ?spenders=1,2,3.
+func (h handler) GetSettlementPlan(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	ids, err := parseGroup(c.QueryParam("spenders"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	plan, err := h.service().Plan(ctx, ids)
+	if err != nil {
+		logger.Error("query debts error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, plan)
+}
+
+// GetSettlementQR renders the PromptPay QR code for ?from_id to pay ?to_id
+// back, of ?amount or the whole debt.
+func (h handler) GetSettlementQR(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	fromID, err := strconv.ParseInt(c.QueryParam("from_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid from_id")
+	}
+	toID, err := strconv.ParseInt(c.QueryParam("to_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid to_id")
+	}
+	var amount float64
+	if v := c.QueryParam("amount"); v != "" {
+		if amount, err = strconv.ParseFloat(v, 64); err != nil {
+			return c.JSON(http.StatusBadRequest, ErrInvalidAmount.Error())
+		}
+	}
+
+	payload, err := h.service().PaymentRequest(ctx, fromID, toID, amount)
+	switch err {
+	case nil:
+		return promptpay.Respond(c, payload)
+	case ErrSameSpender, ErrInvalidAmount, ErrOverpay, promptpay.ErrInvalidAmount:
+		return c.JSON(http.StatusBadRequest, err.Error())
+	case ErrUnknownSpender, promptpay.ErrNoID:
+		return c.JSON(http.StatusNotFound, err.Error())
+	case ErrNothingOwed:
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	logger.Error("payment request error", zap.Error(err))
+	return c.JSON(http.StatusInternalServerError, err.Error())
+}
+
+func (h handler) SettleUp(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var st Settlement
+	if err := c.Bind(&st); err != nil {
+		return c.JSON(http.StatusBadRequest, "bad request body")
+	}
+
+	st, err := h.service().SettleUp(ctx, st)
+	switch err {
+	case nil:
+		return c.JSON(http.StatusCreated, st)
+	case ErrSameSpender, ErrInvalidAmount, ErrOverpay, ErrUnknownSpender:
+		return c.JSON(http.StatusBadRequest, err.Error())
+	case ErrNothingOwed, transaction.ErrSpenderInactive:
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	logger.Error("settle up error", zap.Error(err))
+	return c.JSON(http.StatusInternalServerError, err.Error())
+}
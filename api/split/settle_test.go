@@ -0,0 +1,213 @@
+package split
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	spenderActiveStmt = `SELECT active FROM spender WHERE id = $1 FOR SHARE;`
+	rulesStmt         = `SELECT r.id, r.spender_id, r.priority, r.note_contains, r.note_regex, r.min_amount, r.max_amount, r.transaction_type,
+	COALESCE(r.category_id, 0), COALESCE(c.name, ''), r.tags FROM category_rule r LEFT JOIN category c ON c.id = r.category_id WHERE r.spender_id = $1 ORDER BY r.priority, r.id;`
+	transactionStmt = `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id", "tags") VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
+	categoryStmt    = `SELECT id, COALESCE(spender_id, 0), COALESCE(parent_id, 0), name, icon, color, type FROM category WHERE (spender_id IS NULL OR spender_id = $1) AND LOWER(name) = LOWER($2) AND type = LOWER($3) ORDER BY spender_id NULLS LAST LIMIT 1;`
+	outboxStmt      = `INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`
+)
+
+func TestGetSpenderBalances(t *testing.T) {
+	c, rec := call(http.MethodGet, "", "id", "1")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	mock.ExpectQuery(balancesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "balance"}).
+		AddRow(2, "Jot", 120.5).AddRow(3, "Hong", -20))
+
+	err := New(config.FeatureFlag{}, db).GetSpenderBalances(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"spender_id": 1, "owed": 120.5, "owing": 20, "balances": [
+		{"spender_id": 2, "name": "Jot", "amount": 120.5},
+		{"spender_id": 3, "name": "Hong", "amount": -20}
+	]}`, rec.Body.String())
+}
+
+func TestGetSettlementPlan(t *testing.T) {
+	t.Run("simplifies the debts of the group", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "")
+		c.QueryParams().Set("spenders", "1,2,3,2")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(groupDebtsStmt).WithArgs("{1,2,3}").WillReturnRows(sqlmock.NewRows([]string{"debtor", "creditor", "sum"}).
+			AddRow(1, 2, 100).AddRow(2, 1, 40).AddRow(2, 3, 60))
+
+		err := New(config.FeatureFlag{}, db).GetSettlementPlan(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"debts": [{"from_id": 1, "to_id": 2, "amount": 60}, {"from_id": 2, "to_id": 3, "amount": 60}],
+			"transfers": [{"from_id": 1, "to_id": 3, "amount": 60}]
+		}`, rec.Body.String())
+	})
+
+	t.Run("needs two spenders", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "")
+		c.QueryParams().Set("spenders", "1")
+
+		err := New(config.FeatureFlag{}, nil).GetSettlementPlan(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func settlementCategory(id int64, typ string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "spender_id", "parent_id", "name", "icon", "color", "type"}).AddRow(id, 0, 0, SettlementCategory, "handshake", "#009688", typ)
+}
+
+func TestSettleUp(t *testing.T) {
+	date := time.Date(2024, 5, 18, 19, 0, 0, 0, time.UTC)
+	lock := func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSpenderStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Hong"))
+		mock.ExpectQuery(lockSpenderStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Jot"))
+	}
+
+	t.Run("pays off the whole debt", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"from_id": 2, "to_id": 1, "date": "2024-05-18T19:00:00Z"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		lock(mock)
+		mock.ExpectQuery(owedStmt).WithArgs(int64(2), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(66.67))
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(nil))
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(2), SettlementCategory, "expense").WillReturnRows(settlementCategory(10, "expense"))
+		mock.ExpectQuery(transactionStmt).WithArgs("2024-05-18T19:00:00Z", 66.67, SettlementCategory, "expense", "Settle up with Hong", "", int64(2), int64(10), "{}").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(nil))
+		mock.ExpectQuery(categoryStmt).WithArgs(int64(1), SettlementCategory, "income").WillReturnRows(settlementCategory(17, "income"))
+		mock.ExpectQuery(transactionStmt).WithArgs("2024-05-18T19:00:00Z", 66.67, SettlementCategory, "income", "Settle up from Jot", "", int64(1), int64(17), "{}").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectQuery(settlementStmt).WithArgs(int64(2), int64(1), 66.67, date, int64(10), int64(11)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, date))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).SettleUp(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 3, "from_id": 2, "to_id": 1, "amount": 66.67, "date": "2024-05-18T19:00:00Z",
+			"from_transaction_id": 10, "to_transaction_id": 11, "created_at": "2024-05-18T19:00:00Z"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("paying more than owed", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"from_id": 2, "to_id": 1, "amount": 100}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		lock(mock)
+		mock.ExpectQuery(owedStmt).WithArgs(int64(2), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(66.67))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).SettleUp(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `"amount is more than what is owed"`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nothing owed", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"from_id": 1, "to_id": 2}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		lock(mock)
+		mock.ExpectQuery(owedStmt).WithArgs(int64(1), int64(2)).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(-66.67))
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).SettleUp(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("with itself", func(t *testing.T) {
+		c, rec := call(http.MethodPost, `{"from_id": 1, "to_id": 1}`)
+
+		err := New(config.FeatureFlag{}, nil).SettleUp(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestGetSettlementQR(t *testing.T) {
+	getSpenderStmt := `SELECT id, name, email, active, email_verified_at IS NOT NULL, timezone, locale, currency, month_start_day, COALESCE(promptpay_id, '') FROM spender WHERE id = $1;`
+	spenderRows := func(promptPayID string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "email", "active", "email_verified", "timezone", "locale", "currency", "month_start_day", "promptpay_id"}).
+			AddRow(1, "Hong", "hong@jot.ok", true, true, "Asia/Bangkok", "th-TH", "THB", 1, promptPayID)
+	}
+
+	t.Run("for the whole debt", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "")
+		c.QueryParams().Set("from_id", "2")
+		c.QueryParams().Set("to_id", "1")
+		c.QueryParams().Set("format", "json")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getSpenderStmt).WithArgs("1").WillReturnRows(spenderRows("0801234567"))
+		mock.ExpectQuery(owedStmt).WithArgs(int64(2), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(66.67))
+
+		err := New(config.FeatureFlag{}, db).GetSettlementQR(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "540566.67")
+	})
+
+	t.Run("more than owed", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "")
+		c.QueryParams().Set("from_id", "2")
+		c.QueryParams().Set("to_id", "1")
+		c.QueryParams().Set("amount", "100")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getSpenderStmt).WithArgs("1").WillReturnRows(spenderRows("0801234567"))
+		mock.ExpectQuery(owedStmt).WithArgs(int64(2), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(66.67))
+
+		err := New(config.FeatureFlag{}, db).GetSettlementQR(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("spender paid back has no promptpay id", func(t *testing.T) {
+		c, rec := call(http.MethodGet, "")
+		c.QueryParams().Set("from_id", "2")
+		c.QueryParams().Set("to_id", "1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getSpenderStmt).WithArgs("1").WillReturnRows(spenderRows(""))
+
+		err := New(config.FeatureFlag{}, db).GetSettlementQR(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
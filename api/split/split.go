@@ -0,0 +1,212 @@
+package split
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Method is how a bill is divided among its shares.
+type Method string
+
+const (
+	// MethodEqual divides the bill evenly, share values are ignored.
+	MethodEqual Method = "equal"
+	// MethodExact takes share values as amounts adding up to the bill.
+	MethodExact Method = "exact"
+	// MethodPercent takes share values as percentages adding up to 100.
+	MethodPercent Method = "percent"
+	// MethodShares divides the bill in proportion to share values.
+	MethodShares Method = "shares"
+)
+
+var (
+	ErrInvalidMethod   = errors.New("method must be equal, exact, percent or shares")
+	ErrInvalidAmount   = errors.New("amount must be positive")
+	ErrNoShares        = errors.New("shares must name at least one spender")
+	ErrDuplicateShare  = errors.New("shares must name each spender once")
+	ErrInvalidShare    = errors.New("share values must not be negative, and some must be positive")
+	ErrExactMismatch   = errors.New("exact amounts must add up to the bill amount")
+	ErrPercentMismatch = errors.New("percentages must add up to 100")
+)
+
+type Share struct {
+	SpenderID int64 `json:"spender_id"`
+	// Value is the amount, percentage or number of shares, by the method.
+	Value float64 `json:"value,omitempty"`
+	// Amount is what the spender owes of the bill.
+	Amount float64 `json:"amount"`
+}
+
+// Transfer is money owed, or to pay, by From to To.
+type Transfer struct {
+	From   int64   `json:"from_id"`
+	To     int64   `json:"to_id"`
+	Amount float64 `json:"amount"`
+}
+
+// Amounts are handled in satang so they add up to the cent.
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func baht(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// Split works out the amount of each share of a bill of total. Rounding
+// leftovers go a satang at a time to the shares with the largest remainder,
+// ties to the first listed.
+func Split(total float64, method Method, shares []Share) ([]Share, error) {
+	if total <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if len(shares) == 0 {
+		return nil, ErrNoShares
+	}
+	seen := map[int64]bool{}
+	var sum float64
+	for _, s := range shares {
+		if seen[s.SpenderID] {
+			return nil, ErrDuplicateShare
+		}
+		seen[s.SpenderID] = true
+		if s.Value < 0 {
+			return nil, ErrInvalidShare
+		}
+		sum += s.Value
+	}
+
+	weights := make([]float64, len(shares))
+	switch method {
+	case MethodEqual:
+		for i := range weights {
+			weights[i] = 1
+		}
+	case MethodExact:
+		var exact int64
+		for _, s := range shares {
+			exact += cents(s.Value)
+		}
+		if exact != cents(total) {
+			return nil, ErrExactMismatch
+		}
+		for i, s := range shares {
+			weights[i] = float64(cents(s.Value))
+		}
+	case MethodPercent:
+		if math.Abs(sum-100) > 0.0001 {
+			return nil, ErrPercentMismatch
+		}
+		for i, s := range shares {
+			weights[i] = s.Value
+		}
+	case MethodShares:
+		if sum <= 0 {
+			return nil, ErrInvalidShare
+		}
+		for i, s := range shares {
+			weights[i] = s.Value
+		}
+	default:
+		return nil, ErrInvalidMethod
+	}
+
+	split := make([]Share, len(shares))
+	for i, c := range allocate(cents(total), weights) {
+		split[i] = shares[i]
+		split[i].Amount = baht(c)
+		if method == MethodEqual {
+			split[i].Value = 0
+		}
+	}
+	return split, nil
+}
+
+// allocate divides total in proportion to weights with the largest
+// remainder method, so the parts always add up to total.
+func allocate(total int64, weights []float64) []int64 {
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+
+	parts := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	left := total
+	for i, w := range weights {
+		exact := float64(total) * w / sum
+		parts[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(parts[i])
+		left -= parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; left > 0; i++ {
+		parts[order[i%len(order)]]++
+		left--
+	}
+	return parts
+}
+
+// Net sums debts into what each spender is owed, negative when it owes.
+func Net(debts []Transfer) map[int64]int64 {
+	net := map[int64]int64{}
+	for _, d := range debts {
+		c := cents(d.Amount)
+		net[d.From] -= c
+		net[d.To] += c
+	}
+	return net
+}
+
+// Simplify settles debts with as few transfers as it finds: it works out
+// what each spender owes or is owed overall, then repeatedly has the one
+// owing most pay the one owed most. That takes at most one transfer less
+// than the spenders involved.
+func Simplify(debts []Transfer) []Transfer {
+	type balance struct {
+		id    int64
+		cents int64
+	}
+	var debtors, creditors []balance
+	for id, c := range Net(debts) {
+		if c < 0 {
+			debtors = append(debtors, balance{id, -c})
+		} else if c > 0 {
+			creditors = append(creditors, balance{id, c})
+		}
+	}
+	largest := func(b []balance) func(i, j int) bool {
+		return func(i, j int) bool {
+			if b[i].cents != b[j].cents {
+				return b[i].cents > b[j].cents
+			}
+			return b[i].id < b[j].id
+		}
+	}
+
+	transfers := []Transfer{}
+	for len(debtors) > 0 && len(creditors) > 0 {
+		sort.Slice(debtors, largest(debtors))
+		sort.Slice(creditors, largest(creditors))
+		d, c := &debtors[0], &creditors[0]
+		amount := min(d.cents, c.cents)
+		transfers = append(transfers, Transfer{From: d.id, To: c.id, Amount: baht(amount)})
+		d.cents -= amount
+		c.cents -= amount
+		if d.cents == 0 {
+			debtors = debtors[1:]
+		}
+		if c.cents == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
@@ -0,0 +1,75 @@
+package split
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  float64
+		method Method
+		shares []Share
+		want   []float64
+		err    error
+	}{
+		{"equal", 90, MethodEqual, []Share{{SpenderID: 1}, {SpenderID: 2}, {SpenderID: 3}}, []float64{30, 30, 30}, nil},
+		{"equal with leftover satang", 100, MethodEqual, []Share{{SpenderID: 1}, {SpenderID: 2}, {SpenderID: 3}}, []float64{33.34, 33.33, 33.33}, nil},
+		{"exact", 100, MethodExact, []Share{{SpenderID: 1, Value: 60.5}, {SpenderID: 2, Value: 39.5}}, []float64{60.5, 39.5}, nil},
+		{"exact not adding up", 100, MethodExact, []Share{{SpenderID: 1, Value: 60}, {SpenderID: 2, Value: 30}}, nil, ErrExactMismatch},
+		{"percent", 250, MethodPercent, []Share{{SpenderID: 1, Value: 50}, {SpenderID: 2, Value: 30}, {SpenderID: 3, Value: 20}}, []float64{125, 75, 50}, nil},
+		{"percent with leftover satang", 10, MethodPercent, []Share{{SpenderID: 1, Value: 33.3}, {SpenderID: 2, Value: 33.3}, {SpenderID: 3, Value: 33.4}}, []float64{3.33, 3.33, 3.34}, nil},
+		{"percent not adding up", 100, MethodPercent, []Share{{SpenderID: 1, Value: 50}, {SpenderID: 2, Value: 40}}, nil, ErrPercentMismatch},
+		{"shares", 100, MethodShares, []Share{{SpenderID: 1, Value: 2}, {SpenderID: 2, Value: 1}}, []float64{66.67, 33.33}, nil},
+		{"no shares at all", 100, MethodShares, []Share{{SpenderID: 1}, {SpenderID: 2}}, nil, ErrInvalidShare},
+		{"negative share", 100, MethodShares, []Share{{SpenderID: 1, Value: -1}, {SpenderID: 2, Value: 2}}, nil, ErrInvalidShare},
+		{"same spender twice", 100, MethodEqual, []Share{{SpenderID: 1}, {SpenderID: 1}}, nil, ErrDuplicateShare},
+		{"nobody", 100, MethodEqual, nil, nil, ErrNoShares},
+		{"nothing to split", 0, MethodEqual, []Share{{SpenderID: 1}}, nil, ErrInvalidAmount},
+		{"unknown method", 100, "halves", []Share{{SpenderID: 1}}, nil, ErrInvalidMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := Split(tt.total, tt.method, tt.shares)
+
+			assert.Equal(t, tt.err, err)
+			var got []float64
+			for _, s := range shares {
+				got = append(got, s.Amount)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	t.Run("a chain becomes a single transfer", func(t *testing.T) {
+		got := Simplify([]Transfer{{From: 1, To: 2, Amount: 100}, {From: 2, To: 3, Amount: 100}})
+
+		assert.Equal(t, []Transfer{{From: 1, To: 3, Amount: 100}}, got)
+	})
+
+	t.Run("a cycle cancels out", func(t *testing.T) {
+		got := Simplify([]Transfer{{From: 1, To: 2, Amount: 50}, {From: 2, To: 3, Amount: 50}, {From: 3, To: 1, Amount: 50}})
+
+		assert.Empty(t, got)
+	})
+
+	t.Run("largest debtor pays largest creditor first", func(t *testing.T) {
+		got := Simplify([]Transfer{
+			{From: 1, To: 3, Amount: 30},
+			{From: 1, To: 4, Amount: 20.5},
+			{From: 2, To: 3, Amount: 10},
+			{From: 2, To: 4, Amount: 40},
+			{From: 3, To: 4, Amount: 5},
+		})
+
+		assert.Equal(t, []Transfer{
+			{From: 1, To: 4, Amount: 50.5},
+			{From: 2, To: 3, Amount: 35},
+			{From: 2, To: 4, Amount: 15},
+		}, got)
+	})
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// Memory keeps files in memory, for tests.
+type Memory struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{files: make(map[string][]byte)}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[key] = append([]byte(nil), content...)
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, ok := m.files[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// Keys lists what is stored.
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for k := range m.files {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type S3Options struct {
+	// Endpoint is e.g. https://s3.ap-southeast-1.amazonaws.com, or
+	// http://localhost:9000 for MinIO. Buckets are addressed by path.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3 stores files in a bucket of any S3-compatible service, requests are
+// signed with AWS Signature Version 4.
+type S3 struct {
+	opts   S3Options
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3(opts S3Options) *S3 {
+	return &S3{opts: opts, client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}
+}
+
+func (s *S3) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	req, err := s.request(ctx, http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, content)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("storage: s3 put %s: %w", key, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return s3Error("put", key, res)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, nil)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("storage: s3 get %s: %w", key, err)
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer res.Body.Close()
+		return nil, s3Error("get", key, res)
+	}
+}
+
+func (s *S3) request(ctx context.Context, method, key string, content []byte) (*http.Request, error) {
+	u, err := url.Parse(s.opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + path.Join(s.opts.Bucket, s.opts.Prefix, key)
+
+	return http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(content))
+}
+
+// sign adds the Authorization header of AWS Signature Version 4, covering
+// the host, the payload and the Content-Type, Range and X-Amz-* headers.
+func (s *S3) sign(req *http.Request, payload []byte) {
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	amzDate := s.now().UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := amzDate[:8] + "/" + s.opts.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Error reads the error document S3 answers with.
+func s3Error(op, key string, res *http.Response) error {
+	var doc struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if xml.Unmarshal(body, &doc) != nil || doc.Code == "" {
+		return fmt.Errorf("storage: s3 %s %s: %s", op, key, res.Status)
+	}
+	return fmt.Errorf("storage: s3 %s %s: %s %s: %s", op, key, res.Status, doc.Code, doc.Message)
+}
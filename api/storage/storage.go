@@ -0,0 +1,62 @@
+// Package storage keeps uploaded files on the local filesystem or in an
+// S3-compatible bucket.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+type Storage interface {
+	Put(ctx context.Context, key string, content []byte, contentType string) error
+	// Get returns ErrNotFound when nothing is stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// New creates the backend selected by cfg, keys are stored under its prefix.
+func New(cfg config.Storage) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal(path.Join(cfg.LocalDir, cfg.Prefix)), nil
+	case "s3":
+		if cfg.Bucket == "" || cfg.Endpoint == "" {
+			return nil, errors.New("storage: s3 needs a bucket and an endpoint")
+		}
+		return NewS3(S3Options{
+			Endpoint:        cfg.Endpoint,
+			Region:          cfg.Region,
+			Bucket:          cfg.Bucket,
+			Prefix:          cfg.Prefix,
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+		}), nil
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
+	}
+}
+
+// ContentKey names content after its SHA-256, so the same file is stored
+// once and different files never collide whatever their names.
+func ContentKey(content []byte, ext string) string {
+	sum := sha256.Sum256(content)
+	h := hex.EncodeToString(sum[:])
+	return h[:2] + "/" + h + strings.ToLower(ext)
+}
+
+// validKey refuses keys that could escape the prefix of the backend.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+)
+
+// subscriberBuffer is how many events a slow client may lag behind before
+// it gets disconnected. It resumes from Last-Event-ID when it reconnects.
+const subscriberBuffer = 64
+
+// Broker fans transaction events relayed from the outbox out to the
+// streams of the spender they belong to. It is an outbox.Sink.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[int64]map[chan outbox.Event]struct{}
+	closed bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subs: make(map[int64]map[chan outbox.Event]struct{}),
+	}
+}
+
+// SpenderID tells which spender a transaction event belongs to.
+func SpenderID(e outbox.Event) (int64, bool) {
+	if !strings.HasPrefix(e.Type, "transaction.") {
+		return 0, false
+	}
+
+	var payload struct {
+		SpenderID int64 `json:"spender_id"`
+	}
+	if err := json.Unmarshal(e.Payload, &payload); err != nil || payload.SpenderID == 0 {
+		return 0, false
+	}
+	return payload.SpenderID, true
+}
+
+func (b *Broker) Send(ctx context.Context, e outbox.Event) error {
+	spenderID, ok := SpenderID(e)
+	if !ok {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[spenderID] {
+		select {
+		case ch <- e:
+		default:
+			b.remove(spenderID, ch)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the events of a spender as they are relayed. The
+// channel is closed when the subscriber falls behind or the broker is
+// closed, and cancel must be called once the subscriber is gone.
+func (b *Broker) Subscribe(spenderID int64) (<-chan outbox.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan outbox.Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if b.subs[spenderID] == nil {
+		b.subs[spenderID] = make(map[chan outbox.Event]struct{})
+	}
+	b.subs[spenderID][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(spenderID, ch)
+	}
+}
+
+// Close ends every open stream so the HTTP server can shut down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for spenderID, chans := range b.subs {
+		for ch := range chans {
+			b.remove(spenderID, ch)
+		}
+	}
+}
+
+func (b *Broker) remove(spenderID int64, ch chan outbox.Event) {
+	if _, ok := b.subs[spenderID][ch]; !ok {
+		return
+	}
+	delete(b.subs[spenderID], ch)
+	if len(b.subs[spenderID]) == 0 {
+		delete(b.subs, spenderID)
+	}
+	close(ch)
+}
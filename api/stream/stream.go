@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// replayStmt returns the events a client missed since Last-Event-ID. Only
+// published events are replayed, the others reach the client live as the
+// relay streams events once they are marked as published.
+const replayStmt = `SELECT id, event_type, payload, created_at FROM outbox
+WHERE id > $1 AND published_at IS NOT NULL AND event_type LIKE 'transaction.%' AND payload::jsonb->>'spender_id' = $2
+ORDER BY id;`
+
+type handler struct {
+	db     *sql.DB
+	broker *Broker
+}
+
+func New(db *sql.DB, broker *Broker) *handler {
+	return &handler{db, broker}
+}
+
+func (h handler) StreamSpenderTransactions(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	spenderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid spender id")
+	}
+
+	var lastID int64
+	if v := c.Request().Header.Get("Last-Event-ID"); v != "" {
+		lastID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid Last-Event-ID")
+		}
+	}
+
+	// subscribe before replaying so nothing published in between is lost
+	events, cancel := h.broker.Subscribe(spenderID)
+	defer cancel()
+
+	var missed []outbox.Event
+	if lastID > 0 {
+		missed, err = h.replay(c, lastID, spenderID)
+		if err != nil {
+			logger.Error("replay error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	for _, e := range missed {
+		if err := writeEvent(res, e); err != nil {
+			return nil
+		}
+		lastID = e.ID
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if e.ID <= lastID {
+				continue
+			}
+			if err := writeEvent(res, e); err != nil {
+				return nil
+			}
+			lastID = e.ID
+		}
+	}
+}
+
+func (h handler) replay(c echo.Context, lastID, spenderID int64) ([]outbox.Event, error) {
+	rows, err := h.db.QueryContext(c.Request().Context(), replayStmt, lastID, strconv.FormatInt(spenderID, 10))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []outbox.Event
+	for rows.Next() {
+		var e outbox.Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func writeEvent(res *echo.Response, e outbox.Event) error {
+	_, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Payload)
+	if err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
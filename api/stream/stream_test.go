@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func event(id int64, eventType, payload string) outbox.Event {
+	return outbox.Event{ID: id, Type: eventType, Payload: []byte(payload)}
+}
+
+func subscribers(b *Broker, spenderID int64) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs[spenderID])
+}
+
+func TestSpenderID(t *testing.T) {
+	id, ok := SpenderID(event(1, outbox.EventTransactionCreated, `{"id":3,"spender_id":2}`))
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), id)
+
+	_, ok = SpenderID(event(2, outbox.EventSpenderCreated, `{"id":2}`))
+	assert.False(t, ok)
+}
+
+func TestBroker(t *testing.T) {
+	t.Run("deliver only the events of the subscribed spender", func(t *testing.T) {
+		b := NewBroker()
+		events, cancel := b.Subscribe(1)
+		defer cancel()
+
+		b.Send(context.Background(), event(1, outbox.EventTransactionCreated, `{"spender_id":2}`))
+		b.Send(context.Background(), event(2, outbox.EventTransactionCreated, `{"spender_id":1}`))
+
+		e := <-events
+		assert.Equal(t, int64(2), e.ID)
+		assert.Empty(t, events)
+	})
+
+	t.Run("disconnect a subscriber that falls behind", func(t *testing.T) {
+		b := NewBroker()
+		events, cancel := b.Subscribe(1)
+		defer cancel()
+
+		for i := 0; i <= subscriberBuffer; i++ {
+			b.Send(context.Background(), event(int64(i), outbox.EventTransactionCreated, `{"spender_id":1}`))
+		}
+
+		assert.Equal(t, 0, subscribers(b, 1))
+		for range events {
+		}
+	})
+
+	t.Run("close every subscriber", func(t *testing.T) {
+		b := NewBroker()
+		events, cancel := b.Subscribe(1)
+		defer cancel()
+
+		b.Close()
+
+		_, ok := <-events
+		assert.False(t, ok)
+		late, _ := b.Subscribe(1)
+		_, ok = <-late
+		assert.False(t, ok)
+	})
+}
+
+func TestStreamSpenderTransactions(t *testing.T) {
+	t.Run("push live events until the broker closes", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions/stream", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		b := NewBroker()
+		h := New(nil, b)
+		done := make(chan error)
+		go func() { done <- h.StreamSpenderTransactions(c) }()
+
+		assert.Eventually(t, func() bool { return subscribers(b, 1) == 1 }, time.Second, time.Millisecond)
+		b.Send(context.Background(), event(5, outbox.EventTransactionDeleted, `{"id":3,"spender_id":1}`))
+		b.Close()
+
+		assert.NoError(t, <-done)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "id: 5\nevent: transaction.deleted\ndata: {\"id\":3,\"spender_id\":1}\n\n", rec.Body.String())
+	})
+
+	t.Run("replay missed events after Last-Event-ID", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions/stream", nil)
+		req.Header.Set("Last-Event-ID", "3")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		created := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(replayStmt).WithArgs(int64(3), "1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "payload", "created_at"}).
+				AddRow(4, outbox.EventTransactionCreated, `{"id":9,"spender_id":1}`, created))
+
+		b := NewBroker()
+		h := New(db, b)
+		done := make(chan error)
+		go func() { done <- h.StreamSpenderTransactions(c) }()
+
+		assert.Eventually(t, func() bool { return subscribers(b, 1) == 1 }, time.Second, time.Millisecond)
+		// already replayed, must not be sent twice
+		b.Send(context.Background(), event(4, outbox.EventTransactionCreated, `{"id":9,"spender_id":1}`))
+		b.Send(context.Background(), event(6, outbox.EventTransactionUpdated, `{"id":"9","spender_id":1}`))
+		b.Close()
+
+		assert.NoError(t, <-done)
+		assert.Equal(t, "id: 4\nevent: transaction.created\ndata: {\"id\":9,\"spender_id\":1}\n\n"+
+			"id: 6\nevent: transaction.updated\ndata: {\"id\":\"9\",\"spender_id\":1}\n\n", rec.Body.String())
+	})
+
+	t.Run("invalid Last-Event-ID", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions/stream", nil)
+		req.Header.Set("Last-Event-ID", "abc")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		h := New(nil, NewBroker())
+		err := h.StreamSpenderTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,173 @@
+package transaction
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultPage  = 1
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+// signedAmount is the effect of a transaction row on the spender balance.
+const signedAmount = `CASE WHEN transaction_type = 'income' THEN amount ELSE -amount END`
+
+// historyStmt computes the running balance over the whole spender history
+// before the date range and paging are applied, so a page starting in the
+// middle of the history still carries the right balance.
+const historyStmt = `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id, tags, running_balance
+FROM (
+	SELECT id, date, amount, category, transaction_type, note, image_url, spender_id, tags,
+		SUM(` + signedAmount + `) OVER (ORDER BY date, id) AS running_balance
+	FROM transaction
+	WHERE spender_id = $1
+) t
+WHERE ($2::timestamptz IS NULL OR date >= $2) AND ($3::timestamptz IS NULL OR date < $3)
+ORDER BY date, id
+LIMIT $4 OFFSET $5;`
+
+const historyTotalsStmt = `SELECT
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0),
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type <> 'income'), 0),
+	COALESCE(SUM(` + signedAmount + `) FILTER (WHERE date < $2), 0),
+	COALESCE(SUM(` + signedAmount + `) FILTER (WHERE $3::timestamptz IS NULL OR date < $3), 0),
+	COUNT(*) FILTER (WHERE ($2::timestamptz IS NULL OR date >= $2) AND ($3::timestamptz IS NULL OR date < $3))
+FROM transaction
+WHERE spender_id = $1;`
+
+type HistoryQuery struct {
+	Page int
+	// Limit is 0 for all the rows.
+	Limit int
+	// From is inclusive and To is exclusive, nil means unbounded.
+	From *time.Time
+	To   *time.Time
+
+	// fromDate and toDate tell From and To were plain dates, read as UTC
+	// until In knows the spender time zone.
+	fromDate, toDate bool
+}
+
+// In reads the plain dates of q as midnights in loc.
+func (q HistoryQuery) In(loc *time.Location) HistoryQuery {
+	if q.From != nil && q.fromDate {
+		t := midnight(*q.From, loc)
+		q.From = &t
+	}
+	if q.To != nil && q.toDate {
+		t := midnight(*q.To, loc)
+		q.To = &t
+	}
+	return q
+}
+
+func midnight(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// ParseHistoryQuery reads the page, limit, from and to query parameters.
+func ParseHistoryQuery(c echo.Context) (HistoryQuery, error) {
+	var page, limit int
+	var err error
+
+	if v := c.QueryParam("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return HistoryQuery{}, errors.New("page must be a positive number")
+		}
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return HistoryQuery{}, errLimit
+		}
+	}
+
+	return NewHistoryQuery(page, limit, c.QueryParam("from"), c.QueryParam("to"))
+}
+
+var errLimit = errors.New("limit must be between 1 and " + strconv.Itoa(maxLimit))
+
+// NewHistoryQuery validates the paging and date range of a history request.
+// Without page nor limit every row is returned, as before paging existed, a
+// page alone has the default limit. Empty dates are unbounded.
+func NewHistoryQuery(page, limit int, from, to string) (HistoryQuery, error) {
+	q := HistoryQuery{Page: defaultPage}
+
+	if page < 0 {
+		return q, errors.New("page must be a positive number")
+	} else if page > 0 {
+		q.Page = page
+		q.Limit = defaultLimit
+	}
+
+	if limit < 0 || limit > maxLimit {
+		return q, errLimit
+	} else if limit > 0 {
+		q.Limit = limit
+	}
+
+	if from != "" {
+		t, dateOnly, err := parseDateParam(from)
+		if err != nil {
+			return q, errors.New("from must be YYYY-MM-DD or RFC3339")
+		}
+		q.From = &t
+		q.fromDate = dateOnly
+	}
+
+	if to != "" {
+		t, dateOnly, err := parseDateParam(to)
+		if err != nil {
+			return q, errors.New("to must be YYYY-MM-DD or RFC3339")
+		}
+		// a plain date includes the whole day
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		q.To = &t
+		q.toDate = dateOnly
+	}
+
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return q, errors.New("from must be before to")
+	}
+
+	return q, nil
+}
+
+// Window returns the LIMIT and OFFSET of the page of q, a nil LIMIT for all
+// the rows.
+func (q HistoryQuery) Window() (limit interface{}, offset int) {
+	if q.Limit == 0 {
+		return nil, 0
+	}
+	return q.Limit, (q.Page - 1) * q.Limit
+}
+
+// Pagination tells where the page of q is among total rows.
+func (q HistoryQuery) Pagination(total int) Pagination {
+	if q.Limit == 0 {
+		return Pagination{CurrentPage: 1, TotalPages: 1, PerPage: total}
+	}
+	return Pagination{
+		CurrentPage: q.Page,
+		TotalPages:  (total + q.Limit - 1) / q.Limit,
+		PerPage:     q.Limit,
+	}
+}
+
+func parseDateParam(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
@@ -0,0 +1,215 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// maxMonths bounds the monthly report.
+const maxMonths = 60
+
+var (
+	ErrInvalidMonth = errors.New("month must be current or YYYY-MM")
+	ErrMonthRange   = errors.New("from must not be after to, and at most " + strconv.Itoa(maxMonths) + " months before it")
+)
+
+const summaryStmt = `SELECT
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0),
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type <> 'income'), 0)
+FROM transaction
+WHERE spender_id = $1 AND ($2::timestamptz IS NULL OR date >= $2) AND ($3::timestamptz IS NULL OR date < $3);`
+
+// monthlyStmt shifts dates back by the days the spender month starts late,
+// so each budget month lands in the calendar month it starts in.
+const monthlyStmt = `SELECT
+	to_char(date_trunc('month', (date AT TIME ZONE $2) - make_interval(days => $3 - 1)), 'YYYY-MM') AS month,
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0),
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type <> 'income'), 0)
+FROM transaction
+WHERE spender_id = $1 AND date >= $4 AND date < $5
+GROUP BY month
+ORDER BY month;`
+
+// Period is a budget month of the spender, named after the calendar month
+// it starts in.
+type Period struct {
+	Month string    `json:"month"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+}
+
+type MonthSummary struct {
+	Period
+	TotalIncome   float64 `json:"total_income"`
+	TotalExpenses float64 `json:"total_expenses"`
+	Net           float64 `json:"net"`
+}
+
+// MonthlyReport is the spender totals by budget month, oldest first.
+type MonthlyReport struct {
+	Currency      string         `json:"currency"`
+	Timezone      string         `json:"timezone"`
+	MonthStartDay int            `json:"month_start_day"`
+	Months        []MonthSummary `json:"months"`
+}
+
+// preferences of the spender, the defaults for transactions whose spender
+// is gone.
+func (s Service) preferences(ctx context.Context, spenderID string) (spender.Preferences, error) {
+	p, err := spender.GetPreferences(ctx, s.db, spenderID)
+	if err == spender.ErrNotFound {
+		return p, nil
+	}
+	return p, err
+}
+
+func validMonth(month string) error {
+	if _, err := time.Parse("2006-01", month); err != nil && month != "current" {
+		return ErrInvalidMonth
+	}
+	return nil
+}
+
+// period is the budget month named by month, "current" is the one today
+// is in. month is expected to be valid.
+func (s Service) period(p spender.Preferences, month string) Period {
+	var from, to time.Time
+	if t, err := time.Parse("2006-01", month); err == nil {
+		from, to = p.Month(t.Year(), t.Month())
+	} else {
+		from, to = p.MonthOf(s.now())
+	}
+	return Period{Month: from.Format("2006-01"), From: from, To: to}
+}
+
+// Period is the budget month named by month, "current" or YYYY-MM, with
+// the preferences p.
+func (s Service) Period(p spender.Preferences, month string) (Period, error) {
+	if err := validMonth(month); err != nil {
+		return Period{}, err
+	}
+	return s.period(p, month), nil
+}
+
+// Summary returns the spender totals over the whole history, or over one
+// of its budget months when month is "current" or YYYY-MM.
+func (s Service) Summary(ctx context.Context, spenderID, month string) (Summary, *Period, error) {
+	if month != "" {
+		if err := validMonth(month); err != nil {
+			return Summary{}, nil, err
+		}
+	}
+	p, err := s.preferences(ctx, spenderID)
+	if err != nil {
+		return Summary{}, nil, err
+	}
+
+	var period *Period
+	var from, to *time.Time
+	if month != "" {
+		pr := s.period(p, month)
+		period, from, to = &pr, &pr.From, &pr.To
+	}
+
+	var totalIncome, totalExpenses float64
+	err = s.db.QueryRowContext(ctx, summaryStmt, spenderID, from, to).Scan(&totalIncome, &totalExpenses)
+	if err != nil {
+		return Summary{}, nil, err
+	}
+
+	return Summary{
+		TotalIncome:    totalIncome,
+		TotalExpenses:  totalExpenses,
+		CurrentBalance: totalIncome - totalExpenses,
+		Currency:       p.Currency,
+	}, period, nil
+}
+
+// Monthly returns the spender totals of every budget month from the one
+// named by from to the one named by to, both YYYY-MM. By default it covers
+// the twelve months up to the current one.
+func (s Service) Monthly(ctx context.Context, spenderID, from, to string) (MonthlyReport, error) {
+	for _, m := range []string{from, to} {
+		if err := validMonth(m); m != "" && err != nil {
+			return MonthlyReport{}, err
+		}
+	}
+	p, err := s.preferences(ctx, spenderID)
+	if err != nil {
+		return MonthlyReport{}, err
+	}
+
+	if to == "" {
+		to = "current"
+	}
+	last := s.period(p, to)
+	first := Period{From: last.From.AddDate(0, -11, 0)}
+	if from != "" {
+		first = s.period(p, from)
+	}
+	n := monthsBetween(first.From, last.From) + 1
+	if n < 1 || n > maxMonths {
+		return MonthlyReport{}, ErrMonthRange
+	}
+
+	rows, err := s.db.QueryContext(ctx, monthlyStmt, spenderID, p.Timezone, p.MonthStartDay, first.From, last.To)
+	if err != nil {
+		return MonthlyReport{}, err
+	}
+	defer rows.Close()
+
+	totals := map[string][2]float64{}
+	for rows.Next() {
+		var month string
+		var income, expenses float64
+		if err := rows.Scan(&month, &income, &expenses); err != nil {
+			return MonthlyReport{}, err
+		}
+		totals[month] = [2]float64{income, expenses}
+	}
+	if err := rows.Err(); err != nil {
+		return MonthlyReport{}, err
+	}
+
+	report := MonthlyReport{Currency: p.Currency, Timezone: p.Timezone, MonthStartDay: p.MonthStartDay}
+	for i := 0; i < n; i++ {
+		start := first.From.AddDate(0, i, 0)
+		from, to := p.Month(start.Year(), start.Month())
+		month := from.Format("2006-01")
+		t := totals[month]
+		report.Months = append(report.Months, MonthSummary{
+			Period:        Period{Month: month, From: from, To: to},
+			TotalIncome:   t[0],
+			TotalExpenses: t[1],
+			Net:           t[0] - t[1],
+		})
+	}
+	return report, nil
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+}
+
+func (h *handler) GetSpenderMonthlySummary(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	report, err := h.service().Monthly(ctx, c.Param("id"), c.QueryParam("from"), c.QueryParam("to"))
+	if err == ErrInvalidMonth || err == ErrMonthRange {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
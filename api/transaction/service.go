@@ -0,0 +1,230 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/anomaly"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rule"
+	"github.com/lib/pq"
+)
+
+const (
+	cStmt = `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id", "tags") VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
+	uStmt = `UPDATE transaction SET date=$1, amount=$2, category=$3, transaction_type=$4, spender_id=$5, note=$6, image_url=$7, category_id=NULLIF($8, 0) WHERE id=$9`
+
+	spenderActiveStmt = `SELECT active FROM spender WHERE id = $1 FOR SHARE;`
+)
+
+var (
+	ErrNotFound        = errors.New("transaction not found")
+	ErrSpenderInactive = errors.New("spender is inactive")
+)
+
+// Service is the transaction business logic shared by the REST and gRPC APIs.
+type Service struct {
+	flag config.FeatureFlag
+	db   *sql.DB
+	now  func() time.Time
+}
+
+func NewService(cfg config.FeatureFlag, db *sql.DB) Service {
+	return Service{cfg, db, time.Now}
+}
+
+func (s Service) Create(ctx context.Context, t Transaction) (Transaction, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return t, err
+	}
+	defer tx.Rollback()
+
+	if t, err = Insert(ctx, tx, t); err != nil {
+		return t, err
+	}
+	// flagged in the same transaction, an expense is never saved unchecked
+	if t.TransactionType == "expense" {
+		if _, err := anomaly.Detect(ctx, tx, t.SpenderId, t.ID, t.Category, t.Amount); err != nil {
+			return t, err
+		}
+	}
+	return t, tx.Commit()
+}
+
+// Insert saves t within tx along with its outbox event, for callers that
+// record it with other changes. It skips the anomaly check of Create.
+func Insert(ctx context.Context, tx *sql.Tx, t Transaction) (Transaction, error) {
+	// the share lock keeps the spender from being deactivated until we commit
+	var active bool
+	err := tx.QueryRowContext(ctx, spenderActiveStmt, t.SpenderId).Scan(&active)
+	if err == nil && !active {
+		return t, ErrSpenderInactive
+	} else if err != nil && err != sql.ErrNoRows {
+		return t, err
+	}
+
+	if t, err = categorize(ctx, tx, t); err != nil {
+		return t, err
+	}
+	if t.CategoryID, t.Category, err = resolveCategory(ctx, tx, t.SpenderId, t.CategoryID, t.Category, t.TransactionType); err != nil {
+		return t, err
+	}
+	if err := tx.QueryRowContext(ctx, cStmt, t.Date, t.Amount, t.Category, t.TransactionType, t.Note, t.ImageURL, t.SpenderId, t.CategoryID, pq.Array(t.Tags)).Scan(&t.ID); err != nil {
+		return t, err
+	}
+	if err := outbox.Write(ctx, tx, outbox.EventTransactionCreated, t); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+// categorize applies the first rule of the spender t meets. The rule tags
+// are added to those of t, its category only when t comes without one.
+func categorize(ctx context.Context, tx *sql.Tx, t Transaction) (Transaction, error) {
+	t.Tags = rule.MergeTags(t.Tags, nil)
+	r, ok, err := rule.Match(ctx, tx, t.SpenderId, t.Note, t.Amount, t.TransactionType)
+	if err != nil || !ok {
+		return t, err
+	}
+	if t.CategoryID == 0 && strings.TrimSpace(t.Category) == "" {
+		t.CategoryID = r.CategoryID
+	}
+	t.Tags = rule.MergeTags(t.Tags, r.Tags)
+	return t, nil
+}
+
+// resolveCategory returns the catalog id and name of the category of a
+// transaction, none for a transaction without category.
+func resolveCategory(ctx context.Context, tx *sql.Tx, spenderID, id int64, name, transactionType string) (int64, string, error) {
+	if id == 0 && strings.TrimSpace(name) == "" {
+		return 0, "", nil
+	}
+	c, err := category.Resolve(ctx, tx, spenderID, id, name, transactionType)
+	if err != nil {
+		return 0, name, err
+	}
+	return c.ID, c.Name, nil
+}
+
+func isInvalidCategory(err error) bool {
+	return err == category.ErrUnknownCategory || err == category.ErrTypeMismatch
+}
+
+// Update replaces the transaction id, ErrNotFound when there is none. It
+// returns t with the category as named in the catalog.
+func (s Service) Update(ctx context.Context, id int64, t PutTransaction) (PutTransaction, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return t, err
+	}
+	defer tx.Rollback()
+
+	t.CategoryID, t.Category, err = resolveCategory(ctx, tx, int64(t.SpenderId), t.CategoryID, t.Category, t.TransactionType)
+	if err != nil {
+		return t, err
+	}
+	res, err := tx.ExecContext(ctx, uStmt, t.Date, t.Amount, t.Category, t.TransactionType, t.SpenderId, t.Note, t.ImageUrl, t.CategoryID, id)
+	if err != nil {
+		return t, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return t, err
+	} else if n == 0 {
+		return t, ErrNotFound
+	}
+
+	err = outbox.Write(ctx, tx, outbox.EventTransactionUpdated, map[string]interface{}{
+		"id":          id,
+		"spender_id":  t.SpenderId,
+		"transaction": t,
+	})
+	if err != nil {
+		return t, err
+	}
+	return t, tx.Commit()
+}
+
+func (s Service) Delete(ctx context.Context, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var spenderID int64
+	err = tx.QueryRowContext(ctx, deleteStmt, id).Scan(&spenderID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	err = outbox.Write(ctx, tx, outbox.EventTransactionDeleted, map[string]int64{
+		"id":         id,
+		"spender_id": spenderID,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// History returns a page of the spender transactions with running balances,
+// q is expected to come from NewHistoryQuery. Its plain dates are read in
+// the spender time zone.
+func (s Service) History(ctx context.Context, spenderID string, q HistoryQuery) (SpenderIDTransactionResponse, error) {
+	p, err := s.preferences(ctx, spenderID)
+	if err != nil {
+		return SpenderIDTransactionResponse{}, err
+	}
+	q = q.In(p.Location())
+
+	var totalIncome, totalExpenses, opening, closing float64
+	var total int
+	err = s.db.QueryRowContext(ctx, historyTotalsStmt, spenderID, q.From, q.To).
+		Scan(&totalIncome, &totalExpenses, &opening, &closing, &total)
+	if err != nil {
+		return SpenderIDTransactionResponse{}, err
+	}
+
+	limit, offset := q.Window()
+	rows, err := s.db.QueryContext(ctx, historyStmt, spenderID, q.From, q.To, limit, offset)
+	if err != nil {
+		return SpenderIDTransactionResponse{}, err
+	}
+	defer rows.Close()
+
+	trans := []TransactionWithBalance{}
+	for rows.Next() {
+		var t TransactionWithBalance
+		err := rows.Scan(&t.ID, &t.Date, &t.Amount, &t.Category, &t.TransactionType, &t.Note, &t.ImageURL, &t.SpenderId, pq.Array(&t.Tags), &t.RunningBalance)
+		if err != nil {
+			return SpenderIDTransactionResponse{}, err
+		}
+		trans = append(trans, t)
+	}
+	if err := rows.Err(); err != nil {
+		return SpenderIDTransactionResponse{}, err
+	}
+
+	return SpenderIDTransactionResponse{
+		Transactions: trans,
+		Summary: Summary{
+			TotalIncome:    totalIncome,
+			TotalExpenses:  totalExpenses,
+			CurrentBalance: totalIncome - totalExpenses,
+			Currency:       p.Currency,
+		},
+		Balance: Balance{
+			Opening: opening,
+			Closing: closing,
+		},
+		Pagination: q.Pagination(total),
+	}, nil
+}
@@ -2,16 +2,19 @@ package transaction
 
 import (
 	"database/sql"
-	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/category"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
 
+const deleteStmt = `DELETE FROM transaction WHERE id = $1 RETURNING spender_id;`
+
 type Transaction struct {
 	ID              int64   `json:"id"`
 	Date            string  `json:"date"`
@@ -21,6 +24,11 @@ type Transaction struct {
 	Note            string  `json:"note"`
 	ImageURL        string  `json:"image_url"`
 	SpenderId       int64   `json:"spender_id"`
+	// CategoryID picks the category from the spender catalog, Category is
+	// matched by name when it is 0. Transactions without either are
+	// categorized by the spender rules.
+	CategoryID int64    `json:"category_id,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
 }
 
 type handler struct {
@@ -32,11 +40,15 @@ func New(cfg config.FeatureFlag, db *sql.DB) *handler {
 	return &handler{cfg, db}
 }
 
+func (h handler) service() Service {
+	return NewService(h.flag, h.db)
+}
+
 func (h handler) GetAll(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	rows, err := h.db.QueryContext(ctx, `SELECT * FROM transaction WHERE transaction_type='expense'`)
+	rows, err := h.db.QueryContext(ctx, `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction WHERE transaction_type='expense'`)
 	if err != nil {
 		logger.Error("query error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
@@ -66,13 +78,17 @@ func (h handler) Create(c echo.Context) error {
 		logger.Error(msg, zap.Error(err))
 		return c.JSON(http.StatusBadRequest, msg)
 	}
-	var lastInsertId int64
-	err := h.db.QueryRowContext(ctx, `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "spender_id") VALUES ($1, $2, $3, $4, $5) RETURNING id;`, req.Date, req.Amount, req.Category, req.TransactionType, req.SpenderId).Scan(&lastInsertId)
-	if err != nil {
-		fmt.Println("query row error", err.Error())
+
+	req, err := h.service().Create(ctx, req)
+	if isInvalidCategory(err) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	} else if err == ErrSpenderInactive {
+		return c.JSON(http.StatusConflict, err.Error())
+	} else if err != nil {
+		logger.Error("create transaction error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
-	req.ID = lastInsertId
+
 	return c.JSON(http.StatusCreated, req)
 }
 
@@ -97,6 +113,7 @@ type PutTransaction struct {
 	Note            string    `json:"note"`
 	ImageUrl        string    `json:"image_url"`
 	SpenderId       int       `json:"spender_id"`
+	CategoryID      int64     `json:"category_id,omitempty"`
 }
 
 func (h handler) PutTransaction(c echo.Context) error {
@@ -104,17 +121,23 @@ func (h handler) PutTransaction(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	transactionID := c.Param("id") // Get the ID from the URL path
+	transactionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid transaction id")
+	}
 	var req PutTransaction
 	if err := c.Bind(&req); err != nil {
 		logger.Error(msg, zap.Error(err))
 		return c.JSON(http.StatusBadRequest, msg)
 	}
 
-	query := `UPDATE transaction SET date=$1, amount=$2, category=$3, transaction_type=$4, spender_id=$5, note=$6, image_url=$7 WHERE id=$8`
-	_, err := h.db.ExecContext(ctx, query, req.Date, req.Amount, req.Category, req.TransactionType, req.SpenderId, req.Note, req.ImageUrl, transactionID)
-	if err != nil {
-		logger.Error("query error", zap.Error(err))
+	req, err = h.service().Update(ctx, transactionID, req)
+	if isInvalidCategory(err) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	} else if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("update transaction error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
@@ -122,10 +145,32 @@ func (h handler) PutTransaction(c echo.Context) error {
 	return c.JSON(http.StatusOK, req)
 }
 
+func (h handler) Delete(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	transactionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid transaction id")
+	}
+
+	err = h.service().Delete(ctx, transactionID)
+	if err == ErrNotFound {
+		return c.JSON(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		logger.Error("delete transaction error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
 type Summary struct {
 	TotalIncome    float64 `json:"total_income"`
 	TotalExpenses  float64 `json:"total_expenses"`
 	CurrentBalance float64 `json:"current_balance"`
+	// Currency is the base currency of the spender.
+	Currency string `json:"currency"`
 }
 
 type Pagination struct {
@@ -134,84 +179,89 @@ type Pagination struct {
 	PerPage     int `json:"per_page"`
 }
 
+// Balance is the spender balance right before the first and right after the
+// last transaction of the requested date range.
+type Balance struct {
+	Opening float64 `json:"opening_balance"`
+	Closing float64 `json:"closing_balance"`
+}
+
+// TransactionWithBalance is a transaction along with the spender balance
+// after it was applied, in (date, id) order over the whole history.
+type TransactionWithBalance struct {
+	Transaction
+	RunningBalance float64 `json:"running_balance"`
+}
+
 type SpenderIDTransactionResponse struct {
-	Transactions []Transaction `json:"transactions"`
-	Summary      Summary       `json:"summary"`
-	Pagination   Pagination    `json:"pagination"`
+	Transactions []TransactionWithBalance `json:"transactions"`
+	Summary      Summary                  `json:"summary"`
+	Balance      Balance                  `json:"balance"`
+	Pagination   Pagination               `json:"pagination"`
 }
 type SpenderIDTransactionResponseSummary struct {
 	Summary Summary `json:"summary"`
+	// Period is the budget month summed up, unset for the whole history.
+	Period *Period `json:"period,omitempty"`
 }
 
+// GetSpenderTransactionSummary sums up the whole spender history, or one of
+// its budget months with ?month=current or ?month=YYYY-MM.
 func (h *handler) GetSpenderTransactionSummary(c echo.Context) error {
-	totalIncome, totalExpenses, err2, done, _ := transaction(c, h)
-	if done {
-		return err2
-	}
-
-	// Calculate the current balance
-	currentBalance := totalIncome - totalExpenses
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
 
-	// Construct the response
-	response := SpenderIDTransactionResponseSummary{
-		Summary: Summary{
-			TotalIncome:    totalIncome,
-			TotalExpenses:  totalExpenses,
-			CurrentBalance: currentBalance,
-		},
+	summary, period, err := h.service().Summary(ctx, c.Param("id"), c.QueryParam("month"))
+	if err == ErrInvalidMonth {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, SpenderIDTransactionResponseSummary{Summary: summary, Period: period})
 }
 
-func transaction(c echo.Context, h *handler) (float64, float64, error, bool, []Transaction) {
-	sqlQuery := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction WHERE spender_id=$1`
-
-	spenderID := c.Param("id") // Get the spender ID from the URL parameter
-
-	// Placeholder for the database connection
-	db := h.db // Assuming there is a db field in the handler struct for the database connection
-
-	// Querying the database for transactions related to the spender
-	rows, err := db.Query(sqlQuery, spenderID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
-		return 0, 0, err, true, nil
-	}
-
-	defer rows.Close()
-
-	var transactions []Transaction
-	var totalIncome, totalExpenses float64
-
-	for rows.Next() {
-		var t Transaction
-		err := rows.Scan(&t.ID, &t.Date, &t.Amount, &t.Category, &t.TransactionType, &t.Note, &t.ImageURL, &t.SpenderId)
-		if err != nil {
-			return 0, 0, c.JSON(http.StatusInternalServerError, err.Error()), true, nil
-		}
-		transactions = append(transactions, t)
+// CategoryTransactions is a category of the breakdown with its own
+// transactions, its totals rolled up from its subcategories.
+type CategoryTransactions struct {
+	CategoryID      int64                  `json:"category_id,omitempty"`
+	Category        string                 `json:"category"`
+	TransactionType string                 `json:"transaction_type"`
+	Total           float64                `json:"total"`
+	Count           int                    `json:"count"`
+	Transactions    []Transaction          `json:"transactions"`
+	Children        []CategoryTransactions `json:"children,omitempty"`
+}
 
-		// Calculate totals for summary
-		if t.TransactionType == "income" {
-			totalIncome += t.Amount
-		} else {
-			totalExpenses += t.Amount
+// byCategory arranges txs under the nodes of their categories.
+func byCategory(nodes []*category.Node, txs map[category.Key][]Transaction) []CategoryTransactions {
+	out := make([]CategoryTransactions, 0, len(nodes))
+	for _, n := range nodes {
+		own := txs[n.Key()]
+		if own == nil {
+			own = []Transaction{}
 		}
+		out = append(out, CategoryTransactions{
+			CategoryID:      n.CategoryID,
+			Category:        n.Category,
+			TransactionType: n.TransactionType,
+			Total:           n.Total,
+			Count:           n.Count,
+			Transactions:    own,
+			Children:        byCategory(n.Children, txs),
+		})
 	}
-	return totalIncome, totalExpenses, nil, false, transactions
-}
-
-type CategoryTransactions struct {
-	Category     string        `json:"category"`
-	Transactions []Transaction `json:"transactions"`
+	return out
 }
 
+// GetTransactionsGroupedByCategory returns every transaction under its
+// category, subcategories under their parents with the totals rolled up.
 func (h *handler) GetTransactionsGroupedByCategory(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	sqlQuery := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction`
+	sqlQuery := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id, COALESCE(category_id, 0) FROM transaction ORDER BY date, id`
 
 	rows, err := h.db.QueryContext(ctx, sqlQuery)
 	if err != nil {
@@ -220,38 +270,46 @@ func (h *handler) GetTransactionsGroupedByCategory(c echo.Context) error {
 	}
 	defer rows.Close()
 
-	transactionsByCategory := make(map[string][]Transaction)
-
+	txs := map[category.Key][]Transaction{}
+	var totals []category.Total
 	for rows.Next() {
 		var t Transaction
-		err := rows.Scan(&t.ID, &t.Date, &t.Amount, &t.Category, &t.TransactionType, &t.Note, &t.ImageURL, &t.SpenderId)
+		err := rows.Scan(&t.ID, &t.Date, &t.Amount, &t.Category, &t.TransactionType, &t.Note, &t.ImageURL, &t.SpenderId, &t.CategoryID)
 		if err != nil {
 			logger.Error("scan error", zap.Error(err))
 			return c.JSON(http.StatusInternalServerError, err.Error())
 		}
-		transactionsByCategory[t.Category] = append(transactionsByCategory[t.Category], t)
+		total := category.Total{CategoryID: t.CategoryID, Category: t.Category, TransactionType: t.TransactionType, Total: t.Amount, Count: 1}
+		txs[total.Key()] = append(txs[total.Key()], t)
+		totals = append(totals, total)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, transactionsByCategory)
+	cats, err := category.Ancestry(ctx, h.db, category.IDs(totals))
+	if err != nil {
+		logger.Error("query categories error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, byCategory(category.Tree(cats, totals), txs))
 }
 
 func (h *handler) GetSpenderTransactions(c echo.Context) error {
-	totalIncome, totalExpenses, _, _, tran := transaction(c, h)
-	// Calculate the current balance
-	currentBalance := totalIncome - totalExpenses
-	// Construct the response
-	response := SpenderIDTransactionResponse{
-		Transactions: tran,
-		Summary: Summary{
-			TotalIncome:    totalIncome,
-			TotalExpenses:  totalExpenses,
-			CurrentBalance: currentBalance,
-		},
-		Pagination: Pagination{
-			CurrentPage: 1,
-			TotalPages:  1,
-			PerPage:     len(tran),
-		},
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+	spenderID := c.Param("id")
+
+	q, err := ParseHistoryQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	response, err := h.service().History(ctx, spenderID, q)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
 	return c.JSON(http.StatusOK, response)
@@ -261,7 +319,7 @@ func (h handler) GetAllTransaction(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	rows, err := h.db.QueryContext(ctx, `SELECT * FROM transaction`)
+	rows, err := h.db.QueryContext(ctx, `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction`)
 	if err != nil {
 		logger.Error("query error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
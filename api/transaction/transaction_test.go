@@ -2,11 +2,13 @@ package transaction
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -31,7 +33,7 @@ func TestGetAllSpender(t *testing.T) {
 
 		rows := sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
 			AddRow(1, "2024-05-18 08:45:24.119432+00", "0.0", "Food", "expense", "", "", "1")
-		mock.ExpectQuery(`SELECT * FROM transaction WHERE transaction_type='expense'`).WillReturnRows(rows)
+		mock.ExpectQuery(`SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction WHERE transaction_type='expense'`).WillReturnRows(rows)
 
 		h := New(config.FeatureFlag{}, db)
 		err := h.GetAll(c)
@@ -82,9 +84,15 @@ func TestCreate(t *testing.T) {
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
-		cStmt := `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "spender_id") VALUES ($1, $2, $3, $4, $5) RETURNING id;`
+		cStmt := `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id", "tags") VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
 		row := sqlmock.NewRows([]string{"id"}).AddRow(1)
-		mock.ExpectQuery(cStmt).WithArgs("2024-05-18T15:00:37.557628+07:00", 200.99, "refund", "income", 2).WillReturnRows(row)
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(2), "refund", "income").WillReturnRows(categoryRows(16, 0, "Refund", "income"))
+		mock.ExpectQuery(cStmt).WithArgs("2024-05-18T15:00:37.557628+07:00", 200.99, "Refund", "income", "", "", 2, int64(16), "{}").WillReturnRows(row)
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, db)
@@ -92,7 +100,183 @@ func TestCreate(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusCreated, rec.Code)
-		assert.JSONEq(t, `{"id":1,"date":"2024-05-18T15:00:37.557628+07:00","amount":200.99,"category":"refund","transaction_type":"income","note":"","image_url":"","spender_id":2}`, rec.Body.String())
+		assert.JSONEq(t, `{"id":1,"date":"2024-05-18T15:00:37.557628+07:00","amount":200.99,"category":"Refund","transaction_type":"income","note":"","image_url":"","spender_id":2,"category_id":16}`, rec.Body.String())
+	})
+
+	t.Run("create transaction for an inactive spender", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date":"2024-05-18T15:00:37.557628+07:00","amount":200.99,"category":"refund","transaction_type":"income","spender_id":2}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(false))
+		mock.ExpectRollback()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create transaction categorized by a rule", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date":"2024-05-18T15:00:37.557628+07:00","amount":65,"transaction_type":"expense","note":"STARBUCKS SIAM","spender_id":2,"tags":["work"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		cStmt := `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id", "tags") VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(ruleColumns).
+			AddRow(1, 2, 0, "", "", nil, 50.0, "expense", 19, "Coffee", "{}").
+			AddRow(2, 2, 1, "starbucks", "", nil, nil, "expense", 19, "Coffee", "{coffee,work}"))
+		mock.ExpectQuery(categoryByIDStmt).WithArgs(int64(2), int64(19)).WillReturnRows(categoryRows(19, 2, "Coffee", "expense"))
+		mock.ExpectQuery(cStmt).WithArgs("2024-05-18T15:00:37.557628+07:00", 65.0, "Coffee", "expense", "STARBUCKS SIAM", "", 2, int64(19), "{\"work\",\"coffee\"}").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(anomalyStatsStmt).WithArgs(int64(2), "Coffee", int64(1)).WillReturnRows(anomalyStats(0, 0, 0, 0, 0))
+		mock.ExpectCommit()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id":1,"date":"2024-05-18T15:00:37.557628+07:00","amount":65,"category":"Coffee","transaction_type":"expense","note":"STARBUCKS SIAM","image_url":"","spender_id":2,"category_id":19,"tags":["work","coffee"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create transaction with a category and the tags of a rule", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date":"2024-05-18T15:00:37.557628+07:00","amount":65,"category":"snacks","transaction_type":"expense","note":"STARBUCKS SIAM","spender_id":2,"tags":["work"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		cStmt := `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id", "tags") VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(ruleColumns).
+			AddRow(2, 2, 0, "starbucks", "", nil, nil, "expense", 19, "Coffee", "{coffee,work}"))
+		mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(2), "snacks", "expense").WillReturnRows(categoryRows(21, 2, "Snacks", "expense"))
+		mock.ExpectQuery(cStmt).WithArgs("2024-05-18T15:00:37.557628+07:00", 65.0, "Snacks", "expense", "STARBUCKS SIAM", "", 2, int64(21), "{\"work\",\"coffee\"}").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(anomalyStatsStmt).WithArgs(int64(2), "Snacks", int64(1)).WillReturnRows(anomalyStats(0, 0, 0, 0, 0))
+		mock.ExpectCommit()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id":1,"date":"2024-05-18T15:00:37.557628+07:00","amount":65,"category":"Snacks","transaction_type":"expense","note":"STARBUCKS SIAM","image_url":"","spender_id":2,"category_id":21,"tags":["work","coffee"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create transaction flags an unusual expense before commit", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date":"2024-05-18T15:00:37.557628+07:00","amount":500,"category":"food","transaction_type":"expense","spender_id":2}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		cStmt := `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id", "tags") VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(2), "food", "expense").WillReturnRows(categoryRows(1, 0, "Food", "expense"))
+		mock.ExpectQuery(cStmt).WithArgs("2024-05-18T15:00:37.557628+07:00", 500.0, "Food", "expense", "", "", 2, int64(1), "{}").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(anomalyStatsStmt).WithArgs(int64(2), "Food", int64(9)).WillReturnRows(anomalyStats(20, 10, 100, 20, 140))
+		mock.ExpectExec(`INSERT INTO anomaly (transaction_id, spender_id, reason, score) VALUES ($1, $2, $3, $4);`).
+			WithArgs(int64(9), int64(2), "unusual_amount", 20.0).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create transaction is rolled back when it cannot be checked", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date":"2024-05-18T15:00:37.557628+07:00","amount":500,"category":"food","transaction_type":"expense","spender_id":2}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		cStmt := `INSERT INTO transaction ("date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id", "tags") VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9) RETURNING id;`
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(2), "food", "expense").WillReturnRows(categoryRows(1, 0, "Food", "expense"))
+		mock.ExpectQuery(cStmt).WithArgs("2024-05-18T15:00:37.557628+07:00", 500.0, "Food", "expense", "", "", 2, int64(1), "{}").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(anomalyStatsStmt).WithArgs(int64(2), "Food", int64(9)).WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create transaction with an unknown category", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date":"2024-05-18T15:00:37.557628+07:00","amount":200.99,"category":"lottery","transaction_type":"income","spender_id":2}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(spenderActiveStmt).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+		mock.ExpectQuery(rulesStmt).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(ruleColumns))
+		mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(2), "lottery", "income").WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `"category not found, create it first"`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
@@ -108,7 +292,7 @@ type Expense struct {
 }
 
 func TestPutTransaction(t *testing.T) {
-	query := `UPDATE transaction SET date=$1, amount=$2, category=$3, transaction_type=$4, spender_id=$5, note=$6, image_url=$7 WHERE id=$8`
+	query := `UPDATE transaction SET date=$1, amount=$2, category=$3, transaction_type=$4, spender_id=$5, note=$6, image_url=$7, category_id=NULLIF($8, 0) WHERE id=$9`
 
 	e := echo.New()
 	defer e.Close()
@@ -138,22 +322,62 @@ func TestPutTransaction(t *testing.T) {
 	defer db.Close()
 
 	// Setup mock to expect a time.Time object for the date
+	mock.ExpectBegin()
+	mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(1), "Utilities", "Expense").WillReturnRows(categoryRows(20, 1, "Utilities", "expense"))
 	mock.ExpectExec(query).WithArgs(
 		testDate, // Exact time.Time object
-		updateData.Amount, updateData.Category, updateData.TransactionType, updateData.SpenderId, updateData.Note, updateData.ImageUrl, "1",
+		updateData.Amount, updateData.Category, updateData.TransactionType, updateData.SpenderId, updateData.Note, updateData.ImageUrl, int64(20), int64(1),
 	).WillReturnResult(sqlmock.NewResult(1, 1))
+	payload := &capture{}
+	mock.ExpectExec(outboxStmt).WithArgs("transaction.updated", payload).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	h := New(config.FeatureFlag{}, db)
 	err := h.PutTransaction(c)
 
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
-	assert.JSONEq(t, string(bodyData), rec.Body.String())
+	updateData.CategoryID = 20
+	want, _ := json.Marshal(updateData)
+	assert.JSONEq(t, string(want), rec.Body.String())
+	assert.Contains(t, payload.value, `"id":1,`)
+}
+
+func TestPutTransactionNotFound(t *testing.T) {
+	query := `UPDATE transaction SET date=$1, amount=$2, category=$3, transaction_type=$4, spender_id=$5, note=$6, image_url=$7, category_id=NULLIF($8, 0) WHERE id=$9`
+	body := `{"date": "2024-05-17T00:00:00Z", "amount": 100, "category": "Utilities", "transaction_type": "expense", "spender_id": 1}`
+	req := httptest.NewRequest(http.MethodPut, "/transaction/99", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("99")
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(1), "Utilities", "expense").WillReturnRows(categoryRows(20, 1, "Utilities", "expense"))
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), 100, "Utilities", "expense", 1, "", "", int64(20), int64(99)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := New(config.FeatureFlag{}, db).PutTransaction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func prefsRows(timezone string, monthStartDay int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"timezone", "locale", "currency", "month_start_day"}).
+		AddRow(timezone, "th-TH", "THB", monthStartDay)
 }
 
+const prefsStmt = `SELECT timezone, locale, currency, month_start_day FROM spender WHERE id = $1;`
+
 func TestGetSpenderTransactionsSummarySuccess(t *testing.T) {
 	e := echo.New()
-	db, mock, err := sqlmock.New()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
 	}
@@ -161,19 +385,12 @@ func TestGetSpenderTransactionsSummarySuccess(t *testing.T) {
 
 	h := &handler{db: db}
 
-	// Prepare the SQL query regex, allowing for flexible whitespace
-	sqlQuery := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction WHERE spender_id=$1`
-	sqlQuery = regexp.QuoteMeta(sqlQuery)
-	sqlQuery = strings.Replace(sqlQuery, "\\ ", "\\s*", -1) // Allow any amount of whitespace
-
-	// Set up the mock expectation with the modified regex
-	mock.ExpectQuery(sqlQuery).
-		WithArgs("1").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
-			AddRow(1, time.Now(), 100.00, "Income", "income", "Salary", "http://example.com/img.jpg", 1).
-			AddRow(2, time.Now(), 50.00, "Food", "expense", "Groceries", "http://example.com/img2.jpg", 1))
+	mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+	mock.ExpectQuery(summaryStmt).
+		WithArgs("1", nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"income", "expenses"}).AddRow(100.00, 50.00))
 
-	req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions/summart", nil)
+	req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions/summary", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetParamNames("id")
@@ -181,6 +398,7 @@ func TestGetSpenderTransactionsSummarySuccess(t *testing.T) {
 
 	if assert.NoError(t, h.GetSpenderTransactionSummary(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"summary": {"total_income":100,"total_expenses":50,"current_balance":50,"currency":"THB"}}`, rec.Body.String())
 	}
 
 	// Ensure all expectations were met
@@ -189,21 +407,156 @@ func TestGetSpenderTransactionsSummarySuccess(t *testing.T) {
 	}
 }
 
+func TestGetSpenderTransactionsMonthSummary(t *testing.T) {
+	bangkok, _ := time.LoadLocation("Asia/Bangkok")
+
+	t.Run("a month starting on the 25th", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		from := time.Date(2024, 5, 25, 0, 0, 0, 0, bangkok)
+		to := time.Date(2024, 6, 25, 0, 0, 0, 0, bangkok)
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 25))
+		mock.ExpectQuery(summaryStmt).WithArgs("1", from, to).
+			WillReturnRows(sqlmock.NewRows([]string{"income", "expenses"}).AddRow(30000.00, 1200.50))
+
+		req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions/summary?month=2024-05", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		err := (&handler{db: db}).GetSpenderTransactionSummary(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"summary": {"total_income":30000,"total_expenses":1200.5,"current_balance":28799.5,"currency":"THB"},
+			"period": {"month":"2024-05","from":"2024-05-25T00:00:00+07:00","to":"2024-06-25T00:00:00+07:00"}
+		}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("the current month", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 25))
+		mock.ExpectQuery(summaryStmt).
+			WithArgs("1", time.Date(2023, 12, 25, 0, 0, 0, 0, bangkok), time.Date(2024, 1, 25, 0, 0, 0, 0, bangkok)).
+			WillReturnRows(sqlmock.NewRows([]string{"income", "expenses"}).AddRow(0.0, 0.0))
+
+		s := NewService(config.FeatureFlag{}, db)
+		// still the 24th in Bangkok
+		s.now = func() time.Time { return time.Date(2024, 1, 24, 16, 59, 0, 0, time.UTC) }
+		_, period, err := s.Summary(context.Background(), "1", "current")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "2023-12", period.Month)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("an invalid month", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions/summary?month=May", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		err := (&handler{}).GetSpenderTransactionSummary(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestGetSpenderMonthlySummary(t *testing.T) {
+	t.Run("months with and without transactions", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("UTC", 25))
+		mock.ExpectQuery(monthlyStmt).
+			WithArgs("1", "UTC", 25, time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 25, 0, 0, 0, 0, time.UTC)).
+			WillReturnRows(sqlmock.NewRows([]string{"month", "income", "expenses"}).
+				AddRow("2024-03", 1000.0, 400.0).
+				AddRow("2024-05", 1000.0, 1250.0))
+
+		req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions/monthly?from=2024-03&to=2024-05", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		err := (&handler{db: db}).GetSpenderMonthlySummary(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"currency":"THB","timezone":"UTC","month_start_day":25,"months":[
+			{"month":"2024-03","from":"2024-03-25T00:00:00Z","to":"2024-04-25T00:00:00Z","total_income":1000,"total_expenses":400,"net":600},
+			{"month":"2024-04","from":"2024-04-25T00:00:00Z","to":"2024-05-25T00:00:00Z","total_income":0,"total_expenses":0,"net":0},
+			{"month":"2024-05","from":"2024-05-25T00:00:00Z","to":"2024-06-25T00:00:00Z","total_income":1000,"total_expenses":1250,"net":-250}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("the last twelve months by default", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("UTC", 1))
+		mock.ExpectQuery(monthlyStmt).
+			WithArgs("1", "UTC", 1, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)).
+			WillReturnRows(sqlmock.NewRows([]string{"month", "income", "expenses"}))
+
+		s := NewService(config.FeatureFlag{}, db)
+		s.now = func() time.Time { return time.Date(2024, 5, 18, 12, 0, 0, 0, time.UTC) }
+		report, err := s.Monthly(context.Background(), "1", "", "")
+
+		assert.NoError(t, err)
+		assert.Len(t, report.Months, 12)
+		assert.Equal(t, "2023-06", report.Months[0].Month)
+		assert.Equal(t, "2024-05", report.Months[11].Month)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	for _, query := range []string{"from=2024-13", "from=2024-05&to=2024-03", "from=2010-01&to=2024-05"} {
+		t.Run("bad query "+query, func(t *testing.T) {
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+			mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("UTC", 1))
+
+			req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions/monthly?"+query, nil)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			err := (&handler{db: db}).GetSpenderMonthlySummary(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
+
 func TestGetTransactionsGroupedByCategory(t *testing.T) {
 	// Initialize Echo and handler
 	e := echo.New()
-	db, mock, _ := sqlmock.New()
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	h := New(config.FeatureFlag{}, db)
 
 	// Mock database response
-	query := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction`
-	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
-		AddRow(1, "2024-04-30T09:00:00.000Z", 1000, "Food", "expense", "Lunch", "https://example.com/image1.jpg", 1).
-		AddRow(2, "2024-04-29T19:00:00.000Z", 2000, "Transport", "income", "Salary", "https://example.com/image2.jpg", 1).
-		AddRow(3, "2024-04-29T19:00:00.000Z", 2000, "Other", "income", "Salary", "https://example.com/image2.jpg", 1))
+	query := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id, COALESCE(category_id, 0) FROM transaction ORDER BY date, id`
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "category_id"}).
+		AddRow(1, "2024-04-29T12:00:00.000Z", 120.5, "Food", "expense", "Snacks", "", 1, 1).
+		AddRow(2, "2024-04-29T19:00:00.000Z", 2000, "Salary", "income", "Salary", "", 1, 12).
+		AddRow(3, "2024-04-30T09:00:00.000Z", 1000, "Restaurants", "expense", "Lunch", "https://example.com/image1.jpg", 1, 19).
+		AddRow(4, "2024-04-30T19:00:00.000Z", 300, "Gadgets", "expense", "Cable", "", 2, 0))
+	mock.ExpectQuery(ancestryStmt).WithArgs("{1,12,19}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "spender_id", "parent_id", "name", "icon", "color", "type"}).
+			AddRow(1, 0, 0, "Food", "restaurant", "#FF9800", "expense").
+			AddRow(12, 0, 0, "Salary", "payments", "#4CAF50", "income").
+			AddRow(19, 0, 1, "Restaurants", "restaurant_menu", "#FF9800", "expense"))
 
 	// Create a request and response recorder
-	req := httptest.NewRequest(http.MethodGet, "/transactions/category", nil)
+	req := httptest.NewRequest(http.MethodGet, "/categorize", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -211,50 +564,44 @@ func TestGetTransactionsGroupedByCategory(t *testing.T) {
 	if assert.NoError(t, h.GetTransactionsGroupedByCategory(c)) {
 		// Validate response
 		assert.Equal(t, http.StatusOK, rec.Code)
-		expected := `{
-			"Food": [
-				{
-					"id": 1,
-					"date": "2024-04-30T09:00:00.000Z",
-					"amount": 1000,
-					"category": "Food",
-					"transaction_type": "expense",
-					"note": "Lunch",
-					"image_url": "https://example.com/image1.jpg",
-					"spender_id": 1
-				}
-			],
-			"Transport": [
-				{
-					"id": 2,
-					"date": "2024-04-29T19:00:00.000Z",
-					"amount": 2000,
-					"category": "Transport",
-					"transaction_type": "income",
-					"note": "Salary",
-					"image_url": "https://example.com/image2.jpg",
-					"spender_id": 1
-				}
-			],
-			"Other": [
-				{
-					"id": 3,
-					"date": "2024-04-29T19:00:00.000Z",
-					"amount": 2000,
-					"category": "Other",
-					"transaction_type": "income",
-					"note": "Salary",
-					"image_url": "https://example.com/image2.jpg",
-					"spender_id": 1
-				}
-			]
-		}`
+		expected := `[
+			{
+				"category_id": 12, "category": "Salary", "transaction_type": "income", "total": 2000, "count": 1,
+				"transactions": [
+					{"id": 2, "date": "2024-04-29T19:00:00.000Z", "amount": 2000, "category": "Salary", "category_id": 12,
+						"transaction_type": "income", "note": "Salary", "image_url": "", "spender_id": 1}
+				]
+			},
+			{
+				"category_id": 1, "category": "Food", "transaction_type": "expense", "total": 1120.5, "count": 2,
+				"transactions": [
+					{"id": 1, "date": "2024-04-29T12:00:00.000Z", "amount": 120.5, "category": "Food", "category_id": 1,
+						"transaction_type": "expense", "note": "Snacks", "image_url": "", "spender_id": 1}
+				],
+				"children": [
+					{
+						"category_id": 19, "category": "Restaurants", "transaction_type": "expense", "total": 1000, "count": 1,
+						"transactions": [
+							{"id": 3, "date": "2024-04-30T09:00:00.000Z", "amount": 1000, "category": "Restaurants", "category_id": 19,
+								"transaction_type": "expense", "note": "Lunch", "image_url": "https://example.com/image1.jpg", "spender_id": 1}
+						]
+					}
+				]
+			},
+			{
+				"category": "Gadgets", "transaction_type": "expense", "total": 300, "count": 1,
+				"transactions": [
+					{"id": 4, "date": "2024-04-30T19:00:00.000Z", "amount": 300, "category": "Gadgets",
+						"transaction_type": "expense", "note": "Cable", "image_url": "", "spender_id": 2}
+				]
+			}
+		]`
 		assert.JSONEq(t, expected, rec.Body.String())
 	}
 }
 
 func TestPutTransactionDbFailure(t *testing.T) {
-	query := `UPDATE transaction SET date=$1, amount=$2, category=$3, transaction_type=$4, spender_id=$5, note=$6, image_url=$7 WHERE id=$8`
+	query := `UPDATE transaction SET date=$1, amount=$2, category=$3, transaction_type=$4, spender_id=$5, note=$6, image_url=$7, category_id=NULLIF($8, 0) WHERE id=$9`
 	e := echo.New()
 	defer e.Close()
 
@@ -277,6 +624,8 @@ func TestPutTransactionDbFailure(t *testing.T) {
 	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	defer db.Close()
 
+	mock.ExpectBegin()
+	mock.ExpectQuery(categoryByNameStmt).WithArgs(int64(1), "Utilities", "Expense").WillReturnRows(categoryRows(20, 1, "Utilities", "expense"))
 	mock.ExpectExec(query).WithArgs(
 		sqlmock.AnyArg(),
 		updateData["amount"],
@@ -285,7 +634,8 @@ func TestPutTransactionDbFailure(t *testing.T) {
 		updateData["spender_id"],
 		updateData["note"],
 		updateData["image_url"],
-		"1",
+		int64(20),
+		int64(1),
 	).WillReturnError(fmt.Errorf("db error"))
 
 	h := New(config.FeatureFlag{}, db)
@@ -296,7 +646,7 @@ func TestPutTransactionDbFailure(t *testing.T) {
 }
 func TestGetSpenderTransactionsSuccess(t *testing.T) {
 	e := echo.New()
-	db, mock, err := sqlmock.New()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
 	}
@@ -304,19 +654,22 @@ func TestGetSpenderTransactionsSuccess(t *testing.T) {
 
 	h := &handler{db: db}
 
-	// Prepare the SQL query regex, allowing for flexible whitespace
-	sqlQuery := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction WHERE spender_id=$1`
-	sqlQuery = regexp.QuoteMeta(sqlQuery)
-	sqlQuery = strings.Replace(sqlQuery, "\\ ", "\\s*", -1) // Allow any amount of whitespace
-
-	// Set up the mock expectation with the modified regex
-	mock.ExpectQuery(sqlQuery).
-		WithArgs("1").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
-			AddRow(1, time.Now(), 100.00, "Income", "income", "Salary", "http://example.com/img.jpg", 1).
-			AddRow(2, time.Now(), 50.00, "Food", "expense", "Groceries", "http://example.com/img2.jpg", 1))
-
-	req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions", nil)
+	// plain dates are midnights in the spender time zone
+	bangkok, _ := time.LoadLocation("Asia/Bangkok")
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, bangkok)
+	to := time.Date(2024, 6, 1, 0, 0, 0, 0, bangkok)
+
+	mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+	mock.ExpectQuery(historyTotalsStmt).
+		WithArgs("1", from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"total_income", "total_expenses", "opening", "closing", "total"}).
+			AddRow(1000.00, 250.00, 900.00, 800.00, 3))
+	mock.ExpectQuery(historyStmt).
+		WithArgs("1", from, to, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "tags", "running_balance"}).
+			AddRow(7, "2024-05-20T00:00:00Z", 50.00, "Food", "expense", "Groceries", "", 1, "{weekly}", 800.00))
+
+	req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions?page=2&limit=2&from=2024-05-01&to=2024-05-31", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetParamNames("id")
@@ -324,6 +677,14 @@ func TestGetSpenderTransactionsSuccess(t *testing.T) {
 
 	if assert.NoError(t, h.GetSpenderTransactions(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"transactions": [
+				{"id":7,"date":"2024-05-20T00:00:00Z","amount":50,"category":"Food","transaction_type":"expense","note":"Groceries","image_url":"","spender_id":1,"tags":["weekly"],"running_balance":800}
+			],
+			"summary": {"total_income":1000,"total_expenses":250,"current_balance":750,"currency":"THB"},
+			"balance": {"opening_balance":900,"closing_balance":800},
+			"pagination": {"current_page":2,"total_pages":2,"per_page":2}
+		}`, rec.Body.String())
 	}
 
 	// Ensure all expectations were met
@@ -332,20 +693,76 @@ func TestGetSpenderTransactionsSuccess(t *testing.T) {
 	}
 }
 
+func TestGetSpenderTransactionsWithoutLimit(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+	mock.ExpectQuery(historyTotalsStmt).WithArgs("1", nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"total_income", "total_expenses", "opening", "closing", "total"}).
+			AddRow(1000.00, 50.00, 0.00, 950.00, 12))
+	mock.ExpectQuery(historyStmt).WithArgs("1", nil, nil, nil, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "tags", "running_balance"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	err := (&handler{db: db}).GetSpenderTransactions(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"pagination":{"current_page":1,"total_pages":1,"per_page":12}`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewHistoryQuery(t *testing.T) {
+	q, err := NewHistoryQuery(0, 0, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, q.Limit)
+
+	q, err = NewHistoryQuery(3, 0, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultLimit, q.Limit)
+	limit, offset := q.Window()
+	assert.Equal(t, defaultLimit, limit)
+	assert.Equal(t, 2*defaultLimit, offset)
+}
+
+func TestGetSpenderTransactionsBadQuery(t *testing.T) {
+	e := echo.New()
+
+	cases := []string{"page=0", "limit=abc", "from=yesterday", "from=2024-05-02&to=2024-05-01"}
+	for _, query := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		h := &handler{}
+		if assert.NoError(t, h.GetSpenderTransactions(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+	}
+}
+
 func TestGetSpenderTransactionsDBError(t *testing.T) {
 	e := echo.New()
-	db, mock, err := sqlmock.New()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
 
 	h := &handler{db: db}
-	sqlQuery := `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction WHERE spender_id=$1`
 
 	// Handle expected errors
-	mock.ExpectQuery(sqlQuery).
-		WithArgs("1").
+	mock.ExpectQuery(prefsStmt).WithArgs("1").WillReturnRows(prefsRows("Asia/Bangkok", 1))
+	mock.ExpectQuery(historyTotalsStmt).
+		WithArgs("1", nil, nil).
 		WillReturnError(fmt.Errorf("db error"))
 
 	req := httptest.NewRequest(http.MethodGet, "/spender/1/transactions", nil)
@@ -375,7 +792,7 @@ func TestGetAllTransaction(t *testing.T) {
 	rows := sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
 		AddRow(1, "2024-05-18T08:45:24.119432Z", 100.0, "Food", "expense", "Lunch at cafe", "http://example.com/image.jpg", 1).
 		AddRow(2, "2024-05-18T09:45:24.119432Z", 50.0, "Transport", "expense", "Bus fare", "", 2)
-	mock.ExpectQuery(`SELECT * FROM transaction`).WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction`).WillReturnRows(rows)
 
 	h := handler{db: db}
 	err = h.GetAllTransaction(c)
@@ -385,3 +802,96 @@ func TestGetAllTransaction(t *testing.T) {
 	expectedJSON := `[{"id":1,"date":"2024-05-18T08:45:24.119432Z","amount":100.0,"category":"Food","transaction_type":"expense","note":"Lunch at cafe","image_url":"http://example.com/image.jpg","spender_id":1},{"id":2,"date":"2024-05-18T09:45:24.119432Z","amount":50.0,"category":"Transport","transaction_type":"expense","note":"Bus fare","image_url":"","spender_id":2}]`
 	assert.JSONEq(t, expectedJSON, rec.Body.String())
 }
+
+const outboxStmt = `INSERT INTO outbox (event_type, payload) VALUES ($1, $2);`
+
+const anomalyStatsStmt = `SELECT COUNT(*),
+	COUNT(*) FILTER (WHERE category = $2),
+	COALESCE(AVG(amount) FILTER (WHERE category = $2), 0),
+	COALESCE(STDDEV_SAMP(amount) FILTER (WHERE category = $2), 0),
+	COALESCE(MAX(amount) FILTER (WHERE category = $2), 0)
+FROM transaction
+WHERE spender_id = $1 AND transaction_type = 'expense' AND id <> $3;`
+
+func anomalyStats(total, count int, mean, stddev, max float64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"total", "count", "mean", "stddev", "max"}).AddRow(total, count, mean, stddev, max)
+}
+
+const ancestryStmt = `WITH RECURSIVE up AS (
+	SELECT * FROM category WHERE id = ANY($1)
+	UNION
+	SELECT c.* FROM category c JOIN up ON c.id = up.parent_id
+) SELECT id, COALESCE(spender_id, 0), COALESCE(parent_id, 0), name, icon, color, type FROM up;`
+
+const categoryByIDStmt = `SELECT id, COALESCE(spender_id, 0), COALESCE(parent_id, 0), name, icon, color, type FROM category WHERE (spender_id IS NULL OR spender_id = $1) AND id = $2;`
+
+const rulesStmt = `SELECT r.id, r.spender_id, r.priority, r.note_contains, r.note_regex, r.min_amount, r.max_amount, r.transaction_type,
+	COALESCE(r.category_id, 0), COALESCE(c.name, ''), r.tags FROM category_rule r LEFT JOIN category c ON c.id = r.category_id WHERE r.spender_id = $1 ORDER BY r.priority, r.id;`
+
+var ruleColumns = []string{"id", "spender_id", "priority", "note_contains", "note_regex", "min_amount", "max_amount", "transaction_type", "category_id", "category", "tags"}
+
+const categoryByNameStmt = `SELECT id, COALESCE(spender_id, 0), COALESCE(parent_id, 0), name, icon, color, type FROM category WHERE (spender_id IS NULL OR spender_id = $1) AND LOWER(name) = LOWER($2) AND type = LOWER($3) ORDER BY spender_id NULLS LAST LIMIT 1;`
+
+func categoryRows(id, spenderID int64, name, typ string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "spender_id", "parent_id", "name", "icon", "color", "type"}).AddRow(id, spenderID, 0, name, "", "#9E9E9E", typ)
+}
+
+func TestDeleteTransaction(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	t.Run("delete transaction successfully", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/transactions/1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(deleteStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(2))
+		mock.ExpectExec(outboxStmt).WithArgs("transaction.deleted", `{"id":1,"spender_id":2}`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete transaction not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/transactions/2", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("2")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(deleteStmt).WithArgs(int64(2)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// capture matches any argument and keeps it.
+type capture struct {
+	value string
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value, _ = v.(string)
+	return true
+}
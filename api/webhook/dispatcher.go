@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderEvent     = "X-HongJot-Event"
+	HeaderDelivery  = "X-HongJot-Delivery"
+	HeaderSignature = "X-HongJot-Signature"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Event is the envelope posted to subscribers. ID is stable across
+// redeliveries so subscribers can drop duplicates.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Sign returns the value of the signature header for a payload.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+const (
+	subsByEventStmt    = `SELECT id, url, secret FROM webhook_subscription WHERE $1 = ANY(string_to_array(event_types, ','));`
+	cDeliveryStmt      = `INSERT INTO webhook_delivery (subscription_id, event_type, payload) VALUES ($1, $2, $3) RETURNING id;`
+	updateDeliveryStmt = `UPDATE webhook_delivery SET status=$1, attempts=attempts+1, response_code=$2, last_error=$3, updated_at=NOW() WHERE id=$4;`
+	getDeliveryStmt    = `SELECT d.event_type, d.payload, s.url, s.secret FROM webhook_delivery d JOIN webhook_subscription s ON s.id = d.subscription_id WHERE d.id = $1;`
+	resetDeliveryStmt  = `UPDATE webhook_delivery SET status='pending', updated_at=NOW() WHERE id=$1;`
+	pendingStmt        = `SELECT d.id, d.event_type, d.payload, d.attempts, s.url, s.secret FROM webhook_delivery d JOIN webhook_subscription s ON s.id = d.subscription_id WHERE d.status = 'pending' ORDER BY d.id;`
+)
+
+// Dispatcher delivers events to the matching subscriptions in the
+// background, retrying failed deliveries with exponential backoff. It
+// only connects to public addresses.
+type Dispatcher struct {
+	db          *sql.DB
+	logger      *zap.Logger
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	wg          sync.WaitGroup
+	quit        chan struct{}
+	once        sync.Once
+}
+
+func NewDispatcher(db *sql.DB, logger *zap.Logger) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		logger: logger,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublic}).DialContext,
+			},
+		},
+		maxAttempts: 5,
+		backoff:     time.Second,
+		quit:        make(chan struct{}),
+	}
+}
+
+// Send fans an outbox event out to the subscriptions of its type. It
+// makes the dispatcher an outbox.Sink: an error means the event was not
+// logged for delivery and the relay should try again later.
+func (d *Dispatcher) Send(ctx context.Context, e outbox.Event) error {
+	body, err := json.Marshal(Event{
+		ID:        strconv.FormatInt(e.ID, 10),
+		Type:      e.Type,
+		CreatedAt: e.CreatedAt.UTC(),
+		Data:      e.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.db.QueryContext(ctx, subsByEventStmt, e.Type)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type target struct {
+		id     int64
+		url    string
+		secret string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.id, &t.url, &t.secret); err != nil {
+			return err
+		}
+		targets = append(targets, t)
+	}
+
+	for _, t := range targets {
+		var deliveryID int64
+		err := d.db.QueryRowContext(ctx, cDeliveryStmt, t.id, e.Type, string(body)).Scan(&deliveryID)
+		if err != nil {
+			return err
+		}
+		d.deliver(deliveryID, e.Type, t.url, t.secret, body, 0)
+	}
+	return nil
+}
+
+// Resume picks up the deliveries a previous run left pending, continuing
+// from the attempts they already used. Every delivery gets at least one
+// more attempt.
+func (d *Dispatcher) Resume(ctx context.Context) (int, error) {
+	rows, err := d.db.QueryContext(ctx, pendingStmt)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type pending struct {
+		id        int64
+		eventType string
+		payload   string
+		attempts  int
+		url       string
+		secret    string
+	}
+	var deliveries []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.eventType, &p.payload, &p.attempts, &p.url, &p.secret); err != nil {
+			return 0, err
+		}
+		deliveries = append(deliveries, p)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range deliveries {
+		done := p.attempts
+		if done >= d.maxAttempts {
+			done = d.maxAttempts - 1
+		}
+		d.deliver(p.id, p.eventType, p.url, p.secret, []byte(p.payload), done)
+	}
+	return len(deliveries), nil
+}
+
+// Redeliver sends a logged delivery again, whatever its status.
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryID int64) error {
+	var eventType, payload, url, secret string
+	err := d.db.QueryRowContext(ctx, getDeliveryStmt, deliveryID).Scan(&eventType, &payload, &url, &secret)
+	if err != nil {
+		return err
+	}
+	if _, err := d.db.ExecContext(ctx, resetDeliveryStmt, deliveryID); err != nil {
+		return err
+	}
+
+	d.deliver(deliveryID, eventType, url, secret, []byte(payload), 0)
+	return nil
+}
+
+// Wait blocks until every delivery in flight is done.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Shutdown stops scheduling retries and waits for deliveries in flight.
+// Deliveries that still have retries left stay pending in the delivery
+// log and are picked up by Resume on the next start.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.once.Do(func() { close(d.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deliver sends body in the background, after done attempts were already
+// made.
+func (d *Dispatcher) deliver(deliveryID int64, eventType, url, secret string, body []byte, done int) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		for attempt := done + 1; attempt <= d.maxAttempts; attempt++ {
+			code, err := d.send(deliveryID, eventType, url, secret, body)
+
+			status, lastErr := StatusDelivered, ""
+			if err != nil {
+				status, lastErr = StatusPending, err.Error()
+				if attempt == d.maxAttempts {
+					status = StatusFailed
+				}
+			}
+
+			if _, err := d.db.Exec(updateDeliveryStmt, status, code, lastErr, deliveryID); err != nil {
+				d.logger.Error("update delivery error", zap.Error(err))
+			}
+			if status != StatusPending {
+				return
+			}
+
+			select {
+			case <-time.After(d.backoff << (attempt - 1)):
+			case <-d.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (d *Dispatcher) send(deliveryID int64, eventType, url, secret string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(deliveryID, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
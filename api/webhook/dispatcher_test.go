@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	t.Cleanup(func() { db.Close() })
+
+	d := NewDispatcher(db, zap.NewNop())
+	// The test servers listen on loopback, which the default client refuses.
+	d.client = &http.Client{Timeout: time.Second}
+	d.backoff = time.Millisecond
+	d.maxAttempts = 3
+	return d, mock
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestSend(t *testing.T) {
+	t.Run("deliver signed event to subscriber", func(t *testing.T) {
+		var got Event
+		var signature, eventType string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &got)
+			eventType = r.Header.Get(HeaderEvent)
+			if r.Header.Get(HeaderSignature) == Sign("s3cret", body) {
+				signature = "valid"
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		d, mock := newTestDispatcher(t)
+		mock.ExpectQuery(subsByEventStmt).WithArgs(outbox.EventSpenderCreated).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret"}).AddRow(1, srv.URL, "s3cret"))
+		mock.ExpectQuery(cDeliveryStmt).WithArgs(int64(1), outbox.EventSpenderCreated, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusDelivered, http.StatusNoContent, "", int64(10)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := d.Send(context.Background(), outbox.Event{ID: 7, Type: outbox.EventSpenderCreated, Payload: []byte(`{"name":"HongJot"}`)})
+		assert.NoError(t, err)
+		d.Wait()
+
+		assert.Equal(t, "7", got.ID)
+		assert.Equal(t, outbox.EventSpenderCreated, got.Type)
+		assert.Equal(t, map[string]interface{}{"name": "HongJot"}, got.Data)
+		assert.Equal(t, outbox.EventSpenderCreated, eventType)
+		assert.Equal(t, "valid", signature)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("retry until the subscriber accepts", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		d, mock := newTestDispatcher(t)
+		mock.ExpectQuery(subsByEventStmt).WithArgs(outbox.EventTransactionCreated).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret"}).AddRow(1, srv.URL, "s3cret"))
+		mock.ExpectQuery(cDeliveryStmt).WithArgs(int64(1), outbox.EventTransactionCreated, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusPending, http.StatusServiceUnavailable, "unexpected status code 503", int64(10)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusPending, http.StatusServiceUnavailable, "unexpected status code 503", int64(10)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusDelivered, http.StatusOK, "", int64(10)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := d.Send(context.Background(), outbox.Event{ID: 8, Type: outbox.EventTransactionCreated, Payload: []byte(`{"id":1}`)})
+		assert.NoError(t, err)
+		d.Wait()
+
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("mark delivery failed after the last attempt", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		d, mock := newTestDispatcher(t)
+		d.maxAttempts = 1
+		mock.ExpectQuery(subsByEventStmt).WithArgs(outbox.EventTransactionDeleted).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret"}).AddRow(1, srv.URL, "s3cret"))
+		mock.ExpectQuery(cDeliveryStmt).WithArgs(int64(1), outbox.EventTransactionDeleted, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusFailed, http.StatusInternalServerError, "unexpected status code 500", int64(10)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := d.Send(context.Background(), outbox.Event{ID: 9, Type: outbox.EventTransactionDeleted, Payload: []byte(`{"id":1}`)})
+		assert.NoError(t, err)
+		d.Wait()
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSendSubscriptionQueryError(t *testing.T) {
+	d, mock := newTestDispatcher(t)
+	mock.ExpectQuery(subsByEventStmt).WithArgs(outbox.EventSpenderCreated).WillReturnError(assert.AnError)
+
+	err := d.Send(context.Background(), outbox.Event{ID: 7, Type: outbox.EventSpenderCreated, Payload: []byte(`{}`)})
+
+	assert.Error(t, err)
+}
+
+func TestRedeliver(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d, mock := newTestDispatcher(t)
+	mock.ExpectQuery(getDeliveryStmt).WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"event_type", "payload", "url", "secret"}).AddRow(outbox.EventSpenderCreated, `{}`, srv.URL, "s3cret"))
+	mock.ExpectExec(resetDeliveryStmt).WithArgs(int64(10)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusDelivered, http.StatusOK, "", int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := d.Redeliver(context.Background(), 10)
+	d.Wait()
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDispatcherRefusesPrivateAddress(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(nil, zap.NewNop())
+	_, err := d.send(1, outbox.EventSpenderCreated, srv.URL, "s3cret", []byte(`{}`))
+
+	assert.ErrorContains(t, err, errPrivateAddr.Error())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestResume(t *testing.T) {
+	t.Run("continue pending deliveries from their attempts", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		d, mock := newTestDispatcher(t)
+		mock.ExpectQuery(pendingStmt).WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "payload", "attempts", "url", "secret"}).
+			AddRow(10, outbox.EventSpenderCreated, `{}`, 1, srv.URL, "s3cret"))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusPending, http.StatusServiceUnavailable, "unexpected status code 503", int64(10)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusFailed, http.StatusServiceUnavailable, "unexpected status code 503", int64(10)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		n, err := d.Resume(context.Background())
+		d.Wait()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("give a delivery out of attempts one more", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		d, mock := newTestDispatcher(t)
+		mock.ExpectQuery(pendingStmt).WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "payload", "attempts", "url", "secret"}).
+			AddRow(11, outbox.EventSpenderCreated, `{}`, 3, srv.URL, "s3cret"))
+		mock.ExpectExec(updateDeliveryStmt).WithArgs(StatusDelivered, http.StatusOK, "", int64(11)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		n, err := d.Resume(context.Background())
+		d.Wait()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// errPrivateAddr refuses subscriber urls that would let a webhook reach
+// services on the server's own network.
+var errPrivateAddr = errors.New("url must not point to a loopback, link-local or private address")
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast())
+}
+
+type lookupFunc func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// checkHost refuses host unless every address it resolves to is public.
+func checkHost(ctx context.Context, lookup lookupFunc, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return errPrivateAddr
+		}
+		return nil
+	}
+
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if !publicIP(a.IP) {
+			return errPrivateAddr
+		}
+	}
+	return nil
+}
+
+// dialPublic is a net.Dialer Control that checks the address actually
+// dialed, so a host that resolves elsewhere after registration, or a
+// redirect, still cannot reach a private address.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return errPrivateAddr
+	}
+	return nil
+}
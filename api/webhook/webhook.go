@@ -0,0 +1,206 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type Subscription struct {
+	ID         int64    `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+type Delivery struct {
+	ID           int64  `json:"id"`
+	EventType    string `json:"event_type"`
+	Payload      string `json:"payload"`
+	Status       string `json:"status"`
+	Attempts     int    `json:"attempts"`
+	ResponseCode int    `json:"response_code"`
+	LastError    string `json:"last_error"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type redeliverer interface {
+	Redeliver(ctx context.Context, deliveryID int64) error
+}
+
+type handler struct {
+	db         *sql.DB
+	dispatcher redeliverer
+	lookup     lookupFunc
+}
+
+func New(db *sql.DB, dispatcher *Dispatcher) *handler {
+	return &handler{db, dispatcher, net.DefaultResolver.LookupIPAddr}
+}
+
+const (
+	cStmt           = `INSERT INTO webhook_subscription (url, secret, event_types) VALUES ($1, $2, $3) RETURNING id, created_at;`
+	getAllStmt      = `SELECT id, url, event_types, created_at FROM webhook_subscription ORDER BY id;`
+	deleteStmt      = `DELETE FROM webhook_subscription WHERE id = $1;`
+	getDeliveryLogs = `SELECT id, event_type, payload, status, attempts, response_code, last_error, created_at, updated_at FROM webhook_delivery WHERE subscription_id = $1 ORDER BY id DESC;`
+)
+
+func validEventType(eventType string) bool {
+	for _, t := range outbox.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (h handler) Create(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var sub Subscription
+	if err := c.Bind(&sub); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return c.JSON(http.StatusBadRequest, "url must be an absolute http(s) url")
+	}
+	if err := checkHost(ctx, h.lookup, u.Hostname()); err != nil {
+		logger.Error("refused webhook url", zap.String("url", sub.URL), zap.Error(err))
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if len(sub.EventTypes) == 0 {
+		return c.JSON(http.StatusBadRequest, "event_types is required")
+	}
+	for _, t := range sub.EventTypes {
+		if !validEventType(t) {
+			return c.JSON(http.StatusBadRequest, "unknown event type: "+t)
+		}
+	}
+	if sub.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			logger.Error("generate secret error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		sub.Secret = hex.EncodeToString(b)
+	}
+
+	err = h.db.QueryRowContext(ctx, cStmt, sub.URL, sub.Secret, strings.Join(sub.EventTypes, ",")).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	logger.Info("create webhook successfully", zap.Int64("id", sub.ID))
+	return c.JSON(http.StatusCreated, sub)
+}
+
+func (h handler) GetAll(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	rows, err := h.db.QueryContext(ctx, getAllStmt)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var sub Subscription
+		var eventTypes string
+		if err := rows.Scan(&sub.ID, &sub.URL, &eventTypes, &sub.CreatedAt); err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		sub.EventTypes = strings.Split(eventTypes, ",")
+		subs = append(subs, sub)
+	}
+
+	return c.JSON(http.StatusOK, map[string][]Subscription{
+		"webhooks": subs,
+	})
+}
+
+func (h handler) Delete(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	res, err := h.db.ExecContext(ctx, deleteStmt, c.Param("id"))
+	if err != nil {
+		logger.Error("exec error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.JSON(http.StatusNotFound, "webhook not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h handler) GetDeliveries(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	rows, err := h.db.QueryContext(ctx, getDeliveryLogs, c.Param("id"))
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		err := rows.Scan(&d.ID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return c.JSON(http.StatusOK, map[string][]Delivery{
+		"deliveries": deliveries,
+	})
+}
+
+func (h handler) Redeliver(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	deliveryID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid delivery id")
+	}
+
+	err = h.dispatcher.Redeliver(ctx, deliveryID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "delivery not found")
+	} else if err != nil {
+		logger.Error("redeliver error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "redelivery scheduled",
+	})
+}
@@ -0,0 +1,237 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRedeliverer struct {
+	err error
+	id  int64
+}
+
+func (f *fakeRedeliverer) Redeliver(ctx context.Context, deliveryID int64) error {
+	f.id = deliveryID
+	return f.err
+}
+
+func lookupAs(ips ...string) lookupFunc {
+	return func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		var addrs []net.IPAddr
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	t.Run("create webhook successfully", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"https://example.com/hook","secret":"s3cret","event_types":["transaction.created","spender.created"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		row := sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, "2024-05-20T00:00:00Z")
+		mock.ExpectQuery(cStmt).WithArgs("https://example.com/hook", "s3cret", "transaction.created,spender.created").WillReturnRows(row)
+
+		h := New(db, nil)
+		h.lookup = lookupAs("93.184.215.14")
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id":1,"url":"https://example.com/hook","secret":"s3cret","event_types":["transaction.created","spender.created"],"created_at":"2024-05-20T00:00:00Z"}`, rec.Body.String())
+	})
+
+	t.Run("create webhook with invalid input", func(t *testing.T) {
+		cases := []string{
+			`{"url":"ftp://example.com","event_types":["transaction.created"]}`,
+			`{"url":"https://example.com/hook","event_types":[]}`,
+			`{"url":"https://example.com/hook","event_types":["transaction.exploded"]}`,
+		}
+		for _, body := range cases {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := New(nil, nil)
+			h.lookup = lookupAs("93.184.215.14")
+			err := h.Create(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		}
+	})
+
+	t.Run("refuse urls on the server's own network", func(t *testing.T) {
+		cases := []struct {
+			url     string
+			resolve []string
+		}{
+			{"http://127.0.0.1:8080/hook", nil},
+			{"http://[::1]/hook", nil},
+			{"http://169.254.169.254/latest/meta-data", nil},
+			{"http://10.0.0.5/hook", nil},
+			{"http://0.0.0.0/hook", nil},
+			{"https://internal.example.com/hook", []string{"93.184.215.14", "192.168.1.20"}},
+			{"https://localhost/hook", []string{"127.0.0.1"}},
+		}
+		for _, tc := range cases {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"`+tc.url+`","event_types":["transaction.created"]}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := New(nil, nil)
+			h.lookup = lookupAs(tc.resolve...)
+			err := h.Create(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, tc.url)
+			assert.Contains(t, rec.Body.String(), "private address", tc.url)
+		}
+	})
+}
+
+func TestGetAllWebhooks(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "url", "event_types", "created_at"}).
+		AddRow(1, "https://example.com/hook", "transaction.created,transaction.deleted", "2024-05-20T00:00:00Z")
+	mock.ExpectQuery(getAllStmt).WillReturnRows(rows)
+
+	h := New(db, nil)
+	err := h.GetAll(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"webhooks":[{"id":1,"url":"https://example.com/hook","event_types":["transaction.created","transaction.deleted"],"created_at":"2024-05-20T00:00:00Z"}]}`, rec.Body.String())
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	t.Run("delete webhook successfully", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/webhooks/1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(deleteStmt).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		h := New(db, nil)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("delete webhook not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/webhooks/2", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("2")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(deleteStmt).WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		h := New(db, nil)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestGetDeliveries(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/1/deliveries", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "event_type", "payload", "status", "attempts", "response_code", "last_error", "created_at", "updated_at"}).
+		AddRow(10, "transaction.created", `{}`, "failed", 5, 500, "unexpected status code 500", "2024-05-20T00:00:00Z", "2024-05-20T00:01:00Z")
+	mock.ExpectQuery(getDeliveryLogs).WithArgs("1").WillReturnRows(rows)
+
+	h := New(db, nil)
+	err := h.GetDeliveries(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"deliveries":[{"id":10,"event_type":"transaction.created","payload":"{}","status":"failed","attempts":5,"response_code":500,"last_error":"unexpected status code 500","created_at":"2024-05-20T00:00:00Z","updated_at":"2024-05-20T00:01:00Z"}]}`, rec.Body.String())
+}
+
+func TestRedeliverHandler(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	t.Run("schedule redelivery", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/deliveries/10/redeliver", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("10")
+
+		f := &fakeRedeliverer{}
+		h := &handler{dispatcher: f}
+		err := h.Redeliver(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, int64(10), f.id)
+	})
+
+	t.Run("delivery not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/deliveries/11/redeliver", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("11")
+
+		h := &handler{dispatcher: &fakeRedeliverer{err: sql.ErrNoRows}}
+		err := h.Redeliver(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,10 +11,13 @@ import (
 
 	"github.com/KKGo-Software-engineering/workshop-summer/api"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/outbox"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/rpc"
 	"github.com/KKGo-Software-engineering/workshop-summer/migration"
 	"github.com/labstack/gommon/log"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -34,6 +38,24 @@ func main() {
 	}
 
 	e := api.New(db, cfg, logger)
+	if n, err := e.Jobs.FailAbandoned(context.Background()); err != nil {
+		logger.Fatal("failing abandoned jobs:", zap.Error(err))
+	} else if n > 0 {
+		logger.Warn("failed jobs left by the previous run", zap.Int64("jobs", n))
+	}
+	if n, err := e.Webhooks.Resume(context.Background()); err != nil {
+		logger.Fatal("resuming webhook deliveries:", zap.Error(err))
+	} else if n > 0 {
+		logger.Info("resumed pending webhook deliveries", zap.Int("deliveries", n))
+	}
+
+	sink, err := newOutboxSink(cfg.Outbox, e)
+	if err != nil {
+		logger.Fatal("creating outbox sink:", zap.Error(err))
+	}
+	relay := outbox.NewRelay(db, sink, logger).WithNotify(e.Stream)
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	go relay.Run(relayCtx)
 
 	go func() { // comment here to simulate slow endpoint then Ctrl+C to stop the server
 		if err := e.Start(":" + cfg.Server.Port); err != nil && err != http.ErrServerClosed {
@@ -43,6 +65,19 @@ func main() {
 
 	logger.Info("Server is running on :%s", zap.String("port", cfg.Server.Port))
 
+	lis, err := net.Listen("tcp", ":"+cfg.Server.GRPCPort)
+	if err != nil {
+		logger.Fatal("listening for grpc:", zap.Error(err))
+	}
+	grpcServer := rpc.New(db, cfg, logger)
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			logger.Fatal("shutting down the grpc server:", zap.Error(err))
+		}
+	}()
+
+	logger.Info("gRPC server is running", zap.String("port", cfg.Server.GRPCPort))
+
 	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
 	sig, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
@@ -51,8 +86,51 @@ func main() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
+	// open event streams never finish on their own
+	e.Stream.Close()
 	if err := e.Shutdown(ctx); err != nil {
 		logger.Fatal("shutting down the server:", zap.Error(err))
 	}
+	stopGRPC(ctx, grpcServer)
+	stopRelay()
+	if err := relay.Drain(ctx); err != nil {
+		logger.Error("draining the outbox:", zap.Error(err))
+	}
+	if err := e.Jobs.Shutdown(ctx); err != nil {
+		logger.Error("waiting for background jobs:", zap.Error(err))
+	}
+	if err := e.Webhooks.Shutdown(ctx); err != nil {
+		logger.Error("waiting for webhook deliveries:", zap.Error(err))
+	}
 	logger.Info("server shutdown gracefully")
 }
+
+// stopGRPC waits for in-flight calls like Echo does, until ctx expires.
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
+func newOutboxSink(cfg config.Outbox, s *api.Server) (outbox.Sink, error) {
+	switch cfg.Sink {
+	case "stdout":
+		return outbox.Multi(outbox.NewWriterSink(os.Stdout), s.Webhooks), nil
+	case "file":
+		f, err := outbox.NewFileSink(cfg.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		return outbox.Multi(f, s.Webhooks), nil
+	default:
+		return s.Webhooks, nil
+	}
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "anomaly" (
+  id SERIAL PRIMARY KEY,
+  transaction_id INT NOT NULL,
+  spender_id INT NOT NULL,
+  reason VARCHAR(50) NOT NULL,
+  score DECIMAL(10,2) DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS anomaly_spender_id_idx ON "anomaly" (spender_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "anomaly";
+-- +goose StatementEnd
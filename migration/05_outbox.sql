@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "outbox" (
+  id BIGSERIAL PRIMARY KEY,
+  event_type VARCHAR(50) NOT NULL,
+  payload TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  published_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON "outbox" (id) WHERE published_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "outbox";
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "attachment" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  location TEXT NOT NULL,
+  transaction_ref VARCHAR(50),
+  image_hash BIGINT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS attachment_spender_id_transaction_ref_idx ON "attachment" (spender_id, transaction_ref);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "attachment";
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "spender" ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- Spenders sharing an email before it was unique, the oldest one keeps the
+-- email and the others get a placeholder until someone sorts them out.
+CREATE TABLE IF NOT EXISTS "spender_email_conflict" (
+	spender_id INT PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	kept_spender_id INT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO "spender_email_conflict" (spender_id, email, kept_spender_id)
+SELECT id, email, kept FROM (
+	SELECT id, email, MIN(id) OVER (PARTITION BY LOWER(TRIM(email))) AS kept FROM "spender"
+) s WHERE id <> kept
+ON CONFLICT (spender_id) DO NOTHING;
+
+UPDATE "spender" SET email = 'duplicate-' || id || '@invalid'
+WHERE id IN (SELECT spender_id FROM "spender_email_conflict");
+
+UPDATE "spender" SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
+
+CREATE UNIQUE INDEX IF NOT EXISTS spender_email_key ON "spender" (email);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS spender_email_key;
+UPDATE "spender" s SET email = c.email FROM "spender_email_conflict" c
+WHERE s.id = c.spender_id AND s.email = 'duplicate-' || s.id || '@invalid';
+DROP TABLE IF EXISTS "spender_email_conflict";
+ALTER TABLE "spender" DROP COLUMN IF EXISTS email_verified_at;
+-- +goose StatementEnd
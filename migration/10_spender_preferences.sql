@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "spender"
+	ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Bangkok',
+	ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT 'th-TH',
+	ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'THB',
+	ADD COLUMN IF NOT EXISTS month_start_day SMALLINT NOT NULL DEFAULT 1
+		CONSTRAINT spender_month_start_day_check CHECK (month_start_day BETWEEN 1 AND 28);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "spender"
+	DROP COLUMN IF EXISTS timezone,
+	DROP COLUMN IF EXISTS locale,
+	DROP COLUMN IF EXISTS currency,
+	DROP COLUMN IF EXISTS month_start_day;
+-- +goose StatementEnd
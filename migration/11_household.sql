@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "household" (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "household_member" (
+  household_id INT NOT NULL REFERENCES household (id) ON DELETE CASCADE,
+  spender_id INT NOT NULL REFERENCES spender (id) ON DELETE CASCADE,
+  role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'member', 'viewer')),
+  joined_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  PRIMARY KEY (household_id, spender_id)
+);
+CREATE INDEX IF NOT EXISTS household_member_spender_id_idx ON "household_member" (spender_id);
+
+CREATE TABLE IF NOT EXISTS "household_invitation" (
+  id SERIAL PRIMARY KEY,
+  household_id INT NOT NULL REFERENCES household (id) ON DELETE CASCADE,
+  email VARCHAR(255) NOT NULL,
+  role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'member', 'viewer')),
+  invited_by INT REFERENCES spender (id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  accepted_at TIMESTAMP WITH TIME ZONE
+);
+-- a single pending invitation per email, inviting again renews it
+CREATE UNIQUE INDEX IF NOT EXISTS household_invitation_pending_key ON "household_invitation" (household_id, email) WHERE accepted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "household_invitation";
+DROP TABLE IF EXISTS "household_member";
+DROP TABLE IF EXISTS "household";
+-- +goose StatementEnd
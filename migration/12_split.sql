@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "bill" (
+  id SERIAL PRIMARY KEY,
+  payer_id INT NOT NULL REFERENCES spender (id) ON DELETE CASCADE,
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+  method VARCHAR(10) NOT NULL CHECK (method IN ('equal', 'exact', 'percent', 'shares')),
+  date TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS bill_payer_id_idx ON "bill" (payer_id);
+
+-- value is what the share was given as: the amount, percentage or number
+-- of shares, amount is what it came to
+CREATE TABLE IF NOT EXISTS "bill_share" (
+  bill_id INT NOT NULL REFERENCES bill (id) ON DELETE CASCADE,
+  spender_id INT NOT NULL REFERENCES spender (id) ON DELETE CASCADE,
+  value DECIMAL(12,4) NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  PRIMARY KEY (bill_id, spender_id)
+);
+CREATE INDEX IF NOT EXISTS bill_share_spender_id_idx ON "bill_share" (spender_id);
+
+CREATE TABLE IF NOT EXISTS "settlement" (
+  id SERIAL PRIMARY KEY,
+  from_id INT NOT NULL REFERENCES spender (id) ON DELETE CASCADE,
+  to_id INT NOT NULL REFERENCES spender (id) ON DELETE CASCADE,
+  amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+  date TIMESTAMP WITH TIME ZONE NOT NULL,
+  from_transaction_id INT,
+  to_transaction_id INT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  CHECK (from_id <> to_id)
+);
+CREATE INDEX IF NOT EXISTS settlement_from_id_idx ON "settlement" (from_id);
+CREATE INDEX IF NOT EXISTS settlement_to_id_idx ON "settlement" (to_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "settlement";
+DROP TABLE IF EXISTS "bill_share";
+DROP TABLE IF EXISTS "bill";
+-- +goose StatementEnd
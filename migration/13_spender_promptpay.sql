@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- promptpay_id is a mobile number as 0XXXXXXXXX or a 13 digit national ID,
+-- where the spender wants to be paid back
+ALTER TABLE "spender" ADD COLUMN IF NOT EXISTS promptpay_id VARCHAR(13);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "spender" DROP COLUMN IF EXISTS promptpay_id;
+-- +goose StatementEnd
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+-- categories without spender are the system ones every spender can use
+CREATE TABLE IF NOT EXISTS "category" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT REFERENCES spender (id) ON DELETE CASCADE,
+  name VARCHAR(50) NOT NULL,
+  icon VARCHAR(32) NOT NULL DEFAULT '',
+  color CHAR(7) NOT NULL DEFAULT '#9E9E9E',
+  type VARCHAR(10) NOT NULL CHECK (type IN ('income', 'expense')),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS category_name_key ON "category" (COALESCE(spender_id, 0), LOWER(name), type);
+
+INSERT INTO "category" (name, icon, color, type) VALUES
+  ('Food', 'restaurant', '#FF9800', 'expense'),
+  ('Transport', 'directions_car', '#2196F3', 'expense'),
+  ('Shopping', 'shopping_bag', '#E91E63', 'expense'),
+  ('Bills', 'receipt', '#607D8B', 'expense'),
+  ('Housing', 'home', '#795548', 'expense'),
+  ('Health', 'local_hospital', '#F44336', 'expense'),
+  ('Entertainment', 'movie', '#9C27B0', 'expense'),
+  ('Travel', 'flight', '#00BCD4', 'expense'),
+  ('Education', 'school', '#3F51B5', 'expense'),
+  ('Settlement', 'handshake', '#009688', 'expense'),
+  ('Other', 'more_horiz', '#9E9E9E', 'expense'),
+  ('Salary', 'payments', '#4CAF50', 'income'),
+  ('Bonus', 'redeem', '#8BC34A', 'income'),
+  ('Investment', 'trending_up', '#CDDC39', 'income'),
+  ('Gift', 'card_giftcard', '#FFC107', 'income'),
+  ('Refund', 'undo', '#03A9F4', 'income'),
+  ('Settlement', 'handshake', '#009688', 'income'),
+  ('Other', 'more_horiz', '#9E9E9E', 'income')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE "transaction" ADD COLUMN IF NOT EXISTS category_id INT REFERENCES category (id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS transaction_category_id_idx ON "transaction" (category_id);
+
+-- categories in use that are not system ones become custom categories of
+-- their spenders, spelled as they were last used
+INSERT INTO "category" (spender_id, name, type)
+SELECT DISTINCT ON (t.spender_id, LOWER(TRIM(t.category)), t.transaction_type)
+  t.spender_id, LEFT(TRIM(t.category), 50), t.transaction_type
+FROM "transaction" t JOIN "spender" s ON s.id = t.spender_id
+WHERE TRIM(t.category) <> '' AND t.transaction_type IN ('income', 'expense')
+  AND NOT EXISTS (
+    SELECT 1 FROM "category" c
+    WHERE c.spender_id IS NULL AND LOWER(c.name) = LOWER(TRIM(t.category)) AND c.type = t.transaction_type
+  )
+ORDER BY t.spender_id, LOWER(TRIM(t.category)), t.transaction_type, t.id DESC
+ON CONFLICT DO NOTHING;
+
+UPDATE "transaction" t SET category_id = c.id, category = c.name
+FROM "category" c
+WHERE t.category_id IS NULL AND LOWER(c.name) = LOWER(TRIM(t.category)) AND c.type = t.transaction_type
+  AND (c.spender_id IS NULL OR c.spender_id = t.spender_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "transaction" DROP COLUMN IF EXISTS category_id;
+DROP TABLE IF EXISTS "category";
+-- +goose StatementEnd
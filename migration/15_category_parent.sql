@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a category may sit under another of the same type, to any depth, so
+-- reports roll the totals of its subcategories up into it
+ALTER TABLE "category" ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES category (id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS category_parent_id_idx ON "category" (parent_id);
+
+INSERT INTO "category" (parent_id, name, icon, color, type)
+SELECT p.id, c.name, c.icon, p.color, p.type
+FROM (VALUES
+  ('Food', 'Restaurants', 'restaurant_menu'),
+  ('Food', 'Groceries', 'local_grocery_store'),
+  ('Transport', 'Fuel', 'local_gas_station'),
+  ('Transport', 'Public Transport', 'train'),
+  ('Bills', 'Electricity', 'bolt'),
+  ('Bills', 'Internet', 'wifi')
+) AS c (parent, name, icon)
+JOIN "category" p ON p.spender_id IS NULL AND p.name = c.parent AND p.type = 'expense'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM "category" WHERE spender_id IS NULL AND parent_id IS NOT NULL;
+ALTER TABLE "category" DROP COLUMN IF EXISTS parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "transaction" ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+-- rules categorize and tag the transactions of their spender entered
+-- without category, the first one met in priority order wins
+CREATE TABLE IF NOT EXISTS "category_rule" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT NOT NULL REFERENCES spender (id) ON DELETE CASCADE,
+  priority INT NOT NULL DEFAULT 0,
+  note_contains VARCHAR(255) NOT NULL DEFAULT '',
+  note_regex VARCHAR(255) NOT NULL DEFAULT '',
+  min_amount DECIMAL(10,2),
+  max_amount DECIMAL(10,2),
+  transaction_type VARCHAR(10) NOT NULL DEFAULT '',
+  category_id INT REFERENCES category (id) ON DELETE SET NULL,
+  tags TEXT[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS category_rule_spender_id_idx ON "category_rule" (spender_id, priority, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "category_rule";
+ALTER TABLE "transaction" DROP COLUMN IF EXISTS tags;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- bills and settlements are shared with other spenders, deleting one of
+-- their spenders would change the balances of the others
+ALTER TABLE "bill" DROP CONSTRAINT IF EXISTS bill_payer_id_fkey,
+  ADD CONSTRAINT bill_payer_id_fkey FOREIGN KEY (payer_id) REFERENCES spender (id) ON DELETE RESTRICT;
+ALTER TABLE "bill_share" DROP CONSTRAINT IF EXISTS bill_share_spender_id_fkey,
+  ADD CONSTRAINT bill_share_spender_id_fkey FOREIGN KEY (spender_id) REFERENCES spender (id) ON DELETE RESTRICT;
+ALTER TABLE "settlement" DROP CONSTRAINT IF EXISTS settlement_from_id_fkey,
+  ADD CONSTRAINT settlement_from_id_fkey FOREIGN KEY (from_id) REFERENCES spender (id) ON DELETE RESTRICT;
+ALTER TABLE "settlement" DROP CONSTRAINT IF EXISTS settlement_to_id_fkey,
+  ADD CONSTRAINT settlement_to_id_fkey FOREIGN KEY (to_id) REFERENCES spender (id) ON DELETE RESTRICT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "bill" DROP CONSTRAINT IF EXISTS bill_payer_id_fkey,
+  ADD CONSTRAINT bill_payer_id_fkey FOREIGN KEY (payer_id) REFERENCES spender (id) ON DELETE CASCADE;
+ALTER TABLE "bill_share" DROP CONSTRAINT IF EXISTS bill_share_spender_id_fkey,
+  ADD CONSTRAINT bill_share_spender_id_fkey FOREIGN KEY (spender_id) REFERENCES spender (id) ON DELETE CASCADE;
+ALTER TABLE "settlement" DROP CONSTRAINT IF EXISTS settlement_from_id_fkey,
+  ADD CONSTRAINT settlement_from_id_fkey FOREIGN KEY (from_id) REFERENCES spender (id) ON DELETE CASCADE;
+ALTER TABLE "settlement" DROP CONSTRAINT IF EXISTS settlement_to_id_fkey,
+  ADD CONSTRAINT settlement_to_id_fkey FOREIGN KEY (to_id) REFERENCES spender (id) ON DELETE CASCADE;
+-- +goose StatementEnd
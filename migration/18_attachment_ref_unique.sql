@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a slip reference is recorded once per spender, the later copies uploaded
+-- before keep their file but lose the reference
+UPDATE "attachment" a SET transaction_ref = NULL
+WHERE transaction_ref IS NOT NULL AND EXISTS (
+  SELECT 1 FROM "attachment" b
+  WHERE b.spender_id = a.spender_id AND b.transaction_ref = a.transaction_ref AND b.id < a.id
+);
+DROP INDEX IF EXISTS attachment_spender_id_transaction_ref_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS attachment_spender_id_transaction_ref_key ON "attachment" (spender_id, transaction_ref)
+  WHERE transaction_ref IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS attachment_spender_id_transaction_ref_key;
+CREATE INDEX IF NOT EXISTS attachment_spender_id_transaction_ref_idx ON "attachment" (spender_id, transaction_ref);
+-- +goose StatementEnd